@@ -2,13 +2,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -28,6 +35,12 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
+	// Cancelled on SIGINT/SIGTERM; background work stops with it and the
+	// server drains before exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
 	// Load and validate configuration
 	cfg := config.Load()
 	if err := cfg.Validate(); err != nil {
@@ -35,34 +48,128 @@ func main() {
 	}
 
 	// Find data directory
-	dataDir := findDataDir()
+	dataDir, err := findDataDir(cfg.DataDir)
+	if err != nil {
+		log.Fatal("Data directory error: ", err)
+	}
+	slog.Info("using data directory", "path", dataDir)
 
 	// Initialize location services
 	zipSvc := location.NewZipCodeService()
+	defer zipSvc.Close()
+	// Borough outlines are optional; without them boroughs come from the
+	// nearest zip
+	boroughsPath := filepath.Join(dataDir, "borough-boundaries.geojson")
+	if _, err := os.Stat(boroughsPath); err == nil {
+		zipSvc.SetBoroughsFile(boroughsPath)
+		slog.Info("loading borough boundaries", "path", boroughsPath)
+	}
 	if err := zipSvc.Load(filepath.Join(dataDir, "nyc-zipcodes.json")); err != nil {
 		log.Fatal("Failed to load zip codes: ", err)
 	}
 	slog.Info("loaded zip codes", "count", zipSvc.Count())
 
 	stopSvc := location.NewStopService()
-	if err := stopSvc.Load(filepath.Join(dataDir, "stops.txt")); err != nil {
+	// Complex IDs are optional; use them when the data directory has them
+	complexesPath := filepath.Join(dataDir, "complexes.csv")
+	_, err = os.Stat(complexesPath)
+	haveComplexes := err == nil
+	if haveComplexes {
+		stopSvc.SetComplexesFile(complexesPath)
+		slog.Info("loading station complexes", "path", complexesPath)
+	}
+	stopsResult, err := stopSvc.Load(filepath.Join(dataDir, "stops.txt"))
+	if err != nil {
 		log.Fatal("Failed to load stops: ", err)
 	}
+	for _, row := range stopsResult.Skipped {
+		slog.Warn("skipped invalid stop row", "line", row.Line, "reason", row.Reason)
+	}
 	slog.Info("loaded subway stops", "total", stopSvc.Count(), "stations", stopSvc.ParentStationCount())
+	if cfg.StationClusterMeters > 0 {
+		stopSvc.SetClusterRadius(float64(cfg.StationClusterMeters))
+		slog.Info("clustering nearby stations", "meters", cfg.StationClusterMeters)
+	}
 
 	// Initialize transit services
-	subwaySvc := transit.NewSubwayService(cfg.HTTPTimeout, cfg.CacheTTL)
-	slog.Info("initialized subway service", "cache_ttl", cfg.CacheTTL)
+	// One pooled client for all upstream MTA requests
+	httpClient := transit.NewHTTPClient(cfg.HTTPTimeout, cfg.UserAgent, cfg.HTTPMaxIdleConnsPerHost)
+
+	// Validate has already parsed these, so only unknown feeds can fail here
+	overrides, err := cfg.RouteFeedOverrideMap()
+	if err == nil {
+		err = transit.OverrideRouteFeeds(overrides)
+	}
+	if err != nil {
+		log.Fatal("Route feed override error: ", err)
+	}
+	for _, route := range slices.Sorted(maps.Keys(overrides)) {
+		slog.Info("overriding route feed", "route", route, "feed", overrides[route])
+	}
+
+	subwaySvc := transit.NewSubwayService(httpClient, cfg.SubwayCacheTTL)
+	subwaySvc.SetTimeSource(cfg.ArrivalTimeSource)
+	// Complexes are what tie a station's lines together; without the file
+	// each station only ever matches its own platforms
+	switch {
+	case cfg.IncludeChildStops && haveComplexes:
+		subwaySvc.SetComplexPlatforms(stopSvc.ComplexPlatformIDs)
+	case cfg.IncludeChildStops:
+		slog.Info("no complexes.csv in the data directory; multi-station arrivals won't span station complexes")
+	}
+	slog.Info("initialized subway service", "cache_ttl", cfg.SubwayCacheTTL)
+
+	if cfg.FeedCachePersist {
+		// A bad cache file only costs a cold start, so never fail on it
+		if n, err := subwaySvc.LoadFeedCache(cfg.FeedCachePath); err != nil {
+			slog.Warn("ignoring unreadable feed cache", "path", cfg.FeedCachePath, "error", err)
+		} else {
+			slog.Info("restored feed cache", "path", cfg.FeedCachePath, "feeds", n)
+		}
+		background.Go(func() {
+			subwaySvc.PersistFeedCache(ctx, cfg.FeedCachePath, cfg.FeedCachePersistInterval)
+		})
+	}
+
+	if cfg.WarmEnabled() {
+		// Any station warms every feed, but a typo should still be caught
+		for _, id := range cfg.WarmStations {
+			if _, ok := stopSvc.GetByID(id); !ok {
+				log.Fatal("Warm feed error: unknown station ", id)
+			}
+		}
+		warmer, err := transit.NewFeedWarmer(subwaySvc, cfg.WarmRefreshInterval, cfg.WarmStations, cfg.WarmRoutes)
+		if err != nil {
+			log.Fatal("Warm feed error: ", err)
+		}
+		if cfg.WarmRefreshInterval >= cfg.SubwayCacheTTL {
+			slog.Warn("warm refresh interval is not below the subway cache TTL; warm feeds may still expire",
+				"interval", cfg.WarmRefreshInterval, "cache_ttl", cfg.SubwayCacheTTL)
+		}
+		slog.Info("warming subway feeds", "feeds", warmer.Feeds(), "stations", cfg.WarmStations, "routes", cfg.WarmRoutes, "interval", cfg.WarmRefreshInterval)
+		background.Go(func() { warmer.Run(ctx) })
+	}
 
-	busSvc := transit.NewBusService(cfg.MTABusAPIKey, cfg.HTTPTimeout, cfg.CacheTTL)
+	busSvc := transit.NewBusService(cfg.MTABusAPIKey, httpClient, cfg.BusArrivalCacheTTL, cfg.BusStopsCacheTTL)
+	if cfg.BusBaseURL != "" {
+		busSvc.SetBaseURL(cfg.BusBaseURL)
+		slog.Info("using custom bus API", "base_url", cfg.BusBaseURL)
+	}
+	busSvc.SetKeyParam(cfg.BusKeyParam)
+	busSvc.SetMaxStops(cfg.MaxBusStops)
 	if busSvc.HasAPIKey() {
-		slog.Info("initialized bus service")
+		slog.Info("initialized bus service", "arrival_cache_ttl", cfg.BusArrivalCacheTTL, "stops_cache_ttl", cfg.BusStopsCacheTTL)
 	} else {
 		slog.Warn("bus service disabled - MTA_BUS_API_KEY not set")
 	}
 
-	alertSvc := transit.NewAlertService(cfg.HTTPTimeout, cfg.CacheTTL)
-	slog.Info("initialized alerts service")
+	alertSvc := transit.NewAlertService(httpClient, cfg.AlertsCacheTTL)
+	alertSvc.SetSummaryLength(cfg.AlertSummaryLength)
+	slog.Info("initialized alerts service", "cache_ttl", cfg.AlertsCacheTTL)
+
+	subwaySvc.SetCircuitBreaker(cfg.CircuitFailureThreshold, cfg.CircuitCooldown)
+	busSvc.SetCircuitBreaker(cfg.CircuitFailureThreshold, cfg.CircuitCooldown)
+	alertSvc.SetCircuitBreaker(cfg.CircuitFailureThreshold, cfg.CircuitCooldown)
 
 	// In development, serve web files from disk so frontend changes are
 	// picked up instantly without rebuilding the binary.
@@ -72,6 +179,10 @@ func main() {
 		slog.Info("serving frontend from disk (dev mode)")
 	}
 
+	if cfg.AdminEnabled() {
+		slog.Info("admin endpoints enabled")
+	}
+
 	// Create router with all routes and middleware
 	router := api.NewRouter(cfg, zipSvc, stopSvc, subwaySvc, busSvc, alertSvc, webFS)
 
@@ -88,12 +199,58 @@ func main() {
 	fmt.Printf("📍 Environment: %s\n", cfg.Env)
 	fmt.Printf("🔗 http://localhost:%s\n", cfg.Port)
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal("Server failed to start: ", err)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Server failed to start: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("server shutdown", "error", err)
+	}
+	// Wait for the final feed cache save
+	background.Wait()
+}
+
+// shutdownTimeout bounds how long in-flight requests get to finish
+const shutdownTimeout = 10 * time.Second
+
+// requiredDataFiles must all be present in the data directory
+var requiredDataFiles = []string{"nyc-zipcodes.json", "stops.txt"}
+
+// findDataDir resolves the directory holding the location data files. A
+// non-empty override (DATA_DIR) is used as-is; otherwise ./data is tried, then
+// a data directory next to the executable. Either way the directory must
+// contain every required file.
+func findDataDir(override string) (string, error) {
+	dir := override
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return "", fmt.Errorf("DATA_DIR %q: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("DATA_DIR %q is not a directory", dir)
+		}
+	} else {
+		dir = discoverDataDir()
+	}
+
+	for _, name := range requiredDataFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return "", fmt.Errorf("data directory %q is missing %s: %w", dir, name, err)
+		}
 	}
+	return dir, nil
 }
 
-func findDataDir() string {
+// discoverDataDir looks for ./data, then data beside the executable
+func discoverDataDir() string {
 	if _, err := os.Stat("data"); err == nil {
 		return "data"
 	}
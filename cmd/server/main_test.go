@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDataFiles creates empty copies of the required data files in dir
+func writeDataFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestFindDataDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	writeDataFiles(t, dir, requiredDataFiles...)
+
+	got, err := findDataDir(dir)
+	if err != nil {
+		t.Fatalf("findDataDir: %v", err)
+	}
+	if got != dir {
+		t.Errorf("findDataDir = %q, want %q", got, dir)
+	}
+}
+
+func TestFindDataDirOverrideMissing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nope")
+
+	if _, err := findDataDir(dir); err == nil || !strings.Contains(err.Error(), "DATA_DIR") {
+		t.Errorf("findDataDir(missing) error = %v, want DATA_DIR error", err)
+	}
+}
+
+func TestFindDataDirOverrideNotDirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stops.txt")
+	writeDataFiles(t, filepath.Dir(file), "stops.txt")
+
+	if _, err := findDataDir(file); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("findDataDir(file) error = %v, want not-a-directory error", err)
+	}
+}
+
+func TestFindDataDirMissingRequiredFile(t *testing.T) {
+	dir := t.TempDir()
+	writeDataFiles(t, dir, "nyc-zipcodes.json")
+
+	if _, err := findDataDir(dir); err == nil || !strings.Contains(err.Error(), "stops.txt") {
+		t.Errorf("findDataDir error = %v, want missing stops.txt", err)
+	}
+}
+
+func TestFindDataDirFallsBackToWorkingDirectory(t *testing.T) {
+	wd := t.TempDir()
+	if err := os.Mkdir(filepath.Join(wd, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeDataFiles(t, filepath.Join(wd, "data"), requiredDataFiles...)
+	t.Chdir(wd)
+
+	got, err := findDataDir("")
+	if err != nil {
+		t.Fatalf("findDataDir: %v", err)
+	}
+	if got != "data" {
+		t.Errorf("findDataDir = %q, want data", got)
+	}
+}
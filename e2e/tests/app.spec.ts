@@ -53,8 +53,10 @@ const MOCK_BUS_RESPONSE = {
 
 const MOCK_ERROR_RESPONSE = {
   success: false,
-  error: "Zip code not found",
-  message: "Zip code 00000 is not in our NYC database",
+  error: {
+    code: "ZIP_NOT_FOUND",
+    message: "Zip code 00000 is not in our NYC database",
+  },
 };
 
 // ---------------------------------------------------------------------------
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/randytsao24/emteeayy/internal/location"
+)
+
+type AdminHandler struct {
+	token    string
+	zipCodes *location.ZipCodeService
+	stops    *location.StopService
+	caches   map[string]CacheFlusher // by scope name, e.g. "subway"
+}
+
+func NewAdminHandler(token string, zips *location.ZipCodeService, stops *location.StopService, caches map[string]CacheFlusher) *AdminHandler {
+	return &AdminHandler{
+		token:    token,
+		zipCodes: zips,
+		stops:    stops,
+		caches:   caches,
+	}
+}
+
+// Reload re-reads the zip code and stop data files without a restart
+func (h *AdminHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	if err := h.zipCodes.Reload(); err != nil {
+		slog.Error("failed to reload zip codes", "error", err)
+		WriteError(w, http.StatusInternalServerError, CodeInternalError, "Failed to reload zip codes: "+err.Error())
+		return
+	}
+
+	stopsResult, err := h.stops.Reload()
+	if err != nil {
+		slog.Error("failed to reload stops", "error", err)
+		WriteError(w, http.StatusInternalServerError, CodeInternalError, "Failed to reload stops: "+err.Error())
+		return
+	}
+
+	slog.Info("reloaded location data",
+		"zipcodes", h.zipCodes.Count(),
+		"stops", h.stops.Count(),
+		"skipped_stop_rows", len(stopsResult.Skipped),
+	)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":         true,
+		"zipcodes":        h.zipCodes.Count(),
+		"stops":           h.stops.Count(),
+		"subway_stations": h.stops.ParentStationCount(),
+		"skipped_rows":    stopsResult.Skipped,
+	})
+}
+
+// FlushCaches drops cached upstream data so the next requests refetch it.
+// ?scope=subway|bus|alerts limits the flush to one service.
+func (h *AdminHandler) FlushCaches(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+
+	targets := h.caches
+	if scope := r.URL.Query().Get("scope"); scope != "" {
+		c, ok := h.caches[scope]
+		if !ok {
+			scopes := slices.Sorted(maps.Keys(h.caches))
+			WriteError(w, http.StatusBadRequest, CodeInvalidParameter, "scope must be one of: "+strings.Join(scopes, ", "))
+			return
+		}
+		targets = map[string]CacheFlusher{scope: c}
+	}
+
+	cleared := make(map[string]int, len(targets))
+	for name, c := range targets {
+		cleared[name] = c.FlushCache()
+	}
+	slog.Info("flushed caches", "cleared", cleared)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"cleared": cleared,
+	})
+}
+
+// authorize checks the bearer token, writing a 401 and returning false if it doesn't match
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		WriteError(w, http.StatusUnauthorized, CodeUnauthorized, "A valid admin token is required")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// nycBounds is a generous box around the five boroughs. Coordinate searches
+// outside it can't find any stations, so they are rejected up front rather
+// than scanning for nothing.
+var nycBounds = struct{ minLat, minLng, maxLat, maxLng float64 }{40.40, -74.40, 41.10, -73.50}
+
+// parseCoords reads the lat and lng query parameters, requiring both to be
+// valid coordinates inside nycBounds. On failure it writes a 400 error and
+// returns ok=false.
+func parseCoords(w http.ResponseWriter, r *http.Request) (lat, lng float64, ok bool) {
+	latStr := r.URL.Query().Get("lat")
+	lngStr := r.URL.Query().Get("lng")
+
+	if latStr == "" || lngStr == "" {
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "lat and lng query parameters are required")
+		return 0, 0, false
+	}
+
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidCoordinates, "Invalid lat parameter")
+		return 0, 0, false
+	}
+
+	lng, err = strconv.ParseFloat(lngStr, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, CodeInvalidCoordinates, "Invalid lng parameter")
+		return 0, 0, false
+	}
+
+	// Written as negated ranges so NaN fails too
+	if !(lat >= -90 && lat <= 90) || !(lng >= -180 && lng <= 180) {
+		WriteError(w, http.StatusBadRequest, CodeInvalidCoordinates, "lat must be between -90 and 90 and lng between -180 and 180")
+		return 0, 0, false
+	}
+	if lat < nycBounds.minLat || lat > nycBounds.maxLat || lng < nycBounds.minLng || lng > nycBounds.maxLng {
+		WriteError(w, http.StatusBadRequest, CodeInvalidCoordinates, "Coordinates are outside the New York City area")
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/randytsao24/emteeayy/internal/models"
+)
+
+// stopExportColumns is the CSV header, in GTFS stops.txt naming
+var stopExportColumns = []string{"stop_id", "stop_name", "stop_lat", "stop_lon", "location_type", "parent_station", "stop_code", "complex_id"}
+
+// ExportSubwayStops streams the loaded stops as a download: parent stations,
+// or every stop with ?include_children=true, as CSV (the default) or GeoJSON
+// with ?format=geojson. Rows are written as they're read rather than built up
+// first; once the body has started an error can only be logged.
+func (h *TransitHandler) ExportSubwayStops(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "geojson" {
+		WriteError(w, http.StatusBadRequest, CodeInvalidParameter, "format must be csv or geojson")
+		return
+	}
+
+	all := r.URL.Query().Get("include_children") == "true"
+	stops := h.stops.All(all)
+	name := "subway-stations"
+	if all {
+		name = "subway-stops"
+	}
+
+	var err error
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		err = writeStopsCSV(w, stops)
+	case "geojson":
+		w.Header().Set("Content-Type", "application/geo+json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.geojson"`)
+		err = writeStopsGeoJSON(w, stops)
+	}
+	if err != nil {
+		slog.Warn("stop export interrupted", "format", format, "error", err)
+	}
+}
+
+func writeStopsCSV(w io.Writer, stops iter.Seq[models.Stop]) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(stopExportColumns); err != nil {
+		return err
+	}
+	coord := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for stop := range stops {
+		err := cw.Write([]string{
+			stop.ID, stop.Name, coord(stop.Lat), coord(stop.Lng),
+			strconv.Itoa(stop.LocationType), stop.ParentStation, stop.Code, stop.ComplexID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// stopFeature is one stop as a GeoJSON Feature
+type stopFeature struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string     `json:"type"`
+		Coordinates [2]float64 `json:"coordinates"` // longitude first
+	} `json:"geometry"`
+	Properties stopProperties `json:"properties"`
+}
+
+type stopProperties struct {
+	ID            string `json:"stop_id"`
+	Name          string `json:"stop_name"`
+	LocationType  int    `json:"location_type"`
+	ParentStation string `json:"parent_station,omitempty"`
+	Code          string `json:"stop_code,omitempty"`
+	ComplexID     string `json:"complex_id,omitempty"`
+}
+
+// writeStopsGeoJSON writes a FeatureCollection one feature at a time
+func writeStopsGeoJSON(w io.Writer, stops iter.Seq[models.Stop]) error {
+	if _, err := io.WriteString(w, `{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+	sep := ""
+	for stop := range stops {
+		f := stopFeature{Type: "Feature", Properties: stopProperties{
+			ID:            stop.ID,
+			Name:          stop.Name,
+			LocationType:  stop.LocationType,
+			ParentStation: stop.ParentStation,
+			Code:          stop.Code,
+			ComplexID:     stop.ComplexID,
+		}}
+		f.Geometry.Type = "Point"
+		f.Geometry.Coordinates = [2]float64{stop.Lng, stop.Lat}
+
+		b, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		sep = ","
+	}
+	_, err := io.WriteString(w, "]}\n")
+	return err
+}
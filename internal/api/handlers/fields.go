@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// parseFields reads the ?fields= sparse fieldset, returning nil when absent
+func parseFields(r *http.Request) []string {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// projectFields trims a station object (or a slice of them) down to the
+// requested top-level JSON fields. Unknown names are ignored and a nil
+// fieldset returns v unchanged.
+func projectFields(v any, fields []string) any {
+	if fields == nil {
+		return v
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+
+	keep := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keep[f] = true
+	}
+
+	switch val := decoded.(type) {
+	case map[string]any:
+		return pick(val, keep)
+	case []any:
+		for i, item := range val {
+			if obj, ok := item.(map[string]any); ok {
+				val[i] = pick(obj, keep)
+			}
+		}
+		return val
+	}
+	return decoded
+}
+
+func pick(obj map[string]any, keep map[string]bool) map[string]any {
+	for k := range obj {
+		if !keep[k] {
+			delete(obj, k)
+		}
+	}
+	return obj
+}
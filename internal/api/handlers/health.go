@@ -4,21 +4,105 @@ package handlers
 import (
 	"net/http"
 	"time"
+
+	"github.com/randytsao24/emteeayy/internal/location"
+	"github.com/randytsao24/emteeayy/internal/transit"
 )
 
 type HealthHandler struct {
 	startTime time.Time
+	zipCodes  *location.ZipCodeService
+	stops     *location.StopService
+	feeds     map[string]FeedStatusReporter
+	upstream  *transit.UpstreamChecker
 }
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{startTime: time.Now()}
+func NewHealthHandler(zips *location.ZipCodeService, stops *location.StopService, feeds map[string]FeedStatusReporter, upstream *transit.UpstreamChecker) *HealthHandler {
+	return &HealthHandler{
+		startTime: time.Now(),
+		zipCodes:  zips,
+		stops:     stops,
+		feeds:     feeds,
+		upstream:  upstream,
+	}
 }
 
+// Health is a liveness check: it reports OK as long as the process is serving
 func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
-		"status":    "OK",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-		"version":   "1.0.0",
-		"uptime":    time.Since(h.startTime).String(),
+		"status":            "OK",
+		"timestamp":         time.Now().UTC().Format(time.RFC3339),
+		"version":           "1.0.0",
+		"uptime":            time.Since(h.startTime).String(),
+		"last_feed_success": h.feedAges(),
+	})
+}
+
+// Ready is a readiness check: it reports 503 until the location data is
+// loaded. It reads the services' ready flags rather than taking their locks,
+// so it answers promptly even while a reload is swapping data in.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"zipcodes": loadStatus(h.zipCodes.IsReady()),
+		"stops":    loadStatus(h.stops.IsReady()),
+	}
+
+	status := http.StatusOK
+	overall := "ready"
+	for _, s := range checks {
+		if s != "ok" {
+			status = http.StatusServiceUnavailable
+			overall = "not_ready"
+			break
+		}
+	}
+
+	writeJSON(w, status, map[string]any{
+		"status":            overall,
+		"timestamp":         time.Now().UTC().Format(time.RFC3339),
+		"dependencies":      checks,
+		"last_feed_success": h.feedAges(),
+	})
+}
+
+// Upstream reports whether each MTA host answers and how quickly, so an MTA
+// outage can be told apart from a problem here. It is always a 200; the
+// status is "degraded" when any host is unreachable.
+func (h *HealthHandler) Upstream(w http.ResponseWriter, r *http.Request) {
+	results, checkedAt := h.upstream.Check(r.Context())
+
+	overall := "ok"
+	for _, u := range results {
+		if !u.Reachable {
+			overall = "degraded"
+			break
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":     overall,
+		"checked_at": checkedAt.UTC().Format(time.RFC3339),
+		"upstreams":  results,
 	})
 }
+
+// feedAges reports how long ago each upstream feed was last fetched successfully
+func (h *HealthHandler) feedAges() map[string]string {
+	ages := make(map[string]string, len(h.feeds))
+	for name, feed := range h.feeds {
+		last := feed.LastSuccess()
+		if last.IsZero() {
+			ages[name] = "never"
+			continue
+		}
+		ages[name] = time.Since(last).Round(time.Second).String()
+	}
+	return ages
+}
+
+func loadStatus(loaded bool) string {
+	if loaded {
+		return "ok"
+	}
+	return "not_loaded"
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import "github.com/randytsao24/emteeayy/internal/transit"
+
+// SearchLimits are the radius and result-count tunables for a family of
+// nearby-search endpoints. Zero fields use the built-in values.
+type SearchLimits struct {
+	DefaultRadius int // meters, used when ?radius= is omitted
+	MaxRadius     int
+	DefaultLimit  int // results, used when ?limit= is omitted
+	MaxLimit      int
+}
+
+var (
+	// defaultLocationLimits apply to the /transit/location stop searches
+	defaultLocationLimits = SearchLimits{
+		DefaultRadius: 1600, // ~1 mile
+		MaxRadius:     8000, // ~5 miles
+		DefaultLimit:  5,
+		MaxLimit:      20,
+	}
+
+	// defaultBoroughLimits apply to the borough station listing, which has no
+	// radius
+	defaultBoroughLimits = SearchLimits{
+		DefaultLimit: 100,
+		MaxLimit:     500,
+	}
+
+	// defaultSubwayLimits apply to the subway arrival searches, where limit
+	// counts stations
+	defaultSubwayLimits = SearchLimits{
+		DefaultRadius: 800,  // ~0.5 mile
+		MaxRadius:     3200, // ~2 miles
+		DefaultLimit:  3,
+		MaxLimit:      transit.MaxSubwayStops,
+	}
+
+	// defaultBusLimits apply to the bus arrival and stop searches; their stop
+	// counts are capped separately by SetMaxBusStops
+	defaultBusLimits = SearchLimits{
+		DefaultRadius: 400,  // ~1/4 mile
+		MaxRadius:     3200, // ~2 miles
+	}
+)
+
+// resolve fills zero fields from builtin, then keeps everything consistent:
+// radii no smaller than minRadius and each default within its cap
+func (l SearchLimits) resolve(builtin SearchLimits, minRadius int) SearchLimits {
+	l.DefaultRadius = positiveOr(l.DefaultRadius, builtin.DefaultRadius)
+	l.MaxRadius = max(positiveOr(l.MaxRadius, builtin.MaxRadius), minRadius)
+	l.DefaultRadius = min(max(l.DefaultRadius, minRadius), l.MaxRadius)
+	l.MaxLimit = positiveOr(l.MaxLimit, builtin.MaxLimit)
+	l.DefaultLimit = min(positiveOr(l.DefaultLimit, builtin.DefaultLimit), l.MaxLimit)
+	return l
+}
+
+// defaultMaxNearArrivals caps the arrivals in one nearby subway response,
+// across every station and direction, when SetMaxNearArrivals isn't given one
+const defaultMaxNearArrivals = 200
+
+// arrivalBudget trims station arrivals to a total shared by every station in
+// a response. Stations are filled in order, nearest first, each keeping its
+// soonest arrivals across both directions.
+type arrivalBudget struct {
+	left      int
+	truncated bool // arrivals were dropped to stay within the budget
+}
+
+func (b *arrivalBudget) apply(stations []transit.StationArrivals) {
+	for i := range stations {
+		north, south := stations[i].Northbound, stations[i].Southbound
+		n, s := 0, 0
+		for n+s < b.left && (n < len(north) || s < len(south)) {
+			if s == len(south) || (n < len(north) && !north[n].ArrivalTime.After(south[s].ArrivalTime)) {
+				n++
+			} else {
+				s++
+			}
+		}
+		if n < len(north) || s < len(south) {
+			b.truncated = true
+		}
+		stations[i].Northbound, stations[i].Southbound = north[:n], south[:s]
+		b.left -= n + s
+	}
+}
+
+func positiveOr(v, fallback int) int {
+	if v > 0 {
+		return v
+	}
+	return fallback
+}
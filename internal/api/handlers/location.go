@@ -1,125 +1,301 @@
 package handlers
 
 import (
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/randytsao24/emteeayy/internal/location"
+	"github.com/randytsao24/emteeayy/internal/models"
 )
 
 const (
-	defaultRadius = 1600  // ~1 mile in meters
-	maxRadius     = 8000  // ~5 miles
-	minRadius     = 50
-	defaultLimit  = 5
-	maxLimit      = 20
+	minRadius = 50
+
+	defaultZipPageLimit = 100
+	maxZipPageLimit     = 500
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
 )
 
 type LocationHandler struct {
 	zipCodes *location.ZipCodeService
 	stops    *location.StopService
+	bus      BusProvider
+	limits   SearchLimits
+	borough  SearchLimits // station counts for the borough listing
 }
 
-func NewLocationHandler(zips *location.ZipCodeService, stops *location.StopService) *LocationHandler {
+// NewLocationHandler creates the location handler. bus is only used for stop
+// counts and may be nil. Zero fields in limits use the built-in defaults.
+func NewLocationHandler(zips *location.ZipCodeService, stops *location.StopService, bus BusProvider, limits SearchLimits) *LocationHandler {
 	return &LocationHandler{
 		zipCodes: zips,
 		stops:    stops,
+		bus:      bus,
+		limits:   limits.resolve(defaultLocationLimits, minRadius),
+		borough:  defaultBoroughLimits,
 	}
 }
 
+// SetBoroughLimits tunes the borough station listing; only the limit fields
+// apply, and zero ones keep the built-in values. Call it before serving.
+func (h *LocationHandler) SetBoroughLimits(limits SearchLimits) {
+	h.borough = limits.resolve(defaultBoroughLimits, minRadius)
+}
+
 // GetStopsByZip finds stops near a zip code
 func (h *LocationHandler) GetStopsByZip(w http.ResponseWriter, r *http.Request) {
-	zipCode := r.PathValue("zipcode")
-
-	if len(zipCode) != 5 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error":   "Invalid zip code format",
-			"message": "Zip code must be exactly 5 digits",
-		})
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
 		return
 	}
-
-	zip, found := h.zipCodes.Get(zipCode)
-	if !found {
-		writeJSON(w, http.StatusNotFound, map[string]any{
-			"error":   "Zip code not found",
-			"message": "Zip code " + zipCode + " is not in our NYC database",
-		})
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	radius := parseIntParam(r, "radius", defaultRadius, minRadius, maxRadius)
-	stops := h.stops.FindNearby(zip.Lat, zip.Lng, float64(radius))
+	radius := parseIntParam(r, "radius", h.limits.DefaultRadius, minRadius, h.limits.MaxRadius)
+	stops := h.stops.FindNearbyWithOptions(zip.Lat, zip.Lng, float64(radius), location.NearbyOptions{
+		IncludeChildren: r.URL.Query().Get("include_children") == "true",
+	})
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":       true,
-		"zip_code":      zipCode,
+		"zip_code":      zip.Code,
 		"location":      zip,
 		"radius_meters": radius,
-		"stops":         stops,
+		"stops":         projectUnits(stops, units),
 		"metadata": map[string]any{
 			"stops_found": len(stops),
 		},
 	})
 }
 
-// GetClosestStops returns the N closest stops to a zip code
-func (h *LocationHandler) GetClosestStops(w http.ResponseWriter, r *http.Request) {
-	zipCode := r.PathValue("zipcode")
+// GetZipInfo returns a zip code's coordinates, borough and city without
+// searching for stops, for clients that only need to place it
+func (h *LocationHandler) GetZipInfo(w http.ResponseWriter, r *http.Request) {
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"zip_code": zip.Code,
+		"location": zip,
+	})
+}
+
+// GetDensity counts transit stops within a radius of a zip code without
+// fetching any arrivals. Bus stops are only counted when a Bus Time key is
+// configured; a failed bus lookup leaves them out rather than failing.
+func (h *LocationHandler) GetDensity(w http.ResponseWriter, r *http.Request) {
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
+		return
+	}
 
-	if len(zipCode) != 5 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error":   "Invalid zip code format",
-			"message": "Zip code must be exactly 5 digits",
-		})
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	zip, found := h.zipCodes.Get(zipCode)
-	if !found {
-		writeJSON(w, http.StatusNotFound, map[string]any{
-			"error":   "Zip code not found",
-			"message": "Zip code " + zipCode + " is not in our NYC database",
-		})
+	radius := parseIntParam(r, "radius", h.limits.DefaultRadius, minRadius, h.limits.MaxRadius)
+	stations := h.stops.FindNearby(zip.Lat, zip.Lng, float64(radius))
+
+	response := map[string]any{
+		"success":         true,
+		"zip_code":        zip.Code,
+		"location":        zip,
+		"radius_meters":   radius,
+		"subway_stations": len(stations),
+	}
+
+	// Nearest station regardless of radius, so sparse areas still get a distance
+	if closest := h.stops.FindClosest(zip.Lat, zip.Lng, 1); len(closest) > 0 {
+		nearest := closest[0]
+		response["nearest_station"] = projectUnits(struct {
+			ID             string  `json:"id"`
+			Name           string  `json:"name"`
+			DistanceMeters float64 `json:"distance_meters"`
+			DistanceMiles  float64 `json:"distance_miles"`
+		}{nearest.ID, nearest.Name, nearest.DistanceMeters, nearest.DistanceMiles}, units)
+	}
+
+	if h.bus != nil && h.bus.HasAPIKey() {
+		busStops, err := h.bus.FindStopsNear(r.Context(), zip.Lat, zip.Lng, radius)
+		if err != nil {
+			slog.Warn("counting bus stops", "zip", zip.Code, "error", err)
+		} else {
+			response["bus_stops"] = len(busStops)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetClosestStops returns the N closest stops to a zip code
+func (h *LocationHandler) GetClosestStops(w http.ResponseWriter, r *http.Request) {
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
 		return
 	}
+	units, ok := parseUnits(w, r)
+	if !ok {
+		return
+	}
+
+	limit := parseIntParam(r, "limit", h.limits.DefaultLimit, 1, h.limits.MaxLimit)
+	maxDistance := parseIntParam(r, "max_distance", 0, 0, h.limits.MaxRadius)
+	stops, truncated := h.stops.FindClosestWithin(zip.Lat, zip.Lng, limit, float64(maxDistance))
+	if stops == nil {
+		stops = []models.StopWithDistance{}
+	}
 
-	limit := parseIntParam(r, "limit", defaultLimit, 1, maxLimit)
-	stops := h.stops.FindClosest(zip.Lat, zip.Lng, limit)
+	metadata := map[string]any{
+		"stops_found":           len(stops),
+		"truncated_by_distance": truncated,
+	}
+	if maxDistance > 0 {
+		metadata["max_distance_meters"] = maxDistance
+	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":  true,
-		"zip_code": zipCode,
+		"zip_code": zip.Code,
 		"location": zip,
-		"stops":    stops,
-		"metadata": map[string]any{
-			"stops_found": len(stops),
-		},
+		"stops":    projectUnits(stops, units),
+		"metadata": metadata,
 	})
 }
 
-// GetAllZipCodes returns all zip codes, optionally filtered by borough
+// GetAllZipCodes returns zip codes sorted by code, optionally filtered by
+// borough and paginated with limit/offset. An unrecognized borough is a 400
+// rather than an empty list.
 func (h *LocationHandler) GetAllZipCodes(w http.ResponseWriter, r *http.Request) {
-	borough := r.URL.Query().Get("borough")
+	borough := strings.TrimSpace(r.URL.Query().Get("borough"))
 
-	var zips []any
+	var zips []models.ZipCode
 	if borough != "" {
-		for _, z := range h.zipCodes.GetByBorough(borough) {
-			zips = append(zips, z)
+		name, ok := h.knownBorough(borough)
+		if !ok {
+			WriteError(w, http.StatusBadRequest, CodeInvalidBorough,
+				fmt.Sprintf("Unknown borough %q; valid boroughs are: %s", borough, strings.Join(h.zipCodes.Boroughs(), ", ")))
+			return
 		}
+		zips = h.zipCodes.GetByBorough(name)
 	} else {
-		for _, z := range h.zipCodes.GetAll() {
-			zips = append(zips, z)
-		}
+		zips = h.zipCodes.GetAll()
+	}
+
+	total := len(zips)
+	limit := parseIntParam(r, "limit", defaultZipPageLimit, 1, maxZipPageLimit)
+	offset := parseIntParam(r, "offset", 0, 0, total)
+
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	page := zips[offset:end]
+	if page == nil {
+		page = []models.ZipCode{}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":  true,
-		"count":    len(zips),
-		"zipcodes": zips,
+		"count":    len(page),
+		"zipcodes": page,
+		"pagination": map[string]any{
+			"total":    total,
+			"limit":    limit,
+			"offset":   offset,
+			"has_more": end < total,
+		},
+	})
+}
+
+// GetStopsByBorough returns the parent stations located in a borough, sorted
+// by name. Stations are placed using Borough, so borough boundaries are used
+// when loaded and the nearest zip otherwise.
+func (h *LocationHandler) GetStopsByBorough(w http.ResponseWriter, r *http.Request) {
+	requested := strings.TrimSpace(r.PathValue("borough"))
+	borough, ok := h.knownBorough(requested)
+	if !ok {
+		WriteError(w, http.StatusBadRequest, CodeInvalidBorough,
+			fmt.Sprintf("Unknown borough %q; valid boroughs are: %s", requested, strings.Join(h.zipCodes.Boroughs(), ", ")))
+		return
+	}
+	limit := parseIntParam(r, "limit", h.borough.DefaultLimit, 1, h.borough.MaxLimit)
+
+	stops := []models.Stop{}
+	total := 0
+	for _, stop := range h.stops.ParentStations() {
+		if b, found := h.zipCodes.Borough(stop.Lat, stop.Lng); !found || b != borough {
+			continue
+		}
+		total++
+		if len(stops) < limit {
+			stops = append(stops, stop)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"borough": borough,
+		"stops":   stops,
+		"count":   len(stops),
+		"total":   total,
 	})
 }
 
+// knownBorough matches name case-insensitively against the loaded boroughs,
+// returning the canonical spelling
+func (h *LocationHandler) knownBorough(name string) (string, bool) {
+	for _, b := range h.zipCodes.Boroughs() {
+		if strings.EqualFold(b, name) {
+			return b, true
+		}
+	}
+	return "", false
+}
+
+// SearchStops finds stations by name, most relevant first
+func (h *LocationHandler) SearchStops(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "q query parameter is required")
+		return
+	}
+	limit := parseIntParam(r, "limit", defaultSearchLimit, 1, maxSearchLimit)
+
+	// ?cursor= continues from a previous page's next_cursor
+	var after *location.SearchCursor
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := location.ParseSearchCursor(token)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidParameter, "cursor is not one this API issued")
+			return
+		}
+		after = &cursor
+	}
+
+	stops, next := h.stops.SearchByNamePage(query, limit, after)
+	response := map[string]any{
+		"success": true,
+		"query":   query,
+		"stops":   stops,
+		"count":   len(stops),
+	}
+	if next != nil {
+		response["next_cursor"] = next.Encode()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
 // GetBoroughs returns all boroughs
 func (h *LocationHandler) GetBoroughs(w http.ResponseWriter, r *http.Request) {
 	boroughs := h.zipCodes.Boroughs()
@@ -138,12 +314,12 @@ func (h *LocationHandler) GetLocationInfo(w http.ResponseWriter, r *http.Request
 		"service":     "NYC Zip Code Transit Lookup",
 		"description": "Find nearby subway stops by entering a NYC zip code",
 		"coverage": map[string]any{
-			"zipcodes":       h.zipCodes.Count(),
+			"zipcodes":        h.zipCodes.Count(),
 			"subway_stations": h.stops.ParentStationCount(),
 		},
 		"defaults": map[string]any{
-			"radius_meters": defaultRadius,
-			"limit":         defaultLimit,
+			"radius_meters": h.limits.DefaultRadius,
+			"limit":         h.limits.DefaultLimit,
 		},
 	})
 }
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/randytsao24/emteeayy/internal/location"
+	"github.com/randytsao24/emteeayy/internal/models"
+	"github.com/randytsao24/emteeayy/internal/transit"
+)
+
+// apiParam describes a path or query parameter
+type apiParam struct {
+	name        string
+	in          string // "path" or "query"
+	typ         string // JSON schema type
+	description string
+	required    bool
+}
+
+// fields maps top-level response properties to a sample value whose Go type
+// drives the generated schema
+type fields map[string]any
+
+// zipStations is one zip's entry in the results of a ?zips= nearby search,
+// which replace lat, lng, nearest_zip and stations. An alias, so it's
+// documented inline rather than as a shared schema.
+type zipStations = struct {
+	ZipCode  string                    `json:"zip_code"`
+	Location models.ZipCode            `json:"location"`
+	Stations []transit.StationArrivals `json:"stations"`
+	Count    int                       `json:"count"`
+}
+
+// apiRoute describes one endpoint. Keep this list in sync with NewRouter.
+type apiRoute struct {
+	method      string
+	path        string
+	tag         string
+	summary     string
+	params      []apiParam
+	body        fields // JSON success body
+	request     fields // JSON request body, for routes that take one
+	bare        bool   // body has no "success" flag
+	contentType string // non-JSON success responses
+}
+
+var (
+	pathZip     = apiParam{"zipcode", "path", "string", "5-digit NYC zip code", true}
+	pathStopID  = apiParam{"stopId", "path", "string", "GTFS parent station ID, e.g. 127", true}
+	pathFeed    = apiParam{"feedName", "path", "string", "Feed name, e.g. ace or 1234567", true}
+	pathRoute   = apiParam{"route", "path", "string", "Subway route ID, e.g. L or 6", true}
+	pathBorough = apiParam{"borough", "path", "string", "Borough name (case-insensitive), e.g. Manhattan", true}
+	queryLat    = apiParam{"lat", "query", "number", "Latitude", true}
+	queryLng    = apiParam{"lng", "query", "number", "Longitude", true}
+	queryRadius = apiParam{"radius", "query", "integer", "Search radius in meters", false}
+	queryLimit  = apiParam{"limit", "query", "integer", "Maximum number of results", false}
+	queryArrLim = apiParam{"arrival_limit", "query", "integer", "Maximum arrivals per direction (subway) or in total (bus)", false}
+	queryMinMin = apiParam{"min_minutes", "query", "integer", "Drop arrivals sooner than this many minutes", false}
+	queryFields = apiParam{"fields", "query", "string", "Comma-separated station fields to return", false}
+	queryUnits  = apiParam{"units", "query", "string", "metric or imperial; omit for both meters and miles", false}
+	queryTimeSr = apiParam{"time_source", "query", "string", "arrival, departure or auto (departure at a trip's first stop): which stop time subway arrivals show", false}
+	queryCatch  = apiParam{"catchable", "query", "boolean", "true to add each station's walk time and drop trains that arrive before you could walk there", false}
+)
+
+var apiRoutes = []apiRoute{
+	// Core
+	{method: "GET", path: "/", tag: "core", summary: "Web frontend, or API information when no frontend is bundled", contentType: "text/html"},
+	{method: "GET", path: "/api", tag: "core", summary: "API information and endpoint listing", bare: true, body: fields{"name": "", "description": "", "version": "", "endpoints": map[string]map[string]string(nil)}},
+	{method: "GET", path: "/openapi.json", tag: "core", summary: "This OpenAPI document", contentType: "application/json"},
+	{method: "GET", path: "/health", tag: "core", summary: "Liveness check", bare: true,
+		body: fields{"status": "", "version": "", "uptime": "", "timestamp": time.Time{}, "last_feed_success": map[string]string(nil)}},
+	{method: "GET", path: "/ready", tag: "core", summary: "Readiness check (503 until data is loaded)", bare: true,
+		body: fields{"status": "", "timestamp": time.Time{}, "dependencies": map[string]string(nil), "last_feed_success": map[string]string(nil)}},
+	{method: "GET", path: "/health/upstream", tag: "core", summary: "MTA host reachability and latency (cached briefly)", bare: true,
+		body: fields{"status": "", "checked_at": time.Time{}, "upstreams": []transit.UpstreamStatus(nil)}},
+
+	// Location
+	{method: "GET", path: "/transit/location/info", tag: "location", summary: "Service info", body: fields{"service": "", "description": "", "coverage": map[string]int(nil), "defaults": map[string]int(nil)}},
+	{method: "GET", path: "/transit/location/boroughs", tag: "location", summary: "List all boroughs", body: fields{"boroughs": []string(nil), "count": 0}},
+	{method: "GET", path: "/transit/location/borough/{borough}/stops", tag: "location", summary: "Parent stations in a borough, sorted by name",
+		params: []apiParam{{"limit", "query", "integer", "Maximum stations", false}},
+		body:   fields{"borough": "", "stops": []models.Stop(nil), "count": 0, "total": 0}},
+	{method: "GET", path: "/transit/location/zipcodes/all", tag: "location", summary: "List zip codes, optionally filtered by borough",
+		params: []apiParam{{"borough", "query", "string", "Borough name (case-insensitive)", false}, {"limit", "query", "integer", "Page size", false}, {"offset", "query", "integer", "Page offset", false}},
+		body:   fields{"zipcodes": []models.ZipCode(nil), "count": 0, "pagination": map[string]any(nil)}},
+	{method: "GET", path: "/transit/location/search", tag: "location", summary: "Search stations by name, most relevant first",
+		params: []apiParam{
+			{"q", "query", "string", "Station name or part of one (case-insensitive)", true}, queryLimit,
+			{"cursor", "query", "string", "next_cursor from the previous page", false}},
+		body: fields{"query": "", "stops": []models.Stop(nil), "count": 0, "next_cursor": ""}},
+	{method: "GET", path: "/transit/location/zip/{zipcode}", tag: "location", summary: "Find subway stops near a zip code",
+		params: []apiParam{queryRadius, queryUnits, {"include_children", "query", "boolean", "Also return platforms and entrances", false}},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "stops": []models.StopWithDistance(nil), "metadata": map[string]int(nil)}},
+	{method: "GET", path: "/transit/location/zip/{zipcode}/closest", tag: "location", summary: "Get the N closest subway stops",
+		params: []apiParam{queryLimit, queryUnits, {"max_distance", "query", "integer", "Drop stops farther than this many meters", false}},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "stops": []models.StopWithDistance(nil), "metadata": map[string]any(nil)}},
+	{method: "GET", path: "/transit/location/zip/{zipcode}/density", tag: "location", summary: "Count stations and bus stops within a radius",
+		params: []apiParam{queryRadius, queryUnits},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "subway_stations": 0, "bus_stops": 0, "nearest_station": map[string]any(nil)}},
+	{method: "GET", path: "/transit/location/zip/{zipcode}/info", tag: "location", summary: "Coordinates, borough and city of a zip code, without a stop search",
+		body: fields{"zip_code": "", "location": models.ZipCode{}}},
+
+	// Subway
+	{method: "GET", path: "/transit/subway/alerts", tag: "subway", summary: "Service alerts, by default those in effect now",
+		params: []apiParam{{"routes", "query", "string", "Comma-separated route IDs", false}, {"severity", "query", "string", "Comma-separated severities", false}, {"stop", "query", "string", "Station or platform stop ID", false}, {"match_base", "query", "boolean", "Match express variants to their base route (6X to 6)", false},
+			{"active", "query", "string", "now (default), upcoming (scheduled, not yet in effect) or all", false}},
+		body: fields{"alerts": []transit.ServiceAlert(nil), "count": 0}},
+	{method: "GET", path: "/transit/subway/arrivals", tag: "subway", summary: "Arrivals for several stations",
+		params: []apiParam{{"stops", "query", "string", "Comma-separated station IDs", true}, queryArrLim, queryMinMin, queryTimeSr, queryFields},
+		body:   fields{"stations": []transit.StationArrivals(nil), "count": 0, "feeds_degraded": false, "failed_feeds": []string(nil)}},
+	{method: "POST", path: "/transit/subway/arrivals", tag: "subway", summary: "Arrivals for a list of up to 25 stations, given as {\"stops\": [...]}",
+		params:  []apiParam{queryArrLim, queryMinMin, queryTimeSr, queryFields},
+		request: fields{"stops": []string(nil)},
+		body:    fields{"stations": []transit.StationArrivals(nil), "count": 0, "feeds_degraded": false, "failed_feeds": []string(nil)}},
+	{method: "GET", path: "/transit/subway/routes", tag: "subway", summary: "Subway routes with colors and feed groups",
+		body: fields{"routes": []transit.Route(nil), "count": 0}},
+	{method: "GET", path: "/transit/subway/station/{stopId}", tag: "subway", summary: "Arrivals for any station",
+		params: []apiParam{{"limit", "query", "integer", "Maximum arrivals per direction", false}, queryMinMin, queryTimeSr, queryFields, {"group_by", "query", "string", "route to nest each direction's arrivals by route", false}},
+		body:   fields{"stop_id": "", "arrivals": map[string][]transit.Arrival(nil), "feeds_degraded": false, "failed_feeds": []string(nil)}},
+	{method: "GET", path: "/transit/subway/station/{stopId}/stream", tag: "subway", summary: "Live arrivals for a station (Server-Sent Events)",
+		params: []apiParam{{"limit", "query", "integer", "Maximum arrivals per direction", false}, queryMinMin, queryTimeSr}, contentType: "text/event-stream"},
+	{method: "GET", path: "/transit/subway/feed/{feedName}", tag: "subway", summary: "Raw GTFS-RT protobuf for a feed", contentType: "application/x-protobuf"},
+	{method: "GET", path: "/transit/subway/route/{route}/arrivals", tag: "subway", summary: "Upcoming arrivals for one line, grouped by station",
+		params: []apiParam{{"limit", "query", "integer", "Maximum stations", false}, queryArrLim, queryMinMin, queryTimeSr, queryFields},
+		body:   fields{"route": "", "stations": []transit.StationArrivals(nil), "count": 0}},
+	{method: "GET", path: "/transit/subway/near/{zipcode}", tag: "subway", summary: "Subway arrivals near a zip code (NDJSON with Accept: application/x-ndjson: a station per line, the last with truncated)",
+		params: []apiParam{queryRadius, queryLimit, queryArrLim, queryMinMin, queryTimeSr, queryFields, queryUnits, queryCatch},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "stations": []transit.StationArrivals(nil), "count": 0, "truncated": false, "feeds_degraded": false, "failed_feeds": []string(nil)}},
+	{method: "GET", path: "/transit/subway/near", tag: "subway", summary: "Subway arrivals near coordinates (NDJSON with Accept: application/x-ndjson: a station per line, the last with truncated), or near each of up to 3 zips with ?zips= (results keyed by zip)",
+		params: []apiParam{
+			{"lat", "query", "number", "Latitude (required unless zips is given)", false},
+			{"lng", "query", "number", "Longitude (required unless zips is given)", false},
+			{"zips", "query", "string", "Comma-separated zip codes; returns results keyed by zip instead", false},
+			queryRadius, queryLimit, queryArrLim, queryMinMin, queryTimeSr, queryFields, queryUnits, queryCatch},
+		body: fields{"lat": 0.0, "lng": 0.0, "nearest_zip": map[string]any(nil), "radius_meters": 0, "stations": []transit.StationArrivals(nil), "results": map[string]zipStations(nil), "count": 0, "truncated": false, "feeds_degraded": false, "failed_feeds": []string(nil)}},
+	{method: "GET", path: "/transit/subway/stops/bbox", tag: "subway", summary: "Parent stations inside a bounding box",
+		params: []apiParam{{"minLat", "query", "number", "South edge", true}, {"minLng", "query", "number", "West edge", true}, {"maxLat", "query", "number", "North edge", true}, {"maxLng", "query", "number", "East edge", true}},
+		body:   fields{"bounds": map[string]float64(nil), "stops": []models.Stop(nil), "count": 0}},
+	{method: "GET", path: "/transit/subway/stops/export", tag: "subway", summary: "Download parent stations, or all stops, as CSV or GeoJSON",
+		params: []apiParam{{"format", "query", "string", "csv (default) or geojson", false}, {"include_children", "query", "boolean", "true to include platforms and entrances", false}}, contentType: "text/csv"},
+	{method: "GET", path: "/transit/subway/stops/{zipcode}", tag: "subway", summary: "Subway stops near a zip code",
+		params: []apiParam{queryRadius, queryUnits},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "stops": []transit.SubwayStop(nil), "count": 0}},
+	{method: "GET", path: "/transit/subway/nearest/{zipcode}", tag: "subway", summary: "Arrivals at the closest station to a zip code",
+		params: []apiParam{queryRadius, queryArrLim, queryMinMin, queryTimeSr, queryFields, queryUnits},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "station": transit.StationArrivals{}, "feeds_degraded": false, "failed_feeds": []string(nil)}},
+	{method: "GET", path: "/transit/subway/nearest", tag: "subway", summary: "Arrivals at the closest station to coordinates",
+		params: []apiParam{queryLat, queryLng, queryRadius, queryArrLim, queryMinMin, queryTimeSr, queryFields, queryUnits},
+		body:   fields{"lat": 0.0, "lng": 0.0, "nearest_zip": map[string]any(nil), "radius_meters": 0, "station": transit.StationArrivals{}, "feeds_degraded": false, "failed_feeds": []string(nil)}},
+
+	// Bus
+	{method: "GET", path: "/transit/bus/near/{zipcode}", tag: "bus", summary: "Bus arrivals near a zip code",
+		params: []apiParam{queryRadius, queryLimit, queryArrLim, queryMinMin},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "arrivals": []transit.BusArrival(nil), "count": 0, "partial": false, "failed_stops": 0}},
+	{method: "GET", path: "/transit/bus/near", tag: "bus", summary: "Bus arrivals near coordinates",
+		params: []apiParam{queryLat, queryLng, queryRadius, queryLimit, queryArrLim, queryMinMin},
+		body:   fields{"lat": 0.0, "lng": 0.0, "nearest_zip": map[string]any(nil), "radius_meters": 0, "arrivals": []transit.BusArrival(nil), "count": 0, "partial": false, "failed_stops": 0}},
+	{method: "GET", path: "/transit/bus/stops/{zipcode}", tag: "bus", summary: "Bus stops near a zip code",
+		params: []apiParam{queryRadius, {"route", "query", "string", "Only stops served by this route, e.g. M34", false}},
+		body:   fields{"zip_code": "", "location": models.ZipCode{}, "radius_meters": 0, "stops": []transit.BusStop(nil), "count": 0}},
+
+	// Admin
+	{method: "POST", path: "/admin/reload", tag: "admin", summary: "Reload zip code and stop data (only when ADMIN_TOKEN is set; Authorization: Bearer <token>)",
+		body: fields{"zipcodes": 0, "stops": 0, "subway_stations": 0, "skipped_rows": []location.SkippedRow(nil)}},
+	{method: "POST", path: "/admin/cache/flush", tag: "admin", summary: "Drop cached upstream data (only when ADMIN_TOKEN is set; Authorization: Bearer <token>)",
+		params: []apiParam{{"scope", "query", "string", "subway, bus or alerts; omit to flush all", false}},
+		body:   fields{"cleared": map[string]int(nil)}},
+}
+
+// pathParams holds the documentation for each {name} used in route paths
+var pathParams = map[string]apiParam{
+	"zipcode":  pathZip,
+	"stopId":   pathStopID,
+	"feedName": pathFeed,
+	"route":    pathRoute,
+	"borough":  pathBorough,
+}
+
+// openAPIDocument is built once from apiRoutes on first request
+var openAPIDocument = sync.OnceValue(buildOpenAPI)
+
+// OpenAPI serves an OpenAPI 3 description of the API
+func (h *RootHandler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
+
+func buildOpenAPI() map[string]any {
+	b := &schemaBuilder{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"success": map[string]any{"type": "boolean"},
+					"error":   b.schema(reflect.TypeFor[APIError]()),
+				},
+				"required": []string{"success", "error"},
+			}},
+		},
+	}
+
+	paths := map[string]any{}
+	for _, route := range apiRoutes {
+		var params []any
+		for _, p := range route.pathParamNames() {
+			params = append(params, p.spec())
+		}
+		for _, p := range route.params {
+			params = append(params, p.spec())
+		}
+
+		op := map[string]any{
+			"summary":     route.summary,
+			"tags":        []string{route.tag},
+			"operationId": operationID(route.method, route.path),
+			"responses": map[string]any{
+				"200":     route.successResponse(b),
+				"default": errorResponse,
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.request != nil {
+			op["requestBody"] = route.requestBody(b)
+		}
+
+		item, _ := paths[route.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[route.path] = item
+		}
+		item[strings.ToLower(route.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "emteeayy",
+			"description": "Real-time MTA transit tracking for NYC",
+			"version":     "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": b.schemas},
+	}
+}
+
+// pathParamNames returns the documented parameters for each {name} in the path
+func (route apiRoute) pathParamNames() []apiParam {
+	var params []apiParam
+	for _, seg := range strings.Split(route.path, "/") {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			p, ok := pathParams[name]
+			if !ok {
+				p = apiParam{name, "path", "string", "", true}
+			}
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+func (route apiRoute) successResponse(b *schemaBuilder) map[string]any {
+	if route.body == nil {
+		return map[string]any{
+			"description": "OK",
+			"content":     map[string]any{route.contentType: map[string]any{}},
+		}
+	}
+
+	props := map[string]any{}
+	if !route.bare {
+		props["success"] = map[string]any{"type": "boolean"}
+	}
+	for name, sample := range route.body {
+		props[name] = b.schema(reflect.TypeOf(sample))
+	}
+	return map[string]any{
+		"description": "OK",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": map[string]any{
+				"type":       "object",
+				"properties": props,
+			}},
+		},
+	}
+}
+
+func (route apiRoute) requestBody(b *schemaBuilder) map[string]any {
+	props := map[string]any{}
+	for name, sample := range route.request {
+		props[name] = b.schema(reflect.TypeOf(sample))
+	}
+	return map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": map[string]any{
+				"type":       "object",
+				"properties": props,
+			}},
+		},
+	}
+}
+
+func (p apiParam) spec() map[string]any {
+	spec := map[string]any{
+		"name":     p.name,
+		"in":       p.in,
+		"required": p.required,
+		"schema":   map[string]any{"type": p.typ},
+	}
+	if p.description != "" {
+		spec["description"] = p.description
+	}
+	return spec
+}
+
+// operationID turns "GET /transit/subway/near/{zipcode}" into
+// "getTransitSubwayNearZipcode"
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.' || r == '_'
+	}) {
+		id += strings.ToUpper(seg[:1]) + seg[1:]
+	}
+	if path == "/" {
+		id += "Root"
+	}
+	return id
+}
+
+// schemaBuilder derives JSON schemas from Go types using their json tags,
+// registering named structs under components/schemas
+type schemaBuilder struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return b.ref(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{} // interfaces accept any value
+}
+
+// ref registers a named struct once and returns a $ref to it
+func (b *schemaBuilder) ref(t reflect.Type) map[string]any {
+	name, ok := b.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := b.schemas[name]; taken {
+			// Same name in another package, e.g. models.Arrival vs transit.Arrival
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+		}
+		b.names[t] = name
+		b.schemas[name] = map[string]any{} // placeholder for recursive types
+		b.schemas[name] = b.object(t)
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// object builds an inline object schema, flattening untagged embedded structs
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := b.object(f.Type)
+			for k, v := range embedded["properties"].(map[string]any) {
+				props[k] = v
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			required = append(required, name)
+		}
+	}
+
+	obj := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
@@ -1,21 +1,52 @@
 package handlers
 
-import "github.com/randytsao24/emteeayy/internal/transit"
+import (
+	"context"
+	"time"
+
+	"github.com/randytsao24/emteeayy/internal/transit"
+)
 
 // SubwayProvider abstracts the subway data source for testability.
 type SubwayProvider interface {
-	GetArrivalsForStation(stopID string) (map[string][]transit.Arrival, error)
-	GetArrivalsForStations(stopIDs []string) ([]transit.StationArrivals, error)
+	GetArrivalsForStation(ctx context.Context, stopID string, opts transit.ArrivalOptions) (map[string][]transit.Arrival, error)
+	GetArrivalsForStations(ctx context.Context, stopIDs []string, opts transit.ArrivalOptions) ([]transit.StationArrivals, error)
+	GetArrivalsForRoute(ctx context.Context, route string, stopLimit int, opts transit.ArrivalOptions) ([]transit.StationArrivals, error)
+	GetFeedBytes(ctx context.Context, feedName string) ([]byte, error)
 }
 
 // BusProvider abstracts the bus data source for testability.
 type BusProvider interface {
 	HasAPIKey() bool
-	FindStopsNear(lat, lng float64, radiusMeters int) ([]transit.BusStop, error)
-	GetArrivalsNear(lat, lng float64, radiusMeters, limit int) ([]transit.BusArrival, error)
+	FindStopsNear(ctx context.Context, lat, lng float64, radiusMeters int) ([]transit.BusStop, error)
+	GetArrivalsNear(ctx context.Context, lat, lng float64, radiusMeters, limit, maxArrivals, minMinutes int) (transit.NearbyBusArrivals, error)
 }
 
 // AlertProvider abstracts the service alerts data source.
 type AlertProvider interface {
-	GetAlerts(routes []string) ([]transit.ServiceAlert, error)
+	GetAlerts(ctx context.Context, routes []string, opts transit.AlertOptions) ([]transit.ServiceAlert, error)
+}
+
+// CacheFlusher is implemented by services that cache upstream data and can
+// drop it on demand. FlushCache returns how many entries were cleared.
+type CacheFlusher interface {
+	FlushCache() int
+}
+
+// FeedStatusReporter is implemented by services that fetch from an upstream
+// feed and can report when they last did so successfully.
+type FeedStatusReporter interface {
+	LastSuccess() time.Time
+}
+
+// FeedFailureReporter is implemented by subway providers that skip failed
+// feeds and can say which ones they skipped during a request.
+type FeedFailureReporter interface {
+	FailedFeeds(ctx context.Context) []string
+}
+
+// UpstreamLister is implemented by services that fetch from upstream URLs
+// and can list them for reachability checks.
+type UpstreamLister interface {
+	UpstreamURLs() []string
 }
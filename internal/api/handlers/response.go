@@ -2,10 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+
+	"github.com/randytsao24/emteeayy/internal/transit"
+)
+
+// Machine-readable error codes returned in APIError.Code
+const (
+	CodeInvalidZip         = "INVALID_ZIP"
+	CodeZipNotFound        = "ZIP_NOT_FOUND"
+	CodeInvalidCoordinates = "INVALID_COORDINATES"
+	CodeInvalidBounds      = "INVALID_BOUNDS"
+	CodeInvalidBorough     = "INVALID_BOROUGH"
+	CodeMissingParameter   = "MISSING_PARAMETER"
+	CodeInvalidParameter   = "INVALID_PARAMETER"
+	CodeStationNotFound    = "STATION_NOT_FOUND"
+	CodeFeedNotFound       = "FEED_NOT_FOUND"
+	CodeRouteNotFound      = "ROUTE_NOT_FOUND"
+	CodeServiceUnavailable = "SERVICE_UNAVAILABLE"
+	CodeUpstreamError      = "UPSTREAM_ERROR"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	CodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	CodeInternalError      = "INTERNAL_ERROR"
 )
 
+// APIError is the body of every error response
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 func writeJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -14,3 +45,26 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 		slog.Error("failed to encode JSON response", "error", err)
 	}
 }
+
+// WriteError writes a consistent error response:
+// {"success": false, "error": {"code": ..., "message": ...}}. Middleware uses
+// it too, so every error from the API shares the envelope.
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"success": false,
+		"error":   APIError{Code: code, Message: message},
+	})
+}
+
+// writeUpstreamError reports a failed upstream call as "message: err" with the
+// given status. Calls short-circuited by an open breaker are a 503 with
+// Retry-After instead, so clients back off rather than retrying at once.
+func writeUpstreamError(w http.ResponseWriter, status int, message string, err error) {
+	var open *transit.CircuitOpenError
+	if errors.As(err, &open) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+		WriteError(w, http.StatusServiceUnavailable, CodeServiceUnavailable, message+": "+err.Error())
+		return
+	}
+	WriteError(w, status, CodeUpstreamError, message+": "+err.Error())
+}
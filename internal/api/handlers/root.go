@@ -2,49 +2,50 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 )
 
-type RootHandler struct{}
+type RootHandler struct {
+	endpoints map[string]map[string]string // group -> "METHOD /path" -> summary
+}
 
 func NewRootHandler() *RootHandler {
 	return &RootHandler{}
 }
 
+// SetRoutes builds the /api endpoint listing from the router's registered
+// patterns (e.g. "GET /health"). Routes are grouped and described using the
+// OpenAPI route table; anything missing from it is listed under "other".
+// Call it once, before serving.
+func (h *RootHandler) SetRoutes(patterns []string) {
+	described := make(map[string]apiRoute, len(apiRoutes))
+	for _, route := range apiRoutes {
+		described[route.method+" "+route.path] = route
+	}
+
+	h.endpoints = make(map[string]map[string]string)
+	for _, pattern := range patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		group, summary := "other", ""
+		if route, ok := described[method+" "+path]; ok {
+			group, summary = route.tag, route.summary
+		}
+		if h.endpoints[group] == nil {
+			h.endpoints[group] = make(map[string]string)
+		}
+		h.endpoints[group][pattern] = summary
+	}
+}
+
 func (h *RootHandler) Index(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{
 		"name":        "emteeayy",
 		"description": "Real-time MTA transit tracking for NYC",
 		"version":     "1.0.0",
-		"endpoints": map[string]any{
-			"core": map[string]string{
-				"GET /":       "API information",
-				"GET /health": "Health check",
-			},
-			"location": map[string]string{
-				"GET /transit/location/info":                  "Service info",
-				"GET /transit/location/boroughs":              "List all boroughs",
-				"GET /transit/location/zipcodes/all":          "List all zip codes",
-				"GET /transit/location/zip/{zipcode}":         "Find subway stops near zip",
-				"GET /transit/location/zip/{zipcode}/closest": "Get N closest subway stops",
-			},
-			"subway": map[string]string{
-				"GET /transit/subway/station/{stopId}":  "Arrivals for any station",
-				"GET /transit/subway/near/{zipcode}":    "Subway arrivals near zip code",
-				"GET /transit/subway/near?lat=X&lng=Y":  "Subway arrivals near coordinates",
-				"GET /transit/subway/stops/{zipcode}":   "Subway stops near zip code",
-			},
-			"bus": map[string]string{
-				"GET /transit/bus/near/{zipcode}":      "Bus arrivals near zip code",
-				"GET /transit/bus/near?lat=X&lng=Y":    "Bus arrivals near coordinates",
-				"GET /transit/bus/stops/{zipcode}":     "Bus stops near zip code",
-			},
-		},
+		"endpoints":   h.endpoints,
 	})
 }
 
 func (h *RootHandler) NotFound(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusNotFound, map[string]any{
-		"error":   "Route not found",
-		"message": "Check the root endpoint (/) for available routes",
-	})
+	WriteError(w, http.StatusNotFound, CodeRouteNotFound, "No such endpoint; see /api for available routes")
 }
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/randytsao24/emteeayy/internal/models"
+	"github.com/randytsao24/emteeayy/internal/transit"
+)
+
+const (
+	// defaultStreamInterval is how often a station stream pushes fresh arrivals
+	defaultStreamInterval = 15 * time.Second
+
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// StreamSubwayArrivals pushes arrivals for a station as Server-Sent Events.
+// An "arrivals" event is sent on connect and then every stream interval until
+// the client disconnects. Upstream failures are sent as "error" events and the
+// stream keeps going.
+func (h *TransitHandler) StreamSubwayArrivals(w http.ResponseWriter, r *http.Request) {
+	stopID := r.PathValue("stopId")
+	if stopID == "" {
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "Stop ID is required")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		slog.Warn("clearing write deadline for stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	opts := stationArrivalOptions(r)
+	ctx := r.Context()
+	ticker := time.NewTicker(h.streamInterval)
+	defer ticker.Stop()
+
+	for {
+		arrivals, err := h.stationArrivals(ctx, stopID, opts)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			err = writeEvent(w, "error", APIError{Code: CodeUpstreamError, Message: "Failed to fetch arrivals: " + err.Error()})
+		} else {
+			err = writeEvent(w, "arrivals", map[string]any{
+				"stop_id":    stopID,
+				"arrivals":   arrivals,
+				"updated_at": time.Now().UTC(),
+			})
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return // client went away
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeEvent writes a single SSE event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// wantsNDJSON reports whether the client asked for newline-delimited JSON
+func wantsNDJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// streamStations writes one StationArrivals object per line, fetching and
+// flushing each station in turn so clients can render them as they arrive.
+// The arrival budget is spent station by station as in the JSON response, and
+// the last line carries truncated. A failure before the first line is
+// reported as a normal error response; after that the stream just ends early.
+func (h *TransitHandler) streamStations(w http.ResponseWriter, r *http.Request, stops []models.StopWithDistance, units string) {
+	opts := arrivalOptions(r)
+	opts.MergedStations = mergedStations(stops)
+	catch := parseCatchable(r, &opts)
+	fields := parseFields(r)
+	budget := arrivalBudget{left: h.maxNear}
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+
+	started := false
+	for i, stop := range stops {
+		stations, err := h.subway.GetArrivalsForStations(r.Context(), []string{stop.ID}, opts)
+		if err != nil {
+			if !started {
+				writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch subway arrivals", err)
+			} else if r.Context().Err() == nil {
+				slog.Warn("ndjson stream ended early", "stop_id", stop.ID, "error", err)
+			}
+			return
+		}
+
+		if len(stations) == 0 {
+			stations = []transit.StationArrivals{{StopID: stop.ID}}
+		}
+		h.enrichStation(&stations[0], stop)
+		catch.apply(&stations[0], stop)
+		budget.apply(stations[:1])
+
+		line := projectFields(projectUnits(stations[0], units), fields)
+		if i == len(stops)-1 {
+			line = withTruncated(line, budget.truncated)
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := enc.Encode(line); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+	if !started {
+		// No stations in range: an empty stream
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// lastStationLine is the final NDJSON station line, which also reports
+// whether the arrival budget dropped any trains along the way
+type lastStationLine struct {
+	transit.StationArrivals
+	Truncated bool `json:"truncated"`
+}
+
+// withTruncated adds truncated to a station line, projected by ?fields= or not
+func withTruncated(line any, truncated bool) any {
+	switch v := line.(type) {
+	case map[string]any:
+		v["truncated"] = truncated
+		return v
+	case transit.StationArrivals:
+		return lastStationLine{StationArrivals: v, Truncated: truncated}
+	}
+	return line
+}
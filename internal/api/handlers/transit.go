@@ -1,101 +1,228 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/randytsao24/emteeayy/internal/location"
+	"github.com/randytsao24/emteeayy/internal/models"
 	"github.com/randytsao24/emteeayy/internal/transit"
 )
 
 const (
-	defaultSubwayRadius  = 800  // ~0.5 mile in meters
-	maxSubwayRadius      = 3200 // ~2 miles
-	minSubwayRadius      = 100
-	defaultStationsLimit = 3
-	maxStationsLimit     = 5
+	minSubwayRadius = 100
+	minBusRadius    = 100
+
+	// maxZipsPerRequest caps ?zips= on the near endpoint
+	maxZipsPerRequest = 3
+
+	// maxMinMinutes caps ?min_minutes=; anything further out isn't "can't
+	// make it" filtering anymore
+	maxMinMinutes = 30
+
+	// maxBoundsArea caps bounding-box searches, in square degrees. 0.05 covers
+	// roughly a borough-sized viewport around 40.7°N.
+	maxBoundsArea = 0.05
 )
 
 type TransitHandler struct {
-	subway   SubwayProvider
-	bus      BusProvider
-	alerts   AlertProvider
-	stops    *location.StopService
-	zipCodes *location.ZipCodeService
+	subway         SubwayProvider
+	bus            BusProvider
+	alerts         AlertProvider
+	stops          *location.StopService
+	zipCodes       *location.ZipCodeService
+	streamInterval time.Duration
+	limits         SearchLimits
+	busSearch      SearchLimits
+	busMaxStops    int
+	maxNear        int // arrivals per nearby subway response
 }
 
-func NewTransitHandler(subway SubwayProvider, bus BusProvider, alerts AlertProvider, stops *location.StopService, zips *location.ZipCodeService) *TransitHandler {
-	return &TransitHandler{
-		subway:   subway,
-		bus:      bus,
-		alerts:   alerts,
-		stops:    stops,
-		zipCodes: zips,
+// NewTransitHandler creates the transit handler. streamInterval sets how often
+// arrival streams push updates; zero uses defaultStreamInterval. limits tunes
+// the subway searches, where limit counts stations; zero fields use the
+// built-in defaults. Its MaxLimit is also the upstream fan-out cap, the most
+// stations a search or stops= query looks up (transit.MaxSubwayStops by
+// default), and can't exceed transit.MaxBulkStations.
+func NewTransitHandler(subway SubwayProvider, bus BusProvider, alerts AlertProvider, stops *location.StopService, zips *location.ZipCodeService, streamInterval time.Duration, limits SearchLimits) *TransitHandler {
+	if streamInterval <= 0 {
+		streamInterval = defaultStreamInterval
 	}
+	limits = limits.resolve(defaultSubwayLimits, minSubwayRadius)
+	limits.MaxLimit = min(limits.MaxLimit, transit.MaxBulkStations)
+	limits.DefaultLimit = min(limits.DefaultLimit, limits.MaxLimit)
+	h := &TransitHandler{
+		subway:         subway,
+		bus:            bus,
+		alerts:         alerts,
+		stops:          stops,
+		zipCodes:       zips,
+		streamInterval: streamInterval,
+		limits:         limits,
+	}
+	h.SetBusLimits(SearchLimits{})
+	h.SetMaxBusStops(0)
+	h.SetMaxNearArrivals(0)
+	return h
+}
+
+// SetBusLimits tunes the bus searches' radius; only the radius fields apply,
+// and zero ones keep the built-in values. Call it before serving.
+func (h *TransitHandler) SetBusLimits(limits SearchLimits) {
+	h.busSearch = limits.resolve(defaultBusLimits, minBusRadius)
+}
+
+// SetMaxNearArrivals caps the arrivals a nearby subway search returns, summed
+// over every station, so a wide radius with high limits can't build an
+// outsized response. Responses that hit it carry truncated: true.
+// Non-positive keeps the default of 200. Call it before serving.
+func (h *TransitHandler) SetMaxNearArrivals(n int) {
+	h.maxNear = positiveOr(n, defaultMaxNearArrivals)
+}
+
+// SetMaxBusStops caps how many stops a nearby bus search queries upstream.
+// Non-positive keeps transit.MaxBusStops. Call it before serving.
+func (h *TransitHandler) SetMaxBusStops(n int) {
+	h.busMaxStops = positiveOr(n, transit.MaxBusStops)
 }
 
 // GetSubwayArrivals returns arrivals for a station
 func (h *TransitHandler) GetSubwayArrivals(w http.ResponseWriter, r *http.Request) {
 	stopID := r.PathValue("stopId")
 	if stopID == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Stop ID is required",
-		})
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "Stop ID is required")
 		return
 	}
 
-	arrivals, err := h.subway.GetArrivalsForStation(stopID)
+	arrivals, err := h.stationArrivals(r.Context(), stopID, stationArrivalOptions(r))
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch arrivals",
-			"message": err.Error(),
-		})
+		writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch arrivals", err)
 		return
 	}
 
-	h.resolveDestinations(arrivals["northbound"])
-	h.resolveDestinations(arrivals["southbound"])
+	var body any = arrivals
+	if r.URL.Query().Get("group_by") == "route" {
+		body = groupArrivalsByRoute(arrivals)
+	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	writeJSON(w, http.StatusOK, h.withFeedStatus(r.Context(), map[string]any{
 		"success":  true,
 		"stop_id":  stopID,
-		"arrivals": arrivals,
-	})
+		"arrivals": projectFields(body, parseFields(r)),
+	}))
 }
 
-// GetSubwayArrivalsNearZip returns subway arrivals near a zip code
-func (h *TransitHandler) GetSubwayArrivalsNearZip(w http.ResponseWriter, r *http.Request) {
-	zipCode := r.PathValue("zipcode")
-	if len(zipCode) != 5 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid zip code format",
+// routeArrivals is one route's arrivals within a direction
+type routeArrivals struct {
+	Route    string            `json:"route"`
+	Arrivals []transit.Arrival `json:"arrivals"`
+}
+
+// groupArrivalsByRoute nests each direction's arrivals by route, with routes
+// sorted by ID. Arrivals arrive time-sorted, so each route's list stays
+// time-sorted. The per-direction limit has already been applied, so it caps
+// the direction as a whole, not each route.
+func groupArrivalsByRoute(byDirection map[string][]transit.Arrival) map[string][]routeArrivals {
+	grouped := make(map[string][]routeArrivals, len(byDirection))
+	for direction, arrivals := range byDirection {
+		index := make(map[string]int)
+		routes := []routeArrivals{}
+		for _, arr := range arrivals {
+			i, ok := index[arr.Route]
+			if !ok {
+				i = len(routes)
+				index[arr.Route] = i
+				routes = append(routes, routeArrivals{Route: arr.Route})
+			}
+			routes[i].Arrivals = append(routes[i].Arrivals, arr)
+		}
+		slices.SortFunc(routes, func(a, b routeArrivals) int {
+			return strings.Compare(a.Route, b.Route)
 		})
+		grouped[direction] = routes
+	}
+	return grouped
+}
+
+// stationArrivals fetches both directions for a station with destinations
+// resolved to station names
+func (h *TransitHandler) stationArrivals(ctx context.Context, stopID string, opts transit.ArrivalOptions) (map[string][]transit.Arrival, error) {
+	arrivals, err := h.subway.GetArrivalsForStation(ctx, stopID, opts)
+	if err != nil {
+		return nil, err
+	}
+	h.resolveDestinations(arrivals["northbound"])
+	h.resolveDestinations(arrivals["southbound"])
+	return arrivals, nil
+}
+
+// stationArrivalOptions reads the per-direction limit for single-station
+// endpoints, where limit isn't already taken by a station count
+func stationArrivalOptions(r *http.Request) transit.ArrivalOptions {
+	return transit.ArrivalOptions{
+		PerDirection: parseIntQueryParam(r, "limit", transit.DefaultArrivalsPerDirection, 1, transit.MaxArrivalsPerDirection),
+		MinMinutes:   minMinutes(r),
+		TimeSource:   timeSource(r),
+	}
+}
+
+// GetSubwayFeed returns the raw GTFS-RT protobuf for a feed, served from cache
+func (h *TransitHandler) GetSubwayFeed(w http.ResponseWriter, r *http.Request) {
+	feedName := r.PathValue("feedName")
+
+	body, err := h.subway.GetFeedBytes(r.Context(), feedName)
+	if errors.Is(err, transit.ErrUnknownFeed) {
+		WriteError(w, http.StatusNotFound, CodeFeedNotFound, "Unknown feed "+feedName)
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, http.StatusBadGateway, "Failed to fetch feed", err)
 		return
 	}
 
-	zip, found := h.zipCodes.Get(zipCode)
-	if !found {
-		writeJSON(w, http.StatusNotFound, map[string]any{
-			"error":   "Zip code not found",
-			"message": "Zip code " + zipCode + " is not in our NYC database",
-		})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// GetSubwayArrivalsNearZip returns subway arrivals near a zip code
+func (h *TransitHandler) GetSubwayArrivalsNearZip(w http.ResponseWriter, r *http.Request) {
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
+		return
+	}
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	radius := parseIntQueryParam(r, "radius", defaultSubwayRadius, minSubwayRadius, maxSubwayRadius)
-	limit := parseIntQueryParam(r, "limit", defaultStationsLimit, 1, maxStationsLimit)
+	radius := parseIntQueryParam(r, "radius", h.limits.DefaultRadius, minSubwayRadius, h.limits.MaxRadius)
+	limit := parseIntQueryParam(r, "limit", h.limits.DefaultLimit, 1, h.limits.MaxLimit)
 
-	// Find nearby subway stations
-	nearbyStops := h.stops.FindNearby(zip.Lat, zip.Lng, float64(radius))
-	if len(nearbyStops) > limit {
-		nearbyStops = nearbyStops[:limit]
+	if wantsNDJSON(r) {
+		h.streamStations(w, r, h.nearbyStops(zip.Lat, zip.Lng, radius, limit), units)
+		return
 	}
 
-	if len(nearbyStops) == 0 {
+	budget := arrivalBudget{left: h.maxNear}
+	stationArrivals, err := h.nearStations(r, zip.Lat, zip.Lng, radius, limit, arrivalOptions(r), &budget)
+	if err != nil {
+		writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch subway arrivals", err)
+		return
+	}
+
+	if len(stationArrivals) == 0 {
 		writeJSON(w, http.StatusOK, map[string]any{
 			"success":       true,
-			"zip_code":      zipCode,
+			"zip_code":      zip.Code,
 			"location":      zip,
 			"radius_meters": radius,
 			"stations":      []any{},
@@ -105,83 +232,121 @@ func (h *TransitHandler) GetSubwayArrivalsNearZip(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Extract stop IDs for arrival lookup
-	stopIDs := make([]string, len(nearbyStops))
-	for i, stop := range nearbyStops {
-		stopIDs[i] = stop.ID
+	writeJSON(w, http.StatusOK, h.withFeedStatus(r.Context(), map[string]any{
+		"success":       true,
+		"zip_code":      zip.Code,
+		"location":      zip,
+		"radius_meters": radius,
+		"stations":      projectFields(projectUnits(stationArrivals, units), parseFields(r)),
+		"count":         len(stationArrivals),
+		"truncated":     budget.truncated,
+	}))
+}
+
+// getSubwayArrivalsNearZips serves ?zips=10001,11201: nearby stations and
+// arrivals for each zip, keyed by zip code. Zips are fetched one after another
+// so the second and later lookups are served from the feed cache rather than
+// downloading overlapping feeds again.
+func (h *TransitHandler) getSubwayArrivalsNearZips(w http.ResponseWriter, r *http.Request) {
+	var codes []string
+	for _, code := range strings.Split(r.URL.Query().Get("zips"), ",") {
+		if code = strings.TrimSpace(code); code != "" && !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "zips must list at least one zip code")
+		return
+	}
+	if len(codes) > maxZipsPerRequest {
+		WriteError(w, http.StatusBadRequest, CodeInvalidParameter, fmt.Sprintf("At most %d zip codes per request", maxZipsPerRequest))
+		return
 	}
 
-	// Fetch arrivals for all nearby stations
-	stationArrivals, err := h.subway.GetArrivalsForStations(stopIDs)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch subway arrivals",
-			"message": err.Error(),
-		})
+	zips := make([]models.ZipCode, len(codes))
+	for i, code := range codes {
+		if !isValidZip(code) {
+			WriteError(w, http.StatusBadRequest, CodeInvalidZip, "Zip code "+code+" must be exactly 5 digits")
+			return
+		}
+		zip, found := h.zipCodes.Get(code)
+		if !found {
+			WriteError(w, http.StatusNotFound, CodeZipNotFound, "Zip code "+code+" is not in our NYC database")
+			return
+		}
+		zips[i] = zip
+	}
+
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	// Enrich station arrivals with stop info
-	for i := range stationArrivals {
-		if i < len(nearbyStops) {
-			stationArrivals[i].StopName = nearbyStops[i].Name
-			stationArrivals[i].Lat = nearbyStops[i].Lat
-			stationArrivals[i].Lng = nearbyStops[i].Lng
-			stationArrivals[i].DistanceMeters = nearbyStops[i].DistanceMeters
-			stationArrivals[i].DistanceMiles = nearbyStops[i].DistanceMiles
+	radius := parseIntQueryParam(r, "radius", h.limits.DefaultRadius, minSubwayRadius, h.limits.MaxRadius)
+	limit := parseIntQueryParam(r, "limit", h.limits.DefaultLimit, 1, h.limits.MaxLimit)
+	opts := arrivalOptions(r)
+	fields := parseFields(r)
+	budget := arrivalBudget{left: h.maxNear} // shared by every zip
+
+	results := make(map[string]any, len(zips))
+	for _, zip := range zips {
+		stationArrivals, err := h.nearStations(r, zip.Lat, zip.Lng, radius, limit, opts, &budget)
+		if err != nil {
+			writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch subway arrivals", err)
+			return
+		}
+
+		results[zip.Code] = map[string]any{
+			"zip_code": zip.Code,
+			"location": zip,
+			"stations": projectFields(projectUnits(stationArrivals, units), fields),
+			"count":    len(stationArrivals),
 		}
 	}
-	h.resolveStationDestinations(stationArrivals)
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	writeJSON(w, http.StatusOK, h.withFeedStatus(r.Context(), map[string]any{
 		"success":       true,
-		"zip_code":      zipCode,
-		"location":      zip,
 		"radius_meters": radius,
-		"stations":      stationArrivals,
-		"count":         len(stationArrivals),
-	})
+		"results":       results,
+		"count":         len(results),
+		"truncated":     budget.truncated,
+	}))
 }
 
-// GetSubwayArrivalsNearCoords returns subway arrivals near lat/lng coordinates
+// GetSubwayArrivalsNearCoords returns subway arrivals near lat/lng coordinates,
+// or near each of several zip codes when ?zips= is given
 func (h *TransitHandler) GetSubwayArrivalsNearCoords(w http.ResponseWriter, r *http.Request) {
-	latStr := r.URL.Query().Get("lat")
-	lngStr := r.URL.Query().Get("lng")
-
-	if latStr == "" || lngStr == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "lat and lng query parameters are required",
-		})
+	if r.URL.Query().Has("zips") {
+		h.getSubwayArrivalsNearZips(w, r)
 		return
 	}
 
-	lat, err := strconv.ParseFloat(latStr, 64)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid lat parameter",
-		})
+	lat, lng, ok := parseCoords(w, r)
+	if !ok {
 		return
 	}
-
-	lng, err := strconv.ParseFloat(lngStr, 64)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid lng parameter",
-		})
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	radius := parseIntQueryParam(r, "radius", defaultSubwayRadius, minSubwayRadius, maxSubwayRadius)
-	limit := parseIntQueryParam(r, "limit", defaultStationsLimit, 1, maxStationsLimit)
+	radius := parseIntQueryParam(r, "radius", h.limits.DefaultRadius, minSubwayRadius, h.limits.MaxRadius)
+	limit := parseIntQueryParam(r, "limit", h.limits.DefaultLimit, 1, h.limits.MaxLimit)
 
-	// Find nearby subway stations
-	nearbyStops := h.stops.FindNearby(lat, lng, float64(radius))
-	if len(nearbyStops) > limit {
-		nearbyStops = nearbyStops[:limit]
+	if wantsNDJSON(r) {
+		h.streamStations(w, r, h.nearbyStops(lat, lng, radius, limit), units)
+		return
 	}
 
-	if len(nearbyStops) == 0 {
-		writeJSON(w, http.StatusOK, map[string]any{
+	budget := arrivalBudget{left: h.maxNear}
+	stationArrivals, err := h.nearStations(r, lat, lng, radius, limit, arrivalOptions(r), &budget)
+	if err != nil {
+		writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch subway arrivals", err)
+		return
+	}
+
+	if len(stationArrivals) == 0 {
+		writeJSON(w, http.StatusOK, h.withNearestZip(map[string]any{
 			"success":       true,
 			"lat":           lat,
 			"lng":           lng,
@@ -189,67 +354,156 @@ func (h *TransitHandler) GetSubwayArrivalsNearCoords(w http.ResponseWriter, r *h
 			"stations":      []any{},
 			"count":         0,
 			"message":       "No subway stations found within radius",
-		})
+		}, lat, lng, units))
 		return
 	}
 
-	// Extract stop IDs for arrival lookup
-	stopIDs := make([]string, len(nearbyStops))
-	for i, stop := range nearbyStops {
-		stopIDs[i] = stop.ID
+	writeJSON(w, http.StatusOK, h.withFeedStatus(r.Context(), h.withNearestZip(map[string]any{
+		"success":       true,
+		"lat":           lat,
+		"lng":           lng,
+		"radius_meters": radius,
+		"stations":      projectFields(projectUnits(stationArrivals, units), parseFields(r)),
+		"count":         len(stationArrivals),
+		"truncated":     budget.truncated,
+	}, lat, lng, units)))
+}
+
+// GetNearestStationByZip returns live arrivals for the single closest station to a zip code
+func (h *TransitHandler) GetNearestStationByZip(w http.ResponseWriter, r *http.Request) {
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
+		return
+	}
+	units, ok := parseUnits(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeNearestStation(w, r, zip.Lat, zip.Lng, units, map[string]any{
+		"zip_code": zip.Code,
+		"location": zip,
+	})
+}
+
+// GetNearestStationByCoords returns live arrivals for the single closest station to lat/lng
+func (h *TransitHandler) GetNearestStationByCoords(w http.ResponseWriter, r *http.Request) {
+	lat, lng, ok := parseCoords(w, r)
+	if !ok {
+		return
+	}
+	units, ok := parseUnits(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeNearestStation(w, r, lat, lng, units, h.withNearestZip(map[string]any{
+		"lat": lat,
+		"lng": lng,
+	}, lat, lng, units))
+}
+
+// writeNearestStation finds the closest parent station within the requested
+// radius and writes its arrivals, merged with the caller's location fields
+func (h *TransitHandler) writeNearestStation(w http.ResponseWriter, r *http.Request, lat, lng float64, units string, response map[string]any) {
+	radius := parseIntQueryParam(r, "radius", h.limits.MaxRadius, minSubwayRadius, h.limits.MaxRadius)
+
+	nearbyStops := h.stops.FindNearby(lat, lng, float64(radius))
+	if len(nearbyStops) == 0 {
+		WriteError(w, http.StatusNotFound, CodeStationNotFound, "No subway station within "+strconv.Itoa(radius)+" meters")
+		return
 	}
+	nearest := nearbyStops[0]
 
-	// Fetch arrivals for all nearby stations
-	stationArrivals, err := h.subway.GetArrivalsForStations(stopIDs)
+	opts := arrivalOptions(r)
+	opts.MergedStations = mergedStations(nearbyStops[:1])
+	stationArrivals, err := h.subway.GetArrivalsForStations(r.Context(), []string{nearest.ID}, opts)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch subway arrivals",
-			"message": err.Error(),
-		})
+		writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch subway arrivals", err)
 		return
 	}
 
-	// Enrich station arrivals with stop info
-	for i := range stationArrivals {
-		if i < len(nearbyStops) {
-			stationArrivals[i].StopName = nearbyStops[i].Name
-			stationArrivals[i].Lat = nearbyStops[i].Lat
-			stationArrivals[i].Lng = nearbyStops[i].Lng
-			stationArrivals[i].DistanceMeters = nearbyStops[i].DistanceMeters
-			stationArrivals[i].DistanceMiles = nearbyStops[i].DistanceMiles
+	station := transit.StationArrivals{StopID: nearest.ID}
+	if len(stationArrivals) > 0 {
+		station = stationArrivals[0]
+	}
+	h.enrichStation(&station, nearest)
+
+	response["success"] = true
+	response["radius_meters"] = radius
+	response["station"] = projectFields(projectUnits(station, units), parseFields(r))
+	writeJSON(w, http.StatusOK, h.withFeedStatus(r.Context(), response))
+}
+
+// GetSubwayStopsInBounds returns parent stations inside a map viewport
+func (h *TransitHandler) GetSubwayStopsInBounds(w http.ResponseWriter, r *http.Request) {
+	names := []string{"minLat", "minLng", "maxLat", "maxLng"}
+	values := make([]float64, len(names))
+	for i, name := range names {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			WriteError(w, http.StatusBadRequest, CodeMissingParameter, "minLat, minLng, maxLat and maxLng query parameters are required")
+			return
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, CodeInvalidCoordinates, "Invalid "+name+" parameter")
+			return
 		}
+		values[i] = v
+	}
+	minLat, minLng, maxLat, maxLng := values[0], values[1], values[2], values[3]
+
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 {
+		WriteError(w, http.StatusBadRequest, CodeInvalidCoordinates, "Bounds must be valid latitudes and longitudes")
+		return
+	}
+	if minLat >= maxLat || minLng >= maxLng {
+		WriteError(w, http.StatusBadRequest, CodeInvalidBounds, "minLat and minLng must be less than maxLat and maxLng")
+		return
+	}
+	if (maxLat-minLat)*(maxLng-minLng) > maxBoundsArea {
+		WriteError(w, http.StatusBadRequest, CodeInvalidBounds, "Bounding box is too large; zoom in and try again")
+		return
+	}
+
+	stops := h.stops.FindInBounds(minLat, minLng, maxLat, maxLng)
+	stopsResponse := make([]transit.SubwayStop, 0, len(stops))
+	for _, stop := range stops {
+		stopsResponse = append(stopsResponse, transit.SubwayStop{
+			ID:   stop.ID,
+			Name: stop.Name,
+			Lat:  stop.Lat,
+			Lng:  stop.Lng,
+		})
 	}
-	h.resolveStationDestinations(stationArrivals)
 
 	writeJSON(w, http.StatusOK, map[string]any{
-		"success":       true,
-		"lat":           lat,
-		"lng":           lng,
-		"radius_meters": radius,
-		"stations":      stationArrivals,
-		"count":         len(stationArrivals),
+		"success": true,
+		"bounds": map[string]float64{
+			"min_lat": minLat,
+			"min_lng": minLng,
+			"max_lat": maxLat,
+			"max_lng": maxLng,
+		},
+		"stops": stopsResponse,
+		"count": len(stopsResponse),
 	})
 }
 
 // GetSubwayStopsNear returns subway stops near a zip code
 func (h *TransitHandler) GetSubwayStopsNear(w http.ResponseWriter, r *http.Request) {
-	zipCode := r.PathValue("zipcode")
-	if len(zipCode) != 5 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid zip code format",
-		})
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
 		return
 	}
 
-	zip, found := h.zipCodes.Get(zipCode)
-	if !found {
-		writeJSON(w, http.StatusNotFound, map[string]any{
-			"error": "Zip code not found",
-		})
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	radius := parseIntQueryParam(r, "radius", defaultSubwayRadius, minSubwayRadius, maxSubwayRadius)
+	radius := parseIntQueryParam(r, "radius", h.limits.DefaultRadius, minSubwayRadius, h.limits.MaxRadius)
 	stops := h.stops.FindNearby(zip.Lat, zip.Lng, float64(radius))
 
 	// Convert to simpler response format
@@ -262,15 +516,16 @@ func (h *TransitHandler) GetSubwayStopsNear(w http.ResponseWriter, r *http.Reque
 			Lng:            stop.Lng,
 			DistanceMeters: stop.DistanceMeters,
 			DistanceMiles:  stop.DistanceMiles,
+			Direction:      stop.Direction,
 		})
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":       true,
-		"zip_code":      zipCode,
+		"zip_code":      zip.Code,
 		"location":      zip,
 		"radius_meters": radius,
-		"stops":         stopsResponse,
+		"stops":         projectUnits(stopsResponse, units),
 		"count":         len(stopsResponse),
 	})
 }
@@ -278,146 +533,134 @@ func (h *TransitHandler) GetSubwayStopsNear(w http.ResponseWriter, r *http.Reque
 // GetBusArrivalsNearZip returns bus arrivals near a zip code
 func (h *TransitHandler) GetBusArrivalsNearZip(w http.ResponseWriter, r *http.Request) {
 	if !h.bus.HasAPIKey() {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
-			"error":   "Bus service unavailable",
-			"message": "MTA_BUS_API_KEY not configured",
-		})
-		return
-	}
-
-	zipCode := r.PathValue("zipcode")
-	if len(zipCode) != 5 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid zip code format",
-		})
+		WriteError(w, http.StatusServiceUnavailable, CodeServiceUnavailable, "MTA_BUS_API_KEY not configured")
 		return
 	}
 
-	zip, found := h.zipCodes.Get(zipCode)
-	if !found {
-		writeJSON(w, http.StatusNotFound, map[string]any{
-			"error":   "Zip code not found",
-			"message": "Zip code " + zipCode + " is not in our NYC database",
-		})
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
 		return
 	}
 
-	radius := parseIntQueryParam(r, "radius", 400, 100, maxSubwayRadius)
-	limit := parseIntQueryParam(r, "limit", transit.DefaultBusLimit, 1, transit.MaxBusStops)
-	arrivals, err := h.bus.GetArrivalsNear(zip.Lat, zip.Lng, radius, limit)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch bus arrivals",
-			"message": err.Error(),
-		})
+	radius := parseIntQueryParam(r, "radius", h.busSearch.DefaultRadius, minBusRadius, h.busSearch.MaxRadius)
+	stopLimit, arrivalLimit := h.busLimits(r)
+	nearby, ok := h.busArrivalsNear(w, r, zip.Lat, zip.Lng, radius, stopLimit, arrivalLimit)
+	if !ok {
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":       true,
-		"zip_code":      zipCode,
+		"zip_code":      zip.Code,
 		"location":      zip,
 		"radius_meters": radius,
-		"arrivals":      arrivals,
-		"count":         len(arrivals),
+		"arrivals":      nearby.Arrivals,
+		"count":         len(nearby.Arrivals),
+		"partial":       nearby.Partial(),
+		"failed_stops":  nearby.StopsFailed,
 	})
 }
 
 // GetBusArrivalsNearCoords returns bus arrivals near lat/lng coordinates
 func (h *TransitHandler) GetBusArrivalsNearCoords(w http.ResponseWriter, r *http.Request) {
 	if !h.bus.HasAPIKey() {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
-			"error":   "Bus service unavailable",
-			"message": "MTA_BUS_API_KEY not configured",
-		})
+		WriteError(w, http.StatusServiceUnavailable, CodeServiceUnavailable, "MTA_BUS_API_KEY not configured")
 		return
 	}
 
-	latStr := r.URL.Query().Get("lat")
-	lngStr := r.URL.Query().Get("lng")
-
-	if latStr == "" || lngStr == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "lat and lng query parameters are required",
-		})
+	lat, lng, ok := parseCoords(w, r)
+	if !ok {
 		return
 	}
-
-	lat, err := strconv.ParseFloat(latStr, 64)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid lat parameter",
-		})
+	units, ok := parseUnits(w, r)
+	if !ok {
 		return
 	}
 
-	lng, err := strconv.ParseFloat(lngStr, 64)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid lng parameter",
-		})
-		return
-	}
-
-	radius := parseIntQueryParam(r, "radius", 400, 100, maxSubwayRadius)
-	limit := parseIntQueryParam(r, "limit", transit.DefaultBusLimit, 1, transit.MaxBusStops)
-	arrivals, err := h.bus.GetArrivalsNear(lat, lng, radius, limit)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch bus arrivals",
-			"message": err.Error(),
-		})
+	radius := parseIntQueryParam(r, "radius", h.busSearch.DefaultRadius, minBusRadius, h.busSearch.MaxRadius)
+	stopLimit, arrivalLimit := h.busLimits(r)
+	nearby, ok := h.busArrivalsNear(w, r, lat, lng, radius, stopLimit, arrivalLimit)
+	if !ok {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	writeJSON(w, http.StatusOK, h.withNearestZip(map[string]any{
 		"success":       true,
 		"lat":           lat,
 		"lng":           lng,
 		"radius_meters": radius,
-		"arrivals":      arrivals,
-		"count":         len(arrivals),
-	})
+		"arrivals":      nearby.Arrivals,
+		"count":         len(nearby.Arrivals),
+		"partial":       nearby.Partial(),
+		"failed_stops":  nearby.StopsFailed,
+	}, lat, lng, units))
+}
+
+// busArrivalsNear fetches merged bus arrivals, writing an error response and
+// returning false on failure. When every stop's fetch failed the upstream is
+// effectively down, so that's a 502 rather than an empty success.
+func (h *TransitHandler) busArrivalsNear(w http.ResponseWriter, r *http.Request, lat, lng float64, radius, stopLimit, arrivalLimit int) (transit.NearbyBusArrivals, bool) {
+	nearby, err := h.bus.GetArrivalsNear(r.Context(), lat, lng, radius, stopLimit, arrivalLimit, minMinutes(r))
+	if errors.Is(err, transit.ErrAllStopsFailed) {
+		writeBusError(w, http.StatusBadGateway, "Failed to fetch bus arrivals for any nearby stop", err)
+		return nearby, false
+	}
+	if err != nil {
+		writeBusError(w, http.StatusInternalServerError, "Failed to fetch bus arrivals", err)
+		return nearby, false
+	}
+	return nearby, true
+}
+
+// writeBusError reports a failed Bus Time call. A rejected key is a
+// misconfiguration rather than an outage, so it's a 503 pointing at the
+// setting (without echoing upstream detail); transient Bus Time failures are
+// a 502. Anything else gets status.
+func writeBusError(w http.ResponseWriter, status int, message string, err error) {
+	switch {
+	case errors.Is(err, transit.ErrBusAuth):
+		WriteError(w, http.StatusServiceUnavailable, CodeServiceUnavailable,
+			"Bus service misconfigured: Bus Time rejected the API key; check MTA_BUS_API_KEY")
+	case errors.Is(err, transit.ErrBusUnavailable):
+		writeUpstreamError(w, http.StatusBadGateway, message, err)
+	default:
+		writeUpstreamError(w, status, message, err)
+	}
 }
 
 // GetBusStopsNear returns bus stops near a location
 func (h *TransitHandler) GetBusStopsNear(w http.ResponseWriter, r *http.Request) {
 	if !h.bus.HasAPIKey() {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
-			"error": "Bus service unavailable",
-		})
+		WriteError(w, http.StatusServiceUnavailable, CodeServiceUnavailable, "Bus service unavailable")
 		return
 	}
 
-	zipCode := r.PathValue("zipcode")
-	if len(zipCode) != 5 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "Invalid zip code format",
-		})
+	zip, ok := resolveZip(w, r, h.zipCodes)
+	if !ok {
 		return
 	}
 
-	zip, found := h.zipCodes.Get(zipCode)
-	if !found {
-		writeJSON(w, http.StatusNotFound, map[string]any{
-			"error": "Zip code not found",
-		})
+	radius := parseIntQueryParam(r, "radius", h.busSearch.DefaultRadius, minBusRadius, h.busSearch.MaxRadius)
+	stops, err := h.bus.FindStopsNear(r.Context(), zip.Lat, zip.Lng, radius)
+	if err != nil {
+		writeBusError(w, http.StatusInternalServerError, "Failed to find bus stops", err)
 		return
 	}
 
-	radius := parseIntQueryParam(r, "radius", 400, 100, maxSubwayRadius)
-	stops, err := h.bus.FindStopsNear(zip.Lat, zip.Lng, radius)
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to find bus stops",
-			"message": err.Error(),
-		})
-		return
+	// ?route=M34 keeps only the stops that route serves
+	if route := strings.TrimSpace(r.URL.Query().Get("route")); route != "" {
+		served := []transit.BusStop{}
+		for _, stop := range stops {
+			if stop.Serves(route) {
+				served = append(served, stop)
+			}
+		}
+		stops = served
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":       true,
-		"zip_code":      zipCode,
+		"zip_code":      zip.Code,
 		"location":      zip,
 		"radius_meters": radius,
 		"stops":         stops,
@@ -425,7 +668,8 @@ func (h *TransitHandler) GetBusStopsNear(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// GetServiceAlerts returns active service alerts, optionally filtered by route
+// GetServiceAlerts returns active service alerts, optionally filtered by
+// route, severity, and station
 func (h *TransitHandler) GetServiceAlerts(w http.ResponseWriter, r *http.Request) {
 	routesParam := r.URL.Query().Get("routes")
 	var routes []string
@@ -433,15 +677,48 @@ func (h *TransitHandler) GetServiceAlerts(w http.ResponseWriter, r *http.Request
 		routes = strings.Split(routesParam, ",")
 	}
 
-	alerts, err := h.alerts.GetAlerts(routes)
+	// ?match_base=true lets "6" match alerts for the 6 express (6X) and back
+	opts := transit.AlertOptions{MatchBaseRoute: r.URL.Query().Get("match_base") == "true"}
+
+	// ?active=upcoming or all widens the default of alerts in effect now
+	if active := strings.ToLower(r.URL.Query().Get("active")); active != "" {
+		if !transit.ValidAlertActivity(active) {
+			WriteError(w, http.StatusBadRequest, CodeInvalidParameter, "active must be now, upcoming or all")
+			return
+		}
+		opts.Active = active
+	}
+
+	alerts, err := h.alerts.GetAlerts(r.Context(), routes, opts)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch service alerts",
-			"message": err.Error(),
-		})
+		writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch service alerts", err)
 		return
 	}
 
+	// Optional ?severity=severe,warning filter
+	if severityParam := r.URL.Query().Get("severity"); severityParam != "" {
+		wanted := make(map[string]bool)
+		for _, s := range strings.Split(severityParam, ",") {
+			wanted[strings.ToLower(strings.TrimSpace(s))] = true
+		}
+		alerts = filterAlerts(alerts, func(a transit.ServiceAlert) bool {
+			return wanted[a.Severity]
+		})
+	}
+
+	// Optional ?stop=127 filter, matching the station and any of its platforms
+	if stopParam := strings.TrimSpace(r.URL.Query().Get("stop")); stopParam != "" {
+		related := h.relatedStopIDs(stopParam)
+		alerts = filterAlerts(alerts, func(a transit.ServiceAlert) bool {
+			for _, id := range a.Stops {
+				if related[id] {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success": true,
 		"alerts":  alerts,
@@ -449,27 +726,170 @@ func (h *TransitHandler) GetServiceAlerts(w http.ResponseWriter, r *http.Request
 	})
 }
 
+func (h *TransitHandler) hasStop(id string) bool {
+	_, ok := h.stops.GetByID(id)
+	return ok
+}
+
+func filterAlerts(alerts []transit.ServiceAlert, keep func(transit.ServiceAlert) bool) []transit.ServiceAlert {
+	filtered := make([]transit.ServiceAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		if keep(alert) {
+			filtered = append(filtered, alert)
+		}
+	}
+	return filtered
+}
+
+// relatedStopIDs normalizes a base or platform stop ID to its station and
+// returns the station plus all of its child stop IDs
+func (h *TransitHandler) relatedStopIDs(stopID string) map[string]bool {
+	station := stopID
+	if stop, ok := h.stops.GetByID(stopID); ok && stop.ParentStation != "" {
+		station = stop.ParentStation
+	} else if !ok && len(stopID) > 1 && strings.ContainsAny(stopID[len(stopID)-1:], "NS") {
+		// Unknown platform ID: fall back to stripping the direction suffix
+		if base := stopID[:len(stopID)-1]; h.hasStop(base) {
+			station = base
+		}
+	}
+
+	related := map[string]bool{station: true, stopID: true}
+	for _, id := range h.stops.PlatformIDs(station) {
+		related[id] = true
+	}
+	return related
+}
+
+// GetSubwayRoutes lists subway routes with their colors and feed groups
+func (h *TransitHandler) GetSubwayRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := transit.Routes()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"routes":  routes,
+		"count":   len(routes),
+	})
+}
+
 // GetSubwayArrivalsForStops returns arrivals for specific station IDs (used by favorites)
 func (h *TransitHandler) GetSubwayArrivalsForStops(w http.ResponseWriter, r *http.Request) {
 	stopsParam := r.URL.Query().Get("stops")
 	if stopsParam == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "stops query parameter is required (comma-separated stop IDs)",
-		})
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "stops query parameter is required (comma-separated stop IDs)")
+		return
+	}
+
+	stopIDs := uniqueStopIDs(strings.Split(stopsParam, ","))
+	if len(stopIDs) == 0 {
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "stops query parameter is required (comma-separated stop IDs)")
+		return
+	}
+	if len(stopIDs) > h.limits.MaxLimit {
+		stopIDs = stopIDs[:h.limits.MaxLimit]
+	}
+
+	h.writeStationsArrivals(w, r, stopIDs)
+}
+
+// uniqueStopIDs trims each ID and drops blanks and repeats, keeping the first
+// occurrence's position
+func uniqueStopIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// stationsRequest is the body of POST /transit/subway/arrivals
+type stationsRequest struct {
+	Stops []string `json:"stops"`
+}
+
+// PostSubwayArrivalsForStops is the bulk form of GetSubwayArrivalsForStops
+// for longer favorites lists: stops come in a JSON body, up to
+// transit.MaxBulkStations of them, and every ID must be a known stop. Query
+// parameters work as they do for the GET.
+func (h *TransitHandler) PostSubwayArrivalsForStops(w http.ResponseWriter, r *http.Request) {
+	var req stationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large")
+			return
+		}
+		WriteError(w, http.StatusBadRequest, CodeInvalidParameter, `Request body must be JSON like {"stops": ["127", "631"]}`)
+		return
+	}
+	req.Stops = uniqueStopIDs(req.Stops)
+	if len(req.Stops) == 0 {
+		WriteError(w, http.StatusBadRequest, CodeMissingParameter, "stops is required (a list of station IDs)")
+		return
+	}
+	if len(req.Stops) > transit.MaxBulkStations {
+		WriteError(w, http.StatusBadRequest, CodeInvalidParameter,
+			fmt.Sprintf("At most %d stops per request, got %d", transit.MaxBulkStations, len(req.Stops)))
 		return
 	}
 
-	stopIDs := strings.Split(stopsParam, ",")
-	if len(stopIDs) > maxStationsLimit {
-		stopIDs = stopIDs[:maxStationsLimit]
+	var unknown []string
+	for _, id := range req.Stops {
+		if _, ok := h.stops.GetByID(id); !ok {
+			unknown = append(unknown, strconv.Quote(id))
+		}
+	}
+	if len(unknown) > 0 {
+		WriteError(w, http.StatusBadRequest, CodeInvalidParameter, "Unknown stop IDs: "+strings.Join(unknown, ", "))
+		return
 	}
 
-	stationArrivals, err := h.subway.GetArrivalsForStations(stopIDs)
+	h.writeStationsArrivals(w, r, req.Stops)
+}
+
+// writeStationsArrivals writes arrivals for the given stations, named and
+// with destinations resolved, in the order given
+func (h *TransitHandler) writeStationsArrivals(w http.ResponseWriter, r *http.Request, stopIDs []string) {
+	stationArrivals, err := h.subway.GetArrivalsForStations(r.Context(), stopIDs, arrivalOptions(r))
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error":   "Failed to fetch arrivals",
-			"message": err.Error(),
-		})
+		writeUpstreamError(w, http.StatusInternalServerError, "Failed to fetch arrivals", err)
+		return
+	}
+
+	for i := range stationArrivals {
+		if stop, ok := h.stops.GetByID(stationArrivals[i].StopID); ok {
+			stationArrivals[i].StopName = stop.Name
+			stationArrivals[i].Lat = stop.Lat
+			stationArrivals[i].Lng = stop.Lng
+		}
+	}
+	h.resolveStationDestinations(stationArrivals)
+
+	writeJSON(w, http.StatusOK, h.withFeedStatus(r.Context(), map[string]any{
+		"success":  true,
+		"stations": projectFields(stationArrivals, parseFields(r)),
+		"count":    len(stationArrivals),
+	}))
+}
+
+// GetSubwayRouteArrivals returns upcoming arrivals for one line system-wide,
+// grouped by station and ordered by the soonest train
+func (h *TransitHandler) GetSubwayRouteArrivals(w http.ResponseWriter, r *http.Request) {
+	route := strings.ToUpper(r.PathValue("route"))
+	limit := parseIntQueryParam(r, "limit", transit.DefaultRouteStops, 1, transit.MaxRouteStops)
+
+	stationArrivals, err := h.subway.GetArrivalsForRoute(r.Context(), route, limit, arrivalOptions(r))
+	if errors.Is(err, transit.ErrUnknownRoute) {
+		WriteError(w, http.StatusNotFound, CodeRouteNotFound, "Unknown subway route "+route)
+		return
+	}
+	if err != nil {
+		writeUpstreamError(w, http.StatusBadGateway, "Failed to fetch route arrivals", err)
 		return
 	}
 
@@ -484,23 +904,27 @@ func (h *TransitHandler) GetSubwayArrivalsForStops(w http.ResponseWriter, r *htt
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"success":  true,
-		"stations": stationArrivals,
+		"route":    route,
+		"stations": projectFields(stationArrivals, parseFields(r)),
 		"count":    len(stationArrivals),
 	})
 }
 
+// resolveDestinations replaces each arrival's Destination with the terminus
+// name and borough, looked up from DestinationID, which is left as is for
+// clients that need the stop ID
 func (h *TransitHandler) resolveDestinations(arrivals []transit.Arrival) {
 	for i := range arrivals {
-		if arrivals[i].Destination == "" {
+		if arrivals[i].DestinationID == "" {
 			continue
 		}
-		stop, ok := h.stops.GetByID(arrivals[i].Destination)
+		stop, ok := h.stops.GetByID(arrivals[i].DestinationID)
 		if !ok {
 			continue
 		}
 		name := stop.Name
-		if zip, found := h.zipCodes.FindNearest(stop.Lat, stop.Lng); found && zip.Borough != "" {
-			name += " (" + zip.Borough + ")"
+		if borough, found := h.zipCodes.Borough(stop.Lat, stop.Lng); found {
+			name += " (" + borough + ")"
 		}
 		arrivals[i].Destination = name
 	}
@@ -513,6 +937,186 @@ func (h *TransitHandler) resolveStationDestinations(stations []transit.StationAr
 	}
 }
 
+// withFeedStatus flags a subway response as incomplete when feeds failed
+// during the request: station lookups skip those feeds, so some lines' trains
+// are missing. Complete responses are left as they are.
+func (h *TransitHandler) withFeedStatus(ctx context.Context, response map[string]any) map[string]any {
+	reporter, ok := h.subway.(FeedFailureReporter)
+	if !ok {
+		return response
+	}
+	if failed := reporter.FailedFeeds(ctx); len(failed) > 0 {
+		response["feeds_degraded"] = true
+		response["failed_feeds"] = failed
+	}
+	return response
+}
+
+// nearbyStops returns up to limit parent stations within radius of lat/lng,
+// nearest first
+func (h *TransitHandler) nearbyStops(lat, lng float64, radius, limit int) []models.StopWithDistance {
+	stops := h.stops.FindNearby(lat, lng, float64(radius))
+	if len(stops) > limit {
+		stops = stops[:limit]
+	}
+	return stops
+}
+
+// nearStations fetches arrivals for the stations nearbyStops finds, enriched
+// with stop info and ?catchable= applied, then spends budget across them. No
+// stations in range is an empty slice without an upstream call.
+func (h *TransitHandler) nearStations(r *http.Request, lat, lng float64, radius, limit int, opts transit.ArrivalOptions, budget *arrivalBudget) ([]transit.StationArrivals, error) {
+	nearbyStops := h.nearbyStops(lat, lng, radius, limit)
+	if len(nearbyStops) == 0 {
+		return []transit.StationArrivals{}, nil
+	}
+
+	// Extract stop IDs for arrival lookup
+	stopIDs := make([]string, len(nearbyStops))
+	for i, stop := range nearbyStops {
+		stopIDs[i] = stop.ID
+	}
+
+	opts.MergedStations = mergedStations(nearbyStops)
+	catch := parseCatchable(r, &opts)
+	stationArrivals, err := h.subway.GetArrivalsForStations(r.Context(), stopIDs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enrich station arrivals with stop info
+	for i := range stationArrivals {
+		if i < len(nearbyStops) {
+			h.enrichStation(&stationArrivals[i], nearbyStops[i])
+			catch.apply(&stationArrivals[i], nearbyStops[i])
+		}
+	}
+	budget.apply(stationArrivals)
+	return stationArrivals, nil
+}
+
+// withNearestZip adds a best-effort nearest_zip object to a coordinate-based
+// response so clients know which zip they're effectively in. It is left out
+// when no zip codes are loaded. Its distances follow ?units= like a station's.
+func (h *TransitHandler) withNearestZip(response map[string]any, lat, lng float64, units string) map[string]any {
+	zip, ok := h.zipCodes.FindNearest(lat, lng)
+	if !ok {
+		return response
+	}
+	meters := location.Haversine(lat, lng, zip.Lat, zip.Lng)
+	response["nearest_zip"] = projectUnits(map[string]any{
+		"code":            zip.Code,
+		"borough":         zip.Borough,
+		"distance_meters": meters,
+		"distance_miles":  location.MetersToMiles(meters),
+	}, units)
+	return response
+}
+
+// enrichStation copies stop location and distance onto a station's arrivals
+// and resolves destination names
+func (h *TransitHandler) enrichStation(station *transit.StationArrivals, stop models.StopWithDistance) {
+	station.StopName = stop.Name
+	station.Lat = stop.Lat
+	station.Lng = stop.Lng
+	station.DistanceMeters = stop.DistanceMeters
+	station.DistanceMiles = stop.DistanceMiles
+	station.Direction = stop.Direction
+	h.resolveDestinations(station.Northbound)
+	h.resolveDestinations(station.Southbound)
+}
+
+// arrivalOptions reads arrival tuning params for multi-station endpoints. The
+// per-direction cap is arrival_limit since limit already caps station count.
+func arrivalOptions(r *http.Request) transit.ArrivalOptions {
+	return transit.ArrivalOptions{
+		PerDirection: parseIntQueryParam(r, "arrival_limit", transit.DefaultArrivalsPerDirection, 1, transit.MaxArrivalsPerDirection),
+		MinMinutes:   minMinutes(r),
+		TimeSource:   timeSource(r),
+	}
+}
+
+// mergedStations collects the stations clustering folded into each stop, so
+// their trains are still listed under the station that was kept
+func mergedStations(stops []models.StopWithDistance) map[string][]string {
+	var merged map[string][]string
+	for _, stop := range stops {
+		if len(stop.MergedIDs) == 0 {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string][]string)
+		}
+		merged[stop.ID] = stop.MergedIDs
+	}
+	return merged
+}
+
+// timeSource reads ?time_source=, which stop time subway arrivals show.
+// Unknown values are ignored in favor of the server's default.
+func timeSource(r *http.Request) string {
+	if source := strings.ToLower(r.URL.Query().Get("time_source")); transit.ValidTimeSource(source) {
+		return source
+	}
+	return ""
+}
+
+// minMinutes reads ?min_minutes=, the soonest arrival worth showing. Trains
+// or buses closer than that can't be caught, so they're dropped.
+func minMinutes(r *http.Request) int {
+	return parseIntQueryParam(r, "min_minutes", 0, 0, maxMinMinutes)
+}
+
+// catchFilter implements ?catchable=true on the nearby-arrivals endpoints:
+// each station gets a walk time from the search point, and trains that
+// arrive before the rider could walk there are dropped
+type catchFilter struct {
+	perDirection int // the requested cap, applied after filtering
+}
+
+// parseCatchable returns nil unless ?catchable=true. Filtering can remove
+// the soonest arrivals, so it widens opts to fetch as many as allowed and
+// the filter trims back to the requested cap.
+func parseCatchable(r *http.Request, opts *transit.ArrivalOptions) *catchFilter {
+	if r.URL.Query().Get("catchable") != "true" {
+		return nil
+	}
+	f := &catchFilter{perDirection: opts.PerDirection}
+	opts.PerDirection = transit.MaxArrivalsPerDirection
+	return f
+}
+
+// apply sets the station's walk time from stop's distance and keeps only the
+// arrivals the rider can reach. A nil filter does nothing.
+func (f *catchFilter) apply(station *transit.StationArrivals, stop models.StopWithDistance) {
+	if f == nil {
+		return
+	}
+	walk := location.WalkMinutes(stop.DistanceMeters)
+	station.WalkMinutes = walk
+	station.Northbound = catchableArrivals(station.Northbound, walk, f.perDirection)
+	station.Southbound = catchableArrivals(station.Southbound, walk, f.perDirection)
+}
+
+// catchableArrivals returns up to limit arrivals more than walk minutes away
+func catchableArrivals(arrivals []transit.Arrival, walk, limit int) []transit.Arrival {
+	kept := []transit.Arrival{}
+	for _, arr := range arrivals {
+		if arr.MinutesAway > walk && len(kept) < limit {
+			kept = append(kept, arr)
+		}
+	}
+	return kept
+}
+
+// busLimits reads the two bus caps: limit is how many nearby stops to query,
+// arrival_limit is how many arrivals to return across all of them.
+func (h *TransitHandler) busLimits(r *http.Request) (stopLimit, arrivalLimit int) {
+	stopLimit = parseIntQueryParam(r, "limit", min(transit.DefaultBusLimit, h.busMaxStops), 1, h.busMaxStops)
+	arrivalLimit = parseIntQueryParam(r, "arrival_limit", transit.DefaultBusArrivals, 1, transit.MaxBusArrivals)
+	return stopLimit, arrivalLimit
+}
+
 func parseIntQueryParam(r *http.Request, name string, defaultVal, min, max int) int {
 	str := r.URL.Query().Get(name)
 	if str == "" {
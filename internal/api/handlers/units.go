@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Unit systems accepted by the ?units= query parameter. The empty value keeps
+// the default response shape with both meters and miles.
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+)
+
+// parseUnits reads the ?units= query parameter. A missing value selects the
+// default shape; anything other than metric or imperial writes a 400 and
+// returns false.
+func parseUnits(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch units := strings.ToLower(r.URL.Query().Get("units")); units {
+	case "", unitsMetric, unitsImperial:
+		return units, true
+	default:
+		WriteError(w, http.StatusBadRequest, CodeInvalidParameter, "units must be metric or imperial")
+		return "", false
+	}
+}
+
+// projectUnits rewrites the distance fields of v, at any depth, for a unit
+// system: metric swaps distance_miles for distance_km and imperial drops
+// distance_meters. Objects without a distance_meters field are left alone,
+// and the default units return v unchanged.
+func projectUnits(v any, units string) any {
+	if units == "" {
+		return v
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+	convertUnits(decoded, units)
+	return decoded
+}
+
+func convertUnits(v any, units string) {
+	switch val := v.(type) {
+	case map[string]any:
+		if meters, ok := val["distance_meters"].(float64); ok {
+			switch units {
+			case unitsMetric:
+				val["distance_km"] = meters / 1000
+				delete(val, "distance_miles")
+			case unitsImperial:
+				delete(val, "distance_meters")
+			}
+		}
+		for _, child := range val {
+			convertUnits(child, units)
+		}
+	case []any:
+		for _, item := range val {
+			convertUnits(item, units)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/randytsao24/emteeayy/internal/location"
+	"github.com/randytsao24/emteeayy/internal/models"
+)
+
+// isValidZip reports whether s is a five-digit US zip code
+func isValidZip(s string) bool {
+	if len(s) != 5 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveZip validates the {zipcode} path value and looks it up. On failure it
+// writes a 400 or 404 error and returns ok=false.
+func resolveZip(w http.ResponseWriter, r *http.Request, zips *location.ZipCodeService) (models.ZipCode, bool) {
+	zipCode := r.PathValue("zipcode")
+	if !isValidZip(zipCode) {
+		WriteError(w, http.StatusBadRequest, CodeInvalidZip, "Zip code must be exactly 5 digits")
+		return models.ZipCode{}, false
+	}
+
+	zip, found := zips.Get(zipCode)
+	if !found {
+		WriteError(w, http.StatusNotFound, CodeZipNotFound, "Zip code "+zipCode+" is not in our NYC database")
+		return models.ZipCode{}, false
+	}
+	return zip, true
+}
@@ -1,13 +1,25 @@
 package api_test
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/randytsao24/emteeayy/internal/api"
@@ -22,50 +34,177 @@ import (
 // ---------------------------------------------------------------------------
 
 type mockSubwayProvider struct {
-	arrivals []transit.Arrival
-	err      error
+	arrivals    []transit.Arrival
+	err         error
+	lastSuccess time.Time
+	panicMsg    string   // GetArrivalsForStation panics with this when set
+	cached      int      // entries reported and reset by FlushCache
+	upstreams   []string // reported by UpstreamURLs
+	failedFeeds []string // reported by FailedFeeds
+
+	// byStation, when set, replaces arrivals for GetArrivalsForStations: each
+	// station gets its own northbound trains plus those of stations merged into it
+	byStation map[string][]transit.Arrival
 }
 
-func (m *mockSubwayProvider) GetArrivalsForStation(stopID string) (map[string][]transit.Arrival, error) {
+func (m *mockSubwayProvider) LastSuccess() time.Time { return m.lastSuccess }
+
+func (m *mockSubwayProvider) UpstreamURLs() []string { return m.upstreams }
+
+func (m *mockSubwayProvider) FailedFeeds(ctx context.Context) []string { return m.failedFeeds }
+
+func (m *mockSubwayProvider) FlushCache() int {
+	n := m.cached
+	m.cached = 0
+	return n
+}
+
+func (m *mockSubwayProvider) GetArrivalsForStation(ctx context.Context, stopID string, opts transit.ArrivalOptions) (map[string][]transit.Arrival, error) {
+	if m.panicMsg != "" {
+		panic(m.panicMsg)
+	}
 	if m.err != nil {
 		return nil, m.err
 	}
 	return map[string][]transit.Arrival{
-		"northbound": m.arrivals,
-		"southbound": m.arrivals,
+		"northbound": m.limited(opts),
+		"southbound": m.limited(opts),
 	}, nil
 }
 
-func (m *mockSubwayProvider) GetArrivalsForStations(stopIDs []string) ([]transit.StationArrivals, error) {
+func (m *mockSubwayProvider) GetArrivalsForStations(ctx context.Context, stopIDs []string, opts transit.ArrivalOptions) ([]transit.StationArrivals, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
 	result := make([]transit.StationArrivals, len(stopIDs))
 	for i, id := range stopIDs {
+		if m.byStation != nil {
+			north := slices.Clone(m.byStation[id])
+			for _, merged := range opts.MergedStations[id] {
+				north = append(north, m.byStation[merged]...)
+			}
+			result[i] = transit.StationArrivals{StopID: id, Northbound: north}
+			continue
+		}
 		result[i] = transit.StationArrivals{
 			StopID:     id,
-			Northbound: m.arrivals,
-			Southbound: m.arrivals,
+			Northbound: m.limited(opts),
+			Southbound: m.limited(opts),
 		}
 	}
 	return result, nil
 }
 
+func (m *mockSubwayProvider) GetArrivalsForRoute(ctx context.Context, route string, stopLimit int, opts transit.ArrivalOptions) ([]transit.StationArrivals, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if route != "L" {
+		return nil, fmt.Errorf("%w: %s", transit.ErrUnknownRoute, route)
+	}
+	var arrivals []transit.Arrival
+	for _, arr := range m.limited(opts) {
+		if arr.Route == route {
+			arrivals = append(arrivals, arr)
+		}
+	}
+	return []transit.StationArrivals{{StopID: "L08", Northbound: arrivals}}, nil
+}
+
+func (m *mockSubwayProvider) GetFeedBytes(ctx context.Context, feedName string) ([]byte, error) {
+	if feedName != "ace" {
+		return nil, fmt.Errorf("%w: %s", transit.ErrUnknownFeed, feedName)
+	}
+	return []byte{0x0a, 0x03, 0x32, 0x2e, 0x30}, nil
+}
+
+// limited returns a copy of the mock arrivals trimmed like the real service
+func (m *mockSubwayProvider) limited(opts transit.ArrivalOptions) []transit.Arrival {
+	var arrivals []transit.Arrival
+	for _, arr := range m.arrivals {
+		if arr.MinutesAway >= opts.MinMinutes {
+			arrivals = append(arrivals, arr)
+		}
+	}
+	if opts.PerDirection > 0 && len(arrivals) > opts.PerDirection {
+		arrivals = arrivals[:opts.PerDirection]
+	}
+	return arrivals
+}
+
 type mockBusProvider struct {
-	hasKey   bool
-	stops    []transit.BusStop
-	arrivals []transit.BusArrival
-	err      error
+	hasKey      bool
+	stops       []transit.BusStop
+	arrivals    []transit.BusArrival
+	err         error
+	failedStops int // reported as failed out of len(stops) by GetArrivalsNear
+	lastLimit   int // the stop limit GetArrivalsNear was last called with
+	cached      int // entries reported and reset by FlushCache
+}
+
+func (m *mockBusProvider) FlushCache() int {
+	n := m.cached
+	m.cached = 0
+	return n
 }
 
 func (m *mockBusProvider) HasAPIKey() bool { return m.hasKey }
 
-func (m *mockBusProvider) FindStopsNear(lat, lng float64, radiusMeters int) ([]transit.BusStop, error) {
+func (m *mockBusProvider) FindStopsNear(ctx context.Context, lat, lng float64, radiusMeters int) ([]transit.BusStop, error) {
 	return m.stops, m.err
 }
 
-func (m *mockBusProvider) GetArrivalsNear(lat, lng float64, radiusMeters, limit int) ([]transit.BusArrival, error) {
-	return m.arrivals, m.err
+func (m *mockBusProvider) GetArrivalsNear(ctx context.Context, lat, lng float64, radiusMeters, limit, maxArrivals, minMinutes int) (transit.NearbyBusArrivals, error) {
+	m.lastLimit = limit
+	if m.err != nil {
+		return transit.NearbyBusArrivals{}, m.err
+	}
+	var arrivals []transit.BusArrival
+	for _, arr := range m.arrivals {
+		if arr.MinutesAway >= minMinutes {
+			arrivals = append(arrivals, arr)
+		}
+	}
+	if maxArrivals > 0 && len(arrivals) > maxArrivals {
+		arrivals = arrivals[:maxArrivals]
+	}
+	return transit.NearbyBusArrivals{Arrivals: arrivals, StopsQueried: len(m.stops), StopsFailed: m.failedStops}, nil
+}
+
+type mockAlertProvider struct {
+	alerts      []transit.ServiceAlert
+	err         error
+	lastSuccess time.Time
+	cached      int // entries reported and reset by FlushCache
+}
+
+func (m *mockAlertProvider) LastSuccess() time.Time { return m.lastSuccess }
+
+func (m *mockAlertProvider) FlushCache() int {
+	n := m.cached
+	m.cached = 0
+	return n
+}
+
+func (m *mockAlertProvider) GetAlerts(ctx context.Context, routes []string, opts transit.AlertOptions) ([]transit.ServiceAlert, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	alerts := transit.FilterAlertsByActivity(m.alerts, opts.Active, time.Now())
+	if len(routes) == 0 {
+		return alerts, nil
+	}
+	// Exact route matches are enough here; express variants are covered by
+	// the transit package's own tests
+	var filtered []transit.ServiceAlert
+	for _, a := range alerts {
+		if slices.ContainsFunc(a.Routes, func(r string) bool {
+			return slices.ContainsFunc(routes, func(want string) bool { return strings.EqualFold(r, want) })
+		}) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -83,21 +222,31 @@ func dataDir(t *testing.T) string {
 
 func newTestServer(t *testing.T, subway handlers.SubwayProvider, bus handlers.BusProvider) *httptest.Server {
 	t.Helper()
+	return newTestServerWithConfig(t, &config.Config{HTTPTimeout: 5 * time.Second}, subway, bus)
+}
+
+func newTestServerWithConfig(t *testing.T, cfg *config.Config, subway handlers.SubwayProvider, bus handlers.BusProvider) *httptest.Server {
+	t.Helper()
+	return newTestServerWithAlerts(t, cfg, subway, bus, &mockAlertProvider{})
+}
+
+func newTestServerWithAlerts(t *testing.T, cfg *config.Config, subway handlers.SubwayProvider, bus handlers.BusProvider, alerts handlers.AlertProvider) *httptest.Server {
+	t.Helper()
 
 	dir := dataDir(t)
 
 	zipSvc := location.NewZipCodeService()
+	t.Cleanup(zipSvc.Close)
 	if err := zipSvc.Load(filepath.Join(dir, "nyc-zipcodes.json")); err != nil {
 		t.Fatalf("load zip codes: %v", err)
 	}
 
 	stopSvc := location.NewStopService()
-	if err := stopSvc.Load(filepath.Join(dir, "stops.txt")); err != nil {
+	if _, err := stopSvc.Load(filepath.Join(dir, "stops.txt")); err != nil {
 		t.Fatalf("load stops: %v", err)
 	}
 
-	cfg := &config.Config{HTTPTimeout: 5 * time.Second}
-	router := api.NewRouter(cfg, zipSvc, stopSvc, subway, bus, nil)
+	router := api.NewRouter(cfg, zipSvc, stopSvc, subway, bus, alerts, nil)
 	return httptest.NewServer(router)
 }
 
@@ -142,6 +291,22 @@ func get(t *testing.T, server *httptest.Server, path string) *http.Response {
 	return resp
 }
 
+func post(t *testing.T, server *httptest.Server, path, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("build POST %s: %v", path, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	return resp
+}
+
 func decodeBody(t *testing.T, resp *http.Response) map[string]any {
 	t.Helper()
 	defer resp.Body.Close()
@@ -173,6 +338,24 @@ func assertField(t *testing.T, body map[string]any, field string) {
 	}
 }
 
+// assertError checks the structured error envelope and its code
+func assertError(t *testing.T, body map[string]any, code string) {
+	t.Helper()
+	if success, _ := body["success"].(bool); success {
+		t.Errorf("expected success=false, body: %v", body)
+	}
+	apiErr, ok := body["error"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected error object, body: %v", body)
+	}
+	if got := apiErr["code"]; got != code {
+		t.Errorf("expected error code %q, got %v", code, got)
+	}
+	if msg, _ := apiErr["message"].(string); msg == "" {
+		t.Errorf("expected non-empty error message, body: %v", body)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Health & root
 // ---------------------------------------------------------------------------
@@ -193,6 +376,72 @@ func TestHealth(t *testing.T) {
 	}
 }
 
+func TestHealthFeedStatus(t *testing.T) {
+	subway := defaultSubway()
+	subway.lastSuccess = time.Now().Add(-30 * time.Second)
+	srv := newTestServer(t, subway, defaultBus())
+	defer srv.Close()
+
+	body := decodeBody(t, get(t, srv, "/health"))
+	feeds, ok := body["last_feed_success"].(map[string]any)
+	if !ok {
+		t.Fatalf("missing last_feed_success, body: %v", body)
+	}
+	if feeds["subway"] != "30s" {
+		t.Errorf("subway = %v, want 30s", feeds["subway"])
+	}
+	if feeds["alerts"] != "never" {
+		t.Errorf("alerts = %v, want never", feeds["alerts"])
+	}
+}
+
+func TestReady(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/ready")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	if body["status"] != "ready" {
+		t.Errorf("status = %v, want ready", body["status"])
+	}
+	deps := body["dependencies"].(map[string]any)
+	if deps["zipcodes"] != "ok" || deps["stops"] != "ok" {
+		t.Errorf("dependencies = %v, want all ok", deps)
+	}
+}
+
+func TestReadyBeforeStopsLoaded(t *testing.T) {
+	zipSvc := location.NewZipCodeService()
+	t.Cleanup(zipSvc.Close)
+	if err := zipSvc.Load(filepath.Join(dataDir(t), "nyc-zipcodes.json")); err != nil {
+		t.Fatalf("load zip codes: %v", err)
+	}
+	stopSvc := location.NewStopService()
+
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second}
+	router := api.NewRouter(cfg, zipSvc, stopSvc, defaultSubway(), defaultBus(), &mockAlertProvider{}, nil)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp := get(t, srv, "/ready")
+	assertStatus(t, resp, http.StatusServiceUnavailable)
+
+	deps := decodeBody(t, resp)["dependencies"].(map[string]any)
+	if deps["stops"] != "not_loaded" {
+		t.Errorf("stops = %v, want not_loaded", deps["stops"])
+	}
+	if deps["zipcodes"] != "ok" {
+		t.Errorf("zipcodes = %v, want ok", deps["zipcodes"])
+	}
+
+	// Liveness is unaffected
+	resp = get(t, srv, "/health")
+	assertStatus(t, resp, http.StatusOK)
+	resp.Body.Close()
+}
+
 func TestAPIRoot(t *testing.T) {
 	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
@@ -204,6 +453,191 @@ func TestAPIRoot(t *testing.T) {
 	assertField(t, body, "endpoints")
 }
 
+func TestOpenAPIDocument(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/openapi.json")
+	assertStatus(t, resp, http.StatusOK)
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("decoding OpenAPI document: %v", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+	if doc.Info.Title == "" || doc.Info.Version == "" {
+		t.Error("info.title and info.version are required")
+	}
+
+	for _, path := range []string{"/transit/subway/station/{stopId}", "/transit/location/zip/{zipcode}", "/transit/bus/near"} {
+		if _, ok := doc.Paths[path]["get"]; !ok {
+			t.Errorf("missing GET %s", path)
+		}
+	}
+
+	// Structural checks: unique operation IDs, declared path params, success responses
+	opIDs := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			if op.OperationID == "" || opIDs[op.OperationID] {
+				t.Errorf("%s %s: missing or duplicate operationId %q", method, path, op.OperationID)
+			}
+			opIDs[op.OperationID] = true
+
+			if _, ok := op.Responses["200"]; !ok {
+				t.Errorf("%s %s: no 200 response", method, path)
+			}
+
+			declared := make(map[string]bool)
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					declared[p.Name] = true
+				}
+			}
+			for _, seg := range strings.Split(path, "/") {
+				if name, ok := strings.CutPrefix(seg, "{"); ok {
+					if name = strings.TrimSuffix(name, "}"); !declared[name] {
+						t.Errorf("%s %s: path parameter %q not declared", method, path, name)
+					}
+				}
+			}
+		}
+	}
+
+	// Every $ref points at a defined schema
+	for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(raw), -1) {
+		if _, ok := doc.Components.Schemas[m[1]]; !ok {
+			t.Errorf("unresolved $ref to schema %q", m[1])
+		}
+	}
+	if _, ok := doc.Components.Schemas["StationArrivals"]; !ok {
+		t.Error("expected StationArrivals schema derived from transit.StationArrivals")
+	}
+
+	// ?zips= mode answers with results keyed by zip
+	var near struct {
+		Content map[string]struct {
+			Schema struct {
+				Properties map[string]struct {
+					AdditionalProperties struct {
+						Properties map[string]any `json:"properties"`
+					} `json:"additionalProperties"`
+				} `json:"properties"`
+			} `json:"schema"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(doc.Paths["/transit/subway/near"]["get"].Responses["200"], &near); err != nil {
+		t.Fatalf("decoding near response: %v", err)
+	}
+	result := near.Content["application/json"].Schema.Properties["results"].AdditionalProperties.Properties
+	for _, field := range []string{"zip_code", "location", "stations", "count"} {
+		if _, ok := result[field]; !ok {
+			t.Errorf("near results entry is missing %q in %v", field, result)
+		}
+	}
+}
+
+func TestOpenAPIMatchesEndpointListing(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	resp := get(t, srv, "/openapi.json")
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("decoding OpenAPI document: %v", err)
+	}
+	resp.Body.Close()
+
+	listing := decodeBody(t, get(t, srv, "/api"))["endpoints"].(map[string]any)
+	for _, group := range listing {
+		for route := range group.(map[string]any) {
+			method, path, _ := strings.Cut(route, " ")
+			path, _, _ = strings.Cut(path, "?")
+			if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("%s is listed at /api but missing from /openapi.json", route)
+			}
+		}
+	}
+}
+
+func TestAPIListingMatchesRouter(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret"}
+	srv := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	listing := decodeBody(t, get(t, srv, "/api"))["endpoints"].(map[string]any)
+	if other, ok := listing["other"]; ok {
+		t.Errorf("routes registered without an OpenAPI entry: %v", other)
+	}
+	listed := make(map[string]bool)
+	for _, group := range listing {
+		for route, summary := range group.(map[string]any) {
+			listed[route] = true
+			if summary == "" {
+				t.Errorf("%s has no description", route)
+			}
+		}
+	}
+
+	// Routes the old hand-written listing left out
+	for _, route := range []string{"GET /transit/subway/alerts", "GET /transit/subway/near", "GET /openapi.json", "POST /admin/reload", "POST /admin/cache/flush"} {
+		if !listed[route] {
+			t.Errorf("%s is routed but not listed at /api", route)
+		}
+	}
+
+	// Every documented operation is routed, and so listed
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	resp := get(t, srv, "/openapi.json")
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("decoding OpenAPI document: %v", err)
+	}
+	resp.Body.Close()
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if route := strings.ToUpper(method) + " " + path; !listed[route] {
+				t.Errorf("%s is documented but not listed at /api", route)
+			}
+		}
+	}
+}
+
+func TestAPIListingOmitsDisabledAdmin(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	listing := decodeBody(t, get(t, srv, "/api"))["endpoints"].(map[string]any)
+	if admin, ok := listing["admin"]; ok {
+		t.Errorf("admin routes listed without an admin token: %v", admin)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Location endpoints (use real data, no external calls)
 // ---------------------------------------------------------------------------
@@ -225,6 +659,133 @@ func TestLocationBoroughs(t *testing.T) {
 	}
 }
 
+func TestLocationSearch(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/search?q=canal&limit=3")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+
+	stops := body["stops"].([]any)
+	if len(stops) != 3 {
+		t.Fatalf("got %d stops, want 3 (limit)", len(stops))
+	}
+	for _, s := range stops {
+		if name := s.(map[string]any)["stop_name"]; name != "Canal St" {
+			t.Errorf("stop %v ranked above the Canal St stations", name)
+		}
+	}
+
+	resp = get(t, srv, "/transit/location/search")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), "MISSING_PARAMETER")
+}
+
+func TestLocationSearchCursor(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	ids := func(body map[string]any) []string {
+		var ids []string
+		for _, s := range body["stops"].([]any) {
+			ids = append(ids, s.(map[string]any)["stop_id"].(string))
+		}
+		return ids
+	}
+
+	all := decodeBody(t, get(t, srv, "/transit/location/search?q=canal&limit=50"))
+	want := ids(all)
+	if len(want) < 3 {
+		t.Fatalf("got %d matches for canal, want several to page through", len(want))
+	}
+	if _, ok := all["next_cursor"]; ok {
+		t.Error("next_cursor on a page holding every match")
+	}
+
+	var got []string
+	path := "/transit/location/search?q=canal&limit=2"
+	for page := 0; page <= len(want); page++ {
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		got = append(got, ids(body)...)
+		cursor, ok := body["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		path = "/transit/location/search?q=canal&limit=2&cursor=" + url.QueryEscape(cursor)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged results = %v, want %v with no gaps or repeats", got, want)
+	}
+
+	for _, cursor := range []string{"!!!", "bm90IGpzb24"} {
+		resp := get(t, srv, "/transit/location/search?q=canal&cursor="+cursor)
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertError(t, decodeBody(t, resp), "INVALID_PARAMETER")
+	}
+}
+
+func TestLocationStopsByBorough(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/borough/manhattan/stops?limit=500")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	if body["borough"] != "Manhattan" {
+		t.Errorf("borough = %v, want canonical Manhattan", body["borough"])
+	}
+
+	ids := map[string]bool{}
+	for _, s := range body["stops"].([]any) {
+		stop := s.(map[string]any)
+		ids[stop["stop_id"].(string)] = true
+		if stop["location_type"] != float64(1) {
+			t.Errorf("%v is not a parent station", stop["stop_id"])
+		}
+	}
+	if !ids["127"] {
+		t.Error("Times Sq-42 St (127) missing from Manhattan")
+	}
+	if ids["L08"] {
+		t.Error("Bedford Av (L08, Brooklyn) listed in Manhattan")
+	}
+	if body["total"] != float64(len(ids)) {
+		t.Errorf("total = %v, want %d", body["total"], len(ids))
+	}
+
+	resp = get(t, srv, "/transit/location/borough/Manhattan/stops?limit=5")
+	assertStatus(t, resp, http.StatusOK)
+	body = decodeBody(t, resp)
+	if body["count"] != float64(5) || len(body["stops"].([]any)) != 5 {
+		t.Errorf("limit=5 returned count %v", body["count"])
+	}
+	if body["total"] != float64(len(ids)) {
+		t.Errorf("limited total = %v, want %d", body["total"], len(ids))
+	}
+
+	// Configured limits replace the built-in 100 and 500
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, BoroughDefaultStations: 3, BoroughMaxStations: 10}
+	limited := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
+	defer limited.Close()
+	for path, want := range map[string]float64{
+		"/transit/location/borough/Manhattan/stops":           3,
+		"/transit/location/borough/Manhattan/stops?limit=500": 10,
+	} {
+		if body := decodeBody(t, get(t, limited, path)); body["count"] != want {
+			t.Errorf("%s count = %v, want %v", path, body["count"], want)
+		}
+	}
+
+	resp = get(t, srv, "/transit/location/borough/Narnia/stops")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), "INVALID_BOROUGH")
+}
+
 func TestLocationInfo(t *testing.T) {
 	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
@@ -260,7 +821,9 @@ func TestLocationStopsByZip(t *testing.T) {
 		{"valid NYC zip", "/transit/location/zip/10001", http.StatusOK},
 		{"non-NYC zip", "/transit/location/zip/99999", http.StatusNotFound},
 		{"too short", "/transit/location/zip/100", http.StatusBadRequest},
-		{"letters", "/transit/location/zip/abcde", http.StatusNotFound}, // 5 chars but not found
+		{"letters", "/transit/location/zip/abcde", http.StatusBadRequest},
+		{"mixed", "/transit/location/zip/1000a", http.StatusBadRequest},
+		{"symbols", "/transit/location/zip/10-01", http.StatusBadRequest},
 	}
 
 	for _, tc := range tests {
@@ -271,52 +834,457 @@ func TestLocationStopsByZip(t *testing.T) {
 	}
 }
 
-func TestLocationStopsByZipResponse(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestConfiguredSearchDefaults(t *testing.T) {
+	cfg := &config.Config{
+		HTTPTimeout:           5 * time.Second,
+		LocationDefaultRadius: 300,
+		LocationMaxRadius:     2000,
+		SubwayDefaultRadius:   500,
+		SubwayMaxStations:     50, // clamped to what the subway service will look up
+	}
+	srv := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/location/zip/10001")
-	assertStatus(t, resp, http.StatusOK)
+	tests := []struct {
+		path   string
+		radius float64
+	}{
+		{"/transit/location/zip/10001", 300},
+		{"/transit/location/zip/10001?radius=99999", 2000},
+		{"/transit/location/zip/10001?radius=1200", 1200},
+		{"/transit/subway/near/10001", 500},
+		{"/transit/subway/near/10001?radius=99999", 3200}, // unset max keeps the built-in
+	}
+	for _, tc := range tests {
+		body := decodeBody(t, get(t, srv, tc.path))
+		if body["radius_meters"] != tc.radius {
+			t.Errorf("%s radius_meters = %v, want %v", tc.path, body["radius_meters"], tc.radius)
+		}
+	}
 
-	body := decodeBody(t, resp)
-	assertSuccess(t, body)
-	assertField(t, body, "stops")
-	assertField(t, body, "zip_code")
-	assertField(t, body, "metadata")
+	info := decodeBody(t, get(t, srv, "/transit/location/info"))
+	if defaults := info["defaults"].(map[string]any); defaults["radius_meters"] != float64(300) || defaults["limit"] != float64(5) {
+		t.Errorf("info defaults = %v, want radius 300 and the built-in limit 5", defaults)
+	}
 
-	stops, ok := body["stops"].([]any)
-	if !ok || len(stops) == 0 {
-		t.Error("expected non-empty stops for 10001")
+	stops := make([]string, transit.MaxBulkStations+5)
+	for i := range stops {
+		stops[i] = strconv.Itoa(101 + i)
+	}
+	body := decodeBody(t, get(t, srv, "/transit/subway/arrivals?stops="+strings.Join(stops, ",")))
+	if body["count"] != float64(transit.MaxBulkStations) {
+		t.Errorf("arrivals count = %v, want capped at %d", body["count"], transit.MaxBulkStations)
 	}
 }
 
-func TestLocationClosestStops(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestSubwayFeedsDegraded(t *testing.T) {
+	subway := defaultSubway()
+	srv := newTestServer(t, subway, defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/location/zip/10001/closest?limit=3")
-	assertStatus(t, resp, http.StatusOK)
-
-	body := decodeBody(t, resp)
-	assertSuccess(t, body)
+	paths := []string{
+		"/transit/subway/near/10001",
+		"/transit/subway/near?lat=40.7506&lng=-73.9971",
+		"/transit/subway/near?zips=10001,11201",
+		"/transit/subway/nearest/10001",
+		"/transit/subway/station/127",
+		"/transit/subway/arrivals?stops=127",
+	}
 
-	stops, ok := body["stops"].([]any)
-	if !ok {
-		t.Fatal("expected stops array")
+	for _, path := range paths {
+		body := decodeBody(t, get(t, srv, path))
+		if _, ok := body["feeds_degraded"]; ok {
+			t.Errorf("%s: feeds_degraded set with every feed healthy: %v", path, body)
+		}
 	}
-	if len(stops) > 3 {
-		t.Errorf("limit=3 but got %d stops", len(stops))
+
+	subway.failedFeeds = []string{"bdfm", "g"}
+	for _, path := range paths {
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		if body["feeds_degraded"] != true {
+			t.Errorf("%s: feeds_degraded = %v, want true", path, body["feeds_degraded"])
+		}
+		if failed, _ := body["failed_feeds"].([]any); len(failed) != 2 || failed[0] != "bdfm" || failed[1] != "g" {
+			t.Errorf("%s: failed_feeds = %v, want [bdfm g]", path, body["failed_feeds"])
+		}
 	}
 }
 
-func TestLocationAllZipCodes(t *testing.T) {
+func TestSubwayArrivalsDeduplicatesStops(t *testing.T) {
 	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/location/zipcodes/all")
-	assertStatus(t, resp, http.StatusOK)
+	stopIDs := func(resp *http.Response) []string {
+		t.Helper()
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		var ids []string
+		for _, raw := range body["stations"].([]any) {
+			ids = append(ids, raw.(map[string]any)["stop_id"].(string))
+		}
+		if body["count"] != float64(len(ids)) {
+			t.Errorf("count = %v, want %d", body["count"], len(ids))
+		}
+		return ids
+	}
 
-	body := decodeBody(t, resp)
+	if got := stopIDs(get(t, srv, "/transit/subway/arrivals?stops=127,127,127")); !slices.Equal(got, []string{"127"}) {
+		t.Errorf("stops=127,127,127 gave %v, want [127]", got)
+	}
+	// Duplicates collapse before the cap, so six IDs naming five stations all fit
+	got := stopIDs(get(t, srv, "/transit/subway/arrivals?stops=128,%20127,,127%20,129,130,131"))
+	if want := []string{"128", "127", "129", "130", "131"}; !slices.Equal(got, want) {
+		t.Errorf("stops with spaces and repeats gave %v, want %v", got, want)
+	}
+	resp := get(t, srv, "/transit/subway/arrivals?stops=,%20,")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), handlers.CodeMissingParameter)
+
+	resp, err := http.Post(srv.URL+"/transit/subway/arrivals", "application/json",
+		strings.NewReader(`{"stops": ["631", " 127", "631", "127 ", ""]}`))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	if got := stopIDs(resp); !slices.Equal(got, []string{"631", "127"}) {
+		t.Errorf("POSTed stops gave %v, want [631 127]", got)
+	}
+}
+
+func TestSubwayArrivalsPost(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	postJSON := func(body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/transit/subway/arrivals?arrival_limit=1", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		return resp
+	}
+
+	// Past the GET's cap of MaxSubwayStops, in the order given
+	stops := []string{"127", "631", "A27", "128", "129", "130", "131"}
+	resp := postJSON(`{"stops": ["` + strings.Join(stops, `", "`) + `"]}`)
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	stations, _ := body["stations"].([]any)
+	if len(stations) != len(stops) || body["count"] != float64(len(stops)) {
+		t.Fatalf("got %d stations (count %v), want %d", len(stations), body["count"], len(stops))
+	}
+	for i, raw := range stations {
+		station := raw.(map[string]any)
+		if station["stop_id"] != stops[i] || station["stop_name"] == "" {
+			t.Errorf("station %d = %v %v, want named %s", i, station["stop_id"], station["stop_name"], stops[i])
+		}
+		if north, _ := station["northbound"].([]any); len(north) != 1 {
+			t.Errorf("station %s has %d northbound arrivals, want arrival_limit=1", stops[i], len(north))
+		}
+	}
+
+	tooMany := make([]string, transit.MaxBulkStations+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Quote(strconv.Itoa(100 + i)) // distinct, so none collapse
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"over the cap", `{"stops": [` + strings.Join(tooMany, ",") + `]}`, http.StatusBadRequest, handlers.CodeInvalidParameter},
+		{"unknown stop", `{"stops": ["127", "XYZ"]}`, http.StatusBadRequest, handlers.CodeInvalidParameter},
+		{"empty list", `{"stops": []}`, http.StatusBadRequest, handlers.CodeMissingParameter},
+		{"no stops field", `{}`, http.StatusBadRequest, handlers.CodeMissingParameter},
+		{"not JSON", `stops=127`, http.StatusBadRequest, handlers.CodeInvalidParameter},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := postJSON(tc.body)
+			assertStatus(t, resp, tc.status)
+			assertError(t, decodeBody(t, resp), tc.code)
+		})
+	}
+
+	// The GET variant is still there
+	assertStatus(t, get(t, srv, "/transit/subway/arrivals?stops=127"), http.StatusOK)
+}
+
+func TestConfiguredStopCaps(t *testing.T) {
+	// The built-in station cap holds a wide search to transit.MaxSubwayStops
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	body := decodeBody(t, get(t, srv, "/transit/subway/near/10001?radius=3200&limit=50"))
+	srv.Close()
+	if body["count"] != float64(transit.MaxSubwayStops) {
+		t.Fatalf("default station count = %v, want %d", body["count"], transit.MaxSubwayStops)
+	}
+
+	cfg := &config.Config{
+		HTTPTimeout:       5 * time.Second,
+		SubwayMaxStations: 7,
+		MaxBusStops:       3,
+	}
+	bus := defaultBus()
+	srv = newTestServerWithConfig(t, cfg, defaultSubway(), bus)
+	defer srv.Close()
+
+	body = decodeBody(t, get(t, srv, "/transit/subway/near/10001?radius=3200&limit=50"))
+	if body["count"] != float64(7) {
+		t.Errorf("station count = %v, want widened to the configured 7", body["count"])
+	}
+	body = decodeBody(t, get(t, srv, "/transit/subway/arrivals?stops=127,128,129,130,131,132,133,134,135"))
+	if body["count"] != float64(7) {
+		t.Errorf("arrivals count = %v, want capped at the configured 7", body["count"])
+	}
+
+	assertStatus(t, get(t, srv, "/transit/bus/near/10001?limit=50"), http.StatusOK)
+	if bus.lastLimit != 3 {
+		t.Errorf("bus stop limit = %d, want capped at the configured 3", bus.lastLimit)
+	}
+	assertStatus(t, get(t, srv, "/transit/bus/near/10001"), http.StatusOK)
+	if bus.lastLimit != 3 {
+		t.Errorf("default bus stop limit = %d, want the built-in 5 lowered to the cap", bus.lastLimit)
+	}
+}
+
+func TestConfiguredBusRadius(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	body := decodeBody(t, get(t, srv, "/transit/bus/near/10001"))
+	srv.Close()
+	if body["radius_meters"] != float64(400) {
+		t.Fatalf("default bus radius = %v, want 400", body["radius_meters"])
+	}
+
+	cfg := &config.Config{
+		HTTPTimeout:      5 * time.Second,
+		SubwayMaxRadius:  3200,
+		BusDefaultRadius: 250,
+		BusMaxRadius:     1000,
+	}
+	srv = newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, path := range []string{
+		"/transit/bus/near/10001",
+		"/transit/bus/near?lat=40.7484&lng=-73.9967",
+		"/transit/bus/stops/10001",
+	} {
+		if got := decodeBody(t, get(t, srv, path))["radius_meters"]; got != float64(250) {
+			t.Errorf("%s radius = %v, want the configured 250", path, got)
+		}
+		wide := path + "?radius=3000"
+		if strings.Contains(path, "?") {
+			wide = path + "&radius=3000"
+		}
+		if got := decodeBody(t, get(t, srv, wide))["radius_meters"]; got != float64(1000) {
+			t.Errorf("%s radius = %v, want capped at the configured 1000, not the subway max", path, got)
+		}
+	}
+}
+
+func TestLocationStopsByZipResponse(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zip/10001")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "stops")
+	assertField(t, body, "zip_code")
+	assertField(t, body, "metadata")
+
+	stops, ok := body["stops"].([]any)
+	if !ok || len(stops) == 0 {
+		t.Error("expected non-empty stops for 10001")
+	}
+}
+
+func TestLocationClosestStopsMaxDistance(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	// Little Neck has no station within ~7km
+	body := decodeBody(t, get(t, srv, "/transit/location/zip/11363/closest?limit=3&max_distance=3000"))
+	assertSuccess(t, body)
+	if stops := body["stops"].([]any); len(stops) != 0 {
+		t.Errorf("got %d stops within 3000m, want 0", len(stops))
+	}
+	meta := body["metadata"].(map[string]any)
+	if meta["truncated_by_distance"] != true {
+		t.Errorf("truncated_by_distance = %v, want true", meta["truncated_by_distance"])
+	}
+	if meta["max_distance_meters"] != float64(3000) {
+		t.Errorf("max_distance_meters = %v, want 3000", meta["max_distance_meters"])
+	}
+
+	// Without the cap the far stations come back
+	body = decodeBody(t, get(t, srv, "/transit/location/zip/11363/closest?limit=3"))
+	if stops := body["stops"].([]any); len(stops) != 3 {
+		t.Errorf("got %d stops without a cap, want 3", len(stops))
+	}
+	if meta := body["metadata"].(map[string]any); meta["truncated_by_distance"] != false {
+		t.Errorf("uncapped truncated_by_distance = %v, want false", meta["truncated_by_distance"])
+	}
+}
+
+func TestLocationStopsIncludeDirection(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zip/10001/closest?limit=3")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	stops, ok := body["stops"].([]any)
+	if !ok || len(stops) == 0 {
+		t.Fatal("expected non-empty stops array")
+	}
+	for _, s := range stops {
+		stop := s.(map[string]any)
+		if dir, _ := stop["direction"].(string); dir == "" {
+			t.Errorf("stop %v missing direction", stop["stop_id"])
+		}
+		assertField(t, stop, "bearing")
+	}
+}
+
+func TestLocationStopsIncludeChildren(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	parentsOnly := decodeBody(t, get(t, srv, "/transit/location/zip/10036?radius=300"))["stops"].([]any)
+	withChildren := decodeBody(t, get(t, srv, "/transit/location/zip/10036?radius=300&include_children=true"))["stops"].([]any)
+
+	if len(withChildren) <= len(parentsOnly) {
+		t.Errorf("include_children returned %d stops, want more than %d", len(withChildren), len(parentsOnly))
+	}
+	for _, s := range parentsOnly {
+		stop := s.(map[string]any)
+		if ids, _ := stop["platform_ids"].([]any); len(ids) == 0 {
+			t.Errorf("parent %v missing platform_ids", stop["stop_id"])
+		}
+	}
+}
+
+func TestLocationClosestStops(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zip/10001/closest?limit=3")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+
+	stops, ok := body["stops"].([]any)
+	if !ok {
+		t.Fatal("expected stops array")
+	}
+	if len(stops) > 3 {
+		t.Errorf("limit=3 but got %d stops", len(stops))
+	}
+}
+
+func TestLocationZipInfo(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zip/10036/info")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	if body["zip_code"] != "10036" {
+		t.Errorf("zip_code = %v, want 10036", body["zip_code"])
+	}
+	loc := body["location"].(map[string]any)
+	if loc["borough"] != "Manhattan" || loc["lat"] == nil || loc["lng"] == nil {
+		t.Errorf("location = %v, want Manhattan with coordinates", loc)
+	}
+	for _, key := range []string{"stops", "radius_meters", "metadata"} {
+		if _, ok := body[key]; ok {
+			t.Errorf("info response has %q; it shouldn't search for stops", key)
+		}
+	}
+
+	resp = get(t, srv, "/transit/location/zip/00000/info")
+	assertStatus(t, resp, http.StatusNotFound)
+	assertError(t, decodeBody(t, resp), "ZIP_NOT_FOUND")
+
+	resp = get(t, srv, "/transit/location/zip/1003/info")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), "INVALID_ZIP")
+}
+
+func TestLocationDensity(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	density := func(zip string) map[string]any {
+		t.Helper()
+		resp := get(t, srv, "/transit/location/zip/"+zip+"/density?radius=1000")
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		assertSuccess(t, body)
+		assertField(t, body, "nearest_station")
+		return body
+	}
+	nearestMeters := func(body map[string]any) float64 {
+		return body["nearest_station"].(map[string]any)["distance_meters"].(float64)
+	}
+
+	// Times Square vs. Marine Park, Brooklyn
+	dense := density("10036")
+	sparse := density("11234")
+
+	denseCount := dense["subway_stations"].(float64)
+	sparseCount := sparse["subway_stations"].(float64)
+	if denseCount < 5 {
+		t.Errorf("10036 subway_stations = %v, want at least 5", denseCount)
+	}
+	if sparseCount >= denseCount {
+		t.Errorf("11234 subway_stations = %v, want fewer than 10036 (%v)", sparseCount, denseCount)
+	}
+	if nearestMeters(sparse) <= nearestMeters(dense) {
+		t.Errorf("nearest station from 11234 (%vm) should be farther than from 10036 (%vm)", nearestMeters(sparse), nearestMeters(dense))
+	}
+	if dense["bus_stops"] != float64(1) {
+		t.Errorf("bus_stops = %v, want 1 from mock", dense["bus_stops"])
+	}
+	if _, ok := dense["stations"]; ok {
+		t.Error("density should not include station arrivals")
+	}
+}
+
+func TestLocationDensityWithoutBusKey(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), &mockBusProvider{hasKey: false})
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zip/10036/density")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertField(t, body, "subway_stations")
+	if _, ok := body["bus_stops"]; ok {
+		t.Error("bus_stops should be omitted when the bus service is not configured")
+	}
+
+	resp = get(t, srv, "/transit/location/zip/abcde/density")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), "INVALID_ZIP")
+}
+
+func TestLocationAllZipCodes(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zipcodes/all")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
 	assertSuccess(t, body)
 
 	zips, ok := body["zipcodes"].([]any)
@@ -325,219 +1293,2133 @@ func TestLocationAllZipCodes(t *testing.T) {
 	}
 }
 
-func TestLocationAllZipCodesBoroughFilter(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestLocationAllZipCodesPagination(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	all := decodeBody(t, get(t, srv, "/transit/location/zipcodes/all?limit=500"))
+	allZips := all["zipcodes"].([]any)
+	total := int(all["pagination"].(map[string]any)["total"].(float64))
+	if len(allZips) != total {
+		t.Fatalf("limit=500 returned %d of %d zip codes", len(allZips), total)
+	}
+	for i := 1; i < len(allZips); i++ {
+		prev := allZips[i-1].(map[string]any)["code"].(string)
+		cur := allZips[i].(map[string]any)["code"].(string)
+		if prev >= cur {
+			t.Fatalf("zip codes not sorted: %s before %s", prev, cur)
+		}
+	}
+
+	// Walk the pages and confirm they stitch back together exactly
+	var paged []any
+	for offset := 0; ; offset += 40 {
+		resp := get(t, srv, fmt.Sprintf("/transit/location/zipcodes/all?limit=40&offset=%d", offset))
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		page := body["zipcodes"].([]any)
+		paged = append(paged, page...)
+
+		pagination := body["pagination"].(map[string]any)
+		if pagination["limit"].(float64) != 40 || int(pagination["offset"].(float64)) != offset {
+			t.Errorf("pagination = %v, want limit=40 offset=%d", pagination, offset)
+		}
+		if pagination["has_more"] != true {
+			break
+		}
+	}
+
+	if len(paged) != total {
+		t.Fatalf("paged through %d zip codes, want %d", len(paged), total)
+	}
+	for i := range paged {
+		if paged[i].(map[string]any)["code"] != allZips[i].(map[string]any)["code"] {
+			t.Fatalf("page mismatch at index %d", i)
+		}
+	}
+}
+
+func TestLocationAllZipCodesPaginationBounds(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	body := decodeBody(t, get(t, srv, "/transit/location/zipcodes/all?offset=100000"))
+	if zips := body["zipcodes"].([]any); len(zips) != 0 {
+		t.Errorf("offset past end returned %d zip codes, want 0", len(zips))
+	}
+	if body["pagination"].(map[string]any)["has_more"] != false {
+		t.Error("has_more should be false past the end")
+	}
+
+	body = decodeBody(t, get(t, srv, "/transit/location/zipcodes/all?limit=100000"))
+	if limit := body["pagination"].(map[string]any)["limit"].(float64); limit != 500 {
+		t.Errorf("limit = %v, want clamped to 500", limit)
+	}
+}
+
+func TestLocationAllZipCodesBoroughFilter(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/location/zipcodes/all?borough=Manhattan")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "zipcodes")
+}
+
+func TestLocationAllZipCodesBoroughValidation(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	total := func(path string) float64 {
+		t.Helper()
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		assertSuccess(t, body)
+		return body["pagination"].(map[string]any)["total"].(float64)
+	}
+
+	all := total("/transit/location/zipcodes/all")
+	manhattan := total("/transit/location/zipcodes/all?borough=manhattan")
+	if manhattan == 0 || manhattan >= all {
+		t.Errorf("borough=manhattan total = %v, want between 0 and %v", manhattan, all)
+	}
+
+	resp := get(t, srv, "/transit/location/zipcodes/all?borough=Manhatan")
+	assertStatus(t, resp, http.StatusBadRequest)
+	body := decodeBody(t, resp)
+	assertError(t, body, "INVALID_BOROUGH")
+	msg := body["error"].(map[string]any)["message"].(string)
+	for _, b := range []string{"Manhattan", "Brooklyn", "Staten Island"} {
+		if !strings.Contains(msg, b) {
+			t.Errorf("error message %q should list %s", msg, b)
+		}
+	}
+}
+
+func TestDistanceUnits(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		units   string
+		present []string
+		absent  []string
+	}{
+		{"default", "", []string{"distance_meters", "distance_miles"}, []string{"distance_km"}},
+		{"metric", "?units=metric", []string{"distance_meters", "distance_km"}, []string{"distance_miles"}},
+		{"imperial", "?units=imperial", []string{"distance_miles"}, []string{"distance_meters", "distance_km"}},
+	}
+
+	endpoints := []struct {
+		path string
+		key  string
+	}{
+		{"/transit/location/zip/10001", "stops"},
+		{"/transit/location/zip/10001/closest", "stops"},
+		{"/transit/subway/near/10001", "stations"},
+		{"/transit/subway/near?lat=40.7484&lng=-73.9967", "stations"},
+		{"/transit/subway/stops/10001", "stops"},
+	}
+
+	for _, tc := range tests {
+		for _, ep := range endpoints {
+			t.Run(tc.name+" "+ep.path, func(t *testing.T) {
+				path := ep.path + tc.units
+				if tc.units != "" && strings.Contains(ep.path, "?") {
+					path = ep.path + "&" + tc.units[1:]
+				}
+				resp := get(t, srv, path)
+				assertStatus(t, resp, http.StatusOK)
+
+				items, ok := decodeBody(t, resp)[ep.key].([]any)
+				if !ok || len(items) == 0 {
+					t.Fatalf("expected non-empty %s", ep.key)
+				}
+				item := items[0].(map[string]any)
+				for _, f := range tc.present {
+					assertField(t, item, f)
+				}
+				for _, f := range tc.absent {
+					if _, ok := item[f]; ok {
+						t.Errorf("unexpected field %q in %v", f, item)
+					}
+				}
+			})
+		}
+	}
+
+	for _, ep := range endpoints {
+		t.Run("unknown rejected "+ep.path, func(t *testing.T) {
+			path := ep.path + "?units=furlongs"
+			if strings.Contains(ep.path, "?") {
+				path = ep.path + "&units=furlongs"
+			}
+			resp := get(t, srv, path)
+			assertStatus(t, resp, http.StatusBadRequest)
+			assertError(t, decodeBody(t, resp), "INVALID_PARAMETER")
+		})
+	}
+
+	// A zero distance keeps its fields in every mode
+	loc := decodeBody(t, get(t, srv, "/transit/location/zip/10001/info"))["location"].(map[string]any)
+	for units, fields := range map[string][]string{
+		"":         {"distance_meters", "distance_miles"},
+		"metric":   {"distance_meters", "distance_km"},
+		"imperial": {"distance_miles"},
+	} {
+		body := decodeBody(t, get(t, srv, fmt.Sprintf("/transit/subway/near?lat=%v&lng=%v&units=%s", loc["lat"], loc["lng"], units)))
+		zip := body["nearest_zip"].(map[string]any)
+		for _, f := range fields {
+			if d, ok := zip[f].(float64); !ok || d != 0 {
+				t.Errorf("units=%q nearest_zip %s = %v, want 0", units, f, zip[f])
+			}
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Subway endpoints
+// ---------------------------------------------------------------------------
+
+func TestSubwayStation(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/station/127")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "arrivals")
+	assertField(t, body, "stop_id")
+}
+
+func TestSubwayDestinationKeepsStopID(t *testing.T) {
+	subway := &mockSubwayProvider{arrivals: []transit.Arrival{{
+		Route: "A", StopID: "127N", Direction: "northbound",
+		ArrivalTime: time.Now().Add(4 * time.Minute), MinutesAway: 4,
+		Destination: "A02", DestinationID: "A02",
+	}}}
+	srv := newTestServer(t, subway, defaultBus())
+	defer srv.Close()
+
+	check := func(path string, arrival map[string]any) {
+		t.Helper()
+		if arrival["destination"] != "Inwood-207 St (Manhattan)" {
+			t.Errorf("%s: destination = %v, want the resolved name", path, arrival["destination"])
+		}
+		if arrival["destination_id"] != "A02" {
+			t.Errorf("%s: destination_id = %v, want the raw stop ID A02", path, arrival["destination_id"])
+		}
+	}
+
+	body := decodeBody(t, get(t, srv, "/transit/subway/station/127"))
+	northbound := body["arrivals"].(map[string]any)["northbound"].([]any)
+	if len(northbound) != 1 {
+		t.Fatalf("station: got %d northbound arrivals, want 1", len(northbound))
+	}
+	check("station", northbound[0].(map[string]any))
+
+	body = decodeBody(t, get(t, srv, "/transit/subway/near/10036?limit=1"))
+	station := body["stations"].([]any)[0].(map[string]any)
+	check("near", station["northbound"].([]any)[0].(map[string]any))
+}
+
+func manyArrivals(n int) *mockSubwayProvider {
+	m := &mockSubwayProvider{}
+	for i := 0; i < n; i++ {
+		m.arrivals = append(m.arrivals, transit.Arrival{
+			Route:       "A",
+			StopID:      "127N",
+			Direction:   "northbound",
+			ArrivalTime: time.Now().Add(time.Duration(i+1) * time.Minute),
+			MinutesAway: i + 1,
+		})
+	}
+	return m
+}
+
+func TestSubwayArrivalsPerDirectionLimit(t *testing.T) {
+	srv := newTestServer(t, manyArrivals(30), defaultBus())
+	defer srv.Close()
+
+	stationCount := func(path string) int {
+		body := decodeBody(t, get(t, srv, path))
+		arrivals := body["arrivals"].(map[string]any)
+		return len(arrivals["northbound"].([]any))
+	}
+	nearCount := func(path string) int {
+		body := decodeBody(t, get(t, srv, path))
+		station := body["stations"].([]any)[0].(map[string]any)
+		return len(station["northbound"].([]any))
+	}
+
+	tests := []struct {
+		name  string
+		count func(string) int
+		path  string
+		want  int
+	}{
+		{"station default", stationCount, "/transit/subway/station/127", transit.DefaultArrivalsPerDirection},
+		{"station limit", stationCount, "/transit/subway/station/127?limit=2", 2},
+		{"station clamped", stationCount, "/transit/subway/station/127?limit=500", transit.MaxArrivalsPerDirection},
+		{"near default", nearCount, "/transit/subway/near/10001", transit.DefaultArrivalsPerDirection},
+		{"near limit", nearCount, "/transit/subway/near/10001?arrival_limit=3", 3},
+		{"near clamped", nearCount, "/transit/subway/near?lat=40.7484&lng=-73.9967&arrival_limit=500", transit.MaxArrivalsPerDirection},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.count(tc.path); got != tc.want {
+				t.Errorf("got %d arrivals per direction, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubwayNearArrivalsCap(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, MaxNearArrivals: 25}
+	srv := newTestServerWithConfig(t, cfg, manyArrivals(30), defaultBus())
+	defer srv.Close()
+
+	// total counts the arrivals in a list of stations, and checks that a
+	// station holds the soonest of both directions
+	total := func(t *testing.T, stations []any) int {
+		t.Helper()
+		n := 0
+		for _, s := range stations {
+			station := s.(map[string]any)
+			north, south := len(station["northbound"].([]any)), len(station["southbound"].([]any))
+			if north-south > 1 || south > north {
+				t.Errorf("station %v kept %d northbound and %d southbound, want the soonest of both", station["stop_id"], north, south)
+			}
+			n += north + south
+		}
+		return n
+	}
+
+	for _, path := range []string{
+		"/transit/subway/near/10001?limit=5&arrival_limit=20",
+		"/transit/subway/near?lat=40.7484&lng=-73.9967&limit=5&arrival_limit=20",
+	} {
+		body := decodeBody(t, get(t, srv, path))
+		stations := body["stations"].([]any)
+		if len(stations) < 2 {
+			t.Fatalf("%s: got %d stations, want several", path, len(stations))
+		}
+		if n := total(t, stations); n != 25 {
+			t.Errorf("%s: %d arrivals, want the cap of 25", path, n)
+		}
+		if body["truncated"] != true {
+			t.Errorf("%s: truncated = %v, want true", path, body["truncated"])
+		}
+	}
+
+	// Several zips share one budget
+	body := decodeBody(t, get(t, srv, "/transit/subway/near?zips=10001,10036&limit=5&arrival_limit=20"))
+	n := 0
+	for _, result := range body["results"].(map[string]any) {
+		n += total(t, result.(map[string]any)["stations"].([]any))
+	}
+	if n != 25 || body["truncated"] != true {
+		t.Errorf("zips: %d arrivals, truncated = %v, want 25 and true", n, body["truncated"])
+	}
+
+	// Under the cap nothing is dropped
+	body = decodeBody(t, get(t, srv, "/transit/subway/near/10001?limit=1&arrival_limit=5"))
+	if n := total(t, body["stations"].([]any)); n != 10 || body["truncated"] != false {
+		t.Errorf("under the cap: %d arrivals, truncated = %v, want 10 and false", n, body["truncated"])
+	}
+}
+
+func TestArrivalsMinMinutes(t *testing.T) {
+	bus := defaultBus()
+	bus.arrivals = nil
+	for i := 0; i < 10; i++ {
+		bus.arrivals = append(bus.arrivals, transit.BusArrival{Route: "M34", MinutesAway: i})
+	}
+	srv := newTestServer(t, manyArrivals(10), bus)
+	defer srv.Close()
+
+	minutes := func(list []any) []int {
+		var out []int
+		for _, a := range list {
+			out = append(out, int(a.(map[string]any)["minutes_away"].(float64)))
+		}
+		return out
+	}
+	station := func(path string) []int {
+		body := decodeBody(t, get(t, srv, path))
+		return minutes(body["arrivals"].(map[string]any)["northbound"].([]any))
+	}
+	near := func(path string) []int {
+		body := decodeBody(t, get(t, srv, path))
+		return minutes(body["stations"].([]any)[0].(map[string]any)["northbound"].([]any))
+	}
+	busNear := func(path string) []int {
+		return minutes(decodeBody(t, get(t, srv, path))["arrivals"].([]any))
+	}
+
+	tests := []struct {
+		name     string
+		minutes  func(string) []int
+		path     string
+		wantMin  int
+		wantSize int
+	}{
+		{"station default", station, "/transit/subway/station/127?limit=10", 1, 10},
+		{"station filtered", station, "/transit/subway/station/127?limit=10&min_minutes=4", 4, 7},
+		{"station filtered before limit", station, "/transit/subway/station/127?limit=2&min_minutes=4", 4, 2},
+		{"near filtered", near, "/transit/subway/near/10001?arrival_limit=10&min_minutes=3", 3, 8},
+		{"bus default", busNear, "/transit/bus/near/10001", 0, 10},
+		{"bus filtered", busNear, "/transit/bus/near/10001?min_minutes=2", 2, 8},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.minutes(tc.path)
+			if len(got) != tc.wantSize {
+				t.Fatalf("got %d arrivals %v, want %d", len(got), got, tc.wantSize)
+			}
+			if got[0] != tc.wantMin {
+				t.Errorf("soonest arrival = %d minutes, want %d", got[0], tc.wantMin)
+			}
+		})
+	}
+}
+
+func TestSubwayStationGroupByRoute(t *testing.T) {
+	subway := &mockSubwayProvider{}
+	for i, route := range []string{"E", "A", "C", "A", "E", "A"} {
+		subway.arrivals = append(subway.arrivals, transit.Arrival{
+			Route:       route,
+			StopID:      "A27N",
+			Direction:   "northbound",
+			ArrivalTime: time.Now().Add(time.Duration(i+1) * time.Minute),
+			MinutesAway: i + 1,
+		})
+	}
+	srv := newTestServer(t, subway, defaultBus())
+	defer srv.Close()
+
+	body := decodeBody(t, get(t, srv, "/transit/subway/station/A27?group_by=route&limit=10"))
+	assertSuccess(t, body)
+
+	arrivals := body["arrivals"].(map[string]any)
+	for _, direction := range []string{"northbound", "southbound"} {
+		groups := arrivals[direction].([]any)
+		var routes []string
+		for _, g := range groups {
+			group := g.(map[string]any)
+			route := group["route"].(string)
+			routes = append(routes, route)
+
+			last := -1.0
+			for _, a := range group["arrivals"].([]any) {
+				arr := a.(map[string]any)
+				if arr["route"] != route {
+					t.Errorf("%s: %v arrival filed under route %s", direction, arr["route"], route)
+				}
+				if mins := arr["minutes_away"].(float64); mins < last {
+					t.Errorf("%s route %s: arrivals not time-sorted", direction, route)
+				} else {
+					last = mins
+				}
+			}
+		}
+		if want := []string{"A", "C", "E"}; !slices.Equal(routes, want) {
+			t.Errorf("%s routes = %v, want %v", direction, routes, want)
+		}
+	}
+
+	// Without group_by the flat format is unchanged
+	flat := decodeBody(t, get(t, srv, "/transit/subway/station/A27?limit=10"))
+	if n := len(flat["arrivals"].(map[string]any)["northbound"].([]any)); n != 6 {
+		t.Errorf("flat northbound has %d arrivals, want 6", n)
+	}
+}
+
+func TestSubwayNearMultipleZips(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/near?zips=10001,11201")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+
+	results := body["results"].(map[string]any)
+	if len(results) != 2 || body["count"] != float64(2) {
+		t.Fatalf("got %d results (count %v), want 2", len(results), body["count"])
+	}
+	for _, code := range []string{"10001", "11201"} {
+		result, ok := results[code].(map[string]any)
+		if !ok {
+			t.Fatalf("missing result for %s", code)
+		}
+		if result["zip_code"] != code {
+			t.Errorf("results[%s].zip_code = %v", code, result["zip_code"])
+		}
+		stations := result["stations"].([]any)
+		if len(stations) == 0 {
+			t.Errorf("results[%s] has no stations", code)
+		}
+		if result["count"] != float64(len(stations)) {
+			t.Errorf("results[%s].count = %v, want %d", code, result["count"], len(stations))
+		}
+	}
+}
+
+func TestSubwayNearMultipleZipsValidation(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		zips   string
+		status int
+		code   string
+	}{
+		{"malformed zip in list", "10001,abc", http.StatusBadRequest, "INVALID_ZIP"},
+		{"unknown zip in list", "10001,99999", http.StatusNotFound, "ZIP_NOT_FOUND"},
+		{"too many zips", "10001,10002,10003,10004", http.StatusBadRequest, "INVALID_PARAMETER"},
+		{"empty list", ",", http.StatusBadRequest, "MISSING_PARAMETER"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, "/transit/subway/near?zips="+tc.zips)
+			assertStatus(t, resp, tc.status)
+			assertError(t, decodeBody(t, resp), tc.code)
+		})
+	}
+}
+
+func TestSubwayStationServiceError(t *testing.T) {
+	failSubway := &mockSubwayProvider{err: errors.New("feed unavailable")}
+	srv := newTestServer(t, failSubway, defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/station/127")
+	assertStatus(t, resp, http.StatusInternalServerError)
+	assertError(t, decodeBody(t, resp), "UPSTREAM_ERROR")
+}
+
+func TestSubwayStationStream(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/transit/subway/station/127/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	assertStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// Read the first event, which is sent immediately on connect
+	reader := bufio.NewReader(resp.Body)
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+
+	if event != "arrivals" {
+		t.Errorf("event = %q, want arrivals", event)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		t.Fatalf("decoding event data: %v", err)
+	}
+	assertField(t, payload, "arrivals")
+	if payload["stop_id"] != "127" {
+		t.Errorf("stop_id = %v, want 127", payload["stop_id"])
+	}
+
+	cancel()
+}
+
+func TestSubwayRoutes(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/routes")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+
+	routes := body["routes"].([]any)
+	if int(body["count"].(float64)) != len(routes) {
+		t.Errorf("count = %v, want %d", body["count"], len(routes))
+	}
+	var found bool
+	for _, r := range routes {
+		route := r.(map[string]any)
+		if route["id"] == "A" {
+			found = true
+			if route["color"] != "#0039A6" || route["feed"] != "ace" {
+				t.Errorf("A = %v, want blue #0039A6 in ace", route)
+			}
+		}
+	}
+	if !found {
+		t.Error("route A not listed")
+	}
+}
+
+func TestSubwayRouteArrivals(t *testing.T) {
+	subway := &mockSubwayProvider{arrivals: []transit.Arrival{
+		{Route: "L", StopID: "L08N", Direction: "northbound", ArrivalTime: time.Now().Add(3 * time.Minute), MinutesAway: 3},
+		{Route: "A", StopID: "A27N", Direction: "northbound", ArrivalTime: time.Now().Add(4 * time.Minute), MinutesAway: 4},
+	}}
+	srv := newTestServer(t, subway, defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/route/l/arrivals")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+
+	if body["route"] != "L" {
+		t.Errorf("route = %v, want L", body["route"])
+	}
+	stations := body["stations"].([]any)
+	if len(stations) != 1 {
+		t.Fatalf("got %d stations, want 1", len(stations))
+	}
+	station := stations[0].(map[string]any)
+	if name, _ := station["stop_name"].(string); station["stop_id"] != "L08" || name == "" {
+		t.Errorf("station = %v, want L08 with its name", station)
+	}
+	if north := station["northbound"].([]any); len(north) != 1 {
+		t.Errorf("got %d northbound arrivals, want just the L", len(north))
+	}
+}
+
+func TestSubwayRawFeed(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/feed/ace")
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q, want application/x-protobuf", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if len(body) == 0 {
+		t.Error("expected feed bytes")
+	}
+
+	resp = get(t, srv, "/transit/subway/feed/unknown")
+	assertStatus(t, resp, http.StatusNotFound)
+	assertField(t, decodeBody(t, resp), "error")
+}
+
+func TestSubwayNearZip(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"valid zip", "/transit/subway/near/10001", http.StatusOK},
+		{"non-NYC zip", "/transit/subway/near/99999", http.StatusNotFound},
+		{"too short", "/transit/subway/near/100", http.StatusBadRequest},
+		{"letters", "/transit/subway/near/abcde", http.StatusBadRequest},
+		{"symbols", "/transit/subway/near/1000%21", http.StatusBadRequest},
+		{"with radius", "/transit/subway/near/10001?radius=1600", http.StatusOK},
+		{"with limit", "/transit/subway/near/10001?limit=2", http.StatusOK},
+	}
+
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, tc.path)
+			assertStatus(t, resp, tc.status)
+		})
+	}
+}
+
+func TestSubwayNearZipResponse(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/near/10001")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "stations")
+	assertField(t, body, "count")
+	assertField(t, body, "zip_code")
+	assertField(t, body, "radius_meters")
+}
+
+func TestSubwayFieldsParam(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	firstStation := func(t *testing.T, path string) map[string]any {
+		t.Helper()
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		assertSuccess(t, body)
+		stations, _ := body["stations"].([]any)
+		if len(stations) == 0 {
+			t.Fatalf("expected stations, body: %v", body)
+		}
+		return stations[0].(map[string]any)
+	}
+
+	t.Run("projects requested fields", func(t *testing.T) {
+		station := firstStation(t, "/transit/subway/near/10001?fields=stop_id,stop_name,northbound,bogus")
+		for _, f := range []string{"stop_id", "stop_name", "northbound"} {
+			assertField(t, station, f)
+		}
+		for _, f := range []string{"southbound", "distance_meters", "bogus"} {
+			if _, ok := station[f]; ok {
+				t.Errorf("unexpected field %q in projected station", f)
+			}
+		}
+	})
+
+	t.Run("omitted returns everything", func(t *testing.T) {
+		station := firstStation(t, "/transit/subway/near/10001")
+		for _, f := range []string{"stop_id", "stop_name", "northbound", "southbound"} {
+			assertField(t, station, f)
+		}
+	})
+
+	t.Run("nearest station", func(t *testing.T) {
+		resp := get(t, srv, "/transit/subway/nearest/10001?fields=stop_id")
+		assertStatus(t, resp, http.StatusOK)
+		station, _ := decodeBody(t, resp)["station"].(map[string]any)
+		if len(station) != 1 || station["stop_id"] == nil {
+			t.Errorf("expected only stop_id, got %v", station)
+		}
+	})
+}
+
+func TestSubwayNearNDJSON(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, path := range []string{
+		"/transit/subway/near/10001?limit=3",
+		"/transit/subway/near?lat=40.7484&lng=-73.9967&limit=3",
+	} {
+		t.Run(path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", "application/x-ndjson")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+			defer resp.Body.Close()
+
+			assertStatus(t, resp, http.StatusOK)
+			if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+			}
+
+			var stations []map[string]any
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var station map[string]any
+				if err := json.Unmarshal(scanner.Bytes(), &station); err != nil {
+					t.Fatalf("line %d is not a JSON object: %v", len(stations)+1, err)
+				}
+				stations = append(stations, station)
+			}
+			if err := scanner.Err(); err != nil {
+				t.Fatalf("reading stream: %v", err)
+			}
+
+			if len(stations) != 3 {
+				t.Fatalf("got %d lines, want one per station (3)", len(stations))
+			}
+			seen := make(map[any]bool)
+			for _, station := range stations {
+				assertField(t, station, "stop_name")
+				assertField(t, station, "northbound")
+				if seen[station["stop_id"]] {
+					t.Errorf("station %v streamed twice", station["stop_id"])
+				}
+				seen[station["stop_id"]] = true
+			}
+		})
+	}
+}
+
+func TestSubwayNearNDJSONArrivalBudget(t *testing.T) {
+	// Each mock station has two arrivals, so a budget of 3 runs out on the second
+	srv := newTestServerWithConfig(t, &config.Config{HTTPTimeout: 5 * time.Second, MaxNearArrivals: 3}, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/transit/subway/near/10001?limit=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp, http.StatusOK)
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v", len(lines)+1, err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+
+	total := 0
+	for i, line := range lines {
+		for _, dir := range []string{"northbound", "southbound"} {
+			arrivals, _ := line[dir].([]any)
+			total += len(arrivals)
+		}
+		if _, ok := line["truncated"]; ok != (i == len(lines)-1) {
+			t.Errorf("line %d truncated present = %v, want it on the last line only", i+1, ok)
+		}
+	}
+	if total != 3 {
+		t.Errorf("streamed %d arrivals, want the budget of 3", total)
+	}
+	if lines[2]["truncated"] != true {
+		t.Errorf("last line truncated = %v, want true", lines[2]["truncated"])
+	}
+}
+
+func TestSubwayNearCoords(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"valid coords", "/transit/subway/near?lat=40.7484&lng=-73.9967", http.StatusOK},
+		{"missing lat", "/transit/subway/near?lng=-73.9967", http.StatusBadRequest},
+		{"missing lng", "/transit/subway/near?lat=40.7484", http.StatusBadRequest},
+		{"invalid lat", "/transit/subway/near?lat=abc&lng=-73.9967", http.StatusBadRequest},
+		{"invalid lng", "/transit/subway/near?lat=40.7484&lng=xyz", http.StatusBadRequest},
+	}
+
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, tc.path)
+			assertStatus(t, resp, tc.status)
+		})
+	}
+}
+
+func TestCoordEndpointsRejectBadCoordinates(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	coords := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"missing lat", "lng=-73.98", "MISSING_PARAMETER"},
+		{"missing lng", "lat=40.75", "MISSING_PARAMETER"},
+		{"non-numeric lat", "lat=abc&lng=-73.98", "INVALID_COORDINATES"},
+		{"non-numeric lng", "lat=40.75&lng=xyz", "INVALID_COORDINATES"},
+		{"latitude out of range", "lat=999&lng=-73.98", "INVALID_COORDINATES"},
+		{"longitude out of range", "lat=40.75&lng=-999", "INVALID_COORDINATES"},
+		{"not a number", "lat=NaN&lng=-73.98", "INVALID_COORDINATES"},
+		{"outside NYC", "lat=51.5074&lng=-0.1278", "INVALID_COORDINATES"},
+		{"just past the NYC box", "lat=40.75&lng=-73.40", "INVALID_COORDINATES"},
+	}
+	// Every coordinate endpoint shares parseCoords, so each rejects the same
+	// inputs the same way
+	for _, endpoint := range []string{"/transit/subway/near", "/transit/subway/nearest", "/transit/bus/near"} {
+		for _, tc := range coords {
+			t.Run(endpoint+"/"+tc.name, func(t *testing.T) {
+				resp := get(t, srv, endpoint+"?"+tc.query)
+				assertStatus(t, resp, http.StatusBadRequest)
+				assertError(t, decodeBody(t, resp), tc.code)
+			})
+		}
+	}
+
+	// Staten Island's south shore is well inside the box
+	resp := get(t, srv, "/transit/subway/near?lat=40.5126&lng=-74.2513")
+	assertStatus(t, resp, http.StatusOK)
+}
+
+func TestSubwayNearCatchable(t *testing.T) {
+	subway := &mockSubwayProvider{}
+	for _, mins := range []int{2, 5, 15, 25} {
+		subway.arrivals = append(subway.arrivals, transit.Arrival{
+			Route: "Q", StopID: "Q05N", Direction: "northbound",
+			ArrivalTime: time.Now().Add(time.Duration(mins) * time.Minute), MinutesAway: mins,
+		})
+	}
+	srv := newTestServer(t, subway, defaultBus())
+	defer srv.Close()
+
+	// Mid-Central Park: the closest station is several minutes' walk away
+	const near = "/transit/subway/near?lat=40.7794&lng=-73.9632&radius=1500&limit=1&arrival_limit=2"
+
+	station := func(path string) map[string]any {
+		t.Helper()
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		stations := decodeBody(t, resp)["stations"].([]any)
+		if len(stations) != 1 {
+			t.Fatalf("%s: got %d stations, want 1", path, len(stations))
+		}
+		return stations[0].(map[string]any)
+	}
+	minutes := func(arrivals any) []int {
+		var out []int
+		for _, arr := range arrivals.([]any) {
+			out = append(out, int(arr.(map[string]any)["minutes_away"].(float64)))
+		}
+		return out
+	}
+
+	plain := station(near)
+	if _, ok := plain["walk_minutes"]; ok {
+		t.Error("walk_minutes present without catchable=true")
+	}
+	if got := minutes(plain["northbound"]); !slices.Equal(got, []int{2, 5}) {
+		t.Errorf("northbound = %v, want [2 5]", got)
+	}
+
+	catchable := station(near + "&catchable=true")
+	walk := int(catchable["walk_minutes"].(float64))
+	if want := location.WalkMinutes(catchable["distance_meters"].(float64)); walk != want || walk < 6 || walk >= 15 {
+		t.Fatalf("walk_minutes = %d, want %d (between 6 and 14)", walk, want)
+	}
+	// The arrivals the rider can't reach are dropped before arrival_limit
+	// applies, so the two catchable trains both come back
+	if got := minutes(catchable["northbound"]); !slices.Equal(got, []int{15, 25}) {
+		t.Errorf("catchable northbound = %v, want [15 25]", got)
+	}
+
+	resp := get(t, srv, "/transit/subway/near/10001?catchable=true")
+	assertStatus(t, resp, http.StatusOK)
+	for _, st := range decodeBody(t, resp)["stations"].([]any) {
+		st := st.(map[string]any)
+		walk, _ := st["walk_minutes"].(float64)
+		for _, mins := range minutes(st["northbound"]) {
+			if float64(mins) <= walk {
+				t.Errorf("%v: kept a train %d min away with a %v min walk", st["stop_id"], mins, walk)
+			}
+		}
+	}
+}
+
+func TestCoordsResponsesIncludeNearestZip(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	// Near Penn Station, Manhattan
+	for _, path := range []string{
+		"/transit/subway/near?lat=40.7484&lng=-73.9967",
+		"/transit/subway/nearest?lat=40.7484&lng=-73.9967",
+		"/transit/bus/near?lat=40.7484&lng=-73.9967",
+	} {
+		t.Run(path, func(t *testing.T) {
+			resp := get(t, srv, path)
+			assertStatus(t, resp, http.StatusOK)
+			body := decodeBody(t, resp)
+			assertSuccess(t, body)
+
+			zip, ok := body["nearest_zip"].(map[string]any)
+			if !ok {
+				t.Fatalf("expected nearest_zip object, body: %v", body)
+			}
+			if zip["borough"] != "Manhattan" {
+				t.Errorf("nearest_zip borough = %v, want Manhattan", zip["borough"])
+			}
+			if code, _ := zip["code"].(string); !strings.HasPrefix(code, "100") {
+				t.Errorf("nearest_zip code = %q, want a 100xx Manhattan zip", code)
+			}
+			if d, _ := zip["distance_meters"].(float64); d <= 0 || d > 2000 {
+				t.Errorf("nearest_zip distance_meters = %v, want within 2km", d)
+			}
+		})
+	}
+
+	// ?units= trims nearest_zip distances like station distances
+	for units, fields := range map[string][]string{
+		"metric":   {"distance_meters", "distance_km"},
+		"imperial": {"distance_miles"},
+	} {
+		body := decodeBody(t, get(t, srv, "/transit/subway/near?lat=40.7484&lng=-73.9967&units="+units))
+		zip := body["nearest_zip"].(map[string]any)
+		got := slices.Sorted(maps.Keys(zip))
+		want := slices.Sorted(slices.Values(append([]string{"borough", "code"}, fields...)))
+		if !slices.Equal(got, want) {
+			t.Errorf("units=%s nearest_zip fields = %v, want %v", units, got, want)
+		}
+	}
+}
+
+func TestSubwayNearest(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"by coords", "/transit/subway/nearest?lat=40.7484&lng=-73.9967", http.StatusOK},
+		{"by zip", "/transit/subway/nearest/10001", http.StatusOK},
+		{"missing lng", "/transit/subway/nearest?lat=40.7484", http.StatusBadRequest},
+		{"invalid zip", "/transit/subway/nearest/100", http.StatusBadRequest},
+		{"unknown zip", "/transit/subway/nearest/99999", http.StatusNotFound},
+		{"out at sea", "/transit/subway/nearest?lat=40.45&lng=-73.80", http.StatusNotFound},
+	}
+
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, tc.path)
+			assertStatus(t, resp, tc.status)
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestSubwayNearestResponse(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/nearest?lat=40.7484&lng=-73.9967")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "radius_meters")
+
+	station, ok := body["station"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected station object, body: %v", body)
+	}
+	for _, f := range []string{"stop_id", "stop_name", "distance_meters", "northbound", "southbound"} {
+		assertField(t, station, f)
+	}
+	if north, _ := station["northbound"].([]any); len(north) == 0 {
+		t.Error("expected northbound arrivals from mock provider")
+	}
+}
+
+func TestSubwayNearestNoStation(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/nearest?lat=40.45&lng=-73.80")
+	assertStatus(t, resp, http.StatusNotFound)
+	assertError(t, decodeBody(t, resp), "STATION_NOT_FOUND")
+}
+
+func TestSubwayStopsNearZip(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/stops/10001")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "stops")
+	assertField(t, body, "count")
+}
+
+func TestSubwayStopsInBounds(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/subway/stops/bbox?minLat=40.745&minLng=-73.995&maxLat=40.765&maxLng=-73.970")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "bounds")
+
+	stops, _ := body["stops"].([]any)
+	ids := make(map[string]bool, len(stops))
+	for _, s := range stops {
+		ids[s.(map[string]any)["stop_id"].(string)] = true
+	}
+	if !ids["127"] || !ids["631"] {
+		t.Errorf("expected Times Sq and Grand Central in Midtown box, got %v", ids)
+	}
+	if ids["S31"] {
+		t.Error("St George should be outside the Midtown box")
+	}
+}
+
+func TestSubwayStopsInBoundsValidation(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"missing param", "minLat=40.74&minLng=-74.0&maxLat=40.76", "MISSING_PARAMETER"},
+		{"not a number", "minLat=abc&minLng=-74.0&maxLat=40.76&maxLng=-73.97", "INVALID_COORDINATES"},
+		{"inverted lat", "minLat=40.76&minLng=-74.0&maxLat=40.74&maxLng=-73.97", "INVALID_BOUNDS"},
+		{"inverted lng", "minLat=40.74&minLng=-73.97&maxLat=40.76&maxLng=-74.0", "INVALID_BOUNDS"},
+		{"too large", "minLat=40.4&minLng=-74.3&maxLat=40.95&maxLng=-73.7", "INVALID_BOUNDS"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, "/transit/subway/stops/bbox?"+tc.query)
+			assertStatus(t, resp, http.StatusBadRequest)
+			assertError(t, decodeBody(t, resp), tc.code)
+		})
+	}
+}
+
+func TestSubwayStopsExport(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	stops := location.NewStopService()
+	if _, err := stops.Load(filepath.Join(dataDir(t), "stops.txt")); err != nil {
+		t.Fatalf("load stops: %v", err)
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		for _, tc := range []struct {
+			query    string
+			wantRows int
+			wantFile string
+		}{
+			{"", stops.ParentStationCount(), "subway-stations.csv"},
+			{"?format=CSV&include_children=true", stops.Count(), "subway-stops.csv"},
+		} {
+			resp := get(t, srv, "/transit/subway/stops/export"+tc.query)
+			assertStatus(t, resp, http.StatusOK)
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+				t.Errorf("%q: Content-Type = %q, want text/csv", tc.query, ct)
+			}
+			if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "attachment") || !strings.Contains(cd, tc.wantFile) {
+				t.Errorf("%q: Content-Disposition = %q, want an attachment named %s", tc.query, cd, tc.wantFile)
+			}
+
+			records, err := csv.NewReader(resp.Body).ReadAll()
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("%q: read CSV: %v", tc.query, err)
+			}
+			wantHeader := []string{"stop_id", "stop_name", "stop_lat", "stop_lon", "location_type", "parent_station", "stop_code", "complex_id"}
+			if len(records) == 0 || !slices.Equal(records[0], wantHeader) {
+				t.Fatalf("%q: header = %v, want %v", tc.query, records[:min(1, len(records))], wantHeader)
+			}
+			if rows := len(records) - 1; rows != tc.wantRows {
+				t.Errorf("%q: %d rows, want %d", tc.query, rows, tc.wantRows)
+			}
+		}
+	})
+
+	t.Run("geojson", func(t *testing.T) {
+		resp := get(t, srv, "/transit/subway/stops/export?format=geojson")
+		assertStatus(t, resp, http.StatusOK)
+		if ct := resp.Header.Get("Content-Type"); ct != "application/geo+json" {
+			t.Errorf("Content-Type = %q, want application/geo+json", ct)
+		}
+
+		var collection struct {
+			Type     string `json:"type"`
+			Features []struct {
+				Type     string `json:"type"`
+				Geometry struct {
+					Type        string    `json:"type"`
+					Coordinates []float64 `json:"coordinates"`
+				} `json:"geometry"`
+				Properties map[string]any `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&collection); err != nil {
+			t.Fatalf("decode GeoJSON: %v", err)
+		}
+		resp.Body.Close()
+
+		if collection.Type != "FeatureCollection" || len(collection.Features) != stops.ParentStationCount() {
+			t.Fatalf("got %s with %d features, want FeatureCollection with %d", collection.Type, len(collection.Features), stops.ParentStationCount())
+		}
+		for _, f := range collection.Features {
+			if f.Properties["stop_id"] != "127" {
+				continue
+			}
+			// Times Sq, longitude first
+			c := f.Geometry.Coordinates
+			if f.Type != "Feature" || f.Geometry.Type != "Point" || len(c) != 2 || c[0] > -73 || c[1] < 40 {
+				t.Errorf("127 feature = %+v, want a [lng, lat] Point", f)
+			}
+			return
+		}
+		t.Error("127 missing from export")
+	})
+
+	t.Run("bad format", func(t *testing.T) {
+		resp := get(t, srv, "/transit/subway/stops/export?format=kml")
+		assertStatus(t, resp, http.StatusBadRequest)
+		assertError(t, decodeBody(t, resp), "INVALID_PARAMETER")
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Bus endpoints
+// ---------------------------------------------------------------------------
+
+func TestBusNearZipNoAPIKey(t *testing.T) {
+	noKeyBus := &mockBusProvider{hasKey: false}
+	srv := newTestServer(t, defaultSubway(), noKeyBus)
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/bus/near/10001")
+	assertStatus(t, resp, http.StatusServiceUnavailable)
+
+	body := decodeBody(t, resp)
+	assertField(t, body, "error")
+}
+
+func TestBusNearZip(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"valid zip", "/transit/bus/near/10001", http.StatusOK},
+		{"non-NYC zip", "/transit/bus/near/99999", http.StatusNotFound},
+		{"too short", "/transit/bus/near/100", http.StatusBadRequest},
+		{"letters", "/transit/bus/near/abcde", http.StatusBadRequest},
+	}
+
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, tc.path)
+			assertStatus(t, resp, tc.status)
+		})
+	}
+}
+
+func TestBusNearZipResponse(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/bus/near/10001")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "arrivals")
+	assertField(t, body, "count")
+	assertField(t, body, "zip_code")
+}
+
+func TestBusNearArrivalLimit(t *testing.T) {
+	bus := defaultBus()
+	for i := 0; i < 30; i++ {
+		bus.arrivals = append(bus.arrivals, transit.BusArrival{Route: "M34", MinutesAway: i})
+	}
+	srv := newTestServer(t, defaultSubway(), bus)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/transit/bus/near/10001", transit.DefaultBusArrivals},
+		{"/transit/bus/near/10001?arrival_limit=3", 3},
+		{"/transit/bus/near/10001?limit=2&arrival_limit=7", 7},
+		{"/transit/bus/near?lat=40.7484&lng=-73.9967&arrival_limit=4", 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			resp := get(t, srv, tc.path)
+			assertStatus(t, resp, http.StatusOK)
+
+			body := decodeBody(t, resp)
+			if got := len(body["arrivals"].([]any)); got != tc.want {
+				t.Errorf("got %d arrivals, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBusNearCoords(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"valid coords", "/transit/bus/near?lat=40.7484&lng=-73.9967", http.StatusOK},
+		{"missing lat", "/transit/bus/near?lng=-73.9967", http.StatusBadRequest},
+		{"missing lng", "/transit/bus/near?lat=40.7484", http.StatusBadRequest},
+		{"invalid lat", "/transit/bus/near?lat=abc&lng=-73.9967", http.StatusBadRequest},
+	}
+
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := get(t, srv, tc.path)
+			assertStatus(t, resp, tc.status)
+		})
+	}
+}
+
+func TestBusStopsNearZip(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/bus/stops/10001")
+	assertStatus(t, resp, http.StatusOK)
+
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+	assertField(t, body, "stops")
+	assertField(t, body, "count")
+}
+
+func TestBusStopsNearZipRouteFilter(t *testing.T) {
+	bus := defaultBus()
+	bus.stops = []transit.BusStop{
+		{ID: "MTA_1", Name: "5 AV/W 34 ST", Routes: []string{"M34", "M34A+"}},
+		{ID: "MTA_2", Name: "5 AV/W 33 ST", Routes: []string{"M1", "M2"}},
+		{ID: "MTA_3", Name: "6 AV/W 34 ST"},
+	}
+	srv := newTestServer(t, defaultSubway(), bus)
+	defer srv.Close()
+
+	ids := func(path string) []string {
+		t.Helper()
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		var ids []string
+		for _, s := range body["stops"].([]any) {
+			ids = append(ids, s.(map[string]any)["id"].(string))
+		}
+		if body["count"] != float64(len(ids)) {
+			t.Errorf("%s: count = %v, want %d", path, body["count"], len(ids))
+		}
+		return ids
+	}
+
+	if got := ids("/transit/bus/stops/10001"); len(got) != 3 {
+		t.Errorf("unfiltered = %v, want all 3 stops", got)
+	}
+	if got := ids("/transit/bus/stops/10001?route=m34"); !slices.Equal(got, []string{"MTA_1"}) {
+		t.Errorf("route=m34 = %v, want [MTA_1]", got)
+	}
+	if got := ids("/transit/bus/stops/10001?route=Q58"); len(got) != 0 {
+		t.Errorf("route=Q58 = %v, want none", got)
+	}
+}
+
+func TestBusServiceError(t *testing.T) {
+	failBus := &mockBusProvider{hasKey: true, err: errors.New("upstream error")}
+	srv := newTestServer(t, defaultSubway(), failBus)
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/bus/near/10001")
+	assertStatus(t, resp, http.StatusInternalServerError)
+
+	body := decodeBody(t, resp)
+	assertField(t, body, "error")
+}
+
+func TestBusArrivalsPartialFailure(t *testing.T) {
+	bus := defaultBus()
+	bus.stops = append(bus.stops, transit.BusStop{ID: "MTA_401906", Name: "W 34 ST/6 AV", Lat: 40.7496, Lng: -73.9880})
+	bus.failedStops = 1
+	srv := newTestServer(t, defaultSubway(), bus)
+	defer srv.Close()
+
+	for _, path := range []string{"/transit/bus/near/10001", "/transit/bus/near?lat=40.7484&lng=-73.9967"} {
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		body := decodeBody(t, resp)
+		assertSuccess(t, body)
+		if body["partial"] != true {
+			t.Errorf("%s: partial = %v, want true", path, body["partial"])
+		}
+		if body["failed_stops"] != float64(1) {
+			t.Errorf("%s: failed_stops = %v, want 1", path, body["failed_stops"])
+		}
+	}
+
+	// A complete result reports partial=false
+	srv2 := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv2.Close()
+	body := decodeBody(t, get(t, srv2, "/transit/bus/near/10001"))
+	if body["partial"] != false {
+		t.Errorf("partial = %v, want false", body["partial"])
+	}
+}
+
+func TestBusArrivalsAllStopsFailed(t *testing.T) {
+	bus := &mockBusProvider{hasKey: true, err: fmt.Errorf("%w (3 stops): status 503", transit.ErrAllStopsFailed)}
+	srv := newTestServer(t, defaultSubway(), bus)
+	defer srv.Close()
+
+	resp := get(t, srv, "/transit/bus/near/10001")
+	assertStatus(t, resp, http.StatusBadGateway)
+	assertError(t, decodeBody(t, resp), "UPSTREAM_ERROR")
+}
+
+func TestBusArrivalsUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		upstream   int
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+	}{
+		{"rejected key", http.StatusUnauthorized, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "check MTA_BUS_API_KEY"},
+		{"forbidden key", http.StatusForbidden, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "check MTA_BUS_API_KEY"},
+		{"bus time down", http.StatusServiceUnavailable, http.StatusBadGateway, "UPSTREAM_ERROR", "bus API unavailable (status 503)"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Stop lookups succeed; every stop-monitoring call fails
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/stops-for-location.json") {
+					w.Write([]byte(`{"data":{"stops":[{"id":"MTA_1","name":"W 34 ST/8 AV","lat":40.7523,"lon":-73.9932}]}}`))
+					return
+				}
+				w.WriteHeader(tc.upstream)
+			}))
+			defer upstream.Close()
+
+			bus := transit.NewBusService("key", upstream.Client(), time.Minute, time.Minute)
+			bus.SetBaseURL(upstream.URL)
+			srv := newTestServer(t, defaultSubway(), bus)
+			defer srv.Close()
+
+			resp := get(t, srv, "/transit/bus/near/10001")
+			assertStatus(t, resp, tc.wantStatus)
+			body := decodeBody(t, resp)
+			assertError(t, body, tc.wantCode)
+			msg, _ := body["error"].(map[string]any)["message"].(string)
+			if !strings.Contains(msg, tc.wantMsg) {
+				t.Errorf("message = %q, want it to mention %q", msg, tc.wantMsg)
+			}
+			if strings.Contains(msg, "key=") {
+				t.Errorf("message %q leaks the request URL", msg)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Admin endpoints
+// ---------------------------------------------------------------------------
+
+func TestAdminReload(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret"}
+	srv := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	before := decodeBody(t, get(t, srv, "/transit/location/info"))["coverage"].(map[string]any)
+
+	resp := post(t, srv, "/admin/reload", "secret")
+	assertStatus(t, resp, http.StatusOK)
+	body := decodeBody(t, resp)
+	assertSuccess(t, body)
+
+	if body["zipcodes"] != before["zipcodes"] {
+		t.Errorf("zipcodes after reload = %v, want %v", body["zipcodes"], before["zipcodes"])
+	}
+	if body["subway_stations"] != before["subway_stations"] {
+		t.Errorf("subway_stations after reload = %v, want %v", body["subway_stations"], before["subway_stations"])
+	}
+}
+
+func TestAdminReloadUnauthorized(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret"}
+	srv := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, token := range []string{"", "wrong"} {
+		resp := post(t, srv, "/admin/reload", token)
+		assertStatus(t, resp, http.StatusUnauthorized)
+		resp.Body.Close()
+	}
+}
+
+func TestAdminReloadDisabledWithoutToken(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	resp := post(t, srv, "/admin/reload", "anything")
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Error("admin reload should not be available without a configured token")
+	}
+}
+
+func TestAdminReloadWrongMethod(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret"}
+	srv := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
+	defer srv.Close()
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		req, _ := http.NewRequest(method, srv.URL+"/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s /admin/reload: %v", method, err)
+		}
+		assertStatus(t, resp, http.StatusMethodNotAllowed)
+		if got := resp.Header.Get("Allow"); got != "POST" {
+			t.Errorf("%s: Allow = %q, want POST", method, got)
+		}
+		assertError(t, decodeBody(t, resp), "METHOD_NOT_ALLOWED")
+	}
+}
+
+func TestAdminReloadOversizedBody(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret", MaxRequestBodyBytes: 64}
+	srv := newTestServerWithConfig(t, cfg, defaultSubway(), defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/location/zipcodes/all?borough=Manhattan")
-	assertStatus(t, resp, http.StatusOK)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/reload", strings.NewReader(strings.Repeat("x", 65)))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /admin/reload: %v", err)
+	}
+	assertStatus(t, resp, http.StatusRequestEntityTooLarge)
+	assertError(t, decodeBody(t, resp), "PAYLOAD_TOO_LARGE")
 
-	body := decodeBody(t, resp)
-	assertSuccess(t, body)
-	assertField(t, body, "zipcodes")
+	// A body within the cap is accepted
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/admin/reload", strings.NewReader("{}"))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /admin/reload: %v", err)
+	}
+	assertStatus(t, resp, http.StatusOK)
+	resp.Body.Close()
 }
 
-// ---------------------------------------------------------------------------
-// Subway endpoints
-// ---------------------------------------------------------------------------
-
-func TestSubwayStation(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestAdminCacheFlush(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret"}
+	subway := &mockSubwayProvider{cached: 3}
+	bus := &mockBusProvider{hasKey: true, cached: 2}
+	alerts := &mockAlertProvider{cached: 1}
+	srv := newTestServerWithAlerts(t, cfg, subway, bus, alerts)
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/subway/station/127")
+	resp := post(t, srv, "/admin/cache/flush?scope=bus", "secret")
 	assertStatus(t, resp, http.StatusOK)
+	cleared := decodeBody(t, resp)["cleared"].(map[string]any)
+	if len(cleared) != 1 || cleared["bus"] != float64(2) {
+		t.Errorf("scoped flush cleared %v, want only bus: 2", cleared)
+	}
+	if bus.cached != 0 || subway.cached != 3 {
+		t.Errorf("after bus flush: bus %d, subway %d cached; want 0 and 3", bus.cached, subway.cached)
+	}
 
+	resp = post(t, srv, "/admin/cache/flush", "secret")
+	assertStatus(t, resp, http.StatusOK)
 	body := decodeBody(t, resp)
 	assertSuccess(t, body)
-	assertField(t, body, "arrivals")
-	assertField(t, body, "stop_id")
+	cleared = body["cleared"].(map[string]any)
+	want := map[string]float64{"subway": 3, "bus": 0, "alerts": 1}
+	for name, n := range want {
+		if cleared[name] != n {
+			t.Errorf("cleared[%s] = %v, want %v", name, cleared[name], n)
+		}
+	}
+	if subway.cached != 0 || alerts.cached != 0 {
+		t.Error("full flush left caches populated")
+	}
+
+	resp = post(t, srv, "/admin/cache/flush?scope=ferry", "secret")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), "INVALID_PARAMETER")
 }
 
-func TestSubwayStationServiceError(t *testing.T) {
-	failSubway := &mockSubwayProvider{err: errors.New("feed unavailable")}
-	srv := newTestServer(t, failSubway, defaultBus())
+func TestAdminCacheFlushUnauthorized(t *testing.T) {
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second, AdminToken: "secret"}
+	subway := &mockSubwayProvider{cached: 3}
+	srv := newTestServerWithConfig(t, cfg, subway, defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/subway/station/127")
-	assertStatus(t, resp, http.StatusInternalServerError)
-
-	body := decodeBody(t, resp)
-	assertField(t, body, "error")
+	for _, token := range []string{"", "wrong"} {
+		resp := post(t, srv, "/admin/cache/flush", token)
+		assertStatus(t, resp, http.StatusUnauthorized)
+		assertError(t, decodeBody(t, resp), "UNAUTHORIZED")
+	}
+	if subway.cached != 3 {
+		t.Errorf("unauthorized flush cleared the cache (%d left)", subway.cached)
+	}
 }
 
-func TestSubwayNearZip(t *testing.T) {
+// ---------------------------------------------------------------------------
+// Error responses
+// ---------------------------------------------------------------------------
+
+func TestErrorResponses(t *testing.T) {
 	tests := []struct {
 		name   string
 		path   string
+		bus    *mockBusProvider
 		status int
+		code   string
 	}{
-		{"valid zip", "/transit/subway/near/10001", http.StatusOK},
-		{"non-NYC zip", "/transit/subway/near/99999", http.StatusNotFound},
-		{"too short", "/transit/subway/near/100", http.StatusBadRequest},
-		{"with radius", "/transit/subway/near/10001?radius=1600", http.StatusOK},
-		{"with limit", "/transit/subway/near/10001?limit=2", http.StatusOK},
+		{"invalid zip", "/transit/location/zip/abc", nil, http.StatusBadRequest, "INVALID_ZIP"},
+		{"unknown zip", "/transit/subway/near/99999", nil, http.StatusNotFound, "ZIP_NOT_FOUND"},
+		{"missing coordinates", "/transit/subway/near", nil, http.StatusBadRequest, "MISSING_PARAMETER"},
+		{"invalid coordinates", "/transit/subway/near?lat=abc&lng=-73.99", nil, http.StatusBadRequest, "INVALID_COORDINATES"},
+		{"unknown feed", "/transit/subway/feed/xyz", nil, http.StatusNotFound, "FEED_NOT_FOUND"},
+		{"unknown route", "/transit/subway/route/K/arrivals", nil, http.StatusNotFound, "ROUTE_NOT_FOUND"},
+		{"bus not configured", "/transit/bus/near/10001", &mockBusProvider{hasKey: false}, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := defaultBus()
+			if tt.bus != nil {
+				bus = tt.bus
+			}
+			srv := newTestServer(t, defaultSubway(), bus)
+			defer srv.Close()
+
+			resp := get(t, srv, tt.path)
+			assertStatus(t, resp, tt.status)
+			assertError(t, decodeBody(t, resp), tt.code)
+		})
 	}
+}
 
+func TestUnknownAPIPathReturnsJSON404(t *testing.T) {
 	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
 
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			resp := get(t, srv, tc.path)
-			assertStatus(t, resp, tc.status)
-		})
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/transit/nope"},
+		{http.MethodGet, "/transit/subway/station/127/extra"},
+		{http.MethodGet, "/api/v2"},
+		{http.MethodPost, "/transit/nope"},
+	} {
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		assertStatus(t, resp, http.StatusNotFound)
+		assertError(t, decodeBody(t, resp), "ROUTE_NOT_FOUND")
 	}
 }
 
-func TestSubwayNearZipResponse(t *testing.T) {
+func TestWrongMethodOnGetRoute(t *testing.T) {
 	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/subway/near/10001")
+	for _, path := range []string{"/health", "/transit/subway/station/127", "/transit/subway/near"} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		assertStatus(t, resp, http.StatusMethodNotAllowed)
+		if got := resp.Header.Get("Allow"); got != "GET, HEAD" {
+			t.Errorf("POST %s: Allow = %q, want GET, HEAD", path, got)
+		}
+		assertError(t, decodeBody(t, resp), "METHOD_NOT_ALLOWED")
+	}
+}
+
+// newFrontendServer is a test server that also serves webFS as the frontend
+func newFrontendServer(t *testing.T, cfg *config.Config, webFS fstest.MapFS) *httptest.Server {
+	t.Helper()
+	dir := dataDir(t)
+	zipSvc := location.NewZipCodeService()
+	t.Cleanup(zipSvc.Close)
+	if err := zipSvc.Load(filepath.Join(dir, "nyc-zipcodes.json")); err != nil {
+		t.Fatalf("load zip codes: %v", err)
+	}
+	stopSvc := location.NewStopService()
+	if _, err := stopSvc.Load(filepath.Join(dir, "stops.txt")); err != nil {
+		t.Fatalf("load stops: %v", err)
+	}
+	return httptest.NewServer(api.NewRouter(cfg, zipSvc, stopSvc, defaultSubway(), defaultBus(), &mockAlertProvider{}, webFS))
+}
+
+func TestFrontendServedAlongsideJSON404(t *testing.T) {
+	webFS := fstest.MapFS{"index.html": {Data: []byte("<h1>emteeayy</h1>")}}
+	srv := newFrontendServer(t, &config.Config{HTTPTimeout: 5 * time.Second}, webFS)
+	defer srv.Close()
+
+	resp := get(t, srv, "/")
 	assertStatus(t, resp, http.StatusOK)
+	if page, _ := io.ReadAll(resp.Body); !strings.Contains(string(page), "emteeayy") {
+		t.Errorf("GET / = %q, want the frontend", page)
+	}
+	resp.Body.Close()
 
-	body := decodeBody(t, resp)
-	assertSuccess(t, body)
-	assertField(t, body, "stations")
-	assertField(t, body, "count")
-	assertField(t, body, "zip_code")
-	assertField(t, body, "radius_meters")
+	resp = get(t, srv, "/transit/nope")
+	assertStatus(t, resp, http.StatusNotFound)
+	assertError(t, decodeBody(t, resp), "ROUTE_NOT_FOUND")
 }
 
-func TestSubwayNearCoords(t *testing.T) {
+func TestTrailingSlashReachesRoute(t *testing.T) {
+	webFS := fstest.MapFS{
+		"index.html":      {Data: []byte("<h1>emteeayy</h1>")},
+		"docs/index.html": {Data: []byte("<h1>docs</h1>")},
+	}
+	srv := newFrontendServer(t, &config.Config{HTTPTimeout: 5 * time.Second}, webFS)
+	defer srv.Close()
+
+	for _, path := range []string{
+		"/transit/location/boroughs/",
+		"/transit/subway/station/127/",
+		"/transit/location/zip/10001/closest/",
+		"/health/",
+	} {
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusOK)
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("GET %s: Content-Type = %q, want the JSON route", path, ct)
+		}
+		resp.Body.Close()
+	}
+
+	// Unknown API paths still get the JSON 404
+	resp := get(t, srv, "/transit/nope/")
+	assertStatus(t, resp, http.StatusNotFound)
+	assertError(t, decodeBody(t, resp), "ROUTE_NOT_FOUND")
+
+	// Frontend directories keep their slash
+	resp = get(t, srv, "/docs/")
+	assertStatus(t, resp, http.StatusOK)
+	if page, _ := io.ReadAll(resp.Body); !strings.Contains(string(page), "docs") {
+		t.Errorf("GET /docs/ = %q, want the docs page", page)
+	}
+	resp.Body.Close()
+}
+
+func TestFrontendCacheControl(t *testing.T) {
+	webFS := fstest.MapFS{
+		"index.html":      {Data: []byte("<h1>emteeayy</h1>")},
+		"app.js":          {Data: []byte("console.log(1)")},
+		"app.3f2a9c1b.js": {Data: []byte("console.log(2)")},
+	}
+
 	tests := []struct {
-		name   string
-		path   string
-		status int
+		env    string
+		maxAge time.Duration
+		want   map[string]string
 	}{
-		{"valid coords", "/transit/subway/near?lat=40.7484&lng=-73.9967", http.StatusOK},
-		{"missing lat", "/transit/subway/near?lng=-73.9967", http.StatusBadRequest},
-		{"missing lng", "/transit/subway/near?lat=40.7484", http.StatusBadRequest},
-		{"invalid lat", "/transit/subway/near?lat=abc&lng=-73.9967", http.StatusBadRequest},
-		{"invalid lng", "/transit/subway/near?lat=40.7484&lng=xyz", http.StatusBadRequest},
+		{"development", 0, map[string]string{
+			"/":                "no-cache",
+			"/app.js":          "no-cache",
+			"/app.3f2a9c1b.js": "no-cache",
+		}},
+		{"production", 0, map[string]string{
+			"/":                "no-cache",
+			"/index.html":      "no-cache",
+			"/app.js":          "public, max-age=3600",
+			"/app.3f2a9c1b.js": "public, max-age=31536000, immutable",
+		}},
+		{"production", 10 * time.Minute, map[string]string{
+			"/app.js": "public, max-age=600",
+		}},
+	}
+	for _, tc := range tests {
+		cfg := &config.Config{HTTPTimeout: 5 * time.Second, Env: tc.env, StaticMaxAge: tc.maxAge}
+		srv := newFrontendServer(t, cfg, webFS)
+		for path, want := range tc.want {
+			resp := get(t, srv, path)
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				t.Errorf("%s %s: status %d", tc.env, path, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Cache-Control"); got != want {
+				t.Errorf("%s (max age %v) %s: Cache-Control = %q, want %q", tc.env, tc.maxAge, path, got, want)
+			}
+		}
+		srv.Close()
 	}
 
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+	// API responses are left alone
+	srv := newFrontendServer(t, &config.Config{HTTPTimeout: 5 * time.Second}, webFS)
 	defer srv.Close()
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			resp := get(t, srv, tc.path)
-			assertStatus(t, resp, tc.status)
-		})
+	resp := get(t, srv, "/health")
+	resp.Body.Close()
+	if got := resp.Header.Get("Cache-Control"); got != "" {
+		t.Errorf("/health Cache-Control = %q, want none from the static policy", got)
 	}
 }
 
-func TestSubwayStopsNearZip(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestHealthUpstream(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	subway := defaultSubway()
+	subway.upstreams = []string{up.URL + "/gtfs-ace", up.URL + "/gtfs-g", down.URL + "/gtfs-l"}
+	srv := newTestServer(t, subway, defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/subway/stops/10001")
+	resp := get(t, srv, "/health/upstream")
 	assertStatus(t, resp, http.StatusOK)
-
 	body := decodeBody(t, resp)
-	assertSuccess(t, body)
-	assertField(t, body, "stops")
-	assertField(t, body, "count")
+	if body["status"] != "degraded" {
+		t.Errorf("status = %v, want degraded with one host down", body["status"])
+	}
+
+	reachable := map[string]bool{}
+	for _, u := range body["upstreams"].([]any) {
+		u := u.(map[string]any)
+		reachable[u["host"].(string)] = u["reachable"].(bool)
+		if _, ok := u["latency_ms"].(float64); !ok {
+			t.Errorf("%v: latency_ms missing", u["host"])
+		}
+	}
+	want := map[string]bool{up.URL: true, down.URL: false}
+	if !maps.Equal(reachable, want) {
+		t.Errorf("reachability = %v, want %v", reachable, want)
+	}
 }
 
-// ---------------------------------------------------------------------------
-// Bus endpoints
-// ---------------------------------------------------------------------------
+func TestRequestIDHeader(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
+	defer srv.Close()
 
-func TestBusNearZipNoAPIKey(t *testing.T) {
-	noKeyBus := &mockBusProvider{hasKey: false}
-	srv := newTestServer(t, defaultSubway(), noKeyBus)
+	resp := get(t, srv, "/health")
+	resp.Body.Close()
+	if id := resp.Header.Get("X-Request-ID"); len(id) != 16 {
+		t.Errorf("generated X-Request-ID = %q, want 16 hex chars", id)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/health", nil)
+	req.Header.Set("X-Request-ID", "client-abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /health: %v", err)
+	}
+	resp.Body.Close()
+	if id := resp.Header.Get("X-Request-ID"); id != "client-abc" {
+		t.Errorf("X-Request-ID = %q, want the client's ID echoed", id)
+	}
+}
+
+func TestResponseTimeHeader(t *testing.T) {
+	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/bus/near/10001")
-	assertStatus(t, resp, http.StatusServiceUnavailable)
+	// A JSON success, a handler-written error status, and a mux 405
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/health"},
+		{http.MethodGet, "/transit/location/zip/abc"},
+		{http.MethodPost, "/health"},
+	} {
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
 
-	body := decodeBody(t, resp)
-	assertField(t, body, "error")
+		raw := resp.Header.Get("X-Response-Time-Ms")
+		ms, err := strconv.ParseFloat(raw, 64)
+		if err != nil || ms < 0 {
+			t.Errorf("%s %s (%d): X-Response-Time-Ms = %q, want a non-negative number", tc.method, tc.path, resp.StatusCode, raw)
+		}
+	}
 }
 
-func TestBusNearZip(t *testing.T) {
+func TestPanicResponseByEnvironment(t *testing.T) {
+	subway := &mockSubwayProvider{panicMsg: "nil map write in station lookup"}
+
 	tests := []struct {
-		name   string
-		path   string
+		env         string
+		wantSummary bool
+	}{
+		{"development", true},
+		{"production", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.env, func(t *testing.T) {
+			cfg := &config.Config{Env: tc.env, HTTPTimeout: 5 * time.Second}
+			srv := newTestServerWithConfig(t, cfg, subway, defaultBus())
+			defer srv.Close()
+
+			resp := get(t, srv, "/transit/subway/station/127")
+			assertStatus(t, resp, http.StatusInternalServerError)
+			body := decodeBody(t, resp)
+			assertError(t, body, "INTERNAL_ERROR")
+
+			msg := body["error"].(map[string]any)["message"].(string)
+			if got := strings.Contains(msg, "nil map write"); got != tc.wantSummary {
+				t.Errorf("message %q: panic summary included = %v, want %v", msg, got, tc.wantSummary)
+			}
+			if !tc.wantSummary && msg != "Internal Server Error" {
+				t.Errorf("production message = %q, want generic", msg)
+			}
+		})
+	}
+}
+
+func TestZipEndpointsRejectBadZips(t *testing.T) {
+	endpoints := []string{
+		"/transit/location/zip/%s",
+		"/transit/location/zip/%s/closest",
+		"/transit/subway/near/%s",
+		"/transit/subway/nearest/%s",
+		"/transit/subway/stops/%s",
+		"/transit/bus/near/%s",
+		"/transit/bus/stops/%s",
+	}
+	cases := []struct {
+		zip    string
 		status int
+		code   string
 	}{
-		{"valid zip", "/transit/bus/near/10001", http.StatusOK},
-		{"non-NYC zip", "/transit/bus/near/99999", http.StatusNotFound},
-		{"too short", "/transit/bus/near/100", http.StatusBadRequest},
+		{"12ab5", http.StatusBadRequest, "INVALID_ZIP"},
+		{"99999", http.StatusNotFound, "ZIP_NOT_FOUND"},
 	}
 
 	srv := newTestServer(t, defaultSubway(), defaultBus())
 	defer srv.Close()
 
+	for _, endpoint := range endpoints {
+		for _, tc := range cases {
+			path := fmt.Sprintf(endpoint, tc.zip)
+			t.Run(path, func(t *testing.T) {
+				resp := get(t, srv, path)
+				assertStatus(t, resp, tc.status)
+				assertError(t, decodeBody(t, resp), tc.code)
+			})
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Service alerts
+// ---------------------------------------------------------------------------
+
+func TestServiceAlertsSeverityFilter(t *testing.T) {
+	alerts := &mockAlertProvider{alerts: []transit.ServiceAlert{
+		{ID: "1", Header: "Suspended", Severity: "severe", Effect: "no_service"},
+		{ID: "2", Header: "Planned work", Severity: "warning", Cause: "maintenance"},
+		{ID: "3", Header: "Elevator out", Severity: "info"},
+		{ID: "4", Header: "Unclassified"},
+	}}
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second}
+	srv := newTestServerWithAlerts(t, cfg, defaultSubway(), defaultBus(), alerts)
+	defer srv.Close()
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 4},
+		{"?severity=severe", 1},
+		{"?severity=SEVERE,warning", 2},
+		{"?severity=bogus", 0},
+	}
 	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			resp := get(t, srv, tc.path)
-			assertStatus(t, resp, tc.status)
+		t.Run(tc.query, func(t *testing.T) {
+			resp := get(t, srv, "/transit/subway/alerts"+tc.query)
+			assertStatus(t, resp, http.StatusOK)
+
+			body := decodeBody(t, resp)
+			if got := int(body["count"].(float64)); got != tc.want {
+				t.Errorf("count = %d, want %d", got, tc.want)
+			}
 		})
 	}
 }
 
-func TestBusNearZipResponse(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestServiceAlertsActiveParam(t *testing.T) {
+	now := time.Now()
+	alerts := &mockAlertProvider{alerts: []transit.ServiceAlert{
+		{ID: "past", Header: "Over", ActivePeriods: []transit.ActivePeriod{{Start: now.Add(-4 * time.Hour), End: now.Add(-time.Hour)}}},
+		{ID: "current", Header: "Delays", ActivePeriods: []transit.ActivePeriod{{Start: now.Add(-time.Hour), End: now.Add(time.Hour)}}},
+		{ID: "future", Header: "Weekend work", ActivePeriods: []transit.ActivePeriod{{Start: now.Add(24 * time.Hour)}}},
+	}}
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second}
+	srv := newTestServerWithAlerts(t, cfg, defaultSubway(), defaultBus(), alerts)
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/bus/near/10001")
-	assertStatus(t, resp, http.StatusOK)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"current"}},
+		{"?active=now", []string{"current"}},
+		{"?active=upcoming", []string{"future"}},
+		{"?active=ALL", []string{"past", "current", "future"}},
+	}
+	for _, tc := range tests {
+		resp := get(t, srv, "/transit/subway/alerts"+tc.query)
+		assertStatus(t, resp, http.StatusOK)
+		var got []string
+		for _, a := range decodeBody(t, resp)["alerts"].([]any) {
+			got = append(got, a.(map[string]any)["id"].(string))
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q: alerts = %v, want %v", tc.query, got, tc.want)
+		}
+	}
 
-	body := decodeBody(t, resp)
-	assertSuccess(t, body)
-	assertField(t, body, "arrivals")
-	assertField(t, body, "count")
-	assertField(t, body, "zip_code")
+	resp := get(t, srv, "/transit/subway/alerts?active=soon")
+	assertStatus(t, resp, http.StatusBadRequest)
+	assertError(t, decodeBody(t, resp), "INVALID_PARAMETER")
 }
 
-func TestBusNearCoords(t *testing.T) {
-	tests := []struct {
-		name   string
-		path   string
-		status int
-	}{
-		{"valid coords", "/transit/bus/near?lat=40.7484&lng=-73.9967", http.StatusOK},
-		{"missing lat", "/transit/bus/near?lng=-73.9967", http.StatusBadRequest},
-		{"missing lng", "/transit/bus/near?lat=40.7484", http.StatusBadRequest},
-		{"invalid lat", "/transit/bus/near?lat=abc&lng=-73.9967", http.StatusBadRequest},
+func TestUpstreamCircuitOpen(t *testing.T) {
+	open := &transit.CircuitOpenError{Upstream: "alerts", RetryAfter: 12 * time.Second}
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second}
+	bus := &mockBusProvider{hasKey: true, err: fmt.Errorf("fetching stops: %w", open)}
+	srv := newTestServerWithAlerts(t, cfg, defaultSubway(), bus, &mockAlertProvider{err: open})
+	defer srv.Close()
+
+	for _, path := range []string{"/transit/subway/alerts", "/transit/bus/near/10001"} {
+		resp := get(t, srv, path)
+		assertStatus(t, resp, http.StatusServiceUnavailable)
+		if got := resp.Header.Get("Retry-After"); got != "12" {
+			t.Errorf("%s: Retry-After = %q, want 12", path, got)
+		}
+		assertError(t, decodeBody(t, resp), "SERVICE_UNAVAILABLE")
 	}
+}
 
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestServiceAlertsStopFilter(t *testing.T) {
+	alerts := &mockAlertProvider{alerts: []transit.ServiceAlert{
+		{ID: "times-sq-1", Header: "No downtown 1 at Times Sq", Routes: []string{"1"}, Stops: []string{"127S"}},
+		{ID: "times-sq-station", Header: "Times Sq elevator out", Stops: []string{"127"}},
+		{ID: "penn", Header: "Penn Station work", Routes: []string{"1"}, Stops: []string{"128N"}},
+		{ID: "route-only", Header: "A train delays", Routes: []string{"A"}},
+	}}
+	cfg := &config.Config{HTTPTimeout: 5 * time.Second}
+	srv := newTestServerWithAlerts(t, cfg, defaultSubway(), defaultBus(), alerts)
 	defer srv.Close()
 
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"base station", "?stop=127", []string{"times-sq-1", "times-sq-station"}},
+		{"platform ID", "?stop=127N", []string{"times-sq-1", "times-sq-station"}},
+		{"other station", "?stop=128", []string{"penn"}},
+		{"combined with routes", "?stop=127&routes=1", []string{"times-sq-1"}},
+		{"no matches", "?stop=A27", nil},
+	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			resp := get(t, srv, tc.path)
-			assertStatus(t, resp, tc.status)
+			resp := get(t, srv, "/transit/subway/alerts"+tc.query)
+			assertStatus(t, resp, http.StatusOK)
+
+			body := decodeBody(t, resp)
+			var got []string
+			for _, a := range body["alerts"].([]any) {
+				got = append(got, a.(map[string]any)["id"].(string))
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("alerts = %v, want %v", got, tc.want)
+			}
 		})
 	}
 }
 
-func TestBusStopsNearZip(t *testing.T) {
-	srv := newTestServer(t, defaultSubway(), defaultBus())
+func TestClusteredStationKeepsMergedArrivals(t *testing.T) {
+	dir := dataDir(t)
+	zipSvc := location.NewZipCodeService()
+	t.Cleanup(zipSvc.Close)
+	if err := zipSvc.Load(filepath.Join(dir, "nyc-zipcodes.json")); err != nil {
+		t.Fatalf("load zip codes: %v", err)
+	}
+	stopSvc := location.NewStopService()
+	if _, err := stopSvc.Load(filepath.Join(dir, "stops.txt")); err != nil {
+		t.Fatalf("load stops: %v", err)
+	}
+	stopSvc.SetClusterRadius(100)
+
+	// At Times Sq 127 (1/2/3) and 725 (7) are separate parent stations about
+	// 30m apart; clustering keeps 127 and folds 725 into it
+	now := time.Now()
+	subway := &mockSubwayProvider{byStation: map[string][]transit.Arrival{
+		"127": {{Route: "1", StopID: "127N", Direction: "northbound", ArrivalTime: now.Add(2 * time.Minute), MinutesAway: 2}},
+		"725": {{Route: "7", StopID: "725N", Direction: "northbound", ArrivalTime: now.Add(4 * time.Minute), MinutesAway: 4}},
+	}}
+	srv := httptest.NewServer(api.NewRouter(&config.Config{HTTPTimeout: 5 * time.Second}, zipSvc, stopSvc, subway, defaultBus(), &mockAlertProvider{}, nil))
 	defer srv.Close()
 
-	resp := get(t, srv, "/transit/bus/stops/10001")
+	resp := get(t, srv, "/transit/subway/near?lat=40.755290&lng=-73.987495&radius=50")
 	assertStatus(t, resp, http.StatusOK)
-
 	body := decodeBody(t, resp)
 	assertSuccess(t, body)
-	assertField(t, body, "stops")
-	assertField(t, body, "count")
-}
-
-func TestBusServiceError(t *testing.T) {
-	failBus := &mockBusProvider{hasKey: true, err: errors.New("upstream error")}
-	srv := newTestServer(t, defaultSubway(), failBus)
-	defer srv.Close()
-
-	resp := get(t, srv, "/transit/bus/near/10001")
-	assertStatus(t, resp, http.StatusInternalServerError)
 
-	body := decodeBody(t, resp)
-	assertField(t, body, "error")
+	stations := body["stations"].([]any)
+	if len(stations) != 1 {
+		t.Fatalf("got %d stations, want 127 with 725 merged in", len(stations))
+	}
+	station := stations[0].(map[string]any)
+	if station["stop_id"] != "127" {
+		t.Fatalf("stop_id = %v, want 127", station["stop_id"])
+	}
+	var routes []string
+	for _, arr := range station["northbound"].([]any) {
+		routes = append(routes, arr.(map[string]any)["route"].(string))
+	}
+	if !slices.Equal(routes, []string{"1", "7"}) {
+		t.Errorf("northbound routes = %v, want the 1 and the merged station's 7", routes)
+	}
 }
@@ -2,37 +2,87 @@
 package api
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"path"
+	"regexp"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/randytsao24/emteeayy/internal/api/handlers"
+	"github.com/randytsao24/emteeayy/internal/requestid"
+	"github.com/randytsao24/emteeayy/internal/transit"
 )
 
-// responseWriter wraps http.ResponseWriter to capture the status code
+// responseTimeHeader reports how long the server spent before responding
+const responseTimeHeader = "X-Response-Time-Ms"
+
+// responseWriter wraps http.ResponseWriter to capture the status code and
+// stamp the response time header as the status goes out
 type responseWriter struct {
 	http.ResponseWriter
 	status      int
 	wroteHeader bool
+	start       time.Time
 }
 
-func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+func wrapResponseWriter(w http.ResponseWriter, start time.Time) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK, start: start}
 }
 
+// WriteHeader sets the response time header, since headers can't change once
+// the status is sent. Only the first call counts, matching net/http.
 func (rw *responseWriter) WriteHeader(code int) {
 	if rw.wroteHeader {
 		return
 	}
 	rw.status = code
 	rw.wroteHeader = true
+	elapsed := float64(time.Since(rw.start).Microseconds()) / 1000
+	rw.Header().Set(responseTimeHeader, strconv.FormatFloat(elapsed, 'f', 3, 64))
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// Logging logs each HTTP request with method, path, status, and duration
+// Write sends an implicit 200 through WriteHeader first, as net/http would,
+// so handlers that never call WriteHeader still get the header
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer so http.ResponseController can reach
+// Flush and deadline controls
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 64
+
+// RequestID tags each request with an ID, reusing a reasonable X-Request-ID
+// from the client, and echoes it in the response so logs can be correlated
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// Logging logs each HTTP request with method, path, status, and duration,
+// and reports the time to first byte in an X-Response-Time-Ms header
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		wrapped := wrapResponseWriter(w)
+		wrapped := wrapResponseWriter(w, start)
 
 		next.ServeHTTP(wrapped, r)
 
@@ -41,24 +91,46 @@ func Logging(next http.Handler) http.Handler {
 			"path", r.URL.Path,
 			"status", wrapped.status,
 			"duration", time.Since(start).String(),
+			"request_id", requestid.FromContext(r.Context()),
 		)
 	})
 }
 
-// Recovery catches panics and returns a 500 error instead of crashing
-func Recovery(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				slog.Error("panic recovered",
-					"error", err,
-					"stack", string(debug.Stack()),
-				)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
-		}()
-		next.ServeHTTP(w, r)
-	})
+// maxPanicSummary caps the panic text exposed to clients in development
+const maxPanicSummary = 200
+
+// Recovery catches panics and returns a JSON 500 instead of crashing. The full
+// stack is always logged; exposeErrors (development only) also puts a short
+// summary of the panic in the response body.
+func Recovery(exposeErrors bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					slog.Error("panic recovered",
+						"error", err,
+						"stack", string(debug.Stack()),
+					)
+
+					message := "Internal Server Error"
+					if exposeErrors {
+						message += ": " + panicSummary(err)
+					}
+					handlers.WriteError(w, http.StatusInternalServerError, handlers.CodeInternalError, message)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// panicSummary renders a recovered value as a single short line
+func panicSummary(v any) string {
+	s := strings.Join(strings.Fields(fmt.Sprint(v)), " ")
+	if len(s) > maxPanicSummary {
+		s = s[:maxPanicSummary] + "..."
+	}
+	return s
 }
 
 // CORS adds Cross-Origin Resource Sharing headers
@@ -77,13 +149,172 @@ func CORS(next http.Handler) http.Handler {
 	})
 }
 
-// Timeout wraps requests with a timeout context
-func Timeout(duration time.Duration) func(http.Handler) http.Handler {
+// Timeout wraps requests with a timeout context. Streaming responses (SSE
+// paths ending in /stream, the near endpoints when NDJSON is asked for, the
+// stops export) are exempt since TimeoutHandler buffers the response and
+// can't flush. mux resolves which route a request is for.
+func Timeout(mux *http.ServeMux, duration time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return http.TimeoutHandler(next, duration, "Request timeout")
+		timed := http.TimeoutHandler(next, duration, "Request timeout")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreaming(mux, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(w, r)
+		})
 	}
 }
 
+// sseRoutes are the patterns whose handlers hold an event stream open
+var sseRoutes = map[string]bool{
+	"GET /transit/subway/station/{stopId}/stream": true,
+}
+
+// exportRoutes are downloads written row by row as they're read
+var exportRoutes = map[string]bool{
+	"GET /transit/subway/stops/export": true,
+}
+
+// ndjsonRoutes are the patterns whose handlers stream newline-delimited JSON
+// for Accept: application/x-ndjson. Anywhere else the header is ignored, so
+// it mustn't lift the timeout.
+var ndjsonRoutes = map[string]bool{
+	"GET /transit/subway/near/{zipcode}": true,
+	"GET /transit/subway/near":           true,
+}
+
+// isStreaming reports whether a request expects an incrementally flushed response
+func isStreaming(mux *http.ServeMux, r *http.Request) bool {
+	_, pattern := mux.Handler(r)
+	if sseRoutes[pattern] || exportRoutes[pattern] {
+		return true
+	}
+	// ?zips= on /transit/subway/near answers with one JSON document
+	return ndjsonRoutes[pattern] && !r.URL.Query().Has("zips") &&
+		strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// hashedAsset matches file names carrying a content hash, like app.3f2a9c1b.js
+// or index-0d5e77a4.css, whose contents never change under that name
+var hashedAsset = regexp.MustCompile(`(?i)[.-][0-9a-f]{8,}\.[a-z0-9]+$`)
+
+// defaultStaticMaxAge is how long browsers may reuse an unhashed asset when
+// no age is configured
+const defaultStaticMaxAge = time.Hour
+
+// StaticCache sets Cache-Control on frontend files. In development nothing is
+// cached, so edits on disk show up on reload. Otherwise hashed assets are
+// cached for a year as immutable, pages are revalidated every time so a
+// deploy is picked up, and other assets are cached for maxAge (an hour when
+// not positive).
+func StaticCache(development bool, maxAge time.Duration) func(http.Handler) http.Handler {
+	if maxAge <= 0 {
+		maxAge = defaultStaticMaxAge
+	}
+	assetPolicy := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := path.Base(r.URL.Path)
+			switch {
+			case development:
+				w.Header().Set("Cache-Control", "no-cache")
+			case hashedAsset.MatchString(name):
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			case strings.HasSuffix(r.URL.Path, "/") || path.Ext(name) == ".html":
+				w.Header().Set("Cache-Control", "no-cache")
+			default:
+				w.Header().Set("Cache-Control", assetPolicy)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// defaultMaxBodyBytes is used when no body cap is configured
+const defaultMaxBodyBytes = 1 << 20
+
+// LimitBody caps request bodies on write methods at maxBytes (1 MiB when not
+// positive). Requests that declare a larger Content-Length are rejected with
+// 413 up front; bodies of unknown length are wrapped so reads past the cap fail.
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > maxBytes {
+				handlers.WriteError(w, http.StatusRequestEntityTooLarge, handlers.CodePayloadTooLarge,
+					fmt.Sprintf("Request body must not exceed %d bytes", maxBytes))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// methodNotAllowed answers with a JSON 405 naming the allowed methods
+func methodNotAllowed(allowed []string) http.HandlerFunc {
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		handlers.WriteError(w, http.StatusMethodNotAllowed, handlers.CodeMethodNotAllowed,
+			fmt.Sprintf("Method %s not allowed; use %s", r.Method, allow))
+	}
+}
+
+// FeedMemo gives each request its own subway feed memo, so a handler that
+// looks up several stations parses each feed once. SSE streams are skipped:
+// they live for minutes and must see fresh feeds on every tick.
+func FeedMemo(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pattern := mux.Handler(r); sseRoutes[pattern] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(transit.WithFeedMemo(r.Context())))
+		})
+	}
+}
+
+// TrimTrailingSlash routes "/path/" as "/path" when only the trimmed path has
+// a route of its own in mux. Without it a stray slash falls through to a
+// catch-all: the frontend, or the JSON 404 under /transit/. The root and any
+// path whose trimmed form also lands on a catch-all, like the frontend's
+// directories, are left alone, so static files are served as before.
+func TrimTrailingSlash(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if len(path) > 1 && strings.HasSuffix(path, "/") {
+				trimmed := *r
+				u := *r.URL
+				u.Path = strings.TrimSuffix(u.Path, "/")
+				u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+				trimmed.URL = &u
+				if _, pattern := mux.Handler(r); isSubtree(pattern) {
+					if _, pattern := mux.Handler(&trimmed); pattern != "" && !isSubtree(pattern) {
+						r = &trimmed
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isSubtree reports whether a mux pattern is a catch-all for a path prefix
+func isSubtree(pattern string) bool {
+	return strings.HasSuffix(pattern, "/")
+}
+
 // Chain applies multiple middleware in order (first to last)
 func Chain(h http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
 	for i := len(middleware) - 1; i >= 0; i-- {
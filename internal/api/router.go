@@ -3,11 +3,14 @@ package api
 import (
 	"io/fs"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/randytsao24/emteeayy/internal/api/handlers"
 	"github.com/randytsao24/emteeayy/internal/config"
 	"github.com/randytsao24/emteeayy/internal/location"
+	"github.com/randytsao24/emteeayy/internal/transit"
 )
 
 // NewRouter creates and configures the HTTP router with all routes and middleware
@@ -21,55 +24,213 @@ func NewRouter(
 	webFS fs.FS,
 ) http.Handler {
 	mux := http.NewServeMux()
+	routes := &routeTable{mux: mux}
 
 	// Initialize handlers
-	healthHandler := handlers.NewHealthHandler()
+	upstreams := map[string]any{
+		"subway": subwaySvc,
+		"bus":    busSvc,
+		"alerts": alertSvc,
+	}
+	upstreamChecker := transit.NewUpstreamChecker(
+		transit.NewHTTPClient(cfg.UpstreamCheckTimeout, cfg.UserAgent, 1),
+		cfg.UpstreamCheckTimeout, cfg.UpstreamCheckTTL, upstreamURLs(upstreams))
+	healthHandler := handlers.NewHealthHandler(zipSvc, stopSvc, feedReporters(upstreams), upstreamChecker)
 	rootHandler := handlers.NewRootHandler()
-	locationHandler := handlers.NewLocationHandler(zipSvc, stopSvc)
-	transitHandler := handlers.NewTransitHandler(subwaySvc, busSvc, alertSvc, stopSvc, zipSvc)
+	locationHandler := handlers.NewLocationHandler(zipSvc, stopSvc, busSvc, handlers.SearchLimits{
+		DefaultRadius: cfg.LocationDefaultRadius,
+		MaxRadius:     cfg.LocationMaxRadius,
+		DefaultLimit:  cfg.LocationDefaultLimit,
+		MaxLimit:      cfg.LocationMaxLimit,
+	})
+	locationHandler.SetBoroughLimits(handlers.SearchLimits{
+		DefaultLimit: cfg.BoroughDefaultStations,
+		MaxLimit:     cfg.BoroughMaxStations,
+	})
+	transitHandler := handlers.NewTransitHandler(subwaySvc, busSvc, alertSvc, stopSvc, zipSvc, cfg.StreamInterval, handlers.SearchLimits{
+		DefaultRadius: cfg.SubwayDefaultRadius,
+		MaxRadius:     cfg.SubwayMaxRadius,
+		DefaultLimit:  cfg.SubwayDefaultStations,
+		MaxLimit:      cfg.SubwayMaxStations,
+	})
+	transitHandler.SetBusLimits(handlers.SearchLimits{
+		DefaultRadius: cfg.BusDefaultRadius,
+		MaxRadius:     cfg.BusMaxRadius,
+	})
+	transitHandler.SetMaxBusStops(cfg.MaxBusStops)
+	transitHandler.SetMaxNearArrivals(cfg.MaxNearArrivals)
 
 	// Serve frontend (if provided)
 	if webFS != nil {
-		mux.Handle("GET /", http.FileServer(http.FS(webFS)))
+		static := StaticCache(cfg.IsDevelopment(), cfg.StaticMaxAge)
+		routes.handle("GET /", static(http.FileServer(http.FS(webFS))))
 	} else {
-		mux.HandleFunc("GET /", rootHandler.Index)
+		routes.handleFunc("GET /", rootHandler.Index)
 	}
 
 	// Core routes
-	mux.HandleFunc("GET /api", rootHandler.Index)
-	mux.HandleFunc("GET /health", healthHandler.Health)
+	routes.handleFunc("GET /api", rootHandler.Index)
+	routes.handleFunc("GET /openapi.json", rootHandler.OpenAPI)
+	routes.handleFunc("GET /health", healthHandler.Health)
+	routes.handleFunc("GET /ready", healthHandler.Ready)
+	routes.handleFunc("GET /health/upstream", healthHandler.Upstream)
 
 	// Location routes (subway stops)
-	mux.HandleFunc("GET /transit/location/info", locationHandler.GetLocationInfo)
-	mux.HandleFunc("GET /transit/location/boroughs", locationHandler.GetBoroughs)
-	mux.HandleFunc("GET /transit/location/zipcodes/all", locationHandler.GetAllZipCodes)
-	mux.HandleFunc("GET /transit/location/zip/{zipcode}/closest", locationHandler.GetClosestStops)
-	mux.HandleFunc("GET /transit/location/zip/{zipcode}", locationHandler.GetStopsByZip)
+	routes.handleFunc("GET /transit/location/info", locationHandler.GetLocationInfo)
+	routes.handleFunc("GET /transit/location/boroughs", locationHandler.GetBoroughs)
+	routes.handleFunc("GET /transit/location/borough/{borough}/stops", locationHandler.GetStopsByBorough)
+	routes.handleFunc("GET /transit/location/zipcodes/all", locationHandler.GetAllZipCodes)
+	routes.handleFunc("GET /transit/location/search", locationHandler.SearchStops)
+	routes.handleFunc("GET /transit/location/zip/{zipcode}/closest", locationHandler.GetClosestStops)
+	routes.handleFunc("GET /transit/location/zip/{zipcode}/density", locationHandler.GetDensity)
+	routes.handleFunc("GET /transit/location/zip/{zipcode}/info", locationHandler.GetZipInfo)
+	routes.handleFunc("GET /transit/location/zip/{zipcode}", locationHandler.GetStopsByZip)
 
 	// Subway routes - alerts and multi-station lookup
-	mux.HandleFunc("GET /transit/subway/alerts", transitHandler.GetServiceAlerts)
-	mux.HandleFunc("GET /transit/subway/arrivals", transitHandler.GetSubwayArrivalsForStops)
+	routes.handleFunc("GET /transit/subway/alerts", transitHandler.GetServiceAlerts)
+	routes.handleFunc("GET /transit/subway/arrivals", transitHandler.GetSubwayArrivalsForStops)
+	routes.handleFunc("POST /transit/subway/arrivals", transitHandler.PostSubwayArrivalsForStops)
+	routes.handleFunc("GET /transit/subway/routes", transitHandler.GetSubwayRoutes)
 
 	// Subway routes - station-specific
-	mux.HandleFunc("GET /transit/subway/station/{stopId}", transitHandler.GetSubwayArrivals)
+	routes.handleFunc("GET /transit/subway/station/{stopId}", transitHandler.GetSubwayArrivals)
+	routes.handleFunc("GET /transit/subway/station/{stopId}/stream", transitHandler.StreamSubwayArrivals)
+	routes.handleFunc("GET /transit/subway/feed/{feedName}", transitHandler.GetSubwayFeed)
+	routes.handleFunc("GET /transit/subway/route/{route}/arrivals", transitHandler.GetSubwayRouteArrivals)
 
 	// Subway routes - dynamic location-based
-	mux.HandleFunc("GET /transit/subway/near/{zipcode}", transitHandler.GetSubwayArrivalsNearZip)
-	mux.HandleFunc("GET /transit/subway/near", transitHandler.GetSubwayArrivalsNearCoords)
-	mux.HandleFunc("GET /transit/subway/stops/{zipcode}", transitHandler.GetSubwayStopsNear)
+	routes.handleFunc("GET /transit/subway/near/{zipcode}", transitHandler.GetSubwayArrivalsNearZip)
+	routes.handleFunc("GET /transit/subway/near", transitHandler.GetSubwayArrivalsNearCoords)
+	routes.handleFunc("GET /transit/subway/stops/bbox", transitHandler.GetSubwayStopsInBounds)
+	routes.handleFunc("GET /transit/subway/stops/export", transitHandler.ExportSubwayStops)
+	routes.handleFunc("GET /transit/subway/stops/{zipcode}", transitHandler.GetSubwayStopsNear)
+	routes.handleFunc("GET /transit/subway/nearest/{zipcode}", transitHandler.GetNearestStationByZip)
+	routes.handleFunc("GET /transit/subway/nearest", transitHandler.GetNearestStationByCoords)
 
 	// Bus routes - dynamic location-based
-	mux.HandleFunc("GET /transit/bus/near/{zipcode}", transitHandler.GetBusArrivalsNearZip)
-	mux.HandleFunc("GET /transit/bus/near", transitHandler.GetBusArrivalsNearCoords)
-	mux.HandleFunc("GET /transit/bus/stops/{zipcode}", transitHandler.GetBusStopsNear)
+	routes.handleFunc("GET /transit/bus/near/{zipcode}", transitHandler.GetBusArrivalsNearZip)
+	routes.handleFunc("GET /transit/bus/near", transitHandler.GetBusArrivalsNearCoords)
+	routes.handleFunc("GET /transit/bus/stops/{zipcode}", transitHandler.GetBusStopsNear)
+
+	// Admin routes - only registered when an admin token is configured
+	if cfg.AdminEnabled() {
+		adminHandler := handlers.NewAdminHandler(cfg.AdminToken, zipSvc, stopSvc, cacheFlushers(upstreams))
+		routes.handleMethods("/admin/reload", adminHandler.Reload, http.MethodPost)
+		routes.handleMethods("/admin/cache/flush", adminHandler.FlushCaches, http.MethodPost)
+	}
+
+	rootHandler.SetRoutes(routes.patterns)
+	routes.rejectOtherMethods()
+
+	// Unknown API paths get a JSON 404 rather than the frontend's
+	for _, prefix := range []string{"/transit/", "/api/"} {
+		for _, m := range routeMethods {
+			mux.HandleFunc(m+" "+prefix, rootHandler.NotFound)
+		}
+	}
 
 	// Apply middleware stack
 	handler := Chain(mux,
-		Recovery,
+		TrimTrailingSlash(mux), // first, so every later middleware sees the canonical path
+		RequestID,
+		Recovery(cfg.IsDevelopment()),
 		Logging,
 		CORS,
-		Timeout(15*time.Second),
+		LimitBody(cfg.MaxRequestBodyBytes),
+		Timeout(mux, 15*time.Second),
+		FeedMemo(mux),
 	)
 
 	return handler
 }
+
+// routeMethods are the methods a route answers with 405 when they aren't
+// allowed. OPTIONS is left out since CORS answers preflights before routing.
+var routeMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// routeTable registers handlers on a ServeMux and remembers their patterns,
+// so the /api listing is built from what is actually routed
+type routeTable struct {
+	mux      *http.ServeMux
+	patterns []string
+}
+
+func (t *routeTable) handle(pattern string, h http.Handler) {
+	t.mux.Handle(pattern, h)
+	t.patterns = append(t.patterns, pattern)
+}
+
+func (t *routeTable) handleFunc(pattern string, h http.HandlerFunc) {
+	t.handle(pattern, h)
+}
+
+// handleMethods registers a route for each of the allowed methods
+func (t *routeTable) handleMethods(path string, h http.HandlerFunc, allowed ...string) {
+	for _, m := range allowed {
+		t.handleFunc(m+" "+path, h)
+	}
+}
+
+// rejectOtherMethods answers every routed path with a JSON 405 and an Allow
+// header for the methods it doesn't handle. Without these explicit routes a
+// POST to a GET-only path gets the mux's plain-text 405, and a GET to a
+// POST-only path falls through to the "GET /" frontend. Call it after every
+// route is registered.
+func (t *routeTable) rejectOtherMethods() {
+	allowed := make(map[string][]string) // path -> methods
+	var paths []string
+	for _, pattern := range t.patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		if _, seen := allowed[path]; !seen {
+			paths = append(paths, path)
+		}
+		allowed[path] = append(allowed[path], method)
+		if method == http.MethodGet {
+			allowed[path] = append(allowed[path], http.MethodHead)
+		}
+	}
+
+	for _, path := range paths {
+		reject := methodNotAllowed(allowed[path])
+		for _, m := range routeMethods {
+			if !slices.Contains(allowed[path], m) {
+				t.mux.HandleFunc(m+" "+path, reject)
+			}
+		}
+	}
+}
+
+// feedReporters collects the providers that can report upstream fetch status
+func feedReporters(providers map[string]any) map[string]handlers.FeedStatusReporter {
+	reporters := make(map[string]handlers.FeedStatusReporter)
+	for name, p := range providers {
+		if r, ok := p.(handlers.FeedStatusReporter); ok {
+			reporters[name] = r
+		}
+	}
+	return reporters
+}
+
+// upstreamURLs gathers the upstream URLs of the providers that list them
+func upstreamURLs(providers map[string]any) []string {
+	var urls []string
+	for _, p := range providers {
+		if l, ok := p.(handlers.UpstreamLister); ok {
+			urls = append(urls, l.UpstreamURLs()...)
+		}
+	}
+	return urls
+}
+
+// cacheFlushers keeps the providers that can flush their caches
+func cacheFlushers(providers map[string]any) map[string]handlers.CacheFlusher {
+	flushers := make(map[string]handlers.CacheFlusher)
+	for name, p := range providers {
+		if f, ok := p.(handlers.CacheFlusher); ok {
+			flushers[name] = f
+		}
+	}
+	return flushers
+}
@@ -2,6 +2,7 @@
 package cache
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
@@ -10,37 +11,60 @@ import (
 type item[T any] struct {
 	value     T
 	expiresAt time.Time
+	elem      *list.Element // position in recency order; nil when unbounded
 }
 
-// Cache is a generic thread-safe cache with TTL expiration
+// Cache is a generic thread-safe cache with TTL expiration and an optional
+// LRU size bound
 type Cache[T any] struct {
-	items map[string]item[T]
-	mu    sync.RWMutex
-	ttl   time.Duration
-	stop  chan struct{}
+	items    map[string]item[T]
+	mu       sync.RWMutex
+	ttl      time.Duration
+	stop     chan struct{}
+	maxItems int
+	order    *list.List // most recently used at the front; nil when unbounded
 }
 
 // New creates a cache with the specified TTL
 func New[T any](ttl time.Duration) *Cache[T] {
+	return NewBounded[T](ttl, 0)
+}
+
+// NewBounded creates a cache that also holds at most maxItems entries,
+// evicting the least recently used when full. maxItems <= 0 means unbounded.
+func NewBounded[T any](ttl time.Duration, maxItems int) *Cache[T] {
 	c := &Cache[T]{
 		items: make(map[string]item[T]),
 		ttl:   ttl,
 		stop:  make(chan struct{}),
 	}
+	if maxItems > 0 {
+		c.maxItems = maxItems
+		c.order = list.New()
+	}
 	go c.cleanup()
 	return c
 }
 
 // Get retrieves a value, returning (value, true) if found and not expired
 func (c *Cache[T]) Get(key string) (T, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	if c.order != nil {
+		// Bounded caches reorder on read, so they need the write lock
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
 
 	item, exists := c.items[key]
 	if !exists || time.Now().After(item.expiresAt) {
 		var zero T
 		return zero, false
 	}
+	if item.elem != nil {
+		c.order.MoveToFront(item.elem)
+	}
 	return item.value, true
 }
 
@@ -48,18 +72,40 @@ func (c *Cache[T]) Get(key string) (T, bool) {
 func (c *Cache[T]) Set(key string, value T) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.setLocked(key, value, time.Now().Add(c.ttl))
+}
 
-	c.items[key] = item[T]{
+// setLocked stores a value with an explicit expiry; callers hold the write lock
+func (c *Cache[T]) setLocked(key string, value T, expiresAt time.Time) {
+	it := item[T]{
 		value:     value,
-		expiresAt: time.Now().Add(c.ttl),
+		expiresAt: expiresAt,
+	}
+	if c.order != nil {
+		if existing, ok := c.items[key]; ok {
+			it.elem = existing.elem
+			c.order.MoveToFront(it.elem)
+		} else {
+			it.elem = c.order.PushFront(key)
+		}
+	}
+	c.items[key] = it
+
+	if c.order != nil && c.order.Len() > c.maxItems {
+		c.remove(c.order.Back().Value.(string))
 	}
 }
 
+// TTL returns the expiration applied to new entries
+func (c *Cache[T]) TTL() time.Duration {
+	return c.ttl
+}
+
 // Delete removes a key from the cache
 func (c *Cache[T]) Delete(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	delete(c.items, key)
+	c.remove(key)
 }
 
 // Clear removes all items from the cache
@@ -67,6 +113,9 @@ func (c *Cache[T]) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.items = make(map[string]item[T])
+	if c.order != nil {
+		c.order.Init()
+	}
 }
 
 // Size returns the number of items (including expired)
@@ -81,6 +130,14 @@ func (c *Cache[T]) Close() {
 	close(c.stop)
 }
 
+// remove deletes a key and its recency entry; callers hold the write lock
+func (c *Cache[T]) remove(key string) {
+	if it, ok := c.items[key]; ok && it.elem != nil {
+		c.order.Remove(it.elem)
+	}
+	delete(c.items, key)
+}
+
 // cleanup runs periodically to remove expired items
 func (c *Cache[T]) cleanup() {
 	ticker := time.NewTicker(c.ttl)
@@ -103,7 +160,7 @@ func (c *Cache[T]) removeExpired() {
 	now := time.Now()
 	for key, item := range c.items {
 		if now.After(item.expiresAt) {
-			delete(c.items, key)
+			c.remove(key)
 		}
 	}
 }
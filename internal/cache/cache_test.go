@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBoundedEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewBounded[int](time.Minute, 2)
+	defer c.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // a is now more recent than b
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+	if got := c.Size(); got != 2 {
+		t.Errorf("Size = %d, want 2", got)
+	}
+}
+
+func TestBoundedOverwriteDoesNotGrow(t *testing.T) {
+	c := NewBounded[int](time.Minute, 2)
+	defer c.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 10)
+	c.Set("c", 3) // evicts b, the least recently written
+
+	if v, ok := c.Get("a"); !ok || v != 10 {
+		t.Errorf("Get(a) = (%d, %v), want (10, true)", v, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+}
+
+func TestBoundedDeleteAndClear(t *testing.T) {
+	c := NewBounded[int](time.Minute, 2)
+	defer c.Close()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Delete("a")
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b should survive: deleting a freed a slot")
+	}
+
+	c.Clear()
+	if c.Size() != 0 {
+		t.Errorf("Size after Clear = %d, want 0", c.Size())
+	}
+	c.Set("d", 4)
+	c.Set("e", 5)
+	if c.Size() != 2 {
+		t.Errorf("Size = %d, want 2", c.Size())
+	}
+}
+
+func TestUnboundedHasNoLimit(t *testing.T) {
+	c := New[int](time.Minute)
+	defer c.Close()
+
+	for i := range 100 {
+		c.Set(strconv.Itoa(i), i)
+	}
+	if got := c.Size(); got != 100 {
+		t.Errorf("Size = %d, want 100", got)
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedEntry is the on-disk form of a cache entry
+type persistedEntry[T any] struct {
+	Key       string
+	Value     T
+	ExpiresAt time.Time
+}
+
+// SaveFile writes unexpired entries, with their expiry times, to a
+// gzip-compressed gob file. The file is written to a temp file and renamed so
+// readers never see a partial write.
+func (c *Cache[T]) SaveFile(path string) error {
+	c.mu.RLock()
+	now := time.Now()
+	entries := make([]persistedEntry[T], 0, len(c.items))
+	for key, it := range c.items {
+		if now.Before(it.expiresAt) {
+			entries = append(entries, persistedEntry[T]{Key: key, Value: it.value, ExpiresAt: it.expiresAt})
+		}
+	}
+	c.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	zw := gzip.NewWriter(tmp)
+	if err := gob.NewEncoder(zw).Encode(entries); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding cache: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compressing cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing cache file: %w", err)
+	}
+	return nil
+}
+
+// LoadFile restores entries written by SaveFile, keeping their original
+// expiry and skipping any that have already expired. A missing file loads
+// nothing and is not an error; a corrupt file returns an error and leaves the
+// cache untouched. It returns the number of entries restored.
+func (c *Cache[T]) LoadFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("opening cache file: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, fmt.Errorf("reading cache file: %w", err)
+	}
+	defer zr.Close()
+
+	var entries []persistedEntry[T]
+	if err := gob.NewDecoder(zr).Decode(&entries); err != nil {
+		return 0, fmt.Errorf("decoding cache file: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	restored := 0
+	for _, e := range entries {
+		if !now.Before(e.ExpiresAt) {
+			continue
+		}
+		c.setLocked(e.Key, e.Value, e.ExpiresAt)
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "feeds.gob.gz")
+
+	c := New[[]byte](time.Minute)
+	defer c.Close()
+	c.Set("ace", []byte{0x0a, 0x01})
+	c.Set("l", []byte("feed-l"))
+	if err := c.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile: %v", err)
+	}
+
+	warm := New[[]byte](time.Minute)
+	defer warm.Close()
+	n, err := warm.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("restored %d entries, want 2", n)
+	}
+	if v, ok := warm.Get("l"); !ok || string(v) != "feed-l" {
+		t.Errorf("Get(l) = (%q, %v), want warm hit", v, ok)
+	}
+	if v, ok := warm.Get("ace"); !ok || len(v) != 2 {
+		t.Errorf("Get(ace) = (%v, %v), want warm hit", v, ok)
+	}
+}
+
+func TestLoadFileSkipsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds.gob.gz")
+
+	c := New[string](50 * time.Millisecond)
+	defer c.Close()
+	c.Set("old", "x")
+	if err := c.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	warm := New[string](time.Minute)
+	defer warm.Close()
+	n, err := warm.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if n != 0 || warm.Size() != 0 {
+		t.Errorf("restored %d entries (size %d), want none", n, warm.Size())
+	}
+}
+
+func TestLoadFileMissingOrCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	c := New[string](time.Minute)
+	defer c.Close()
+
+	if n, err := c.LoadFile(filepath.Join(dir, "missing.gob.gz")); err != nil || n != 0 {
+		t.Errorf("missing file: (%d, %v), want (0, nil)", n, err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.gob.gz")
+	if err := os.WriteFile(corrupt, []byte("not a gzip stream"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("keep", "me")
+	if _, err := c.LoadFile(corrupt); err == nil {
+		t.Error("expected error for corrupt file")
+	}
+	if v, ok := c.Get("keep"); !ok || v != "me" {
+		t.Error("a failed load should leave existing entries alone")
+	}
+}
@@ -2,8 +2,14 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,16 +20,180 @@ type Config struct {
 	MTABusAPIKey string
 	CacheTTL     time.Duration
 	HTTPTimeout  time.Duration
+	AdminToken   string
+	UserAgent    string
+
+	// BusBaseURL and BusKeyParam point the bus service at a OneBusAway API
+	// other than MTA Bus Time; empty keeps the MTA defaults
+	BusBaseURL  string
+	BusKeyParam string
+
+	// RouteFeedOverridesFile and RouteFeedOverrides reassign subway routes
+	// to feeds, as a JSON object like {"W": "nqrw"} in a file or inline. Inline
+	// entries win; see RouteFeedOverrideMap.
+	RouteFeedOverridesFile string
+	RouteFeedOverrides     string
+
+	// AlertSummaryLength caps the plain-text summary on each service alert
+	AlertSummaryLength int
+
+	// ArrivalTimeSource is the default stop time subway arrivals show:
+	// "arrival", "departure" or "auto"; empty means "arrival"
+	ArrivalTimeSource string
+
+	// IncludeChildStops makes multi-station arrival lookups count every
+	// platform in a station's complex, not just the station's own N and S.
+	// It needs complexes.csv in the data directory to know the complexes.
+	IncludeChildStops bool
+
+	// DataDir overrides data directory discovery when set
+	DataDir string
+
+	// HTTPMaxIdleConnsPerHost sizes the shared upstream connection pool
+	HTTPMaxIdleConnsPerHost int
+
+	// Per-data-type cache TTLs; each falls back to CacheTTL when unset
+	SubwayCacheTTL     time.Duration
+	BusArrivalCacheTTL time.Duration
+	BusStopsCacheTTL   time.Duration
+	AlertsCacheTTL     time.Duration
+
+	// StreamInterval is how often SSE arrival streams push updates. Streams
+	// read through the subway cache, so upstream fetches stay bounded by
+	// SubwayCacheTTL no matter how many clients are connected.
+	StreamInterval time.Duration
+
+	// Search tunables. Location* apply to the /transit/location stop searches;
+	// Borough* to the borough station listing; Subway* to subway arrival
+	// searches, where the limit counts stations; Bus* to bus searches.
+	// Requests can still pick their own radius and limit up to the max.
+	LocationDefaultRadius  int
+	LocationMaxRadius      int
+	LocationDefaultLimit   int
+	LocationMaxLimit       int
+	BoroughDefaultStations int
+	BoroughMaxStations     int
+	SubwayDefaultRadius    int
+	SubwayMaxRadius        int
+	SubwayDefaultStations  int
+	SubwayMaxStations      int // also caps stations per stops= query, at most 25
+	BusDefaultRadius       int
+	BusMaxRadius           int
+
+	// MaxBusStops caps upstream fan-out: the most stops a nearby bus search
+	// queries
+	MaxBusStops int
+
+	// MaxNearArrivals caps the arrivals in one nearby subway response,
+	// summed over its stations; responses over it are trimmed and flagged
+	MaxNearArrivals int
+
+	// StationClusterMeters merges nearby parent stations in "nearby" results
+	// when positive; zero leaves clustering off
+	StationClusterMeters int
+
+	// Upstream circuit breaking: after CircuitFailureThreshold consecutive
+	// failures, calls to that feed or host fail fast for CircuitCooldown
+	CircuitFailureThreshold int
+	CircuitCooldown         time.Duration
+
+	// GET /health/upstream bounds each host check by UpstreamCheckTimeout
+	// and reuses results for UpstreamCheckTTL
+	UpstreamCheckTimeout time.Duration
+	UpstreamCheckTTL     time.Duration
+
+	// MaxRequestBodyBytes caps request bodies on non-GET routes
+	MaxRequestBodyBytes int64
+
+	// StaticMaxAge is how long browsers may cache frontend assets whose names
+	// carry no content hash, outside development
+	StaticMaxAge time.Duration
+
+	// FeedCachePersist saves subway feeds to FeedCachePath every
+	// FeedCachePersistInterval and reloads them at startup, so a restart
+	// doesn't send every first request to the MTA at once
+	FeedCachePersist         bool
+	FeedCachePath            string
+	FeedCachePersistInterval time.Duration
+
+	// WarmStations and WarmRoutes name the subway stations and routes whose
+	// feeds are refreshed in the background every WarmRefreshInterval, so
+	// requests for them are cache hits. Station lookups read every feed, so
+	// listing any station warms them all. Both empty leaves warming off.
+	WarmStations        []string
+	WarmRoutes          []string
+	WarmRefreshInterval time.Duration
 }
 
 // Load reads configuration from environment variables with sensible defaults
 func Load() *Config {
+	cacheTTL := getDurationEnv("CACHE_TTL_SECONDS", 120) * time.Second
+	subwayTTL := getTTLEnv("SUBWAY_CACHE_TTL", cacheTTL)
+
 	return &Config{
 		Port:         getEnv("PORT", "3000"),
 		Env:          getEnv("ENV", "development"),
 		MTABusAPIKey: getEnv("MTA_BUS_API_KEY", ""),
-		CacheTTL:     getDurationEnv("CACHE_TTL_SECONDS", 120) * time.Second,
+		CacheTTL:     cacheTTL,
 		HTTPTimeout:  getDurationEnv("HTTP_TIMEOUT_SECONDS", 10) * time.Second,
+		AdminToken:   getEnv("ADMIN_TOKEN", ""),
+		UserAgent:    getEnv("USER_AGENT", ""),
+		BusBaseURL:   getEnv("BUS_API_BASE_URL", ""),
+		BusKeyParam:  getEnv("BUS_API_KEY_PARAM", ""),
+		DataDir:      getEnv("DATA_DIR", ""),
+
+		ArrivalTimeSource:  getEnv("ARRIVAL_TIME_SOURCE", ""),
+		IncludeChildStops:  getEnv("INCLUDE_CHILD_STOPS", "true") != "false",
+		AlertSummaryLength: getIntEnv("ALERT_SUMMARY_LENGTH", 200),
+
+		RouteFeedOverridesFile: getEnv("ROUTE_FEED_OVERRIDES_FILE", ""),
+		RouteFeedOverrides:     getEnv("ROUTE_FEED_OVERRIDES", ""),
+
+		HTTPMaxIdleConnsPerHost: getIntEnv("HTTP_MAX_IDLE_CONNS_PER_HOST", 10),
+
+		SubwayCacheTTL:     subwayTTL,
+		BusArrivalCacheTTL: getTTLEnv("BUS_ARRIVAL_CACHE_TTL", cacheTTL),
+		BusStopsCacheTTL:   getTTLEnv("BUS_STOPS_CACHE_TTL", cacheTTL),
+		AlertsCacheTTL:     getTTLEnv("ALERTS_CACHE_TTL", cacheTTL),
+
+		StreamInterval: getDurationEnv("STREAM_INTERVAL_SECONDS", 15) * time.Second,
+
+		LocationDefaultRadius:  getIntEnv("LOCATION_DEFAULT_RADIUS", 1600),
+		LocationMaxRadius:      getIntEnv("LOCATION_MAX_RADIUS", 8000),
+		LocationDefaultLimit:   getIntEnv("LOCATION_DEFAULT_LIMIT", 5),
+		LocationMaxLimit:       getIntEnv("LOCATION_MAX_LIMIT", 20),
+		BoroughDefaultStations: getIntEnv("BOROUGH_DEFAULT_STATIONS", 100),
+		BoroughMaxStations:     getIntEnv("BOROUGH_MAX_STATIONS", 500),
+		SubwayDefaultRadius:    getIntEnv("SUBWAY_DEFAULT_RADIUS", 800),
+		SubwayMaxRadius:        getIntEnv("SUBWAY_MAX_RADIUS", 3200),
+		SubwayDefaultStations:  getIntEnv("SUBWAY_DEFAULT_STATIONS", 3),
+		SubwayMaxStations:      getIntEnv("SUBWAY_MAX_STATIONS", 5),
+		BusDefaultRadius:       getIntEnv("BUS_DEFAULT_RADIUS", 400),
+		BusMaxRadius:           getIntEnv("BUS_MAX_RADIUS", 3200),
+
+		MaxBusStops: getIntEnv("MAX_BUS_STOPS", 10),
+
+		MaxNearArrivals: getIntEnv("MAX_NEAR_ARRIVALS", 200),
+
+		StationClusterMeters: getIntEnv("STATION_CLUSTER_METERS", 0),
+
+		CircuitFailureThreshold: getIntEnv("CIRCUIT_FAILURE_THRESHOLD", 5),
+		CircuitCooldown:         getTTLEnv("CIRCUIT_COOLDOWN_SECONDS", 30*time.Second),
+
+		UpstreamCheckTimeout: getTTLEnv("UPSTREAM_CHECK_TIMEOUT_SECONDS", 3*time.Second),
+		UpstreamCheckTTL:     getTTLEnv("UPSTREAM_CHECK_CACHE_SECONDS", 30*time.Second),
+
+		MaxRequestBodyBytes: int64(getIntEnv("MAX_REQUEST_BODY_BYTES", 1<<20)),
+		StaticMaxAge:        getTTLEnv("STATIC_MAX_AGE_SECONDS", time.Hour),
+
+		FeedCachePersist:         getBoolEnv("FEED_CACHE_PERSIST", false),
+		FeedCachePath:            getEnv("FEED_CACHE_PATH", filepath.Join(os.TempDir(), "emteeayy", "feeds.gob.gz")),
+		FeedCachePersistInterval: getTTLEnv("FEED_CACHE_PERSIST_SECONDS", 30*time.Second),
+
+		WarmStations: getListEnv("WARM_STATIONS"),
+		WarmRoutes:   getListEnv("WARM_ROUTES"),
+		// Refresh early enough that jitter never lets a warm feed expire
+		WarmRefreshInterval: getTTLEnv("WARM_REFRESH_SECONDS", subwayTTL*3/4),
 	}
 }
 
@@ -32,11 +202,69 @@ func (c *Config) IsDevelopment() bool {
 	return c.Env == "development"
 }
 
-// Validate checks that required configuration is present
+// AdminEnabled returns true if an admin token is configured
+func (c *Config) AdminEnabled() bool {
+	return c.AdminToken != ""
+}
+
+// WarmEnabled returns true if any stations or routes are to be kept warm
+func (c *Config) WarmEnabled() bool {
+	return len(c.WarmStations) > 0 || len(c.WarmRoutes) > 0
+}
+
+// Validate checks that required configuration is present and well formed
 func (c *Config) Validate() error {
+	if c.BusBaseURL != "" {
+		u, err := url.Parse(c.BusBaseURL)
+		if err != nil {
+			return fmt.Errorf("BUS_API_BASE_URL: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("BUS_API_BASE_URL must be an absolute http(s) URL, got %q", c.BusBaseURL)
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("BUS_API_BASE_URL must not have a query or fragment, got %q", c.BusBaseURL)
+		}
+	}
+	switch c.ArrivalTimeSource {
+	case "", "arrival", "departure", "auto":
+	default:
+		return fmt.Errorf("ARRIVAL_TIME_SOURCE must be arrival, departure or auto, got %q", c.ArrivalTimeSource)
+	}
+	if _, err := c.RouteFeedOverrideMap(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// RouteFeedOverrideMap reads the route-to-feed overrides, the file's first
+// and then the inline ones over them. It is nil when neither is set. Feed
+// names are checked when the overrides are applied, not here.
+func (c *Config) RouteFeedOverrideMap() (map[string]string, error) {
+	var overrides map[string]string
+	if c.RouteFeedOverridesFile != "" {
+		data, err := os.ReadFile(c.RouteFeedOverridesFile)
+		if err != nil {
+			return nil, fmt.Errorf("ROUTE_FEED_OVERRIDES_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &overrides); err != nil {
+			return nil, fmt.Errorf("ROUTE_FEED_OVERRIDES_FILE %s: %w", c.RouteFeedOverridesFile, err)
+		}
+	}
+	if c.RouteFeedOverrides != "" {
+		var inline map[string]string
+		if err := json.Unmarshal([]byte(c.RouteFeedOverrides), &inline); err != nil {
+			return nil, fmt.Errorf("ROUTE_FEED_OVERRIDES: %w", err)
+		}
+		if overrides == nil {
+			overrides = inline
+		} else {
+			maps.Copy(overrides, inline)
+		}
+	}
+	return overrides, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -52,3 +280,46 @@ func getDurationEnv(key string, defaultSeconds int) time.Duration {
 	}
 	return time.Duration(defaultSeconds)
 }
+
+// getTTLEnv reads a TTL in seconds, falling back to the given duration when
+// the variable is unset or not a positive integer
+func getTTLEnv(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return fallback
+}
+
+// getListEnv reads a comma-separated list, trimming entries and dropping
+// empty ones
+func getListEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getBoolEnv reads a boolean in any form strconv.ParseBool accepts (1, t,
+// TRUE, false and so on), falling back to the default when unset or invalid
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadCacheTTLsFallBackToCacheTTL(t *testing.T) {
+	t.Setenv("CACHE_TTL_SECONDS", "90")
+
+	cfg := Load()
+	for name, got := range map[string]time.Duration{
+		"subway":      cfg.SubwayCacheTTL,
+		"bus arrival": cfg.BusArrivalCacheTTL,
+		"bus stops":   cfg.BusStopsCacheTTL,
+		"alerts":      cfg.AlertsCacheTTL,
+	} {
+		if got != 90*time.Second {
+			t.Errorf("%s TTL = %v, want 90s", name, got)
+		}
+	}
+}
+
+func TestLoadCacheTTLOverrides(t *testing.T) {
+	t.Setenv("CACHE_TTL_SECONDS", "90")
+	t.Setenv("SUBWAY_CACHE_TTL", "15")
+	t.Setenv("BUS_ARRIVAL_CACHE_TTL", "20")
+	t.Setenv("BUS_STOPS_CACHE_TTL", "3600")
+	t.Setenv("ALERTS_CACHE_TTL", "300")
+
+	cfg := Load()
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{"subway", cfg.SubwayCacheTTL, 15 * time.Second},
+		{"bus arrival", cfg.BusArrivalCacheTTL, 20 * time.Second},
+		{"bus stops", cfg.BusStopsCacheTTL, time.Hour},
+		{"alerts", cfg.AlertsCacheTTL, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s TTL = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadCacheTTLIgnoresInvalid(t *testing.T) {
+	t.Setenv("CACHE_TTL_SECONDS", "90")
+	t.Setenv("SUBWAY_CACHE_TTL", "soon")
+	t.Setenv("ALERTS_CACHE_TTL", "-5")
+
+	cfg := Load()
+	if cfg.SubwayCacheTTL != 90*time.Second {
+		t.Errorf("subway TTL = %v, want fallback 90s", cfg.SubwayCacheTTL)
+	}
+	if cfg.AlertsCacheTTL != 90*time.Second {
+		t.Errorf("alerts TTL = %v, want fallback 90s", cfg.AlertsCacheTTL)
+	}
+}
+
+func TestLoadFeedCachePersistence(t *testing.T) {
+	cfg := Load()
+	if cfg.FeedCachePersist {
+		t.Error("feed cache persistence should be off by default")
+	}
+	if cfg.FeedCachePath == "" || cfg.FeedCachePersistInterval <= 0 {
+		t.Errorf("defaults = (%q, %v), want a path and positive interval", cfg.FeedCachePath, cfg.FeedCachePersistInterval)
+	}
+
+	t.Setenv("FEED_CACHE_PERSIST", "true")
+	t.Setenv("FEED_CACHE_PATH", "/tmp/feeds.gob.gz")
+	t.Setenv("FEED_CACHE_PERSIST_SECONDS", "90")
+	cfg = Load()
+	if !cfg.FeedCachePersist || cfg.FeedCachePath != "/tmp/feeds.gob.gz" || cfg.FeedCachePersistInterval != 90*time.Second {
+		t.Errorf("got (%v, %q, %v), want (true, /tmp/feeds.gob.gz, 1m30s)", cfg.FeedCachePersist, cfg.FeedCachePath, cfg.FeedCachePersistInterval)
+	}
+
+	for value, want := range map[string]bool{"1": true, "TRUE": true, "0": false, "yes": false} {
+		t.Setenv("FEED_CACHE_PERSIST", value)
+		if got := Load().FeedCachePersist; got != want {
+			t.Errorf("FEED_CACHE_PERSIST=%s gives %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestLoadIncludeChildStops(t *testing.T) {
+	if !Load().IncludeChildStops {
+		t.Error("child stops should be included by default")
+	}
+	t.Setenv("INCLUDE_CHILD_STOPS", "false")
+	if Load().IncludeChildStops {
+		t.Error("INCLUDE_CHILD_STOPS=false should turn child stops off")
+	}
+}
+
+func TestLoadWarmFeeds(t *testing.T) {
+	t.Setenv("SUBWAY_CACHE_TTL", "120")
+	cfg := Load()
+	if cfg.WarmEnabled() {
+		t.Error("feed warming should be off by default")
+	}
+	if cfg.WarmRefreshInterval != 90*time.Second {
+		t.Errorf("default refresh interval = %v, want 3/4 of the 2m subway TTL", cfg.WarmRefreshInterval)
+	}
+
+	t.Setenv("WARM_ROUTES", " L, 7,,")
+	t.Setenv("WARM_STATIONS", "127")
+	t.Setenv("WARM_REFRESH_SECONDS", "45")
+	cfg = Load()
+	if !cfg.WarmEnabled() || !slices.Equal(cfg.WarmRoutes, []string{"L", "7"}) || !slices.Equal(cfg.WarmStations, []string{"127"}) || cfg.WarmRefreshInterval != 45*time.Second {
+		t.Errorf("got (%q, %q, %v), want ([L 7], [127], 45s)", cfg.WarmRoutes, cfg.WarmStations, cfg.WarmRefreshInterval)
+	}
+}
+
+func TestLoadSearchLimits(t *testing.T) {
+	cfg := Load()
+	if cfg.LocationDefaultRadius != 1600 || cfg.SubwayDefaultRadius != 800 || cfg.SubwayMaxStations != 5 {
+		t.Errorf("defaults = (%d, %d, %d), want (1600, 800, 5)", cfg.LocationDefaultRadius, cfg.SubwayDefaultRadius, cfg.SubwayMaxStations)
+	}
+
+	if cfg.MaxBusStops != 10 {
+		t.Errorf("bus stop cap = %d, want 10", cfg.MaxBusStops)
+	}
+	if cfg.BoroughDefaultStations != 100 || cfg.BoroughMaxStations != 500 {
+		t.Errorf("borough limits = (%d, %d), want (100, 500)", cfg.BoroughDefaultStations, cfg.BoroughMaxStations)
+	}
+
+	t.Setenv("LOCATION_DEFAULT_RADIUS", "400")
+	t.Setenv("SUBWAY_DEFAULT_STATIONS", "2")
+	t.Setenv("SUBWAY_MAX_STATIONS", "8")
+	t.Setenv("MAX_BUS_STOPS", "4")
+	cfg = Load()
+	if cfg.LocationDefaultRadius != 400 || cfg.SubwayDefaultStations != 2 {
+		t.Errorf("overrides = (%d, %d), want (400, 2)", cfg.LocationDefaultRadius, cfg.SubwayDefaultStations)
+	}
+	if cfg.SubwayMaxStations != 8 || cfg.MaxBusStops != 4 {
+		t.Errorf("stop cap overrides = (%d, %d), want (8, 4)", cfg.SubwayMaxStations, cfg.MaxBusStops)
+	}
+}
+
+func TestLoadUpstreamCheck(t *testing.T) {
+	cfg := Load()
+	if cfg.UpstreamCheckTimeout != 3*time.Second || cfg.UpstreamCheckTTL != 30*time.Second {
+		t.Errorf("defaults = (%v, %v), want (3s, 30s)", cfg.UpstreamCheckTimeout, cfg.UpstreamCheckTTL)
+	}
+
+	t.Setenv("UPSTREAM_CHECK_TIMEOUT_SECONDS", "1")
+	t.Setenv("UPSTREAM_CHECK_CACHE_SECONDS", "0") // invalid: keeps the default
+	cfg = Load()
+	if cfg.UpstreamCheckTimeout != time.Second || cfg.UpstreamCheckTTL != 30*time.Second {
+		t.Errorf("got (%v, %v), want (1s, 30s)", cfg.UpstreamCheckTimeout, cfg.UpstreamCheckTTL)
+	}
+}
+
+func TestValidateBusBaseURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"", true},
+		{"https://bustime.mta.info", true},
+		{"http://localhost:8080/onebusaway-api-webapp/", true},
+		{"bustime.mta.info", false},
+		{"ftp://oba.example.org", false},
+		{"https://", false},
+		{"https://oba.example.org/?key=abc", false},
+		{"https://oba.example.org/#api", false},
+		{"https://oba example.org", false},
+	}
+	for _, tc := range tests {
+		cfg := &Config{BusBaseURL: tc.url}
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Validate(%q) = %v, want valid=%v", tc.url, err, tc.valid)
+		}
+	}
+}
+
+func TestValidateArrivalTimeSource(t *testing.T) {
+	for source, valid := range map[string]bool{"": true, "arrival": true, "departure": true, "auto": true, "Arrival": false, "scheduled": false} {
+		cfg := &Config{ArrivalTimeSource: source}
+		if err := cfg.Validate(); (err == nil) != valid {
+			t.Errorf("Validate(%q) = %v, want valid=%v", source, err, valid)
+		}
+	}
+}
+
+func TestRouteFeedOverrideMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route-feeds.json")
+	if err := os.WriteFile(path, []byte(`{"W": "bdfm", "H": "ace"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{RouteFeedOverridesFile: path, RouteFeedOverrides: `{"W": "nqrw"}`}
+	got, err := cfg.RouteFeedOverrideMap()
+	if err != nil {
+		t.Fatalf("RouteFeedOverrideMap: %v", err)
+	}
+	if len(got) != 2 || got["W"] != "nqrw" || got["H"] != "ace" {
+		t.Errorf("overrides = %v, want H from the file and W from the inline JSON", got)
+	}
+
+	if got, err := (&Config{}).RouteFeedOverrideMap(); got != nil || err != nil {
+		t.Errorf("unset overrides = (%v, %v), want (nil, nil)", got, err)
+	}
+	for _, cfg := range []*Config{
+		{RouteFeedOverrides: `["W"]`},
+		{RouteFeedOverridesFile: filepath.Join(t.TempDir(), "missing.json")},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted bad overrides", cfg)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package location
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// boroughNameProperties are the feature properties a boundaries file may name
+// its borough with: NYC Open Data's Borough Boundaries export, the DCP
+// shapefile's BoroName, then generic fallbacks
+var boroughNameProperties = []string{"boro_name", "BoroName", "borough", "name"}
+
+// boroughShape is one borough's outline as polygons of rings of [lng, lat]
+// points, GeoJSON order. The first ring of a polygon is its outer edge and
+// any others are holes.
+type boroughShape struct {
+	name     string
+	polygons [][][][2]float64
+	bounds   [4]float64 // minLat, minLng, maxLat, maxLng
+}
+
+// contains reports whether the point is inside the shape, using the even-odd
+// rule across each polygon's rings so holes are excluded
+func (b boroughShape) contains(lat, lng float64) bool {
+	if lat < b.bounds[0] || lng < b.bounds[1] || lat > b.bounds[2] || lng > b.bounds[3] {
+		return false
+	}
+	for _, polygon := range b.polygons {
+		inside := false
+		for _, ring := range polygon {
+			if ringContains(ring, lat, lng) {
+				inside = !inside
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains is a ray-casting point-in-polygon test for one closed ring
+func ringContains(ring [][2]float64, lat, lng float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// readBoroughs reads borough outlines from a GeoJSON FeatureCollection of
+// Polygon or MultiPolygon features
+func readBoroughs(filepath string) ([]boroughShape, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("reading borough boundaries file: %w", err)
+	}
+
+	var collection struct {
+		Features []struct {
+			Properties map[string]any `json:"properties"`
+			Geometry   struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("parsing borough boundaries GeoJSON: %w", err)
+	}
+
+	shapes := make([]boroughShape, 0, len(collection.Features))
+	for i, feature := range collection.Features {
+		var name string
+		for _, key := range boroughNameProperties {
+			if s, ok := feature.Properties[key].(string); ok && strings.TrimSpace(s) != "" {
+				name = strings.TrimSpace(s)
+				break
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("borough boundary feature %d has no borough name", i)
+		}
+
+		var polygons [][][][2]float64
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var polygon [][][2]float64
+			err = json.Unmarshal(feature.Geometry.Coordinates, &polygon)
+			polygons = [][][][2]float64{polygon}
+		case "MultiPolygon":
+			err = json.Unmarshal(feature.Geometry.Coordinates, &polygons)
+		default:
+			return nil, fmt.Errorf("borough boundary %s: unsupported geometry %q", name, feature.Geometry.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("borough boundary %s: %w", name, err)
+		}
+		shapes = append(shapes, newBoroughShape(name, polygons))
+	}
+	return shapes, nil
+}
+
+func newBoroughShape(name string, polygons [][][][2]float64) boroughShape {
+	shape := boroughShape{name: name, polygons: polygons, bounds: [4]float64{90, 180, -90, -180}}
+	for _, polygon := range polygons {
+		for _, ring := range polygon {
+			for _, pt := range ring {
+				shape.bounds[0] = min(shape.bounds[0], pt[1])
+				shape.bounds[1] = min(shape.bounds[1], pt[0])
+				shape.bounds[2] = max(shape.bounds[2], pt[1])
+				shape.bounds[3] = max(shape.bounds[3], pt[0])
+			}
+		}
+	}
+	return shape
+}
@@ -0,0 +1,59 @@
+package location
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by ParseSearchCursor for a cursor it didn't
+// issue
+var ErrInvalidCursor = errors.New("invalid search cursor")
+
+// SearchCursor marks the last result of a SearchByNamePage page. It holds the
+// result's whole sort key rather than a position, so the next page starts
+// right after it even if stops were reloaded in between.
+type SearchCursor struct {
+	rank int // 0 exact, 1 prefix, 2 substring
+	name string
+	id   string
+}
+
+// cursorJSON is a cursor's encoded form; short keys keep the token small
+type cursorJSON struct {
+	Rank int    `json:"r"`
+	Name string `json:"n"`
+	ID   string `json:"i"`
+}
+
+// Encode returns the cursor as an opaque, URL-safe token
+func (c SearchCursor) Encode() string {
+	b, _ := json.Marshal(cursorJSON{c.rank, c.name, c.id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseSearchCursor decodes a token from SearchCursor.Encode
+func ParseSearchCursor(token string) (SearchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return SearchCursor{}, ErrInvalidCursor
+	}
+	var c cursorJSON
+	if err := json.Unmarshal(b, &c); err != nil || c.Rank < 0 || c.Rank > 2 || c.ID == "" {
+		return SearchCursor{}, ErrInvalidCursor
+	}
+	return SearchCursor{rank: c.Rank, name: c.Name, id: c.ID}, nil
+}
+
+// compare orders search results: by rank, then shorter names, then name and
+// ID so the order is total
+func (c SearchCursor) compare(o SearchCursor) int {
+	return cmp.Or(
+		cmp.Compare(c.rank, o.rank),
+		cmp.Compare(len(c.name), len(o.name)),
+		strings.Compare(c.name, o.name),
+		strings.Compare(c.id, o.id),
+	)
+}
@@ -4,6 +4,13 @@ import "math"
 
 const earthRadiusMeters = 6371000
 
+// WalkingMetersPerMinute is an average walking pace (about 3 mph), used to
+// turn straight-line distance into walk time
+const WalkingMetersPerMinute = 80
+
+// compassPoints are the 8 compass labels, clockwise from north
+var compassPoints = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
 // Haversine calculates the distance in meters between two lat/lng points
 func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
 	lat1Rad := lat1 * math.Pi / 180
@@ -20,7 +27,38 @@ func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
 	return earthRadiusMeters * c
 }
 
+// Bearing returns the initial compass bearing in degrees [0, 360) from the
+// first point to the second
+func Bearing(lat1, lng1, lat2, lng2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	deltaLng := (lng2 - lng1) * math.Pi / 180
+
+	y := math.Sin(deltaLng) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) -
+		math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(deltaLng)
+
+	degrees := math.Atan2(y, x) * 180 / math.Pi
+	return math.Mod(degrees+360, 360)
+}
+
+// CompassDirection converts a bearing in degrees to an 8-point compass label
+func CompassDirection(degrees float64) string {
+	degrees = math.Mod(math.Mod(degrees, 360)+360, 360)
+	idx := int(math.Round(degrees/45)) % len(compassPoints)
+	return compassPoints[idx]
+}
+
 // MetersToMiles converts meters to miles
 func MetersToMiles(meters float64) float64 {
 	return meters / 1609.344
 }
+
+// WalkMinutes estimates how many whole minutes it takes to walk meters,
+// rounding up so a rider is never told they have more time than they do
+func WalkMinutes(meters float64) int {
+	if meters <= 0 {
+		return 0
+	}
+	return int(math.Ceil(meters / WalkingMetersPerMinute))
+}
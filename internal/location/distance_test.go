@@ -0,0 +1,81 @@
+package location
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+		compass                string
+	}{
+		{"due north", 40.0, -74.0, 41.0, -74.0, 0, "N"},
+		{"due south", 41.0, -74.0, 40.0, -74.0, 180, "S"},
+		{"due east on equator", 0, 0, 0, 1, 90, "E"},
+		{"due west on equator", 0, 0, 0, -1, 270, "W"},
+		// Penn Station -> Times Square
+		{"penn to times sq", 40.7506, -73.9935, 40.7580, -73.9855, 39.3, "NE"},
+		// Times Square -> Penn Station
+		{"times sq to penn", 40.7580, -73.9855, 40.7506, -73.9935, 219.3, "SW"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Bearing(tc.lat1, tc.lng1, tc.lat2, tc.lng2)
+			if math.Abs(got-tc.want) > 0.5 {
+				t.Errorf("Bearing = %.2f, want ~%.2f", got, tc.want)
+			}
+			if dir := CompassDirection(got); dir != tc.compass {
+				t.Errorf("CompassDirection(%.2f) = %q, want %q", got, dir, tc.compass)
+			}
+		})
+	}
+}
+
+func TestCompassDirection(t *testing.T) {
+	tests := []struct {
+		degrees float64
+		want    string
+	}{
+		{0, "N"},
+		{22, "N"},
+		{23, "NE"},
+		{45, "NE"},
+		{90, "E"},
+		{135, "SE"},
+		{180, "S"},
+		{225, "SW"},
+		{270, "W"},
+		{315, "NW"},
+		{338, "N"},
+		{360, "N"},
+		{-90, "W"},
+	}
+
+	for _, tc := range tests {
+		if got := CompassDirection(tc.degrees); got != tc.want {
+			t.Errorf("CompassDirection(%v) = %q, want %q", tc.degrees, got, tc.want)
+		}
+	}
+}
+
+func TestWalkMinutes(t *testing.T) {
+	tests := []struct {
+		meters float64
+		want   int
+	}{
+		{0, 0},
+		{1, 1},
+		{80, 1},
+		{81, 2},
+		{800, 10},
+	}
+	for _, tc := range tests {
+		if got := WalkMinutes(tc.meters); got != tc.want {
+			t.Errorf("WalkMinutes(%v) = %d, want %d", tc.meters, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package location
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// readySignal marks a service ready once its first successful load has been
+// swapped in. Unlike the loaded flag it is read without the service's lock,
+// so readiness checks never wait behind a reload holding the write lock, and
+// it never goes back to false. Embed it in a service; the zero value is not
+// ready.
+type readySignal struct {
+	ready atomic.Bool
+	once  sync.Once
+	ch    chan struct{} // closed on the first markReady
+}
+
+func (r *readySignal) init() {
+	r.once.Do(func() { r.ch = make(chan struct{}) })
+}
+
+// markReady records a completed load. Call it only after the new data is in
+// place.
+func (r *readySignal) markReady() {
+	r.init()
+	if r.ready.CompareAndSwap(false, true) {
+		close(r.ch)
+	}
+}
+
+// IsReady reports whether data has been successfully loaded at least once
+func (r *readySignal) IsReady() bool {
+	return r.ready.Load()
+}
+
+// WaitReady blocks until the service is ready or ctx is done, returning
+// ctx's error in the latter case
+func (r *readySignal) WaitReady(ctx context.Context) error {
+	r.init()
+	select {
+	case <-r.ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
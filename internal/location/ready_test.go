@@ -0,0 +1,118 @@
+package location
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitReadyUnblocksOnLoad(t *testing.T) {
+	svc := NewStopService()
+	if svc.IsReady() {
+		t.Fatal("new service reports ready")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- svc.WaitReady(context.Background()) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("WaitReady returned %v before any load", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if _, err := svc.Load(filepath.Join("testdata", "stops_missing_column.txt")); err == nil {
+		t.Fatal("expected the malformed file to fail")
+	}
+	if svc.IsReady() {
+		t.Fatal("failed load marked the service ready")
+	}
+
+	if _, err := svc.Load(testStopsPath); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WaitReady: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitReady still blocked after a successful load")
+	}
+	if !svc.IsReady() {
+		t.Error("IsReady = false after load")
+	}
+
+	// Already ready: returns at once
+	if err := svc.WaitReady(context.Background()); err != nil {
+		t.Errorf("WaitReady on a ready service: %v", err)
+	}
+}
+
+func TestWaitReadyHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := NewZipCodeService().WaitReady(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitReady = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// TestReloadWhileReading swaps data in repeatedly while readers query both
+// services; run with -race to check the swaps are safe
+func TestReloadWhileReading(t *testing.T) {
+	stops := loadTestStops(t)
+	zips := loadTestZipCodes(t)
+	wantStops, wantZips := stops.Count(), zips.Count()
+
+	var (
+		stop    atomic.Bool
+		readers sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for !stop.Load() {
+				if !stops.IsReady() || !zips.IsReady() {
+					t.Error("service not ready mid-reload")
+					return
+				}
+				if n := stops.Count(); n != wantStops {
+					t.Errorf("Count mid-reload = %d, want %d", n, wantStops)
+					return
+				}
+				if n := zips.Count(); n != wantZips {
+					t.Errorf("zip Count mid-reload = %d, want %d", n, wantZips)
+					return
+				}
+				if len(stops.FindNearby(40.7553, -73.9875, 400)) == 0 {
+					t.Error("FindNearby found nothing mid-reload")
+					return
+				}
+				if _, ok := stops.GetByID("127"); !ok {
+					t.Error("GetByID(127) missing mid-reload")
+					return
+				}
+				if _, ok := zips.Borough(40.7553, -73.9875); !ok {
+					t.Error("Borough lookup failed mid-reload")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := stops.Reload(); err != nil {
+			t.Errorf("stops reload %d: %v", i, err)
+		}
+		if err := zips.Reload(); err != nil {
+			t.Errorf("zips reload %d: %v", i, err)
+		}
+	}
+	stop.Store(true)
+	readers.Wait()
+}
@@ -1,11 +1,16 @@
 package location
 
 import (
+	"cmp"
 	"encoding/csv"
 	"fmt"
+	"io"
+	"iter"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/randytsao24/emteeayy/internal/models"
@@ -13,9 +18,28 @@ import (
 
 // StopService manages subway stop data
 type StopService struct {
-	stops  []models.Stop
-	mu     sync.RWMutex
-	loaded bool
+	readySignal
+
+	stops     []models.Stop
+	children  map[string][]string // parent station ID -> child stop IDs
+	platforms map[string][]string // parent station ID -> child platform IDs
+	complexes map[string][]string // complex ID -> parent station IDs, in file order
+	path      string
+	mu        sync.RWMutex
+	loaded    bool
+
+	// clusterMeters merges nearby parent stations in FindNearby results;
+	// zero disables clustering
+	clusterMeters float64
+
+	// complexesPath, if set, is read on every Load to fill in ComplexID
+	complexesPath string
+}
+
+// NearbyOptions tunes which stops FindNearbyWithOptions returns
+type NearbyOptions struct {
+	// IncludeChildren also returns platforms and entrances, not just parent stations
+	IncludeChildren bool
 }
 
 // NewStopService creates a new stop service
@@ -23,76 +47,330 @@ func NewStopService() *StopService {
 	return &StopService{}
 }
 
-// Load reads stop data from a GTFS stops.txt file
-func (s *StopService) Load(filepath string) error {
+// SetClusterRadius makes FindNearby merge parent stations that sit within
+// meters of a closer result, e.g. complexes whose lines have separate parent
+// IDs at slightly different coordinates. Zero (the default) disables it.
+func (s *StopService) SetClusterRadius(meters float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusterMeters = meters
+}
+
+// SetComplexesFile makes Load also read station complex IDs from path, a CSV
+// with "GTFS Stop ID" and "Complex ID" columns like the MTA's Stations.csv.
+// Platforms inherit their parent station's complex.
+func (s *StopService) SetComplexesFile(path string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.complexesPath = path
+}
+
+// LoadResult summarizes a stops file load
+type LoadResult struct {
+	Loaded  int          `json:"loaded"`
+	Skipped []SkippedRow `json:"skipped,omitempty"`
+}
+
+// SkippedRow records a row that was rejected during loading
+type SkippedRow struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// Load reads stop data from a GTFS stops.txt file. The file is parsed before
+// taking the write lock and the result replaces any previously loaded data, so
+// it is safe to call again at runtime. Rows with missing IDs or unparseable
+// coordinates are skipped and reported in the result rather than stored.
+func (s *StopService) Load(filepath string) (LoadResult, error) {
+	stops, result, err := readStops(filepath)
+	if err != nil {
+		return result, err
+	}
+
+	s.mu.RLock()
+	complexesPath := s.complexesPath
+	s.mu.RUnlock()
+	if complexesPath != "" {
+		complexes, err := readComplexes(complexesPath)
+		if err != nil {
+			return result, err
+		}
+		applyComplexes(stops, complexes)
+	}
+
+	children, platforms := buildChildIndex(stops)
+	complexes := buildComplexIndex(stops)
+
+	s.mu.Lock()
+	s.stops = stops
+	s.children = children
+	s.platforms = platforms
+	s.complexes = complexes
+	s.path = filepath
+	s.loaded = true
+	s.mu.Unlock()
+
+	s.markReady()
+	return result, nil
+}
+
+// Reload re-reads stop data from the file it was last loaded from
+func (s *StopService) Reload() (LoadResult, error) {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+
+	if path == "" {
+		return LoadResult{}, fmt.Errorf("stops have not been loaded from a file")
+	}
+	return s.Load(path)
+}
+
+// buildChildIndex maps each parent station to the IDs of its child stops,
+// and separately to just its platforms (location_type 0), leaving out
+// entrances and other child locations
+func buildChildIndex(stops []models.Stop) (children, platforms map[string][]string) {
+	children = make(map[string][]string)
+	platforms = make(map[string][]string)
+	for _, stop := range stops {
+		if stop.ParentStation == "" {
+			continue
+		}
+		children[stop.ParentStation] = append(children[stop.ParentStation], stop.ID)
+		if stop.LocationType == 0 {
+			platforms[stop.ParentStation] = append(platforms[stop.ParentStation], stop.ID)
+		}
+	}
+	return children, platforms
+}
+
+// buildComplexIndex maps each complex ID to the parent stations in it
+func buildComplexIndex(stops []models.Stop) map[string][]string {
+	complexes := make(map[string][]string)
+	for _, stop := range stops {
+		if stop.LocationType == 1 && stop.ComplexID != "" {
+			complexes[stop.ComplexID] = append(complexes[stop.ComplexID], stop.ID)
+		}
+	}
+	return complexes
+}
+
+// requiredStopColumns must be present in a stops.txt header
+var requiredStopColumns = []string{"stop_id", "stop_name", "stop_lat", "stop_lon"}
+
+func readStops(filepath string) ([]models.Stop, LoadResult, error) {
+	var result LoadResult
 
 	file, err := os.Open(filepath)
 	if err != nil {
-		return fmt.Errorf("opening stops file: %w", err)
+		return nil, result, fmt.Errorf("opening stops file: %w", err)
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, result, fmt.Errorf("stops file has no data rows")
+	}
 	if err != nil {
-		return fmt.Errorf("reading CSV: %w", err)
+		return nil, result, fmt.Errorf("reading CSV: %w", err)
+	}
+
+	// Map header names to column positions so column order doesn't matter
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")
+		columns[name] = i
+	}
+	for _, name := range requiredStopColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, result, fmt.Errorf("stops file missing required column %q", name)
+		}
 	}
 
-	if len(records) < 2 {
-		return fmt.Errorf("stops file has no data rows")
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
 	}
 
-	// Skip header row
-	for _, record := range records[1:] {
-		if len(record) < 5 {
+	var stops []models.Stop
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, result, fmt.Errorf("reading CSV: %w", err)
+		}
+		rows++
+		line, _ := reader.FieldPos(0)
+
+		stop, reason := parseStopRecord(record, field)
+		if reason != "" {
+			result.Skipped = append(result.Skipped, SkippedRow{Line: line, Reason: reason})
 			continue
 		}
+		stops = append(stops, stop)
+	}
+
+	if rows == 0 {
+		return nil, result, fmt.Errorf("stops file has no data rows")
+	}
+	if len(stops) == 0 {
+		return nil, result, fmt.Errorf("stops file has no valid rows (%d skipped)", len(result.Skipped))
+	}
+
+	result.Loaded = len(stops)
+	return stops, result, nil
+}
+
+// parseStopRecord converts a CSV row to a Stop, returning a non-empty reason
+// if the row is invalid
+func parseStopRecord(record []string, field func([]string, string) string) (models.Stop, string) {
+	id := field(record, "stop_id")
+	if id == "" {
+		return models.Stop{}, "missing stop_id"
+	}
 
-		lat, _ := strconv.ParseFloat(record[2], 64)
-		lng, _ := strconv.ParseFloat(record[3], 64)
-		locationType, _ := strconv.Atoi(record[4])
+	lat, err := strconv.ParseFloat(field(record, "stop_lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return models.Stop{}, fmt.Sprintf("invalid stop_lat %q", field(record, "stop_lat"))
+	}
+	lng, err := strconv.ParseFloat(field(record, "stop_lon"), 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return models.Stop{}, fmt.Sprintf("invalid stop_lon %q", field(record, "stop_lon"))
+	}
 
-		parentStation := ""
-		if len(record) > 5 {
-			parentStation = record[5]
+	locationType := 0
+	if raw := field(record, "location_type"); raw != "" {
+		locationType, err = strconv.Atoi(raw)
+		if err != nil {
+			return models.Stop{}, fmt.Sprintf("invalid location_type %q", raw)
 		}
+	}
+
+	return models.Stop{
+		ID:            id,
+		Name:          field(record, "stop_name"),
+		Lat:           lat,
+		Lng:           lng,
+		LocationType:  locationType,
+		ParentStation: field(record, "parent_station"),
+		Code:          field(record, "stop_code"),
+	}, ""
+}
+
+// Column names accepted in a complexes file: the MTA's Stations.csv headings,
+// or snake_case equivalents
+var (
+	complexStopColumns = []string{"GTFS Stop ID", "gtfs_stop_id", "stop_id"}
+	complexIDColumns   = []string{"Complex ID", "complex_id"}
+)
 
-		s.stops = append(s.stops, models.Stop{
-			ID:            record[0],
-			Name:          record[1],
-			Lat:           lat,
-			Lng:           lng,
-			LocationType:  locationType,
-			ParentStation: parentStation,
-		})
+// readComplexes maps GTFS parent station IDs to MTA complex IDs
+func readComplexes(filepath string) (map[string]string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("opening complexes file: %w", err)
 	}
+	defer file.Close()
 
-	s.loaded = true
-	return nil
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading complexes header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	find := func(names []string) (int, bool) {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	stopCol, ok := find(complexStopColumns)
+	if !ok {
+		return nil, fmt.Errorf("complexes file missing a %q column", complexStopColumns[0])
+	}
+	complexCol, ok := find(complexIDColumns)
+	if !ok {
+		return nil, fmt.Errorf("complexes file missing a %q column", complexIDColumns[0])
+	}
+
+	complexes := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading complexes CSV: %w", err)
+		}
+		if stopCol >= len(record) || complexCol >= len(record) {
+			continue
+		}
+		stopID := strings.TrimSpace(record[stopCol])
+		complexID := strings.TrimSpace(record[complexCol])
+		if stopID != "" && complexID != "" {
+			complexes[stopID] = complexID
+		}
+	}
+	return complexes, nil
 }
 
-// FindNearby returns stops within a radius (meters) of a point
+// applyComplexes sets ComplexID on each station in complexes and on its
+// child stops
+func applyComplexes(stops []models.Stop, complexes map[string]string) {
+	for i := range stops {
+		id := stops[i].ID
+		if stops[i].ParentStation != "" {
+			id = stops[i].ParentStation
+		}
+		if complexID, ok := complexes[id]; ok {
+			stops[i].ComplexID = complexID
+		}
+	}
+}
+
+// FindNearby returns parent stations within a radius (meters) of a point
 func (s *StopService) FindNearby(lat, lng, radiusMeters float64) []models.StopWithDistance {
+	return s.FindNearbyWithOptions(lat, lng, radiusMeters, NearbyOptions{})
+}
+
+// FindNearbyWithOptions returns stops within a radius (meters) of a point.
+// Parent stations carry the IDs of their child platforms. When a cluster
+// radius is set, parent-station results are clustered (see SetClusterRadius).
+func (s *StopService) FindNearbyWithOptions(lat, lng, radiusMeters float64, opts NearbyOptions) []models.StopWithDistance {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var results []models.StopWithDistance
 
 	for _, stop := range s.stops {
-		// Only include parent stations (location_type = 1)
-		if stop.LocationType != 1 {
+		// Only include parent stations (location_type = 1) unless asked for children
+		if stop.LocationType != 1 && !opts.IncludeChildren {
 			continue
 		}
 
 		dist := Haversine(lat, lng, stop.Lat, stop.Lng)
 		if dist <= radiusMeters {
-			results = append(results, models.StopWithDistance{
-				Stop:           stop,
-				DistanceMeters: dist,
-				DistanceMiles:  MetersToMiles(dist),
-			})
+			result := withDistance(stop, lat, lng, dist)
+			if stop.LocationType == 1 {
+				result.PlatformIDs = slices.Clone(s.platforms[stop.ID])
+			}
+			results = append(results, result)
 		}
 	}
 
@@ -101,11 +379,58 @@ func (s *StopService) FindNearby(lat, lng, radiusMeters float64) []models.StopWi
 		return results[i].DistanceMeters < results[j].DistanceMeters
 	})
 
+	if s.clusterMeters > 0 && !opts.IncludeChildren {
+		results = clusterStops(results, s.clusterMeters)
+	}
+
 	return results
 }
 
+// clusterStops folds each stop into the first (closest) kept stop within
+// meters of it, recording the folded IDs on the kept entry. stops must be
+// sorted nearest first.
+func clusterStops(stops []models.StopWithDistance, meters float64) []models.StopWithDistance {
+	var kept []models.StopWithDistance
+	for _, stop := range stops {
+		merged := false
+		for i := range kept {
+			if Haversine(kept[i].Lat, kept[i].Lng, stop.Lat, stop.Lng) <= meters {
+				kept[i].MergedIDs = append(kept[i].MergedIDs, stop.ID)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			kept = append(kept, stop)
+		}
+	}
+	return kept
+}
+
 // FindClosest returns the N closest stops to a point
 func (s *StopService) FindClosest(lat, lng float64, limit int) []models.StopWithDistance {
+	stops, _ := s.FindClosestWithin(lat, lng, limit, 0)
+	return stops
+}
+
+// FindClosestWithin returns up to N closest stops, dropping any farther than
+// maxMeters (zero means no cap). truncated reports whether the cap left fewer
+// stops than FindClosest would have returned.
+func (s *StopService) FindClosestWithin(lat, lng float64, limit int, maxMeters float64) (stops []models.StopWithDistance, truncated bool) {
+	results := s.closest(lat, lng, limit)
+	if maxMeters <= 0 {
+		return results, false
+	}
+	for i, stop := range results {
+		if stop.DistanceMeters > maxMeters {
+			return results[:i], true
+		}
+	}
+	return results, false
+}
+
+// closest returns the N closest parent stations, nearest first
+func (s *StopService) closest(lat, lng float64, limit int) []models.StopWithDistance {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -118,11 +443,9 @@ func (s *StopService) FindClosest(lat, lng float64, limit int) []models.StopWith
 		}
 
 		dist := Haversine(lat, lng, stop.Lat, stop.Lng)
-		results = append(results, models.StopWithDistance{
-			Stop:           stop,
-			DistanceMeters: dist,
-			DistanceMiles:  MetersToMiles(dist),
-		})
+		result := withDistance(stop, lat, lng, dist)
+		result.PlatformIDs = slices.Clone(s.platforms[stop.ID])
+		results = append(results, result)
 	}
 
 	// Sort by distance
@@ -137,6 +460,137 @@ func (s *StopService) FindClosest(lat, lng float64, limit int) []models.StopWith
 	return results
 }
 
+// FindInBounds returns parent stations inside a latitude/longitude rectangle.
+// Edges are inclusive.
+func (s *StopService) FindInBounds(minLat, minLng, maxLat, maxLng float64) []models.Stop {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []models.Stop
+	for _, stop := range s.stops {
+		if stop.LocationType != 1 {
+			continue
+		}
+		if stop.Lat >= minLat && stop.Lat <= maxLat && stop.Lng >= minLng && stop.Lng <= maxLng {
+			results = append(results, stop)
+		}
+	}
+	return results
+}
+
+// ParentStations returns every parent station sorted by name, then ID
+func (s *StopService) ParentStations() []models.Stop {
+	s.mu.RLock()
+	var results []models.Stop
+	for _, stop := range s.stops {
+		if stop.LocationType == 1 {
+			results = append(results, stop)
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(results, func(a, b models.Stop) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+	return results
+}
+
+// All yields the parent stations, or every stop with includeChildren, in
+// file order. It iterates over the data loaded when called without holding a
+// lock, so a slow consumer doesn't block a reload and a reload doesn't change
+// what it yields.
+func (s *StopService) All(includeChildren bool) iter.Seq[models.Stop] {
+	s.mu.RLock()
+	stops := s.stops // Load replaces the slice rather than modifying it
+	s.mu.RUnlock()
+
+	return func(yield func(models.Stop) bool) {
+		for _, stop := range stops {
+			if !includeChildren && stop.LocationType != 1 {
+				continue
+			}
+			if !yield(stop) {
+				return
+			}
+		}
+	}
+}
+
+// SearchByName returns parent stations whose names contain query, ignoring
+// case. Exact matches rank first, then prefix matches, then other substring
+// matches; within a rank shorter names come first. A non-positive limit
+// returns every match.
+func (s *StopService) SearchByName(query string, limit int) []models.Stop {
+	stops, _ := s.SearchByNamePage(query, limit, nil)
+	return stops
+}
+
+// SearchByNamePage is SearchByName resuming after a cursor from an earlier
+// page (nil for the first). It also returns the cursor for the next page, or
+// nil when there are no more matches.
+func (s *StopService) SearchByNamePage(query string, limit int, after *SearchCursor) ([]models.Stop, *SearchCursor) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, nil
+	}
+
+	type match struct {
+		stop models.Stop
+		key  SearchCursor
+	}
+
+	s.mu.RLock()
+	var matches []match
+	for _, stop := range s.stops {
+		if stop.LocationType != 1 {
+			continue
+		}
+		name := strings.ToLower(stop.Name)
+		rank := 0
+		switch {
+		case name == query:
+		case strings.HasPrefix(name, query):
+			rank = 1
+		case strings.Contains(name, query):
+			rank = 2
+		default:
+			continue
+		}
+		key := SearchCursor{rank: rank, name: stop.Name, id: stop.ID}
+		if after == nil || key.compare(*after) > 0 {
+			matches = append(matches, match{stop, key})
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b match) int {
+		return a.key.compare(b.key)
+	})
+	var next *SearchCursor
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+		next = &matches[limit-1].key
+	}
+
+	results := make([]models.Stop, len(matches))
+	for i, m := range matches {
+		results[i] = m.stop
+	}
+	return results, next
+}
+
+// withDistance annotates a stop with its distance and direction from the origin
+func withDistance(stop models.Stop, lat, lng, dist float64) models.StopWithDistance {
+	bearing := Bearing(lat, lng, stop.Lat, stop.Lng)
+	return models.StopWithDistance{
+		Stop:           stop,
+		DistanceMeters: dist,
+		DistanceMiles:  MetersToMiles(dist),
+		Bearing:        bearing,
+		Direction:      CompassDirection(bearing),
+	}
+}
+
 // Count returns the number of loaded stops
 func (s *StopService) Count() int {
 	s.mu.RLock()
@@ -171,6 +625,69 @@ func (s *StopService) GetByID(id string) (models.Stop, bool) {
 	return models.Stop{}, false
 }
 
+// Children returns the child stops (platforms, entrances) of a parent station
+func (s *StopService) Children(parentID string) []models.Stop {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.children[parentID]
+	if len(ids) == 0 {
+		return nil
+	}
+
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	children := make([]models.Stop, 0, len(ids))
+	for _, stop := range s.stops {
+		if want[stop.ID] {
+			children = append(children, stop)
+		}
+	}
+	return children
+}
+
+// PlatformIDs returns the IDs of a parent station's platforms; entrances and
+// other child stops are left out (see Children)
+func (s *StopService) PlatformIDs(parentID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.platforms[parentID])
+}
+
+// ComplexPlatformIDs returns the platform IDs of every station in the same
+// station complex as stationID (a parent station or one of its platforms).
+// Lines in a complex often have their own parent stations: 14 St-Union Sq is
+// 635 for the 4/5/6 and L03 for the L. Without complex data (see
+// SetComplexesFile) it's just the station's own platforms.
+func (s *StopService) ComplexPlatformIDs(stationID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var station models.Stop
+	for _, stop := range s.stops {
+		if stop.ID == stationID {
+			station = stop
+			break
+		}
+	}
+	if station.ParentStation != "" {
+		stationID = station.ParentStation
+	}
+	members := s.complexes[station.ComplexID]
+	if station.ComplexID == "" || len(members) == 0 {
+		members = []string{stationID}
+	}
+
+	var ids []string
+	for _, member := range members {
+		ids = append(ids, s.platforms[member]...)
+	}
+	return ids
+}
+
 // IsLoaded returns true if data has been loaded
 func (s *StopService) IsLoaded() bool {
 	s.mu.RLock()
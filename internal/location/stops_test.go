@@ -0,0 +1,506 @@
+package location
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/randytsao24/emteeayy/internal/models"
+)
+
+var testStopsPath = filepath.Join("..", "..", "data", "stops.txt")
+
+func loadTestStops(t *testing.T) *StopService {
+	t.Helper()
+	svc := NewStopService()
+	if _, err := svc.Load(testStopsPath); err != nil {
+		t.Fatalf("load stops: %v", err)
+	}
+	return svc
+}
+
+func TestStopLoadTwiceDoesNotDuplicate(t *testing.T) {
+	svc := loadTestStops(t)
+	count := svc.Count()
+	stations := svc.ParentStationCount()
+
+	if _, err := svc.Load(testStopsPath); err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+
+	if got := svc.Count(); got != count {
+		t.Errorf("Count after second load = %d, want %d", got, count)
+	}
+	if got := svc.ParentStationCount(); got != stations {
+		t.Errorf("ParentStationCount after second load = %d, want %d", got, stations)
+	}
+
+	// A duplicated dataset would return the same station twice
+	nearby := svc.FindNearby(40.7506, -73.9935, 200)
+	seen := make(map[string]bool)
+	for _, stop := range nearby {
+		if seen[stop.ID] {
+			t.Errorf("stop %s returned more than once", stop.ID)
+		}
+		seen[stop.ID] = true
+	}
+}
+
+func TestStopReload(t *testing.T) {
+	svc := loadTestStops(t)
+	count := svc.Count()
+
+	if _, err := svc.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := svc.Count(); got != count {
+		t.Errorf("Count after reload = %d, want %d", got, count)
+	}
+}
+
+func TestStopReloadWithoutLoad(t *testing.T) {
+	if _, err := NewStopService().Reload(); err == nil {
+		t.Error("expected error reloading a service that was never loaded")
+	}
+}
+
+func TestStopLoadReorderedColumns(t *testing.T) {
+	svc := NewStopService()
+	if _, err := svc.Load(filepath.Join("testdata", "stops_reordered.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if got := svc.Count(); got != 4 {
+		t.Fatalf("Count = %d, want 4", got)
+	}
+	if got := svc.ParentStationCount(); got != 2 {
+		t.Errorf("ParentStationCount = %d, want 2", got)
+	}
+
+	stop, ok := svc.GetByID("127")
+	if !ok {
+		t.Fatal("stop 127 not found")
+	}
+	if stop.Name != "Times Sq-42 St" || stop.Lat != 40.75529 || stop.Lng != -73.987495 || stop.LocationType != 1 {
+		t.Errorf("stop 127 misparsed: %+v", stop)
+	}
+
+	platform, ok := svc.GetByID("127N")
+	if !ok {
+		t.Fatal("stop 127N not found")
+	}
+	if platform.ParentStation != "127" {
+		t.Errorf("127N parent = %q, want 127", platform.ParentStation)
+	}
+}
+
+func TestStopLoadMissingRequiredColumn(t *testing.T) {
+	svc := NewStopService()
+	_, err := svc.Load(filepath.Join("testdata", "stops_missing_column.txt"))
+	if err == nil {
+		t.Fatal("expected error for missing stop_lon column")
+	}
+	if !strings.Contains(err.Error(), "stop_lon") {
+		t.Errorf("error %q should name the missing column", err)
+	}
+	if svc.IsLoaded() {
+		t.Error("service should not be marked loaded after a failed load")
+	}
+}
+
+func TestStopLoadReportsMalformedRows(t *testing.T) {
+	svc := NewStopService()
+	result, err := svc.Load(filepath.Join("testdata", "stops_malformed.txt"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if result.Loaded != 2 || svc.Count() != 2 {
+		t.Errorf("loaded %d (Count %d), want 2", result.Loaded, svc.Count())
+	}
+	for _, id := range []string{"128", "129"} {
+		if _, ok := svc.GetByID(id); ok {
+			t.Errorf("stop %s with bad coordinates should not be stored", id)
+		}
+	}
+
+	wantLines := []int{3, 4, 5}
+	if len(result.Skipped) != len(wantLines) {
+		t.Fatalf("skipped %d rows, want %d: %+v", len(result.Skipped), len(wantLines), result.Skipped)
+	}
+	for i, row := range result.Skipped {
+		if row.Line != wantLines[i] {
+			t.Errorf("skipped[%d].Line = %d, want %d", i, row.Line, wantLines[i])
+		}
+		if row.Reason == "" {
+			t.Errorf("skipped[%d] has no reason", i)
+		}
+	}
+	if !strings.Contains(result.Skipped[0].Reason, "stop_lat") {
+		t.Errorf("reason %q should mention stop_lat", result.Skipped[0].Reason)
+	}
+
+	// A bad row must never surface as a stop at 0,0
+	if got := svc.FindNearby(0, 0, 1000); len(got) != 0 {
+		t.Errorf("found %d stops near 0,0", len(got))
+	}
+}
+
+func TestStopLoadRealDataHasNoSkippedRows(t *testing.T) {
+	result, err := NewStopService().Load(testStopsPath)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(result.Skipped) != 0 {
+		t.Errorf("real stops.txt skipped rows: %+v", result.Skipped)
+	}
+}
+
+func TestStopParentChildLinkage(t *testing.T) {
+	svc := loadTestStops(t)
+
+	// Times Sq-42 St on the 1/2/3
+	if got := svc.PlatformIDs("127"); !reflect.DeepEqual(got, []string{"127N", "127S"}) {
+		t.Errorf("PlatformIDs(127) = %v, want [127N 127S]", got)
+	}
+	for _, child := range svc.Children("127") {
+		if child.ParentStation != "127" {
+			t.Errorf("child %s has parent %q", child.ID, child.ParentStation)
+		}
+	}
+	if got := svc.PlatformIDs("127N"); len(got) != 0 {
+		t.Errorf("platform 127N should have no children, got %v", got)
+	}
+}
+
+func TestStopComplexWithDistinctPlatformIDs(t *testing.T) {
+	svc := NewStopService()
+	if _, err := svc.Load(filepath.Join("testdata", "stops_complex.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// The entrance is a child but not a platform
+	want := []string{"635N", "635S", "L03N", "L03S"}
+	if got := svc.PlatformIDs("635"); !reflect.DeepEqual(got, want) {
+		t.Errorf("PlatformIDs(635) = %v, want %v", got, want)
+	}
+	if got := len(svc.Children("635")); got != len(want)+1 {
+		t.Errorf("Children(635) returned %d stops, want %d", got, len(want)+1)
+	}
+
+	parents := svc.FindNearby(40.7347, -73.9900, 500)
+	if len(parents) != 1 || parents[0].ID != "635" {
+		t.Fatalf("FindNearby = %v, want only parent 635", parents)
+	}
+	if !reflect.DeepEqual(parents[0].PlatformIDs, want) {
+		t.Errorf("parent PlatformIDs = %v, want %v", parents[0].PlatformIDs, want)
+	}
+
+	all := svc.FindNearbyWithOptions(40.7347, -73.9900, 500, NearbyOptions{IncludeChildren: true})
+	if len(all) != 6 {
+		t.Errorf("FindNearbyWithOptions(IncludeChildren) returned %d stops, want 6", len(all))
+	}
+}
+
+func TestStatenIslandRailwayStopsLoaded(t *testing.T) {
+	svc := loadTestStops(t)
+
+	stop, ok := svc.GetByID("S31")
+	if !ok {
+		t.Fatal("St George (S31) not loaded")
+	}
+	if stop.LocationType != 1 {
+		t.Errorf("S31 location_type = %d, want 1", stop.LocationType)
+	}
+
+	platforms := svc.PlatformIDs("S31")
+	slices.Sort(platforms)
+	if !slices.Equal(platforms, []string{"S31N", "S31S"}) {
+		t.Errorf("S31 platforms = %v, want [S31N S31S]", platforms)
+	}
+}
+
+func TestFindInBoundsMidtown(t *testing.T) {
+	svc := loadTestStops(t)
+
+	stops := svc.FindInBounds(40.745, -73.995, 40.765, -73.970)
+	found := make(map[string]bool, len(stops))
+	for _, stop := range stops {
+		if stop.LocationType != 1 {
+			t.Errorf("stop %s is not a parent station", stop.ID)
+		}
+		found[stop.ID] = true
+	}
+
+	for _, id := range []string{"127", "631", "D17", "A27"} {
+		if !found[id] {
+			t.Errorf("expected %s inside Midtown box", id)
+		}
+	}
+	// Platforms, Downtown Brooklyn, and Staten Island are all excluded
+	for _, id := range []string{"127N", "R28", "S31", "S09"} {
+		if found[id] {
+			t.Errorf("did not expect %s inside Midtown box", id)
+		}
+	}
+}
+
+func TestFindNearbyClustering(t *testing.T) {
+	svc := NewStopService()
+	if _, err := svc.Load(filepath.Join("testdata", "stops_cluster.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// A01 and B01 are ~20m apart; C01 is ~550m north
+	lat, lng := 40.7499, -73.9900
+
+	ids := func(stops []models.StopWithDistance) []string {
+		var out []string
+		for _, s := range stops {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+
+	if got := ids(svc.FindNearby(lat, lng, 1000)); !slices.Equal(got, []string{"A01", "B01", "C01"}) {
+		t.Fatalf("unclustered = %v, want [A01 B01 C01]", got)
+	}
+
+	svc.SetClusterRadius(50)
+	nearby := svc.FindNearby(lat, lng, 1000)
+	if got := ids(nearby); !slices.Equal(got, []string{"A01", "C01"}) {
+		t.Fatalf("clustered = %v, want [A01 C01]", got)
+	}
+	if !slices.Equal(nearby[0].MergedIDs, []string{"B01"}) {
+		t.Errorf("A01 MergedIDs = %v, want [B01]", nearby[0].MergedIDs)
+	}
+	if nearby[1].MergedIDs != nil {
+		t.Errorf("C01 MergedIDs = %v, want none", nearby[1].MergedIDs)
+	}
+
+	// Closer stop wins when the origin sits on the other side of the pair
+	nearby = svc.FindNearby(40.7502, -73.9903, 1000)
+	if nearby[0].ID != "B01" || !slices.Equal(nearby[0].MergedIDs, []string{"A01"}) {
+		t.Errorf("clustered from west = %s %v, want B01 [A01]", nearby[0].ID, nearby[0].MergedIDs)
+	}
+
+	// Child-stop queries are never clustered
+	all := svc.FindNearbyWithOptions(lat, lng, 1000, NearbyOptions{IncludeChildren: true})
+	if len(all) != 5 {
+		t.Errorf("IncludeChildren returned %d stops, want 5", len(all))
+	}
+}
+
+func TestFindClosestWithinDistanceCap(t *testing.T) {
+	svc := loadTestStops(t)
+
+	// Bellerose, Queens: the nearest stations are roughly 6-8km away
+	lat, lng := 40.7393, -73.7230
+
+	uncapped := svc.FindClosest(lat, lng, 3)
+	if len(uncapped) != 3 {
+		t.Fatalf("FindClosest returned %d stops, want 3", len(uncapped))
+	}
+
+	capped, truncated := svc.FindClosestWithin(lat, lng, 3, 7000)
+	if !truncated {
+		t.Error("expected truncated = true when the cap drops stops")
+	}
+	if len(capped) == 0 || len(capped) >= len(uncapped) {
+		t.Fatalf("capped returned %d stops, want between 1 and %d", len(capped), len(uncapped)-1)
+	}
+	for _, stop := range capped {
+		if stop.DistanceMeters > 7000 {
+			t.Errorf("%s is %.0fm away, beyond the 7000m cap", stop.ID, stop.DistanceMeters)
+		}
+	}
+
+	if stops, truncated := svc.FindClosestWithin(lat, lng, 3, 1000); len(stops) != 0 || !truncated {
+		t.Errorf("1km cap = %d stops (truncated %v), want none and truncated", len(stops), truncated)
+	}
+
+	// A cap that excludes nothing isn't a truncation
+	if stops, truncated := svc.FindClosestWithin(lat, lng, 3, 20000); len(stops) != 3 || truncated {
+		t.Errorf("20km cap = %d stops (truncated %v), want 3 and not truncated", len(stops), truncated)
+	}
+}
+
+func TestStopSearchByNameRanking(t *testing.T) {
+	svc := NewStopService()
+	if _, err := svc.Load(filepath.Join("testdata", "stops_search.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	ids := func(stops []models.Stop) []string {
+		var out []string
+		for _, s := range stops {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+
+	// Exact, then prefixes (shortest first), then substrings (shortest first);
+	// the C01N platform is never returned
+	want := []string{"C02", "C01", "C03", "W01", "G01"}
+	if got := ids(svc.SearchByName("canal", 0)); !slices.Equal(got, want) {
+		t.Errorf("SearchByName(canal) = %v, want %v", got, want)
+	}
+	if got := ids(svc.SearchByName("  CANAL ST ", 2)); !slices.Equal(got, []string{"C01", "C03"}) {
+		t.Errorf("SearchByName(CANAL ST, 2) = %v, want [C01 C03]", got)
+	}
+	if got := svc.SearchByName("", 0); got != nil {
+		t.Errorf("empty query = %v, want nil", got)
+	}
+}
+
+func TestStopSearchByNamePage(t *testing.T) {
+	svc := NewStopService()
+	if _, err := svc.Load(filepath.Join("testdata", "stops_search.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// Two at a time, round-tripping the cursor as a client would
+	var got []string
+	var after *SearchCursor
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("paging never ended")
+		}
+		stops, next := svc.SearchByNamePage("canal", 2, after)
+		for _, s := range stops {
+			got = append(got, s.ID)
+		}
+		if next == nil {
+			break
+		}
+		cursor, err := ParseSearchCursor(next.Encode())
+		if err != nil {
+			t.Fatalf("page %d cursor: %v", page, err)
+		}
+		after = &cursor
+	}
+	if want := []string{"C02", "C01", "C03", "W01", "G01"}; !slices.Equal(got, want) {
+		t.Errorf("paged = %v, want %v with no gaps or repeats", got, want)
+	}
+
+	// A cursor outlives its stop: after a reload without C01, paging still
+	// resumes right after where C01 sorted
+	gone := SearchCursor{rank: 1, name: "Canal St", id: "C01"}
+	stops, next := svc.SearchByNamePage("canal", 0, &gone)
+	var rest []string
+	for _, s := range stops {
+		rest = append(rest, s.ID)
+	}
+	if want := []string{"C03", "W01", "G01"}; !slices.Equal(rest, want) || next != nil {
+		t.Errorf("after C01 = %v (next %v), want %v and no next page", rest, next, want)
+	}
+
+	for _, token := range []string{"", "not base64!", "bm90IGpzb24", SearchCursor{rank: 7, id: "X"}.Encode(), SearchCursor{rank: 1}.Encode()} {
+		if _, err := ParseSearchCursor(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ParseSearchCursor(%q) = %v, want ErrInvalidCursor", token, err)
+		}
+	}
+}
+
+func TestStopLoadCodesAndComplexes(t *testing.T) {
+	svc := NewStopService()
+	svc.SetComplexesFile(filepath.Join("testdata", "complexes.csv"))
+	if _, err := svc.Load(filepath.Join("testdata", "stops_codes.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		id, code, complexID string
+	}{
+		{"127", "TSQ", "611"},
+		{"127N", "", "611"}, // platforms inherit the parent's complex
+		{"725", "", "611"},
+		{"101", "VCP", "1"},
+	}
+	for _, tc := range tests {
+		stop, ok := svc.GetByID(tc.id)
+		if !ok {
+			t.Fatalf("stop %s not found", tc.id)
+		}
+		if stop.Code != tc.code || stop.ComplexID != tc.complexID {
+			t.Errorf("stop %s code/complex = %q/%q, want %q/%q", tc.id, stop.Code, stop.ComplexID, tc.code, tc.complexID)
+		}
+	}
+
+	// Surfaced in JSON when present, omitted otherwise
+	stop, _ := svc.GetByID("127")
+	data, err := json.Marshal(stop)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"stop_code":"TSQ"`) || !strings.Contains(string(data), `"complex_id":"611"`) {
+		t.Errorf("stop JSON = %s, want stop_code and complex_id", data)
+	}
+	plain := loadTestStops(t)
+	stop, _ = plain.GetByID("127")
+	if data, _ := json.Marshal(stop); strings.Contains(string(data), "stop_code") || strings.Contains(string(data), "complex_id") {
+		t.Errorf("stop without codes JSON = %s, want the fields omitted", data)
+	}
+}
+
+func TestStopComplexPlatformIDs(t *testing.T) {
+	svc := NewStopService()
+	svc.SetComplexesFile(filepath.Join("testdata", "complexes.csv"))
+	if _, err := svc.Load(filepath.Join("testdata", "stops_codes.txt")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// 725 has no platforms of its own in the fixture, but shares complex 611
+	// with 127; platform IDs resolve to their station first
+	for _, id := range []string{"725", "127", "127N"} {
+		if got := svc.ComplexPlatformIDs(id); !slices.Equal(got, []string{"127N"}) {
+			t.Errorf("ComplexPlatformIDs(%s) = %v, want [127N]", id, got)
+		}
+	}
+
+	// Without complex data a station only has its own platforms
+	plain := loadTestStops(t)
+	if got := plain.ComplexPlatformIDs("635"); !slices.Equal(got, []string{"635N", "635S"}) {
+		t.Errorf("ComplexPlatformIDs(635) without complexes = %v, want [635N 635S]", got)
+	}
+}
+
+func TestStopLoadBadComplexesFile(t *testing.T) {
+	svc := NewStopService()
+	svc.SetComplexesFile(filepath.Join("testdata", "stops_codes.txt")) // no Complex ID column
+	if _, err := svc.Load(filepath.Join("testdata", "stops_codes.txt")); err == nil {
+		t.Error("expected an error for a complexes file without a Complex ID column")
+	}
+}
+
+func TestStopAll(t *testing.T) {
+	svc := loadTestStops(t)
+
+	parents := 0
+	for stop := range svc.All(false) {
+		if stop.LocationType != 1 {
+			t.Fatalf("All(false) yielded %s with location type %d", stop.ID, stop.LocationType)
+		}
+		parents++
+	}
+	if parents != svc.ParentStationCount() {
+		t.Errorf("All(false) yielded %d stops, want %d", parents, svc.ParentStationCount())
+	}
+
+	all := 0
+	for range svc.All(true) {
+		all++
+	}
+	if all != svc.Count() {
+		t.Errorf("All(true) yielded %d stops, want %d", all, svc.Count())
+	}
+
+	// Stopping early is fine
+	for range svc.All(true) {
+		break
+	}
+}
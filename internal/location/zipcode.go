@@ -6,30 +6,66 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/randytsao24/emteeayy/internal/cache"
 	"github.com/randytsao24/emteeayy/internal/models"
 )
 
+const (
+	// nearestCacheSize bounds the reverse-geocode cache; each entry covers a
+	// ~100m grid cell, so this comfortably holds a busy city's worth of lookups
+	nearestCacheSize = 4096
+	// nearestCacheTTL only matters for memory; reloads clear the cache
+	nearestCacheTTL = time.Hour
+)
+
 // ZipCodeService manages zip code data
 type ZipCodeService struct {
+	readySignal
+
 	zipCodes map[string]models.ZipCode
+	path     string
 	mu       sync.RWMutex
 	loaded   bool
+
+	// boroughsPath, if set, is read on every Load for Borough lookups
+	boroughsPath string
+	boroughs     []boroughShape
+
+	nearest *cache.Cache[models.ZipCode] // FindNearest results by rounded coordinates
 }
 
 // NewZipCodeService creates a new zip code service
 func NewZipCodeService() *ZipCodeService {
 	return &ZipCodeService{
 		zipCodes: make(map[string]models.ZipCode),
+		nearest:  cache.NewBounded[models.ZipCode](nearestCacheTTL, nearestCacheSize),
 	}
 }
 
-// Load reads zip code data from a JSON file
-func (s *ZipCodeService) Load(filepath string) error {
+// Close stops the nearest-zip cache's cleanup goroutine. Lookups still work
+// afterwards, but expired entries are no longer swept. Call it once.
+func (s *ZipCodeService) Close() {
+	s.nearest.Close()
+}
+
+// SetBoroughsFile makes Load also read borough outlines from path, a GeoJSON
+// FeatureCollection such as NYC Open Data's Borough Boundaries. Without one,
+// Borough falls back to the nearest zip's borough.
+func (s *ZipCodeService) SetBoroughsFile(path string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.boroughsPath = path
+}
 
+// Load reads zip code data from a JSON file. The file is parsed before taking
+// the write lock and the result replaces any previously loaded data, so it is
+// safe to call again at runtime.
+func (s *ZipCodeService) Load(filepath string) error {
 	data, err := os.ReadFile(filepath)
 	if err != nil {
 		return fmt.Errorf("reading zip code file: %w", err)
@@ -48,8 +84,9 @@ func (s *ZipCodeService) Load(filepath string) error {
 	}
 
 	// Convert to our model
+	zipCodes := make(map[string]models.ZipCode, len(raw))
 	for code, loc := range raw {
-		s.zipCodes[code] = models.ZipCode{
+		zipCodes[code] = models.ZipCode{
 			Code:    code,
 			Lat:     loc.Lat,
 			Lng:     loc.Lng,
@@ -58,10 +95,41 @@ func (s *ZipCodeService) Load(filepath string) error {
 		}
 	}
 
+	s.mu.RLock()
+	boroughsPath := s.boroughsPath
+	s.mu.RUnlock()
+
+	var boroughs []boroughShape
+	if boroughsPath != "" {
+		if boroughs, err = readBoroughs(boroughsPath); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.zipCodes = zipCodes
+	s.boroughs = boroughs
+	s.path = filepath
 	s.loaded = true
+	s.nearest.Clear()
+	s.mu.Unlock()
+
+	s.markReady()
 	return nil
 }
 
+// Reload re-reads zip code data from the file it was last loaded from
+func (s *ZipCodeService) Reload() error {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+
+	if path == "" {
+		return fmt.Errorf("zip codes have not been loaded from a file")
+	}
+	return s.Load(path)
+}
+
 // Get returns a zip code by its code
 func (s *ZipCodeService) Get(code string) (models.ZipCode, bool) {
 	s.mu.RLock()
@@ -71,7 +139,7 @@ func (s *ZipCodeService) Get(code string) (models.ZipCode, bool) {
 	return zip, exists
 }
 
-// GetAll returns all zip codes
+// GetAll returns all zip codes sorted by code
 func (s *ZipCodeService) GetAll() []models.ZipCode {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -80,24 +148,29 @@ func (s *ZipCodeService) GetAll() []models.ZipCode {
 	for _, zip := range s.zipCodes {
 		result = append(result, zip)
 	}
+	sortZipCodes(result)
 	return result
 }
 
-// GetByBorough returns all zip codes in a borough
+// GetByBorough returns all zip codes in a borough sorted by code. The name is
+// matched case-insensitively after trimming; an unknown borough yields an
+// empty, non-nil slice.
 func (s *ZipCodeService) GetByBorough(borough string) []models.ZipCode {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var result []models.ZipCode
+	borough = strings.TrimSpace(borough)
+	result := []models.ZipCode{}
 	for _, zip := range s.zipCodes {
-		if zip.Borough == borough {
+		if strings.EqualFold(zip.Borough, borough) {
 			result = append(result, zip)
 		}
 	}
+	sortZipCodes(result)
 	return result
 }
 
-// Boroughs returns a list of all unique boroughs
+// Boroughs returns a list of all unique boroughs in alphabetical order
 func (s *ZipCodeService) Boroughs() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -110,11 +183,20 @@ func (s *ZipCodeService) Boroughs() []string {
 			boroughs = append(boroughs, zip.Borough)
 		}
 	}
+	sort.Strings(boroughs)
 	return boroughs
 }
 
-// FindNearest returns the zip code closest to the given coordinates
+// FindNearest returns the zip code closest to the given coordinates. Lookups
+// are rounded to 3 decimal places (~100m) and cached, so nearby repeated
+// queries skip the scan over every zip centroid.
 func (s *ZipCodeService) FindNearest(lat, lng float64) (models.ZipCode, bool) {
+	lat, lng = roundCoord(lat), roundCoord(lng)
+	key := fmt.Sprintf("%.3f,%.3f", lat, lng)
+	if zip, ok := s.nearest.Get(key); ok {
+		return zip, true
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -131,9 +213,39 @@ func (s *ZipCodeService) FindNearest(lat, lng float64) (models.ZipCode, bool) {
 			best = z
 		}
 	}
+	// Set under the read lock so a concurrent Load can't clear first and
+	// leave a stale entry behind
+	s.nearest.Set(key, best)
 	return best, true
 }
 
+// Borough returns the borough containing the coordinates. With a boundaries
+// file loaded that's the borough whose outline contains the point, which is
+// right at borough edges where the nearest zip centroid can be across the
+// line. Without one, or for points outside every outline (e.g. on the
+// water), it's the nearest zip's borough.
+func (s *ZipCodeService) Borough(lat, lng float64) (string, bool) {
+	s.mu.RLock()
+	for _, shape := range s.boroughs {
+		if shape.contains(lat, lng) {
+			s.mu.RUnlock()
+			return shape.name, true
+		}
+	}
+	s.mu.RUnlock()
+
+	zip, ok := s.FindNearest(lat, lng)
+	if !ok || zip.Borough == "" {
+		return "", false
+	}
+	return zip.Borough, true
+}
+
+// roundCoord rounds to the reverse-geocode cache's grid
+func roundCoord(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
 // Count returns the number of loaded zip codes
 func (s *ZipCodeService) Count() int {
 	s.mu.RLock()
@@ -147,3 +259,9 @@ func (s *ZipCodeService) IsLoaded() bool {
 	defer s.mu.RUnlock()
 	return s.loaded
 }
+
+func sortZipCodes(zips []models.ZipCode) {
+	sort.Slice(zips, func(i, j int) bool {
+		return zips[i].Code < zips[j].Code
+	})
+}
@@ -0,0 +1,249 @@
+package location
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func loadTestZipCodes(t *testing.T) *ZipCodeService {
+	t.Helper()
+	svc := NewZipCodeService()
+	t.Cleanup(svc.Close)
+	if err := svc.Load(filepath.Join("..", "..", "data", "nyc-zipcodes.json")); err != nil {
+		t.Fatalf("load zip codes: %v", err)
+	}
+	return svc
+}
+
+func TestZipCodeGetAllSorted(t *testing.T) {
+	svc := loadTestZipCodes(t)
+
+	zips := svc.GetAll()
+	if len(zips) != svc.Count() {
+		t.Fatalf("GetAll returned %d, want %d", len(zips), svc.Count())
+	}
+	for i := 1; i < len(zips); i++ {
+		if zips[i-1].Code >= zips[i].Code {
+			t.Fatalf("not sorted at %d: %s before %s", i, zips[i-1].Code, zips[i].Code)
+		}
+	}
+}
+
+func TestZipCodeGetByBoroughSorted(t *testing.T) {
+	svc := loadTestZipCodes(t)
+
+	zips := svc.GetByBorough("Brooklyn")
+	if len(zips) == 0 {
+		t.Fatal("expected Brooklyn zip codes")
+	}
+	for i, z := range zips {
+		if z.Borough != "Brooklyn" {
+			t.Errorf("zip %s has borough %q", z.Code, z.Borough)
+		}
+		if i > 0 && zips[i-1].Code >= z.Code {
+			t.Fatalf("not sorted at %d: %s before %s", i, zips[i-1].Code, z.Code)
+		}
+	}
+}
+
+func TestZipCodeGetByBoroughCaseInsensitive(t *testing.T) {
+	svc := loadTestZipCodes(t)
+	want := svc.GetByBorough("Manhattan")
+	if len(want) == 0 {
+		t.Fatal("expected Manhattan zip codes")
+	}
+
+	for _, name := range []string{"manhattan", "MANHATTAN", "  mAnHaTtAn "} {
+		got := svc.GetByBorough(name)
+		if !slices.Equal(got, want) {
+			t.Errorf("GetByBorough(%q) returned %d zips, want the same %d as \"Manhattan\"", name, len(got), len(want))
+		}
+	}
+}
+
+func TestZipCodeGetByBoroughUnknown(t *testing.T) {
+	svc := loadTestZipCodes(t)
+	for _, name := range []string{"Atlantis", ""} {
+		got := svc.GetByBorough(name)
+		if got == nil || len(got) != 0 {
+			t.Errorf("GetByBorough(%q) = %#v, want empty non-nil slice", name, got)
+		}
+	}
+}
+
+func TestZipCodeBoroughsSorted(t *testing.T) {
+	svc := loadTestZipCodes(t)
+
+	boroughs := svc.Boroughs()
+	if len(boroughs) != 5 {
+		t.Fatalf("got %d boroughs, want 5: %v", len(boroughs), boroughs)
+	}
+	if !sort.StringsAreSorted(boroughs) {
+		t.Errorf("boroughs not sorted: %v", boroughs)
+	}
+}
+
+func TestZipCodeOrderingStable(t *testing.T) {
+	svc := loadTestZipCodes(t)
+
+	firstAll := svc.GetAll()
+	firstBorough := svc.GetByBorough("Queens")
+	firstBoroughs := svc.Boroughs()
+
+	for i := 0; i < 20; i++ {
+		if !reflect.DeepEqual(svc.GetAll(), firstAll) {
+			t.Fatal("GetAll order changed between calls")
+		}
+		if !reflect.DeepEqual(svc.GetByBorough("Queens"), firstBorough) {
+			t.Fatal("GetByBorough order changed between calls")
+		}
+		if !reflect.DeepEqual(svc.Boroughs(), firstBoroughs) {
+			t.Fatal("Boroughs order changed between calls")
+		}
+	}
+}
+
+func TestZipCodeLoadTwice(t *testing.T) {
+	svc := loadTestZipCodes(t)
+	count := svc.Count()
+
+	if err := svc.Load(filepath.Join("..", "..", "data", "nyc-zipcodes.json")); err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+	if got := svc.Count(); got != count {
+		t.Errorf("Count after second load = %d, want %d", got, count)
+	}
+
+	if err := svc.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := svc.Count(); got != count {
+		t.Errorf("Count after reload = %d, want %d", got, count)
+	}
+}
+
+func TestZipCodeFindNearestCached(t *testing.T) {
+	svc := loadTestZipCodes(t)
+
+	first, ok := svc.FindNearest(40.75012, -73.99341)
+	if !ok {
+		t.Fatal("expected a nearest zip")
+	}
+	if got := svc.nearest.Size(); got != 1 {
+		t.Fatalf("cache size after first lookup = %d, want 1", got)
+	}
+
+	// Drop the zip from the data: a second lookup in the same ~100m cell must
+	// come from the cache to still find it
+	svc.mu.Lock()
+	delete(svc.zipCodes, first.Code)
+	svc.mu.Unlock()
+
+	second, ok := svc.FindNearest(40.75038, -73.99318)
+	if !ok || second.Code != first.Code {
+		t.Errorf("nearby lookup = %s, want cached %s", second.Code, first.Code)
+	}
+	if got := svc.nearest.Size(); got != 1 {
+		t.Errorf("cache size after nearby lookup = %d, want 1 (same cell)", got)
+	}
+
+	// A lookup a few blocks away lands in a different cell
+	svc.FindNearest(40.7580, -73.9855)
+	if got := svc.nearest.Size(); got != 2 {
+		t.Errorf("cache size after distant lookup = %d, want 2", got)
+	}
+}
+
+func TestZipCodeFindNearestCacheClearedOnReload(t *testing.T) {
+	svc := loadTestZipCodes(t)
+	svc.FindNearest(40.7484, -73.9967)
+
+	if err := svc.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := svc.nearest.Size(); got != 0 {
+		t.Errorf("cache size after reload = %d, want 0", got)
+	}
+}
+
+func TestRoundCoord(t *testing.T) {
+	tests := []struct {
+		in, want float64
+	}{
+		{40.75012, 40.750},
+		{40.75049, 40.750},
+		{40.75051, 40.751},
+		{-73.99341, -73.993},
+		{-73.99361, -73.994},
+	}
+	for _, tc := range tests {
+		if got := roundCoord(tc.in); got != tc.want {
+			t.Errorf("roundCoord(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBoroughUsesBoundariesAtBorder(t *testing.T) {
+	// Ridgewood, Queens, a few blocks from the Brooklyn line; the nearest zip
+	// centroid is Bushwick's
+	const lat, lng = 40.701, -73.906
+
+	plain := loadTestZipCodes(t)
+	if borough, _ := plain.Borough(lat, lng); borough != "Brooklyn" {
+		t.Fatalf("without boundaries Borough = %q, want the nearest zip's Brooklyn", borough)
+	}
+
+	svc := NewZipCodeService()
+	t.Cleanup(svc.Close)
+	svc.SetBoroughsFile(filepath.Join("testdata", "borough_boundaries.geojson"))
+	if err := svc.Load(filepath.Join("..", "..", "data", "nyc-zipcodes.json")); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     string
+	}{
+		{"queens side of the line", lat, lng, "Queens"},
+		{"brooklyn side of the line", 40.701, -73.915, "Brooklyn"},
+		{"second polygon of a multipolygon", 40.59, -73.82, "Queens"},
+		{"outside every outline falls back to nearest zip", 40.758, -73.985, "Manhattan"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, ok := svc.Borough(tc.lat, tc.lng); !ok || got != tc.want {
+				t.Errorf("Borough(%v, %v) = %q, %v; want %q", tc.lat, tc.lng, got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestBoroughShapeExcludesHoles(t *testing.T) {
+	shapes, err := readBoroughs(filepath.Join("testdata", "borough_boundaries.geojson"))
+	if err != nil {
+		t.Fatalf("readBoroughs: %v", err)
+	}
+	queens := shapes[1]
+	if queens.contains(40.695, -73.885) {
+		t.Error("point inside a hole counted as inside the borough")
+	}
+	if !queens.contains(40.705, -73.885) {
+		t.Error("point outside the hole not counted as inside the borough")
+	}
+}
+
+func TestZipCodeLoadBadBoroughsFile(t *testing.T) {
+	svc := NewZipCodeService()
+	t.Cleanup(svc.Close)
+	svc.SetBoroughsFile(filepath.Join("testdata", "missing.geojson"))
+	if err := svc.Load(filepath.Join("..", "..", "data", "nyc-zipcodes.json")); err == nil {
+		t.Fatal("Load succeeded with a missing boundaries file")
+	}
+	if svc.IsLoaded() {
+		t.Error("service marked loaded after a failed Load")
+	}
+}
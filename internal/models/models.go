@@ -18,13 +18,22 @@ type Stop struct {
 	Lng           float64 `json:"stop_lon"`
 	LocationType  int     `json:"location_type"`
 	ParentStation string  `json:"parent_station"`
+
+	// Optional identifiers for joining with other MTA datasets; empty when
+	// the source data doesn't provide them
+	Code      string `json:"stop_code,omitempty"`
+	ComplexID string `json:"complex_id,omitempty"`
 }
 
 // StopWithDistance is a Stop with distance from a reference point
 type StopWithDistance struct {
 	Stop
-	DistanceMeters float64 `json:"distance_meters"`
-	DistanceMiles  float64 `json:"distance_miles"`
+	DistanceMeters float64  `json:"distance_meters"`
+	DistanceMiles  float64  `json:"distance_miles"`
+	Bearing        float64  `json:"bearing"`
+	Direction      string   `json:"direction"`
+	PlatformIDs    []string `json:"platform_ids,omitempty"`
+	MergedIDs      []string `json:"merged_ids,omitempty"` // nearby stations folded into this one
 }
 
 // Arrival represents a subway arrival
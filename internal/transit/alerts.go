@@ -1,9 +1,15 @@
 package transit
 
 import (
+	"context"
 	"fmt"
+	"html"
 	"io"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
@@ -11,6 +17,9 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// alertsUpstream names the alerts feed for circuit breaking
+const alertsUpstream = "alerts"
+
 const alertsFeedURL = "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/camsys%2Fall-alerts"
 
 // ServiceAlert represents an active MTA service alert
@@ -19,66 +28,268 @@ type ServiceAlert struct {
 	Routes      []string `json:"routes"`
 	Header      string   `json:"header"`
 	Description string   `json:"description"`
+	Summary     string   `json:"summary"` // plain-text, length-capped description (or header)
+
+	// GTFS-RT classification as lowercase enum names (e.g. "severe",
+	// "maintenance", "reduced_service"); empty when the feed omits them
+	Severity string `json:"severity,omitempty"`
+	Cause    string `json:"cause,omitempty"`
+	Effect   string `json:"effect,omitempty"`
+
+	// Stops lists stop IDs named by the alert's informed entities
+	Stops         []string       `json:"stops,omitempty"`
+	ActivePeriods []ActivePeriod `json:"active_periods,omitempty"`
+}
+
+// ActivePeriod is a window when an alert applies. A zero Start means it is
+// already in effect; a zero End means it runs until further notice.
+type ActivePeriod struct {
+	Start time.Time `json:"start,omitzero"`
+	End   time.Time `json:"end,omitzero"`
+}
+
+// contains reports whether t falls in the period; End is exclusive
+func (p ActivePeriod) contains(t time.Time) bool {
+	return !t.Before(p.Start) && (p.End.IsZero() || t.Before(p.End))
+}
+
+// ActiveAt reports whether the alert is in effect at t. An alert without
+// active periods always is.
+func (a ServiceAlert) ActiveAt(t time.Time) bool {
+	if len(a.ActivePeriods) == 0 {
+		return true
+	}
+	for _, p := range a.ActivePeriods {
+		if p.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpcomingAt reports whether the alert isn't in effect at t but one of its
+// periods starts later
+func (a ServiceAlert) UpcomingAt(t time.Time) bool {
+	if a.ActiveAt(t) {
+		return false
+	}
+	for _, p := range a.ActivePeriods {
+		if p.Start.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Which alerts AlertOptions.Active selects
+const (
+	AlertsActiveNow = "now"      // in effect now; the default
+	AlertsUpcoming  = "upcoming" // not in effect yet, but scheduled to be
+	AlertsAll       = "all"      // everything in the feed, expired included
+)
+
+// ValidAlertActivity reports whether active is one of the Alerts* values
+func ValidAlertActivity(active string) bool {
+	switch active {
+	case AlertsActiveNow, AlertsUpcoming, AlertsAll:
+		return true
+	}
+	return false
+}
+
+// FilterAlertsByActivity returns the alerts active selects at now. An empty
+// or unknown active means AlertsActiveNow.
+func FilterAlertsByActivity(alerts []ServiceAlert, active string, now time.Time) []ServiceAlert {
+	if active == AlertsAll {
+		return alerts
+	}
+	keep := ServiceAlert.ActiveAt
+	if active == AlertsUpcoming {
+		keep = ServiceAlert.UpcomingAt
+	}
+	var filtered []ServiceAlert
+	for _, alert := range alerts {
+		if keep(alert, now) {
+			filtered = append(filtered, alert)
+		}
+	}
+	return filtered
 }
 
 // AlertService fetches and caches MTA service alerts
 type AlertService struct {
-	client *http.Client
-	cache  *cache.Cache[[]ServiceAlert]
+	fetchTracker
+	fetchLogger
+	circuitBreakers
+	serviceClock
+	client     *http.Client
+	cache      *cache.Cache[*alertIndex]
+	feedURL    string
+	summaryLen int // runes, ellipsis included
 }
 
+// DefaultAlertSummaryLength caps ServiceAlert.Summary unless
+// SetSummaryLength says otherwise
+const DefaultAlertSummaryLength = 200
+
 // NewAlertService creates a new alert service
-func NewAlertService(timeout time.Duration, cacheTTL time.Duration) *AlertService {
+func NewAlertService(client *http.Client, cacheTTL time.Duration) *AlertService {
 	return &AlertService{
-		client: &http.Client{Timeout: timeout},
-		cache:  cache.New[[]ServiceAlert](cacheTTL),
+		client:     client,
+		cache:      cache.New[*alertIndex](cacheTTL),
+		feedURL:    alertsFeedURL,
+		summaryLen: DefaultAlertSummaryLength,
+	}
+}
+
+// SetSummaryLength caps alert summaries at n characters. Non-positive keeps
+// DefaultAlertSummaryLength. Alerts already cached keep their summaries.
+func (s *AlertService) SetSummaryLength(n int) {
+	if n <= 0 {
+		n = DefaultAlertSummaryLength
 	}
+	s.summaryLen = n
 }
 
-// GetAlerts returns active service alerts, optionally filtered by route
-func (s *AlertService) GetAlerts(routes []string) ([]ServiceAlert, error) {
-	allAlerts, err := s.fetchAlerts()
+// AlertOptions controls how GetAlerts matches alerts to routes
+type AlertOptions struct {
+	// MatchBaseRoute treats an express variant as its base route, so a query
+	// for "6" also matches alerts tagged "6X" and vice versa
+	MatchBaseRoute bool
+
+	// Active picks alerts by their active periods: AlertsActiveNow (the
+	// default when empty), AlertsUpcoming or AlertsAll
+	Active string
+}
+
+// GetAlerts returns service alerts, by default only those in effect now,
+// optionally filtered by route
+func (s *AlertService) GetAlerts(ctx context.Context, routes []string, opts AlertOptions) ([]ServiceAlert, error) {
+	idx, err := s.fetchAlerts(ctx)
 	if err != nil {
 		return nil, err
 	}
+	alerts := idx.forRoutes(routes, opts.MatchBaseRoute)
+	return FilterAlertsByActivity(alerts, opts.Active, s.now()), nil
+}
+
+// alertIndex is a decoded feed's alerts with positions looked up by route. It
+// is built once per fetch and never modified, so requests share the cached
+// copy without locking; a refresh builds a new one.
+type alertIndex struct {
+	alerts  []ServiceAlert
+	byRoute map[string][]int // normalized route -> ascending positions in alerts
+	byBase  map[string][]int // the same, keyed by base route for MatchBaseRoute
+}
+
+func newAlertIndex(alerts []ServiceAlert) *alertIndex {
+	idx := &alertIndex{
+		alerts:  alerts,
+		byRoute: make(map[string][]int),
+		byBase:  make(map[string][]int),
+	}
+	add := func(m map[string][]int, route string, i int) {
+		// "6" and "6X" share a base route; list the alert once under it
+		if positions := m[route]; len(positions) == 0 || positions[len(positions)-1] != i {
+			m[route] = append(positions, i)
+		}
+	}
+	for i, alert := range alerts {
+		for _, r := range alert.Routes {
+			add(idx.byRoute, normalizeRouteID(r, false), i)
+			add(idx.byBase, normalizeRouteID(r, true), i)
+		}
+	}
+	return idx
+}
 
+// forRoutes returns the alerts tagged with any of routes, once each and in
+// feed order. Route IDs on both sides are compared case-insensitively; an
+// empty routes list keeps every alert.
+func (idx *alertIndex) forRoutes(routes []string, matchBase bool) []ServiceAlert {
 	if len(routes) == 0 {
-		return allAlerts, nil
+		return idx.alerts
 	}
 
-	routeSet := make(map[string]bool, len(routes))
+	lookup := idx.byRoute
+	if matchBase {
+		lookup = idx.byBase
+	}
+	var positions []int
 	for _, r := range routes {
-		routeSet[r] = true
+		positions = append(positions, lookup[normalizeRouteID(r, matchBase)]...)
+	}
+	if len(positions) == 0 {
+		return nil
 	}
+	slices.Sort(positions)
+	positions = slices.Compact(positions)
 
-	var filtered []ServiceAlert
-	for _, alert := range allAlerts {
-		for _, r := range alert.Routes {
-			if routeSet[r] {
-				filtered = append(filtered, alert)
-				break
-			}
-		}
+	filtered := make([]ServiceAlert, len(positions))
+	for j, i := range positions {
+		filtered[j] = idx.alerts[i]
+	}
+	return filtered
+}
+
+// normalizeRouteID uppercases and trims a route ID. With base set, an express
+// suffix is dropped so "6X" becomes "6"; single-letter IDs are left alone.
+func normalizeRouteID(id string, base bool) string {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	if base && len(id) > 1 {
+		id = strings.TrimSuffix(id, "X")
 	}
-	return filtered, nil
+	return id
+}
+
+// FlushCache drops the cached alerts, returning how many entries there were
+func (s *AlertService) FlushCache() int {
+	n := s.cache.Size()
+	s.cache.Clear()
+	return n
 }
 
-func (s *AlertService) fetchAlerts() ([]ServiceAlert, error) {
+// UpstreamURLs returns the alerts feed URL, for reachability checks
+func (s *AlertService) UpstreamURLs() []string {
+	return []string{s.feedURL}
+}
+
+func (s *AlertService) fetchAlerts(ctx context.Context) (idx *alertIndex, err error) {
 	if cached, ok := s.cache.Get("all"); ok {
 		return cached, nil
 	}
 
-	resp, err := s.client.Get(alertsFeedURL)
+	if err := s.allow(alertsUpstream); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	status, size, entities := 0, 0, 0
+	var alerts []ServiceAlert
+	defer func() {
+		s.record(ctx, alertsUpstream, err)
+		s.logFetch(ctx, "alerts feed fetch", start, err,
+			slog.Int("status", status), slog.Int("bytes", size),
+			slog.Int("entities", entities), slog.Int("alerts", len(alerts)))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("fetching alerts feed: %w", err)
 	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("alerts feed returned status %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
+	size = len(body)
 	if err != nil {
 		return nil, fmt.Errorf("reading alerts response: %w", err)
 	}
@@ -87,15 +298,24 @@ func (s *AlertService) fetchAlerts() ([]ServiceAlert, error) {
 	if err := proto.Unmarshal(body, feed); err != nil {
 		return nil, fmt.Errorf("parsing alerts protobuf: %w", err)
 	}
+	entities = len(feed.GetEntity())
 
-	alerts := s.parseAlerts(feed)
-	s.cache.Set("all", alerts)
-	return alerts, nil
+	s.markSuccess()
+	alerts = s.decodeAlerts(feed)
+	idx = newAlertIndex(alerts)
+	s.cache.Set("all", idx)
+	return idx, nil
 }
 
+// parseAlerts returns the feed's alerts that are in effect now
 func (s *AlertService) parseAlerts(feed *gtfs.FeedMessage) []ServiceAlert {
+	return FilterAlertsByActivity(s.decodeAlerts(feed), AlertsActiveNow, s.now())
+}
+
+// decodeAlerts converts every alert in the feed, whatever its active periods,
+// so one cached copy serves current and upcoming queries alike
+func (s *AlertService) decodeAlerts(feed *gtfs.FeedMessage) []ServiceAlert {
 	var alerts []ServiceAlert
-	now := time.Now().Unix()
 
 	for _, entity := range feed.GetEntity() {
 		alert := entity.GetAlert()
@@ -103,26 +323,33 @@ func (s *AlertService) parseAlerts(feed *gtfs.FeedMessage) []ServiceAlert {
 			continue
 		}
 
-		active := len(alert.GetActivePeriod()) == 0
+		var periods []ActivePeriod
 		for _, period := range alert.GetActivePeriod() {
 			start := int64(period.GetStart())
 			end := int64(period.GetEnd())
-			if now >= start && (end == 0 || now < end) {
-				active = true
-				break
+
+			var p ActivePeriod
+			if start != 0 {
+				p.Start = inNYC(time.Unix(start, 0))
 			}
-		}
-		if !active {
-			continue
+			if end != 0 {
+				p.End = inNYC(time.Unix(end, 0))
+			}
+			periods = append(periods, p)
 		}
 
-		var routes []string
-		seen := make(map[string]bool)
+		var routes, stops []string
+		seenRoutes := make(map[string]bool)
+		seenStops := make(map[string]bool)
 		for _, ie := range alert.GetInformedEntity() {
-			if routeID := ie.GetRouteId(); routeID != "" && !seen[routeID] {
-				seen[routeID] = true
+			if routeID := ie.GetRouteId(); routeID != "" && !seenRoutes[routeID] {
+				seenRoutes[routeID] = true
 				routes = append(routes, routeID)
 			}
+			if stopID := ie.GetStopId(); stopID != "" && !seenStops[stopID] {
+				seenStops[stopID] = true
+				stops = append(stops, stopID)
+			}
 		}
 
 		header := translatedText(alert.GetHeaderText())
@@ -130,17 +357,67 @@ func (s *AlertService) parseAlerts(feed *gtfs.FeedMessage) []ServiceAlert {
 			continue
 		}
 
+		description := translatedText(alert.GetDescriptionText())
+		summary := plainText(description)
+		if summary == "" {
+			summary = plainText(header)
+		}
+
 		alerts = append(alerts, ServiceAlert{
-			ID:          entity.GetId(),
-			Routes:      routes,
-			Header:      header,
-			Description: translatedText(alert.GetDescriptionText()),
+			ID:            entity.GetId(),
+			Routes:        routes,
+			Header:        header,
+			Description:   description,
+			Summary:       truncateText(summary, s.summaryLen),
+			Severity:      enumLabel(alert.SeverityLevel),
+			Cause:         enumLabel(alert.Cause),
+			Effect:        enumLabel(alert.Effect),
+			Stops:         stops,
+			ActivePeriods: periods,
 		})
 	}
 
 	return alerts
 }
 
+// markupTag matches an HTML tag, which MTA alert text is often wrapped in
+var markupTag = regexp.MustCompile(`<[^>]*>`)
+
+// plainText strips markup from alert text, decodes entities and collapses
+// whitespace. Tags become spaces so words on either side of a <br> or </p>
+// don't run together.
+func plainText(s string) string {
+	s = markupTag.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// truncateText shortens s to at most n runes, ending in an ellipsis when cut.
+// It breaks at the last space when one falls in the second half, so words
+// aren't split.
+func truncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(runes[:n])
+	}
+	cut := runes[:n-1]
+	if i := strings.LastIndex(string(cut), " "); i > len(string(cut))/2 {
+		cut = []rune(string(cut)[:i])
+	}
+	return strings.TrimRight(string(cut), " ,;:.-") + "…"
+}
+
+// enumLabel renders an optional GTFS-RT enum as a lowercase name. Unset fields
+// stay empty rather than reporting the proto default.
+func enumLabel[E interface{ String() string }](e *E) string {
+	if e == nil {
+		return ""
+	}
+	return strings.ToLower((*e).String())
+}
+
 func translatedText(ts *gtfs.TranslatedString) string {
 	if ts == nil {
 		return ""
@@ -0,0 +1,468 @@
+package transit
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+func alertEntity(id, header string, configure func(*gtfs.Alert)) *gtfs.FeedEntity {
+	alert := &gtfs.Alert{
+		HeaderText: &gtfs.TranslatedString{
+			Translation: []*gtfs.TranslatedString_Translation{{Text: proto.String(header), Language: proto.String("en")}},
+		},
+		InformedEntity: []*gtfs.EntitySelector{{RouteId: proto.String("A")}},
+	}
+	if configure != nil {
+		configure(alert)
+	}
+	return &gtfs.FeedEntity{Id: proto.String(id), Alert: alert}
+}
+
+func TestParseAlertsClassification(t *testing.T) {
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfs.FeedEntity{
+			alertEntity("suspension", "A trains suspended", func(a *gtfs.Alert) {
+				a.SeverityLevel = gtfs.Alert_SEVERE.Enum()
+				a.Cause = gtfs.Alert_TECHNICAL_PROBLEM.Enum()
+				a.Effect = gtfs.Alert_NO_SERVICE.Enum()
+			}),
+			alertEntity("planned", "Weekend planned work", func(a *gtfs.Alert) {
+				a.SeverityLevel = gtfs.Alert_WARNING.Enum()
+				a.Cause = gtfs.Alert_MAINTENANCE.Enum()
+				a.Effect = gtfs.Alert_REDUCED_SERVICE.Enum()
+			}),
+			alertEntity("bare", "No classification", nil),
+		},
+	}
+
+	svc := NewAlertService(testClient(), time.Minute)
+	alerts := svc.parseAlerts(feed)
+	if len(alerts) != 3 {
+		t.Fatalf("got %d alerts, want 3", len(alerts))
+	}
+
+	tests := []struct {
+		severity, cause, effect string
+	}{
+		{"severe", "technical_problem", "no_service"},
+		{"warning", "maintenance", "reduced_service"},
+		{"", "", ""},
+	}
+	for i, want := range tests {
+		got := alerts[i]
+		if got.Severity != want.severity || got.Cause != want.cause || got.Effect != want.effect {
+			t.Errorf("alert %s = (%q, %q, %q), want (%q, %q, %q)", got.ID,
+				got.Severity, got.Cause, got.Effect, want.severity, want.cause, want.effect)
+		}
+	}
+}
+
+func TestParseAlertsStopsAndActivePeriods(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-time.Hour).Truncate(time.Second)
+	end := now.Add(5 * time.Hour).Truncate(time.Second)
+
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfs.FeedEntity{
+			alertEntity("station", "No downtown 1 trains at Times Sq", func(a *gtfs.Alert) {
+				a.InformedEntity = append(a.InformedEntity,
+					&gtfs.EntitySelector{StopId: proto.String("127S")},
+					&gtfs.EntitySelector{RouteId: proto.String("1"), StopId: proto.String("127S")},
+				)
+				a.ActivePeriod = []*gtfs.TimeRange{{
+					Start: proto.Uint64(uint64(start.Unix())),
+					End:   proto.Uint64(uint64(end.Unix())),
+				}}
+			}),
+			alertEntity("expired", "Old news", func(a *gtfs.Alert) {
+				a.ActivePeriod = []*gtfs.TimeRange{{
+					Start: proto.Uint64(uint64(now.Add(-3 * time.Hour).Unix())),
+					End:   proto.Uint64(uint64(now.Add(-2 * time.Hour).Unix())),
+				}}
+			}),
+			alertEntity("open-ended", "Until further notice", func(a *gtfs.Alert) {
+				a.ActivePeriod = []*gtfs.TimeRange{{Start: proto.Uint64(uint64(start.Unix()))}}
+			}),
+		},
+	}
+
+	svc := NewAlertService(testClient(), time.Minute)
+	alerts := svc.parseAlerts(feed)
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2 (expired dropped)", len(alerts))
+	}
+
+	station := alerts[0]
+	if len(station.Stops) != 1 || station.Stops[0] != "127S" {
+		t.Errorf("Stops = %v, want [127S]", station.Stops)
+	}
+	if len(station.Routes) != 2 {
+		t.Errorf("Routes = %v, want [A 1]", station.Routes)
+	}
+	if len(station.ActivePeriods) != 1 {
+		t.Fatalf("ActivePeriods = %v, want one period", station.ActivePeriods)
+	}
+	period := station.ActivePeriods[0]
+	if !period.Start.Equal(start) || !period.End.Equal(end) {
+		t.Errorf("period = %v..%v, want %v..%v", period.Start, period.End, start, end)
+	}
+	if period.End.Location() != nycLocation {
+		t.Errorf("period zone = %v, want America/New_York", period.End.Location())
+	}
+
+	openEnded := alerts[1]
+	if len(openEnded.ActivePeriods) != 1 || !openEnded.ActivePeriods[0].End.IsZero() {
+		t.Errorf("open-ended period = %v, want zero End", openEnded.ActivePeriods)
+	}
+	if len(openEnded.Stops) != 0 {
+		t.Errorf("route-only alert Stops = %v, want none", openEnded.Stops)
+	}
+}
+
+func TestParseAlertsSummary(t *testing.T) {
+	long := `<p><b>[A]</b> trains are running with delays&nbsp;in both directions</p>` +
+		`<br/>while we address a signal problem near <i>Jay St-MetroTech</i>. ` +
+		strings.Repeat("Consider alternate routes for your trip. ", 10)
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfs.FeedEntity{
+			alertEntity("long", "Delays", func(a *gtfs.Alert) {
+				a.DescriptionText = &gtfs.TranslatedString{
+					Translation: []*gtfs.TranslatedString_Translation{{Text: proto.String(long)}},
+				}
+			}),
+			alertEntity("short", "<b>Elevator</b> out &amp; about", nil),
+		},
+	}
+
+	svc := NewAlertService(testClient(), time.Minute)
+	svc.SetSummaryLength(80)
+	alerts := svc.parseAlerts(feed)
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2", len(alerts))
+	}
+
+	summary := alerts[0].Summary
+	if strings.ContainsAny(summary, "<>&") || strings.Contains(summary, "  ") {
+		t.Errorf("summary %q still has markup, entities or runs of spaces", summary)
+	}
+	if !strings.HasPrefix(summary, "[A] trains are running with delays in both directions while we") {
+		t.Errorf("summary = %q, want the description as plain text", summary)
+	}
+	if n := utf8.RuneCountInString(summary); n > 80 || !strings.HasSuffix(summary, "…") {
+		t.Errorf("summary is %d characters, ending %q; want at most 80 ending in an ellipsis", n, summary[len(summary)-4:])
+	}
+	if strings.HasSuffix(strings.TrimSuffix(summary, "…"), " ") {
+		t.Errorf("summary %q leaves a space before the ellipsis", summary)
+	}
+	if alerts[0].Description != long {
+		t.Error("Description should keep the full original text")
+	}
+
+	// No description: the header stands in, untruncated when it fits
+	if got := alerts[1].Summary; got != "Elevator out & about" {
+		t.Errorf("header-only summary = %q, want %q", got, "Elevator out & about")
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly ten", 11, "exactly ten"},
+		{"break at the last word", 15, "break at the…"},
+		{"Unbreakablewordthatgoeson", 10, "Unbreakab…"},
+		{"café crème brûlée", 11, "café crème…"},
+	}
+	for _, tc := range tests {
+		if got := truncateText(tc.in, tc.n); got != tc.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tc.in, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestFilterAlertsByRoute(t *testing.T) {
+	alerts := []ServiceAlert{
+		{ID: "express", Routes: []string{"6X"}},
+		{ID: "local", Routes: []string{"6"}},
+		{ID: "lower", Routes: []string{"a"}},
+	}
+
+	tests := []struct {
+		name   string
+		routes []string
+		opts   AlertOptions
+		want   []string
+	}{
+		{"exact by default", []string{"6"}, AlertOptions{}, []string{"local"}},
+		{"express stays distinct", []string{"6x"}, AlertOptions{}, []string{"express"}},
+		{"base matches express", []string{"6"}, AlertOptions{MatchBaseRoute: true}, []string{"express", "local"}},
+		{"express query matches base", []string{"6X"}, AlertOptions{MatchBaseRoute: true}, []string{"express", "local"}},
+		{"case and whitespace", []string{" A "}, AlertOptions{}, []string{"lower"}},
+		{"no routes keeps all", nil, AlertOptions{}, []string{"express", "local", "lower"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, a := range filterAlertsByRoute(alerts, tc.routes, tc.opts) {
+				got = append(got, a.ID)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFilterAlertsByActivity(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	period := func(from, to time.Duration) *gtfs.TimeRange {
+		return &gtfs.TimeRange{
+			Start: proto.Uint64(uint64(now.Add(from).Unix())),
+			End:   proto.Uint64(uint64(now.Add(to).Unix())),
+		}
+	}
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfs.FeedEntity{
+			alertEntity("past", "Last night's work", func(a *gtfs.Alert) {
+				a.ActivePeriod = []*gtfs.TimeRange{period(-12*time.Hour, -4*time.Hour)}
+			}),
+			alertEntity("current", "Delays", func(a *gtfs.Alert) {
+				a.ActivePeriod = []*gtfs.TimeRange{period(-time.Hour, time.Hour)}
+			}),
+			alertEntity("future", "Weekend work", func(a *gtfs.Alert) {
+				a.ActivePeriod = []*gtfs.TimeRange{period(-30*time.Hour, -26*time.Hour), period(24*time.Hour, 30*time.Hour)}
+			}),
+			alertEntity("undated", "Elevator out", nil),
+		},
+	}
+
+	svc := NewAlertService(testClient(), time.Minute)
+	svc.SetClock(NewFakeClock(now))
+	alerts := svc.decodeAlerts(feed)
+	if len(alerts) != 4 {
+		t.Fatalf("decoded %d alerts, want all 4 whatever their periods", len(alerts))
+	}
+
+	tests := []struct {
+		active string
+		want   []string
+	}{
+		{"", []string{"current", "undated"}},
+		{AlertsActiveNow, []string{"current", "undated"}},
+		{AlertsUpcoming, []string{"future"}},
+		{AlertsAll, []string{"past", "current", "future", "undated"}},
+	}
+	for _, tc := range tests {
+		var got []string
+		for _, a := range FilterAlertsByActivity(alerts, tc.active, now) {
+			got = append(got, a.ID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("active %q = %v, want %v", tc.active, got, tc.want)
+		}
+	}
+
+	// The future alert's later period is kept for clients to show
+	if periods := alerts[2].ActivePeriods; len(periods) != 2 || !periods[1].Start.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("future periods = %v, want both, the second starting in a day", periods)
+	}
+}
+
+func TestParseAlertsActivePeriodBoundaries(t *testing.T) {
+	start := time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC)
+	end := start.Add(8 * time.Hour)
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfs.FeedEntity{
+			alertEntity("overnight", "Overnight planned work", func(a *gtfs.Alert) {
+				a.ActivePeriod = []*gtfs.TimeRange{{
+					Start: proto.Uint64(uint64(start.Unix())),
+					End:   proto.Uint64(uint64(end.Unix())),
+				}}
+			}),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		active bool
+	}{
+		{"just before start", start.Add(-time.Second), false},
+		{"at start", start, true},
+		{"just before end", end.Add(-time.Second), true},
+		{"at end", end, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewAlertService(testClient(), time.Minute)
+			svc.SetClock(NewFakeClock(tc.at))
+			if got := len(svc.parseAlerts(feed)) == 1; got != tc.active {
+				t.Errorf("active = %v, want %v", got, tc.active)
+			}
+		})
+	}
+}
+
+// randomAlerts returns n alerts each tagged with one to three routes, express
+// variants and odd casing included
+func randomAlerts(n int, rng *rand.Rand) []ServiceAlert {
+	routes := []string{"1", "2", "3", "4", "5", "6", "6X", "7", "7X", "A", "c", "E", "FX", "G", "L", "SI"}
+	alerts := make([]ServiceAlert, n)
+	for i := range alerts {
+		alerts[i].ID = fmt.Sprintf("alert-%d", i)
+		for range 1 + rng.IntN(3) {
+			alerts[i].Routes = append(alerts[i].Routes, routes[rng.IntN(len(routes))])
+		}
+	}
+	return alerts
+}
+
+// filterAlertsByRoute is the reference implementation of
+// alertIndex.forRoutes: a scan of every alert, kept to check the index
+// against and to benchmark it.
+func filterAlertsByRoute(alerts []ServiceAlert, routes []string, opts AlertOptions) []ServiceAlert {
+	if len(routes) == 0 {
+		return alerts
+	}
+
+	routeSet := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		if r = normalizeRouteID(r, opts.MatchBaseRoute); r != "" {
+			routeSet[r] = true
+		}
+	}
+
+	var filtered []ServiceAlert
+	for _, alert := range alerts {
+		for _, r := range alert.Routes {
+			if routeSet[normalizeRouteID(r, opts.MatchBaseRoute)] {
+				filtered = append(filtered, alert)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+func alertIDs(alerts []ServiceAlert) []string {
+	var ids []string
+	for _, a := range alerts {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
+
+func TestAlertIndexMatchesFilterAlertsByRoute(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	alerts := randomAlerts(300, rng)
+	idx := newAlertIndex(alerts)
+
+	queries := [][]string{
+		nil,
+		{"6"},
+		{"6x"},
+		{" a ", "C"},
+		{"6", "6X", "6"}, // overlapping routes still list each alert once
+		{"F"},
+		{"Q"},
+		{""},
+		{"1", "2", "3", "4", "5", "6", "7", "A", "C", "E", "G", "L", "SI"},
+	}
+	for _, routes := range queries {
+		for _, base := range []bool{false, true} {
+			want := alertIDs(filterAlertsByRoute(alerts, routes, AlertOptions{MatchBaseRoute: base}))
+			got := alertIDs(idx.forRoutes(routes, base))
+			if !slices.Equal(got, want) {
+				t.Errorf("routes %q, base %v: index gave %d alerts, scan gave %d\n got %v\nwant %v",
+					routes, base, len(got), len(want), got, want)
+			}
+		}
+	}
+}
+
+func TestGetAlertsRebuildsIndexOnRefresh(t *testing.T) {
+	feedFor := func(route string) []byte {
+		body, err := proto.Marshal(&gtfs.FeedMessage{
+			Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+			Entity: []*gtfs.FeedEntity{
+				alertEntity("delay-"+route, route+" trains delayed", func(a *gtfs.Alert) {
+					a.InformedEntity = []*gtfs.EntitySelector{{RouteId: proto.String(route)}}
+				}),
+			},
+		})
+		if err != nil {
+			t.Fatalf("marshal feed: %v", err)
+		}
+		return body
+	}
+	var current atomic.Value
+	current.Store(feedFor("A"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	svc := NewAlertService(testClient(), time.Minute)
+	svc.feedURL = srv.URL
+	get := func(route string) []string {
+		alerts, err := svc.GetAlerts(context.Background(), []string{route}, AlertOptions{})
+		if err != nil {
+			t.Fatalf("GetAlerts(%s): %v", route, err)
+		}
+		return alertIDs(alerts)
+	}
+
+	if got := get("A"); !slices.Equal(got, []string{"delay-A"}) {
+		t.Fatalf("A = %v, want [delay-A]", got)
+	}
+
+	// Until the cache refreshes the old index keeps serving
+	current.Store(feedFor("L"))
+	if got := get("L"); len(got) != 0 {
+		t.Errorf("L before refresh = %v, want none", got)
+	}
+	svc.FlushCache()
+	if got := get("L"); !slices.Equal(got, []string{"delay-L"}) {
+		t.Errorf("L after refresh = %v, want [delay-L]", got)
+	}
+	if got := get("A"); len(got) != 0 {
+		t.Errorf("A after refresh = %v, want none", got)
+	}
+}
+
+func BenchmarkAlertsByRoute(b *testing.B) {
+	alerts := randomAlerts(2000, rand.New(rand.NewPCG(1, 2)))
+	idx := newAlertIndex(alerts)
+	routes := []string{"6", "L"} // a typical station's lines
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			idx.forRoutes(routes, true)
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			filterAlertsByRoute(alerts, routes, AlertOptions{MatchBaseRoute: true})
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package transit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is how many consecutive failures open a circuit
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is how long an open circuit rejects calls before
+	// letting a probe through
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned, wrapped in a *CircuitOpenError, when an upstream
+// has failed repeatedly and calls to it are being short-circuited
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// CircuitOpenError reports which upstream is short-circuited and for how long
+type CircuitOpenError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %v, retry in %s", e.Upstream, ErrCircuitOpen, e.RetryAfter.Round(time.Second))
+}
+
+func (e *CircuitOpenError) Unwrap() error { return ErrCircuitOpen }
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a consecutive-failure circuit breaker for one upstream. Closed
+// lets everything through; threshold failures in a row open it; after the
+// cooldown it goes half-open and lets a single probe through, which either
+// closes it again or re-opens it for another cooldown.
+type breaker struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// circuitBreakers holds one breaker per upstream name. Embed it in a service.
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*breaker
+}
+
+// SetCircuitBreaker sets how many consecutive failures open an upstream's
+// circuit and how long it stays open. Non-positive values keep the defaults.
+func (c *circuitBreakers) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threshold = threshold
+	c.cooldown = cooldown
+}
+
+func (c *circuitBreakers) settings() (int, time.Duration) {
+	threshold, cooldown := c.threshold, c.cooldown
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return threshold, cooldown
+}
+
+// allow reports whether a call to upstream may proceed, returning a
+// *CircuitOpenError if not
+func (c *circuitBreakers) allow(upstream string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.breakers[upstream]
+	if b == nil {
+		return nil
+	}
+	_, cooldown := c.settings()
+
+	switch b.state {
+	case breakerOpen:
+		if wait := cooldown - time.Since(b.openedAt); wait > 0 {
+			return &CircuitOpenError{Upstream: upstream, RetryAfter: wait}
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			// Someone else's probe is in flight; don't pile on
+			return &CircuitOpenError{Upstream: upstream, RetryAfter: time.Second}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates upstream's breaker with the outcome of an allowed call. A
+// cancelled caller says nothing about the upstream, so it isn't counted.
+func (c *circuitBreakers) record(ctx context.Context, upstream string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.breakers == nil {
+		c.breakers = make(map[string]*breaker)
+	}
+	b := c.breakers[upstream]
+	if b == nil {
+		b = &breaker{}
+		c.breakers[upstream] = b
+	}
+
+	if err != nil && ctx.Err() != nil {
+		b.probing = false
+		return
+	}
+	if err == nil {
+		*b = breaker{}
+		return
+	}
+
+	threshold, _ := c.settings()
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,110 @@
+package transit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerLifecycle(t *testing.T) {
+	var (
+		healthy atomic.Bool
+		hits    atomic.Int32
+	)
+	body := emptyFeedBytes(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	const cooldown = 50 * time.Millisecond
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL}
+	svc.SetCircuitBreaker(2, cooldown)
+
+	fetch := func() error {
+		svc.feedCache.Clear() // always go upstream
+		_, err := svc.GetFeedBytes(context.Background(), "ace")
+		return err
+	}
+
+	// Closed: failures reach the upstream until the threshold
+	for i := 0; i < 2; i++ {
+		if err := fetch(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("failure %d: err = %v, want upstream error", i+1, err)
+		}
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("upstream hit %d times, want 2", hits.Load())
+	}
+
+	// Open: calls fail fast without reaching the upstream
+	err := fetch()
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || open.Upstream != "ace" || open.RetryAfter <= 0 {
+		t.Fatalf("err = %v, want *CircuitOpenError for ace", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("open circuit still hit upstream (%d hits)", hits.Load())
+	}
+
+	// Half-open: after the cooldown one probe goes through; a failed probe
+	// re-opens immediately
+	time.Sleep(cooldown)
+	if err := fetch(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe err = %v, want upstream error", err)
+	}
+	if hits.Load() != 3 {
+		t.Errorf("upstream hit %d times after probe, want 3", hits.Load())
+	}
+	if err := fetch(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after failed probe err = %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful probe closes the circuit again
+	healthy.Store(true)
+	time.Sleep(cooldown)
+	if err := fetch(); err != nil {
+		t.Fatalf("successful probe: %v", err)
+	}
+	healthy.Store(false)
+	if err := fetch(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("closed circuit err = %v, want upstream error (failure count reset)", err)
+	}
+	if hits.Load() != 5 {
+		t.Errorf("upstream hit %d times, want 5", hits.Load())
+	}
+}
+
+func TestCircuitBreakersArePerFeed(t *testing.T) {
+	body := emptyFeedBytes(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL + "/down", "g": srv.URL + "/up"}
+	svc.SetCircuitBreaker(1, time.Minute)
+
+	svc.GetFeedBytes(context.Background(), "ace")
+	if _, err := svc.GetFeedBytes(context.Background(), "ace"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("ace err = %v, want ErrCircuitOpen", err)
+	}
+	if _, err := svc.GetFeedBytes(context.Background(), "g"); err != nil {
+		t.Errorf("g should be unaffected by ace's breaker: %v", err)
+	}
+}
@@ -1,22 +1,106 @@
 package transit
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/randytsao24/emteeayy/internal/cache"
+	"github.com/randytsao24/emteeayy/internal/location"
 )
 
 const (
+	// DefaultBusBaseURL is MTA Bus Time. Other OneBusAway deployments serving
+	// the same API paths can be used with SetBaseURL.
+	DefaultBusBaseURL = "https://bustime.mta.info"
+	// DefaultBusKeyParam is the query parameter the API key is sent in
+	DefaultBusKeyParam = "key"
+
 	defaultBusRadius = 400 // meters
 	DefaultBusLimit  = 5
-	MaxBusStops      = 10
+	// MaxBusStops is the default cap on stops queried per nearby search;
+	// see SetMaxStops
+	MaxBusStops = 10
+
+	// DefaultBusArrivals and MaxBusArrivals bound the merged arrival list
+	// returned by GetArrivalsNear, independent of how many stops are queried
+	DefaultBusArrivals = 20
+	MaxBusArrivals     = 50
+
+	// busFetchConcurrency bounds parallel stop-monitoring requests
+	busFetchConcurrency = 4
+
+	// busUpstream names Bus Time for circuit breaking; stop lookups and
+	// arrivals share one host, so they share one breaker
+	busUpstream = "bustime"
+
+	// busRetryDelay is how long an arrivals fetch waits before its one retry
+	// after a transient failure
+	busRetryDelay = 250 * time.Millisecond
+)
+
+// Kinds of Bus Time failure, each returned wrapped in a *BusAPIError
+var (
+	// ErrBusAuth means the API key was rejected (401 or 403). Retrying won't
+	// help; the key needs fixing.
+	ErrBusAuth = errors.New("bus API rejected the API key")
+	// ErrBusUnavailable means Bus Time was unreachable, overloaded (429) or
+	// failing (5xx); the same request may well succeed later
+	ErrBusUnavailable = errors.New("bus API unavailable")
+	// ErrBusResponse means Bus Time answered with something other than the
+	// expected JSON: an unexpected status or a body that doesn't parse
+	ErrBusResponse = errors.New("bus API returned an unusable response")
 )
 
+// BusAPIError is a failed Bus Time call. Kind is ErrBusAuth, ErrBusUnavailable
+// or ErrBusResponse; errors.Is matches both it and the underlying Err.
+type BusAPIError struct {
+	Kind   error
+	Status int   // HTTP status, or 0 when there was no usable response
+	Err    error // underlying cause, if any
+}
+
+func (e *BusAPIError) Error() string {
+	msg := e.Kind.Error()
+	if e.Status != 0 {
+		msg = fmt.Sprintf("%s (status %d)", msg, e.Status)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *BusAPIError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// busStatusError classifies a non-200 Bus Time status
+func busStatusError(status int) *BusAPIError {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &BusAPIError{Kind: ErrBusAuth, Status: status}
+	case status == http.StatusTooManyRequests || status >= http.StatusInternalServerError:
+		return &BusAPIError{Kind: ErrBusUnavailable, Status: status}
+	default:
+		return &BusAPIError{Kind: ErrBusResponse, Status: status}
+	}
+}
+
 // BusStop represents a bus stop from the MTA API
 type BusStop struct {
 	ID        string   `json:"id"`
@@ -25,6 +109,20 @@ type BusStop struct {
 	Lng       float64  `json:"lng"`
 	Direction string   `json:"direction,omitempty"`
 	Routes    []string `json:"routes,omitempty"`
+
+	DistanceMeters float64 `json:"distance_meters"`
+	DistanceMiles  float64 `json:"distance_miles"`
+}
+
+// Serves reports whether route is among the stop's routes, ignoring case. A
+// stop whose routes the upstream didn't list serves none.
+func (s BusStop) Serves(route string) bool {
+	for _, r := range s.Routes {
+		if strings.EqualFold(r, route) {
+			return true
+		}
+	}
+	return false
 }
 
 // BusArrival represents an upcoming bus arrival
@@ -36,35 +134,90 @@ type BusArrival struct {
 	StopName        string    `json:"stop_name,omitempty"`
 	StopsAway       int       `json:"stops_away"`
 	Feet            int       `json:"feet_away"`
-	ExpectedArrival time.Time `json:"expected_arrival"`
+	ExpectedArrival time.Time `json:"expected_arrival"` // RFC3339 in America/New_York
+	ExpectedLocal   string    `json:"expected_local"`   // NYC wall-clock HH:MM
 	MinutesAway     int       `json:"minutes_away"`
+	Status          string    `json:"status"` // due, approaching or timed, as for subway arrivals
 }
 
-// BusService fetches real-time bus arrivals from MTA SIRI API
+// BusService fetches real-time bus arrivals from the MTA Bus Time API, or any
+// OneBusAway deployment with the same stop and SIRI endpoints
 type BusService struct {
+	fetchTracker
+	fetchLogger
+	circuitBreakers
+	serviceClock
 	apiKey       string
+	keyParam     string
+	baseURL      string
 	client       *http.Client
 	arrivalCache *cache.Cache[[]BusArrival]
 	stopsCache   *cache.Cache[[]BusStop]
+	maxStops     int
+	retryDelay   time.Duration
 }
 
-// NewBusService creates a new bus service
-func NewBusService(apiKey string, timeout time.Duration, cacheTTL time.Duration) *BusService {
+// NewBusService creates a new bus service. Arrivals and stop lookups are cached
+// separately since stop locations change far less often than arrivals.
+func NewBusService(apiKey string, client *http.Client, arrivalTTL, stopsTTL time.Duration) *BusService {
 	return &BusService{
 		apiKey:       apiKey,
-		client:       &http.Client{Timeout: timeout},
-		arrivalCache: cache.New[[]BusArrival](cacheTTL),
-		stopsCache:   cache.New[[]BusStop](cacheTTL),
+		keyParam:     DefaultBusKeyParam,
+		baseURL:      DefaultBusBaseURL,
+		client:       client,
+		arrivalCache: cache.New[[]BusArrival](arrivalTTL),
+		stopsCache:   cache.New[[]BusStop](stopsTTL),
+		maxStops:     MaxBusStops,
+		retryDelay:   busRetryDelay,
+	}
+}
+
+// SetMaxStops caps how many stops GetArrivalsNear queries, for deployments
+// whose Bus Time quota allows more fan-out (or less). Non-positive keeps
+// MaxBusStops.
+func (s *BusService) SetMaxStops(n int) {
+	if n <= 0 {
+		n = MaxBusStops
+	}
+	s.maxStops = n
+}
+
+// SetBaseURL points the service at another OneBusAway-compatible API, e.g.
+// "https://oba.example.org/onebusaway-api-webapp". Requests go to the usual
+// /api/where and /api/siri paths under it.
+func (s *BusService) SetBaseURL(baseURL string) {
+	s.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetKeyParam sets the query parameter the API key is sent in, for
+// deployments that don't use "key". Empty keeps the default.
+func (s *BusService) SetKeyParam(name string) {
+	if name != "" {
+		s.keyParam = name
 	}
 }
 
+// FlushCache drops cached arrivals and stop lookups, returning how many
+// entries there were across both
+func (s *BusService) FlushCache() int {
+	n := s.arrivalCache.Size() + s.stopsCache.Size()
+	s.arrivalCache.Clear()
+	s.stopsCache.Clear()
+	return n
+}
+
+// UpstreamURLs returns the Bus Time base URL, for reachability checks
+func (s *BusService) UpstreamURLs() []string {
+	return []string{s.baseURL}
+}
+
 // HasAPIKey returns true if the service has an API key configured
 func (s *BusService) HasAPIKey() bool {
 	return s.apiKey != ""
 }
 
 // FindStopsNear finds bus stops near a location
-func (s *BusService) FindStopsNear(lat, lng float64, radiusMeters int) ([]BusStop, error) {
+func (s *BusService) FindStopsNear(ctx context.Context, lat, lng float64, radiusMeters int) ([]BusStop, error) {
 	if s.apiKey == "" {
 		return nil, fmt.Errorf("MTA_BUS_API_KEY not configured")
 	}
@@ -79,64 +232,128 @@ func (s *BusService) FindStopsNear(lat, lng float64, radiusMeters int) ([]BusSto
 	}
 
 	params := url.Values{}
-	params.Set("key", s.apiKey)
+	params.Set(s.keyParam, s.apiKey)
 	params.Set("lat", fmt.Sprintf("%f", lat))
 	params.Set("lon", fmt.Sprintf("%f", lng))
 	params.Set("radius", fmt.Sprintf("%d", radiusMeters))
 
-	apiURL := "https://bustime.mta.info/api/where/stops-for-location.json?" + params.Encode()
-	resp, err := s.client.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("fetching stops: %w", err)
-	}
-	defer resp.Body.Close()
-
 	var result stopsForLocationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("parsing response: %w", err)
+	apiURL := s.baseURL + "/api/where/stops-for-location.json?" + params.Encode()
+	if err := s.getJSON(ctx, "bus stops fetch", apiURL, &result, func() []slog.Attr {
+		return []slog.Attr{slog.Int("stops", len(result.Data.Stops))}
+	}); err != nil {
+		return nil, fmt.Errorf("fetching stops: %w", err)
 	}
 
 	var stops []BusStop
 	for _, stop := range result.Data.Stops {
+		dist := location.Haversine(lat, lng, stop.Lat, stop.Lon)
 		stops = append(stops, BusStop{
-			ID:        stop.ID,
-			Name:      stop.Name,
-			Lat:       stop.Lat,
-			Lng:       stop.Lon,
-			Direction: stop.Direction,
+			ID:             stop.ID,
+			Name:           stop.Name,
+			Lat:            stop.Lat,
+			Lng:            stop.Lon,
+			Direction:      stop.Direction,
+			Routes:         stop.routeNames(),
+			DistanceMeters: dist,
+			DistanceMiles:  location.MetersToMiles(dist),
 		})
 	}
 
+	// Nearest first, matching subway stop ordering
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].DistanceMeters < stops[j].DistanceMeters
+	})
+
 	s.stopsCache.Set(cacheKey, stops)
 	return stops, nil
 }
 
+// ErrAllStopsFailed is returned by GetArrivalsNear when stops were found but
+// fetching arrivals failed for every one of them
+var ErrAllStopsFailed = errors.New("arrivals failed for every stop")
+
+// NearbyBusArrivals is the merged result of fetching arrivals for the stops
+// near a location. StopsFailed counts stops whose fetch errored and were left
+// out of Arrivals.
+type NearbyBusArrivals struct {
+	Arrivals     []BusArrival
+	StopsQueried int
+	StopsFailed  int
+}
+
+// Partial reports whether some, but not all, stops failed
+func (n NearbyBusArrivals) Partial() bool {
+	return n.StopsFailed > 0 && n.StopsFailed < n.StopsQueried
+}
+
 // GetArrivalsNear finds stops near a location and fetches arrivals for each.
-// limit controls how many stops are queried (capped at MaxBusStops).
-func (s *BusService) GetArrivalsNear(lat, lng float64, radiusMeters, limit int) ([]BusArrival, error) {
-	stops, err := s.FindStopsNear(lat, lng, radiusMeters)
+// limit controls how many stops are queried (capped by SetMaxStops) and
+// maxArrivals caps the merged, time-sorted result (capped at MaxBusArrivals).
+// Arrivals sooner than minMinutes are dropped before the cap is applied.
+func (s *BusService) GetArrivalsNear(ctx context.Context, lat, lng float64, radiusMeters, limit, maxArrivals, minMinutes int) (NearbyBusArrivals, error) {
+	stops, err := s.FindStopsNear(ctx, lat, lng, radiusMeters)
 	if err != nil {
-		return nil, err
+		return NearbyBusArrivals{}, err
 	}
 
-	if limit <= 0 || limit > MaxBusStops {
-		limit = MaxBusStops
+	if limit <= 0 || limit > s.maxStops {
+		limit = s.maxStops
 	}
 	if len(stops) > limit {
 		stops = stops[:limit]
 	}
 
-	var allArrivals []BusArrival
-	for _, stop := range stops {
-		arrivals, err := s.GetArrivalsForStop(stop.ID)
+	// Fetch each stop concurrently, bounded so a wide search doesn't open a
+	// burst of connections to Bus Time. Failed stops are skipped and counted.
+	perStop := make([][]BusArrival, len(stops))
+	errs := make([]error, len(stops))
+	sem := make(chan struct{}, busFetchConcurrency)
+	var wg sync.WaitGroup
+	for i, stop := range stops {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			arrivals, err := s.GetArrivalsForStop(ctx, stop.ID)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for j := range arrivals {
+				arrivals[j].StopName = stop.Name
+				arrivals[j].Direction = stop.Direction
+			}
+			perStop[i] = arrivals
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return NearbyBusArrivals{}, err
+	}
+
+	result := NearbyBusArrivals{StopsQueried: len(stops)}
+	var firstErr error
+	for _, err := range errs {
 		if err != nil {
-			continue
+			result.StopsFailed++
+			firstErr = cmp.Or(firstErr, err)
 		}
-		for i := range arrivals {
-			arrivals[i].StopName = stop.Name
-			arrivals[i].Direction = stop.Direction
+	}
+	if result.StopsQueried > 0 && result.StopsFailed == result.StopsQueried {
+		return NearbyBusArrivals{}, fmt.Errorf("%w (%d stops): %w", ErrAllStopsFailed, result.StopsFailed, firstErr)
+	}
+
+	var allArrivals []BusArrival
+	for _, arrivals := range perStop {
+		for _, arr := range arrivals {
+			if arr.MinutesAway >= minMinutes {
+				allArrivals = append(allArrivals, arr)
+			}
 		}
-		allArrivals = append(allArrivals, arrivals...)
 	}
 
 	// Sort by arrival time
@@ -144,48 +361,147 @@ func (s *BusService) GetArrivalsNear(lat, lng float64, radiusMeters, limit int)
 		return allArrivals[i].ExpectedArrival.Before(allArrivals[j].ExpectedArrival)
 	})
 
-	return allArrivals, nil
+	if maxArrivals <= 0 || maxArrivals > MaxBusArrivals {
+		maxArrivals = MaxBusArrivals
+	}
+	if len(allArrivals) > maxArrivals {
+		allArrivals = allArrivals[:maxArrivals]
+	}
+
+	result.Arrivals = allArrivals
+	return result, nil
 }
 
 // GetArrivalsForStop fetches arrivals for a specific stop
-func (s *BusService) GetArrivalsForStop(stopID string) ([]BusArrival, error) {
+func (s *BusService) GetArrivalsForStop(ctx context.Context, stopID string) ([]BusArrival, error) {
 	if s.apiKey == "" {
 		return nil, fmt.Errorf("MTA_BUS_API_KEY not configured")
 	}
 
 	if cached, ok := s.arrivalCache.Get(stopID); ok {
-		return cached, nil
+		return s.withCountdowns(cached), nil
 	}
 
 	params := url.Values{}
-	params.Set("key", s.apiKey)
+	params.Set(s.keyParam, s.apiKey)
 	params.Set("MonitoringRef", stopID)
 	params.Set("version", "2")
 
-	apiURL := "https://bustime.mta.info/api/siri/stop-monitoring.json?" + params.Encode()
-	resp, err := s.client.Get(apiURL)
+	var result siriResponse
+	apiURL := s.baseURL + "/api/siri/stop-monitoring.json?" + params.Encode()
+	fetch := func() error {
+		return s.fetchJSON(ctx, "bus arrivals fetch", apiURL, &result, func() []slog.Attr {
+			visits := 0
+			if delivery := result.Siri.ServiceDelivery.StopMonitoringDelivery; len(delivery) > 0 {
+				visits = len(delivery[0].MonitoredStopVisit)
+			}
+			return []slog.Attr{slog.String("stop_id", stopID), slog.Int("visits", visits)}
+		})
+	}
+	// Transient failures get one retry after a short pause, when the deadline
+	// leaves room for it; auth and parse failures would only fail the same way
+	// again. The breaker sees one outcome for the lookup, not one per attempt.
+	err := s.allow(busUpstream)
+	if err == nil {
+		err = fetch()
+		if errors.Is(err, ErrBusUnavailable) && s.canRetry(ctx) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.retryDelay):
+				err = fetch()
+			}
+		}
+		s.record(ctx, busUpstream, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("fetching bus data: %w", err)
 	}
+
+	arrivals := s.parseArrivals(result, stopID)
+	s.arrivalCache.Set(stopID, arrivals)
+	return s.withCountdowns(arrivals), nil
+}
+
+// withCountdowns returns a copy of cached arrivals with MinutesAway and Status
+// measured from now, rounded like subway countdowns, leaving out buses whose
+// expected time has already passed. The
+// cache holds arrivals for the whole TTL, so minutes computed at fetch time
+// would go stale; callers may also annotate the copy freely.
+func (s *BusService) withCountdowns(arrivals []BusArrival) []BusArrival {
+	now := s.now()
+	upcoming := make([]BusArrival, 0, len(arrivals))
+	for _, arr := range arrivals {
+		if arr.ExpectedArrival.Before(now) {
+			continue
+		}
+		arr.MinutesAway, arr.Status = countdown(arr.ExpectedArrival, now)
+		upcoming = append(upcoming, arr)
+	}
+	return upcoming
+}
+
+// getJSON is fetchJSON behind the circuit breaker
+func (s *BusService) getJSON(ctx context.Context, msg, apiURL string, v any, summary func() []slog.Attr) (err error) {
+	if err := s.allow(busUpstream); err != nil {
+		return err
+	}
+	defer func() { s.record(ctx, busUpstream, err) }()
+	return s.fetchJSON(ctx, msg, apiURL, v, summary)
+}
+
+// canRetry reports whether ctx leaves time for the retry pause and another
+// full attempt
+func (s *BusService) canRetry(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > s.retryDelay+s.client.Timeout
+}
+
+// fetchJSON fetches a Bus Time URL into v and logs the outcome, without
+// consulting the circuit breaker. Upstream failures are returned as a
+// *BusAPIError. summary adds parse counts to the log line once v is decoded.
+func (s *BusService) fetchJSON(ctx context.Context, msg, apiURL string, v any, summary func() []slog.Attr) (err error) {
+	start := time.Now()
+	status := 0
+	var body []byte
+	defer func() {
+		attrs := []slog.Attr{slog.Int("status", status), slog.Int("bytes", len(body))}
+		if err == nil {
+			attrs = append(attrs, summary()...)
+		}
+		s.logFetch(ctx, msg, start, err, attrs...)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("building request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &BusAPIError{Kind: ErrBusUnavailable, Err: err}
+	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bus API returned status %d", resp.StatusCode)
+		return busStatusError(resp.StatusCode)
 	}
 
-	var result siriResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("parsing response: %w", err)
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return &BusAPIError{Kind: ErrBusUnavailable, Err: fmt.Errorf("reading response: %w", err)}
 	}
-
-	arrivals := s.parseArrivals(result, stopID)
-	s.arrivalCache.Set(stopID, arrivals)
-	return arrivals, nil
+	if err := json.Unmarshal(body, v); err != nil {
+		return &BusAPIError{Kind: ErrBusResponse, Err: fmt.Errorf("parsing response: %w", err)}
+	}
+	s.markSuccess()
+	return nil
 }
 
 func (s *BusService) parseArrivals(resp siriResponse, stopID string) []BusArrival {
 	var arrivals []BusArrival
-	now := time.Now()
 
 	delivery := resp.Siri.ServiceDelivery.StopMonitoringDelivery
 	if len(delivery) == 0 {
@@ -223,8 +539,8 @@ func (s *BusService) parseArrivals(resp siriResponse, stopID string) []BusArriva
 			StopID:          stopID,
 			StopsAway:       stopsAway,
 			Feet:            feetAway,
-			ExpectedArrival: expectedTime,
-			MinutesAway:     int(expectedTime.Sub(now).Minutes()),
+			ExpectedArrival: inNYC(expectedTime),
+			ExpectedLocal:   formatLocal(expectedTime),
 		})
 	}
 
@@ -249,16 +565,55 @@ func getFirstString(v any) string {
 // API response structures
 type stopsForLocationResponse struct {
 	Data struct {
-		Stops []struct {
-			ID        string  `json:"id"`
-			Name      string  `json:"name"`
-			Lat       float64 `json:"lat"`
-			Lon       float64 `json:"lon"`
-			Direction string  `json:"direction"`
-		} `json:"stops"`
+		Stops []obaStop `json:"stops"`
 	} `json:"data"`
 }
 
+// obaStop is a stop in a stops-for-location response. Bus Time inlines the
+// routes serving it; other OneBusAway deployments may only list route IDs.
+type obaStop struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	Direction string  `json:"direction"`
+	Routes    []struct {
+		ID        string `json:"id"`
+		ShortName string `json:"shortName"`
+	} `json:"routes"`
+	RouteIDs []string `json:"routeIds"`
+}
+
+// routeNames returns the rider-facing names of the routes serving the stop,
+// e.g. "M34" for "MTA NYCT_M34", or nil when the response didn't say
+func (s obaStop) routeNames() []string {
+	var names []string
+	add := func(name string) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, route := range s.Routes {
+		if route.ShortName != "" {
+			add(route.ShortName)
+		} else {
+			add(stripAgency(route.ID))
+		}
+	}
+	for _, id := range s.RouteIDs {
+		add(stripAgency(id))
+	}
+	return names
+}
+
+// stripAgency drops the agency prefix OneBusAway puts on IDs ("MTA NYCT_")
+func stripAgency(id string) string {
+	if _, rest, ok := strings.Cut(id, "_"); ok {
+		return rest
+	}
+	return id
+}
+
 type siriResponse struct {
 	Siri struct {
 		ServiceDelivery struct {
@@ -0,0 +1,582 @@
+package transit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFindStopsNearSortsByDistance(t *testing.T) {
+	// Upstream returns stops out of order: far, near, middle
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"stops":[
+			{"id":"MTA_far","name":"Far","lat":40.7520,"lon":-73.9967},
+			{"id":"MTA_near","name":"Near","lat":40.7485,"lon":-73.9967},
+			{"id":"MTA_mid","name":"Mid","lat":40.7500,"lon":-73.9967}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+
+	stops, err := svc.FindStopsNear(context.Background(), 40.7484, -73.9967, 500)
+	if err != nil {
+		t.Fatalf("FindStopsNear: %v", err)
+	}
+
+	want := []string{"MTA_near", "MTA_mid", "MTA_far"}
+	if len(stops) != len(want) {
+		t.Fatalf("got %d stops, want %d", len(stops), len(want))
+	}
+	for i, id := range want {
+		if stops[i].ID != id {
+			t.Errorf("stops[%d] = %s, want %s", i, stops[i].ID, id)
+		}
+	}
+
+	// 0.0001 degrees of latitude is roughly 11 meters
+	if got := stops[0].DistanceMeters; math.Abs(got-11.1) > 0.5 {
+		t.Errorf("nearest distance = %.2fm, want ~11.1m", got)
+	}
+	for i, stop := range stops {
+		if stop.DistanceMiles <= 0 || math.Abs(stop.DistanceMiles-stop.DistanceMeters/1609.344) > 1e-9 {
+			t.Errorf("stops[%d] miles = %f, inconsistent with %fm", i, stop.DistanceMiles, stop.DistanceMeters)
+		}
+		if i > 0 && stop.DistanceMeters < stops[i-1].DistanceMeters {
+			t.Errorf("stops not sorted at %d", i)
+		}
+	}
+}
+
+func TestFindStopsNearRoutes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"stops":[
+			{"id":"MTA_1","name":"Inline","lat":40.7485,"lon":-73.9967,"routes":[
+				{"id":"MTA NYCT_M34","shortName":"M34"},
+				{"id":"MTA NYCT_M34A+","shortName":""},
+				{"id":"MTA NYCT_M34","shortName":"M34"}
+			]},
+			{"id":"MTA_2","name":"IDs only","lat":40.7490,"lon":-73.9967,"routeIds":["MTABC_Q53+","BX12"]},
+			{"id":"MTA_3","name":"Unlisted","lat":40.7495,"lon":-73.9967}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+
+	stops, err := svc.FindStopsNear(context.Background(), 40.7484, -73.9967, 500)
+	if err != nil {
+		t.Fatalf("FindStopsNear: %v", err)
+	}
+	want := map[string][]string{
+		"MTA_1": {"M34", "M34A+"},
+		"MTA_2": {"Q53+", "BX12"},
+		"MTA_3": nil,
+	}
+	for _, stop := range stops {
+		if !slices.Equal(stop.Routes, want[stop.ID]) {
+			t.Errorf("%s routes = %q, want %q", stop.ID, stop.Routes, want[stop.ID])
+		}
+	}
+	if !stops[0].Serves("m34") || stops[0].Serves("M3") || stops[2].Serves("M34") {
+		t.Error("Serves should match whole route names, ignoring case, and unlisted stops serve nothing")
+	}
+}
+
+// busTimeServer serves a fixed set of stops, each with the given number of
+// arrivals spaced a minute apart
+func busTimeServer(t *testing.T, stopIDs []string, perStop int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "stops-for-location") {
+			var stops []string
+			for i, id := range stopIDs {
+				stops = append(stops, fmt.Sprintf(`{"id":%q,"name":%q,"lat":%f,"lon":-73.9967}`, id, id, 40.7485+float64(i)*0.001))
+			}
+			fmt.Fprintf(w, `{"data":{"stops":[%s]}}`, strings.Join(stops, ","))
+			return
+		}
+
+		var visits []string
+		for i := 0; i < perStop; i++ {
+			at := time.Now().Add(time.Duration(i+1) * time.Minute).Format(time.RFC3339)
+			visits = append(visits, fmt.Sprintf(`{"MonitoredVehicleJourney":{"PublishedLineName":["M34"],"DestinationName":["Ferry"],"MonitoredCall":{"ExpectedArrivalTime":%q}}}`, at))
+		}
+		fmt.Fprintf(w, `{"Siri":{"ServiceDelivery":{"StopMonitoringDelivery":[{"MonitoredStopVisit":[%s]}]}}}`, strings.Join(visits, ","))
+	}))
+}
+
+func TestGetArrivalsNearCapsArrivals(t *testing.T) {
+	srv := busTimeServer(t, []string{"MTA_1", "MTA_2", "MTA_3"}, 4)
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		maxArrivals int
+		want        int
+	}{
+		{"under cap", 20, 12},
+		{"capped", 5, 5},
+		{"zero uses max", 0, 12},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+			svc.baseURL = srv.URL
+
+			nearby, err := svc.GetArrivalsNear(context.Background(), 40.7484, -73.9967, 400, 3, tc.maxArrivals, 0)
+			if err != nil {
+				t.Fatalf("GetArrivalsNear: %v", err)
+			}
+			arrivals := nearby.Arrivals
+			if len(arrivals) != tc.want {
+				t.Errorf("got %d arrivals, want %d", len(arrivals), tc.want)
+			}
+			for i := 1; i < len(arrivals); i++ {
+				if arrivals[i].ExpectedArrival.Before(arrivals[i-1].ExpectedArrival) {
+					t.Fatalf("arrivals not sorted at %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestGetArrivalsNearFetchesStopsConcurrently(t *testing.T) {
+	const (
+		stopCount = 8
+		delay     = 100 * time.Millisecond
+	)
+	var stopIDs []string
+	for i := 0; i < stopCount; i++ {
+		stopIDs = append(stopIDs, fmt.Sprintf("MTA_%d", i))
+	}
+	inner := busTimeServer(t, stopIDs, 2)
+	defer inner.Close()
+
+	// Slow every stop-monitoring call down, and fail one stop outright
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "stop-monitoring") {
+			time.Sleep(delay)
+			if r.URL.Query().Get("MonitoringRef") == "MTA_3" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		}
+		resp, err := http.Get(inner.URL + r.URL.RequestURI())
+		if err != nil {
+			t.Errorf("proxy: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(w, resp.Body)
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+
+	start := time.Now()
+	nearby, err := svc.GetArrivalsNear(context.Background(), 40.7484, -73.9967, 400, stopCount, MaxBusArrivals, 0)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("GetArrivalsNear: %v", err)
+	}
+	arrivals := nearby.Arrivals
+
+	// Every stop but the failing one contributes two arrivals
+	if want := (stopCount - 1) * 2; len(arrivals) != want {
+		t.Errorf("got %d arrivals, want %d", len(arrivals), want)
+	}
+	seen := make(map[string]bool)
+	for _, arr := range arrivals {
+		if arr.StopName == "" {
+			t.Errorf("arrival for %s missing stop name", arr.StopID)
+		}
+		seen[arr.StopID] = true
+	}
+	if seen["MTA_3"] {
+		t.Error("failed stop should be skipped")
+	}
+
+	if serial := stopCount * delay; elapsed >= serial*3/4 {
+		t.Errorf("fan-out took %v, expected well under serial %v", elapsed, serial)
+	}
+}
+
+func TestBusServiceMaxStops(t *testing.T) {
+	var stopIDs []string
+	for i := 0; i < 14; i++ {
+		stopIDs = append(stopIDs, fmt.Sprintf("MTA_%d", i))
+	}
+	srv := busTimeServer(t, stopIDs, 1)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		maxStops int
+		limit    int
+		want     int
+	}{
+		{"default cap", 0, 100, MaxBusStops},
+		{"lower cap", 3, 100, 3},
+		{"higher cap", 12, 100, 12},
+		{"limit under the cap", 12, 4, 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+			svc.baseURL = srv.URL
+			svc.SetMaxStops(tc.maxStops)
+
+			nearby, err := svc.GetArrivalsNear(context.Background(), 40.7484, -73.9967, 400, tc.limit, MaxBusArrivals, 0)
+			if err != nil {
+				t.Fatalf("GetArrivalsNear: %v", err)
+			}
+			if nearby.StopsQueried != tc.want || len(nearby.Arrivals) != tc.want {
+				t.Errorf("queried %d stops (%d arrivals), want %d", nearby.StopsQueried, len(nearby.Arrivals), tc.want)
+			}
+		})
+	}
+}
+
+func TestGetArrivalsNearStopFailures(t *testing.T) {
+	stopIDs := []string{"MTA_1", "MTA_2", "MTA_3"}
+	inner := busTimeServer(t, stopIDs, 2)
+	defer inner.Close()
+
+	tests := []struct {
+		name        string
+		failing     []string
+		wantErr     bool
+		wantFailed  int
+		wantPartial bool
+		wantCount   int
+	}{
+		{"all succeed", nil, false, 0, false, 6},
+		{"some fail", []string{"MTA_2"}, false, 1, true, 4},
+		{"all fail", stopIDs, true, 0, false, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if slices.Contains(tc.failing, r.URL.Query().Get("MonitoringRef")) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				resp, err := http.Get(inner.URL + r.URL.RequestURI())
+				if err != nil {
+					t.Errorf("proxy: %v", err)
+					return
+				}
+				defer resp.Body.Close()
+				io.Copy(w, resp.Body)
+			}))
+			defer srv.Close()
+
+			svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+			svc.baseURL = srv.URL
+
+			nearby, err := svc.GetArrivalsNear(context.Background(), 40.7484, -73.9967, 400, len(stopIDs), MaxBusArrivals, 0)
+			if tc.wantErr {
+				if !errors.Is(err, ErrAllStopsFailed) {
+					t.Fatalf("err = %v, want ErrAllStopsFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetArrivalsNear: %v", err)
+			}
+			if nearby.StopsQueried != len(stopIDs) || nearby.StopsFailed != tc.wantFailed {
+				t.Errorf("stops queried/failed = %d/%d, want %d/%d", nearby.StopsQueried, nearby.StopsFailed, len(stopIDs), tc.wantFailed)
+			}
+			if nearby.Partial() != tc.wantPartial {
+				t.Errorf("Partial() = %v, want %v", nearby.Partial(), tc.wantPartial)
+			}
+			if len(nearby.Arrivals) != tc.wantCount {
+				t.Errorf("got %d arrivals, want %d", len(nearby.Arrivals), tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestBusCountdownRecomputedOnCacheHit(t *testing.T) {
+	base := time.Now().Truncate(time.Second)
+	expected := base.Add(10 * time.Minute)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprintf(w, `{"Siri":{"ServiceDelivery":{"StopMonitoringDelivery":[{"MonitoredStopVisit":[{"MonitoredVehicleJourney":{"PublishedLineName":["M34"],"MonitoredCall":{"ExpectedArrivalTime":%q}}}]}]}}}`,
+			expected.Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	clock := NewFakeClock(base)
+	svc := NewBusService("key", testClient(), 2*time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+	svc.SetClock(clock)
+
+	minutesAway := func() int {
+		t.Helper()
+		arrivals, err := svc.GetArrivalsForStop(context.Background(), "MTA_1")
+		if err != nil || len(arrivals) != 1 {
+			t.Fatalf("GetArrivalsForStop = %v, %v; want one arrival", arrivals, err)
+		}
+		return arrivals[0].MinutesAway
+	}
+
+	if got := minutesAway(); got != 10 {
+		t.Errorf("fresh fetch: %d minutes away, want 10", got)
+	}
+	clock.Advance(100 * time.Second)
+	if got := minutesAway(); got != 8 {
+		t.Errorf("100s later: %d minutes away, want 8", got)
+	}
+	clock.Advance(time.Minute)
+	if got := minutesAway(); got != 7 {
+		t.Errorf("160s later: %d minutes away, want 7", got)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("upstream hit %d times, want 1 (later reads served from cache)", hits.Load())
+	}
+}
+
+func TestBusPastArrivalsDroppedOnCacheHit(t *testing.T) {
+	base := time.Now().Truncate(time.Second)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprintf(w, `{"Siri":{"ServiceDelivery":{"StopMonitoringDelivery":[{"MonitoredStopVisit":[
+			{"MonitoredVehicleJourney":{"PublishedLineName":["M34"],"MonitoredCall":{"ExpectedArrivalTime":%q}}},
+			{"MonitoredVehicleJourney":{"PublishedLineName":["M34"],"MonitoredCall":{"ExpectedArrivalTime":%q}}}
+		]}]}}}`, base.Add(time.Minute).Format(time.RFC3339), base.Add(5*time.Minute).Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	clock := NewFakeClock(base)
+	svc := NewBusService("key", testClient(), 10*time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+	svc.SetClock(clock)
+
+	var statuses []string
+	minutes := func() []int {
+		t.Helper()
+		arrivals, err := svc.GetArrivalsForStop(context.Background(), "MTA_1")
+		if err != nil {
+			t.Fatalf("GetArrivalsForStop: %v", err)
+		}
+		var got []int
+		statuses = nil
+		for _, arr := range arrivals {
+			got = append(got, arr.MinutesAway)
+			statuses = append(statuses, arr.Status)
+		}
+		return got
+	}
+
+	if got := minutes(); !slices.Equal(got, []int{1, 5}) {
+		t.Errorf("fresh fetch: minutes away %v, want [1 5]", got)
+	}
+	if !slices.Equal(statuses, []string{StatusApproaching, StatusTimed}) {
+		t.Errorf("fresh fetch: statuses %v, want [approaching timed]", statuses)
+	}
+	// The first bus is due at +60s; at +90s it's gone from the cached copy.
+	// The second is 3.5 minutes out, which rounds up as a subway countdown does.
+	clock.Advance(90 * time.Second)
+	if got := minutes(); !slices.Equal(got, []int{4}) {
+		t.Errorf("90s later: minutes away %v, want [4]", got)
+	}
+	clock.Advance(5 * time.Minute)
+	if got := minutes(); len(got) != 0 {
+		t.Errorf("after both buses: minutes away %v, want none", got)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("upstream hit %d times, want 1 (later reads served from cache)", hits.Load())
+	}
+}
+
+func TestGetArrivalsForStopTypedErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantKind error
+		wantHits int32
+	}{
+		{"unauthorized", http.StatusUnauthorized, "", ErrBusAuth, 1},
+		{"forbidden", http.StatusForbidden, "", ErrBusAuth, 1},
+		{"unavailable", http.StatusServiceUnavailable, "", ErrBusUnavailable, 2},
+		{"rate limited", http.StatusTooManyRequests, "", ErrBusUnavailable, 2},
+		{"not found", http.StatusNotFound, "", ErrBusResponse, 1},
+		{"bad json", http.StatusOK, "<html>maintenance</html>", ErrBusResponse, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+			svc.baseURL = srv.URL
+			svc.retryDelay = 0
+
+			_, err := svc.GetArrivalsForStop(context.Background(), "MTA_1")
+			if !errors.Is(err, tc.wantKind) {
+				t.Fatalf("err = %v, want %v", err, tc.wantKind)
+			}
+			var apiErr *BusAPIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want a *BusAPIError", err)
+			}
+			if tc.body == "" && apiErr.Status != tc.status {
+				t.Errorf("Status = %d, want %d", apiErr.Status, tc.status)
+			}
+			// Only transient failures are retried
+			if hits.Load() != tc.wantHits {
+				t.Errorf("upstream hit %d times, want %d", hits.Load(), tc.wantHits)
+			}
+		})
+	}
+}
+
+func TestGetArrivalsForStopRetrySucceeds(t *testing.T) {
+	inner := busTimeServer(t, []string{"MTA_1"}, 2)
+	defer inner.Close()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		resp, err := http.Get(inner.URL + r.URL.RequestURI())
+		if err != nil {
+			t.Errorf("proxy: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		io.Copy(w, resp.Body)
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+	svc.retryDelay = 0
+
+	arrivals, err := svc.GetArrivalsForStop(context.Background(), "MTA_1")
+	if err != nil {
+		t.Fatalf("GetArrivalsForStop after one 502: %v", err)
+	}
+	if len(arrivals) != 2 || hits.Load() != 2 {
+		t.Errorf("got %d arrivals in %d hits, want 2 in 2", len(arrivals), hits.Load())
+	}
+}
+
+func TestGetArrivalsForStopRetryCountsOnceOnBreaker(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+	svc.retryDelay = 0
+	svc.SetCircuitBreaker(2, time.Minute)
+
+	// Two attempts, one failure: the breaker stays closed after the first call
+	if _, err := svc.GetArrivalsForStop(context.Background(), "MTA_1"); !errors.Is(err, ErrBusUnavailable) {
+		t.Fatalf("first call err = %v, want ErrBusUnavailable", err)
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("first call made %d requests, want 2", hits.Load())
+	}
+	if _, err := svc.GetArrivalsForStop(context.Background(), "MTA_1"); !errors.Is(err, ErrBusUnavailable) {
+		t.Fatalf("second call err = %v, want ErrBusUnavailable, not an open circuit", err)
+	}
+
+	var open *CircuitOpenError
+	if _, err := svc.GetArrivalsForStop(context.Background(), "MTA_1"); !errors.As(err, &open) {
+		t.Errorf("third call err = %v, want the circuit open after two failed lookups", err)
+	}
+}
+
+func TestGetArrivalsForStopSkipsRetryNearDeadline(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+
+	// Less than the pause plus the client's one-second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := svc.GetArrivalsForStop(ctx, "MTA_1"); !errors.Is(err, ErrBusUnavailable) {
+		t.Fatalf("err = %v, want ErrBusUnavailable", err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("made %d requests, want no retry that couldn't finish in time", hits.Load())
+	}
+}
+
+func TestBusServiceCustomBaseURL(t *testing.T) {
+	// A OneBusAway deployment mounted under a path prefix, taking its key in
+	// api_key rather than MTA's key
+	const prefix = "/onebusaway-api-webapp"
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Query().Get("api_key") != "secret" || r.URL.Query().Has("key") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case prefix + "/api/where/stops-for-location.json":
+			w.Write([]byte(`{"data":{"stops":[{"id":"OBA_1","name":"Main St","lat":40.7485,"lon":-73.9967}]}}`))
+		case prefix + "/api/siri/stop-monitoring.json":
+			at := time.Now().Add(4 * time.Minute).Format(time.RFC3339)
+			fmt.Fprintf(w, `{"Siri":{"ServiceDelivery":{"StopMonitoringDelivery":[{"MonitoredStopVisit":[
+				{"MonitoredVehicleJourney":{"PublishedLineName":["B1"],"DestinationName":["Downtown"],"MonitoredCall":{"ExpectedArrivalTime":%q}}}
+			]}]}}}`, at)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("secret", testClient(), time.Minute, time.Minute)
+	svc.SetBaseURL(srv.URL + prefix + "/")
+	svc.SetKeyParam("api_key")
+
+	nearby, err := svc.GetArrivalsNear(context.Background(), 40.7484, -73.9967, 400, 1, 10, 0)
+	if err != nil {
+		t.Fatalf("GetArrivalsNear: %v (requests: %v)", err, paths)
+	}
+	if len(nearby.Arrivals) != 1 || nearby.Arrivals[0].Route != "B1" || nearby.Arrivals[0].StopID != "OBA_1" {
+		t.Errorf("arrivals = %+v, want one B1 at OBA_1", nearby.Arrivals)
+	}
+	if got := svc.UpstreamURLs(); len(got) != 1 || got[0] != srv.URL+prefix {
+		t.Errorf("UpstreamURLs = %v, want the custom base without a trailing slash", got)
+	}
+}
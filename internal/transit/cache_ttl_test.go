@@ -0,0 +1,26 @@
+package transit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceCacheTTLs(t *testing.T) {
+	subway := NewSubwayService(testClient(), 30*time.Second)
+	if got := subway.feedCache.TTL(); got != 30*time.Second {
+		t.Errorf("subway feed TTL = %v, want 30s", got)
+	}
+
+	bus := NewBusService("key", testClient(), 20*time.Second, time.Hour)
+	if got := bus.arrivalCache.TTL(); got != 20*time.Second {
+		t.Errorf("bus arrival TTL = %v, want 20s", got)
+	}
+	if got := bus.stopsCache.TTL(); got != time.Hour {
+		t.Errorf("bus stops TTL = %v, want 1h", got)
+	}
+
+	alerts := NewAlertService(testClient(), 5*time.Minute)
+	if got := alerts.cache.TTL(); got != 5*time.Minute {
+		t.Errorf("alerts TTL = %v, want 5m", got)
+	}
+}
@@ -0,0 +1,70 @@
+package transit
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time. Services read the time through one so
+// countdowns, past-arrival filtering and alert activity can be tested at
+// exact instants.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the wall clock
+type RealClock struct{}
+
+// Now returns time.Now()
+func (RealClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock that only moves when told to. It is safe for
+// concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// serviceClock holds a service's Clock. Embed it in a service; it reads the
+// real clock unless SetClock is called.
+type serviceClock struct {
+	clock Clock
+}
+
+// SetClock makes the service read the time from clock
+func (c *serviceClock) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+func (c *serviceClock) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
@@ -0,0 +1,65 @@
+package transit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// hangingServer never responds until the client goes away
+func hangingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func cancelSoon(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestSubwayCancelledContext(t *testing.T) {
+	srv := hangingServer(t)
+	svc := NewSubwayService(NewHTTPClient(10*time.Second, "", 0), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL}
+
+	start := time.Now()
+	_, err := svc.GetArrivalsForStation(cancelSoon(t), "A15", ArrivalOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancellation took %v, want prompt return", elapsed)
+	}
+}
+
+func TestBusCancelledContext(t *testing.T) {
+	srv := hangingServer(t)
+	svc := NewBusService("key", NewHTTPClient(10*time.Second, "", 0), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+
+	_, err := svc.GetArrivalsNear(cancelSoon(t), 40.7484, -73.9967, 400, 5, 10, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestAlertsCancelledContext(t *testing.T) {
+	srv := hangingServer(t)
+	svc := NewAlertService(NewHTTPClient(10*time.Second, "", 0), time.Minute)
+	svc.feedURL = srv.URL
+
+	_, err := svc.GetAlerts(cancelSoon(t), nil, AlertOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,26 @@
+package transit
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// fetchTracker records when a service last fetched from its upstream
+// successfully. Embed it in a service to expose LastSuccess.
+type fetchTracker struct {
+	lastSuccess atomic.Int64 // unix nanoseconds, 0 if never
+}
+
+func (t *fetchTracker) markSuccess() {
+	t.lastSuccess.Store(time.Now().UnixNano())
+}
+
+// LastSuccess returns the time of the last successful upstream fetch, or the
+// zero time if there hasn't been one
+func (t *fetchTracker) LastSuccess() time.Time {
+	ns := t.lastSuccess.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,107 @@
+package transit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"google.golang.org/protobuf/proto"
+)
+
+func emptyFeedBytes(t *testing.T) []byte {
+	t.Helper()
+	body, err := proto.Marshal(&gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+	})
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	return body
+}
+
+func TestFetchTrackerNeverFetched(t *testing.T) {
+	var tracker fetchTracker
+	if !tracker.LastSuccess().IsZero() {
+		t.Error("LastSuccess should be zero before any fetch")
+	}
+}
+
+func TestSubwayFetchRecordsSuccess(t *testing.T) {
+	body := emptyFeedBytes(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Millisecond)
+	before := time.Now()
+
+	if _, err := svc.fetchFeedBytes(context.Background(), "test", srv.URL); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	first := svc.LastSuccess()
+	if first.Before(before) {
+		t.Fatalf("LastSuccess = %v, want after %v", first, before)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if _, err := svc.fetchFeedBytes(context.Background(), "test", srv.URL); err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if !svc.LastSuccess().After(first) {
+		t.Errorf("LastSuccess did not advance: %v -> %v", first, svc.LastSuccess())
+	}
+}
+
+func TestSubwayFetchFailureDoesNotRecordSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	if _, err := svc.fetchFeedBytes(context.Background(), "test", srv.URL); err == nil {
+		t.Fatal("expected error for 503 response")
+	}
+	if !svc.LastSuccess().IsZero() {
+		t.Error("failed fetch should not record success")
+	}
+}
+
+func TestAlertFetchRecordsSuccess(t *testing.T) {
+	body := emptyFeedBytes(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewAlertService(testClient(), time.Minute)
+	svc.feedURL = srv.URL
+
+	if _, err := svc.GetAlerts(context.Background(), nil, AlertOptions{}); err != nil {
+		t.Fatalf("GetAlerts: %v", err)
+	}
+	if svc.LastSuccess().IsZero() {
+		t.Error("LastSuccess should be set after a successful fetch")
+	}
+}
+
+func TestBusFetchRecordsSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Siri":{"ServiceDelivery":{"StopMonitoringDelivery":[]}}}`))
+	}))
+	defer srv.Close()
+
+	svc := NewBusService("key", testClient(), time.Minute, time.Minute)
+	svc.baseURL = srv.URL
+
+	if _, err := svc.GetArrivalsForStop(context.Background(), "MTA_1"); err != nil {
+		t.Fatalf("GetArrivalsForStop: %v", err)
+	}
+	if svc.LastSuccess().IsZero() {
+		t.Error("LastSuccess should be set after a successful fetch")
+	}
+}
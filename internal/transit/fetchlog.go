@@ -0,0 +1,43 @@
+package transit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/randytsao24/emteeayy/internal/requestid"
+)
+
+// fetchLogger logs the outcome of upstream requests. Embed it in a service;
+// it logs to slog.Default() unless SetLogger is called.
+type fetchLogger struct {
+	logger *slog.Logger
+}
+
+// SetLogger sends the service's upstream fetch logs to logger
+func (l *fetchLogger) SetLogger(logger *slog.Logger) {
+	l.logger = logger
+}
+
+// logFetch records one upstream request that started at start. Successes are
+// logged at debug so routine polling stays quiet; failures at warn.
+func (l *fetchLogger) logFetch(ctx context.Context, msg string, start time.Time, err error, attrs ...slog.Attr) {
+	logger := l.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	if id := requestid.FromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+
+	level := slog.LevelDebug
+	if err != nil && ctx.Err() == nil { // the caller giving up isn't an upstream problem
+		level = slog.LevelWarn
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,133 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/randytsao24/emteeayy/internal/requestid"
+	"google.golang.org/protobuf/proto"
+)
+
+// captureLogs returns a debug-level logger and a function that decodes every
+// record it has written
+func captureLogs(t *testing.T) (*slog.Logger, func() []map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	return logger, func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("decode log line %q: %v", line, err)
+			}
+			records = append(records, rec)
+		}
+		return records
+	}
+}
+
+// findRecord returns the first record with the given message
+func findRecord(t *testing.T, records []map[string]any, msg string) map[string]any {
+	t.Helper()
+	for _, rec := range records {
+		if rec["msg"] == msg {
+			return rec
+		}
+	}
+	t.Fatalf("no %q log record in %v", msg, records)
+	return nil
+}
+
+func TestSubwayFetchLogging(t *testing.T) {
+	body, err := proto.Marshal(buildFeed(map[string][]testStop{
+		"A": {{"A27N", time.Now().Add(3 * time.Minute)}},
+	}))
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	logger, records := captureLogs(t)
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL}
+	svc.SetLogger(logger)
+
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	if _, err := svc.GetArrivalsForStation(ctx, "A27", ArrivalOptions{}); err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+
+	fetch := findRecord(t, records(), "subway feed fetch")
+	want := map[string]any{
+		"level":      "DEBUG",
+		"feed":       "ace",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(len(body)),
+		"request_id": "req-123",
+	}
+	for key, val := range want {
+		if fetch[key] != val {
+			t.Errorf("fetch %s = %v, want %v", key, fetch[key], val)
+		}
+	}
+	if _, ok := fetch["duration"]; !ok {
+		t.Error("fetch record missing duration")
+	}
+
+	parse := findRecord(t, records(), "subway feed parse")
+	if parse["entities"] != float64(1) || parse["arrivals"] != float64(1) {
+		t.Errorf("parse entities/arrivals = %v/%v, want 1/1", parse["entities"], parse["arrivals"])
+	}
+}
+
+func TestFetchLoggingWarnsOnUpstreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	logger, records := captureLogs(t)
+
+	subway := NewSubwayService(testClient(), time.Minute)
+	subway.feedURLs = map[string]string{"ace": srv.URL}
+	subway.SetLogger(logger)
+	subway.GetFeedBytes(context.Background(), "ace")
+
+	bus := NewBusService("key", testClient(), time.Minute, time.Minute)
+	bus.baseURL = srv.URL
+	bus.SetLogger(logger)
+	bus.GetArrivalsForStop(context.Background(), "MTA_1")
+
+	alerts := NewAlertService(testClient(), time.Minute)
+	alerts.feedURL = srv.URL
+	alerts.SetLogger(logger)
+	alerts.GetAlerts(context.Background(), nil, AlertOptions{})
+
+	logged := records()
+	for _, msg := range []string{"subway feed fetch", "bus arrivals fetch", "alerts feed fetch"} {
+		rec := findRecord(t, logged, msg)
+		if rec["level"] != "WARN" {
+			t.Errorf("%s level = %v, want WARN", msg, rec["level"])
+		}
+		if rec["status"] != float64(http.StatusServiceUnavailable) {
+			t.Errorf("%s status = %v, want 503", msg, rec["status"])
+		}
+		if _, ok := rec["error"]; !ok {
+			t.Errorf("%s missing error", msg)
+		}
+	}
+}
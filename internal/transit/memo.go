@@ -0,0 +1,74 @@
+package transit
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// feedMemoKey is the context key for a request's feed memo
+type feedMemoKey struct{}
+
+// feedMemo holds the feeds decoded during one request, so a handler that calls
+// several service methods parses (and, on a cache miss, fetches) each feed
+// once. Entries are never refreshed; scope a memo to a single request.
+type feedMemo struct {
+	mu     sync.Mutex
+	feeds  map[string]*memoEntry
+	failed []string // feeds whose fetch or parse failed
+}
+
+type memoEntry struct {
+	once     sync.Once
+	arrivals []decodedArrival
+	err      error
+}
+
+// WithFeedMemo returns a context whose subway feed fetches are memoized for
+// as long as the context is in use
+func WithFeedMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, feedMemoKey{}, &feedMemo{feeds: make(map[string]*memoEntry)})
+}
+
+// memoized returns the decoded feed from ctx's memo, running fetch at most once
+// per feed. Without a memo it just calls fetch. Callers get a shared slice and
+// must copy before modifying it.
+func memoized(ctx context.Context, feedName string, fetch func() ([]decodedArrival, error)) ([]decodedArrival, error) {
+	memo, ok := ctx.Value(feedMemoKey{}).(*feedMemo)
+	if !ok {
+		return fetch()
+	}
+
+	memo.mu.Lock()
+	entry, ok := memo.feeds[feedName]
+	if !ok {
+		entry = &memoEntry{}
+		memo.feeds[feedName] = entry
+	}
+	memo.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.arrivals, entry.err = fetch()
+		if entry.err != nil {
+			memo.mu.Lock()
+			memo.failed = append(memo.failed, feedName)
+			memo.mu.Unlock()
+		}
+	})
+	return entry.arrivals, entry.err
+}
+
+// memoFailures returns the sorted names of the feeds that failed in ctx's
+// memo, or nil if none did or there is no memo
+func memoFailures(ctx context.Context) []string {
+	memo, ok := ctx.Value(feedMemoKey{}).(*feedMemo)
+	if !ok {
+		return nil
+	}
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	if len(memo.failed) == 0 {
+		return nil
+	}
+	return slices.Sorted(slices.Values(memo.failed))
+}
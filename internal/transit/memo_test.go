@@ -0,0 +1,122 @@
+package transit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFeedMemoFetchesEachFeedOncePerRequest(t *testing.T) {
+	now := time.Now()
+	body, err := proto.Marshal(buildFeed(map[string][]testStop{
+		"A": {{"A27N", now.Add(3 * time.Minute)}, {"A28N", now.Add(5 * time.Minute)}},
+	}))
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL + "/ace", "bdfm": srv.URL + "/bdfm"}
+
+	// Clearing the feed cache between calls shows the memo, not the cache,
+	// is what saves the refetch
+	ctx := WithFeedMemo(context.Background())
+	if _, err := svc.GetArrivalsForStation(ctx, "A27", ArrivalOptions{}); err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+	svc.feedCache.Clear()
+	stations, err := svc.GetArrivalsForStations(ctx, []string{"A27", "A28"}, ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStations: %v", err)
+	}
+	svc.feedCache.Clear()
+	if _, err := svc.GetArrivalsForStation(ctx, "A28", ArrivalOptions{}); err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+
+	for _, path := range []string{"/ace", "/bdfm"} {
+		if hits[path] != 1 {
+			t.Errorf("%s fetched %d times in one request, want 1", path, hits[path])
+		}
+	}
+	if len(stations) != 2 || len(stations[0].Northbound) != 2 {
+		t.Errorf("memoized feed gave %+v, want A27 arrivals from both feeds", stations)
+	}
+
+	// A new request gets a new memo
+	svc.feedCache.Clear()
+	if _, err := svc.GetArrivalsForStation(WithFeedMemo(context.Background()), "A27", ArrivalOptions{}); err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+	if hits["/ace"] != 2 {
+		t.Errorf("/ace fetched %d times across two requests, want 2", hits["/ace"])
+	}
+}
+
+func TestFailedFeedsReportedPerRequest(t *testing.T) {
+	body, err := proto.Marshal(buildFeed(map[string][]testStop{
+		"A": {{"A27N", time.Now().Add(3 * time.Minute)}},
+	}))
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	healthy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ace" || healthy:
+			w.Write(body)
+		case r.URL.Path == "/bdfm":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte("not a protobuf"))
+		}
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL + "/ace", "bdfm": srv.URL + "/bdfm", "g": srv.URL + "/g"}
+
+	healthy = false
+	ctx := WithFeedMemo(context.Background())
+	stations, err := svc.GetArrivalsForStations(ctx, []string{"A27"}, ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStations: %v", err)
+	}
+	if len(stations) != 1 || len(stations[0].Northbound) != 1 {
+		t.Errorf("stations = %+v, want the healthy feed's A27 arrival", stations)
+	}
+	if got := svc.FailedFeeds(ctx); !slices.Equal(got, []string{"bdfm", "g"}) {
+		t.Errorf("FailedFeeds = %v, want [bdfm g]", got)
+	}
+	if got := svc.FailedFeeds(context.Background()); got != nil {
+		t.Errorf("FailedFeeds without a memo = %v, want nil", got)
+	}
+
+	// Failures belong to the request they happened in. Unparseable bytes are
+	// cached like any others, so clear them for the recovered upstream.
+	healthy = true
+	svc.feedCache.Clear()
+	ctx = WithFeedMemo(context.Background())
+	if _, err := svc.GetArrivalsForStation(ctx, "A27", ArrivalOptions{}); err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+	if got := svc.FailedFeeds(ctx); got != nil {
+		t.Errorf("FailedFeeds after a clean request = %v, want nil", got)
+	}
+}
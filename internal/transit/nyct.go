@@ -0,0 +1,126 @@
+package transit
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// The MTA's subway feeds carry the NYCT GTFS-RT extension (nyct-subway.proto)
+// on trip descriptors and stop time updates. The bindings don't include it,
+// so the extension arrives as unknown fields and is decoded by hand here.
+const nyctExtensionField protowire.Number = 1001
+
+// NyctTripDescriptor fields
+const (
+	nyctTrainIDField   protowire.Number = 1
+	nyctDirectionField protowire.Number = 3
+)
+
+// NyctStopTimeUpdate fields
+const (
+	nyctScheduledTrackField protowire.Number = 1
+	nyctActualTrackField    protowire.Number = 2
+)
+
+// nyctDirections maps NyctTripDescriptor.Direction to Arrival directions. The
+// subway only uses north and south; east and west are left to the stop ID.
+var nyctDirections = map[uint64]string{
+	1: "northbound",
+	3: "southbound",
+}
+
+// nyctTrip is the NYCT extension of a trip descriptor
+type nyctTrip struct {
+	trainID   string
+	direction string // "northbound", "southbound" or "" when not given
+}
+
+// nyctStopTime is the NYCT extension of a stop time update
+type nyctStopTime struct {
+	scheduledTrack string
+	actualTrack    string
+}
+
+// nyctTripOf decodes the NYCT extension of a trip descriptor, reporting false
+// when it is absent or malformed
+func nyctTripOf(trip proto.Message) (nyctTrip, bool) {
+	var ext nyctTrip
+	ok := decodeNyctExtension(trip, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == nyctTrainIDField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			ext.trainID = string(v)
+			return n
+		case num == nyctDirectionField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			ext.direction = nyctDirections[v]
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if !ok {
+		return nyctTrip{}, false
+	}
+	return ext, true
+}
+
+// nyctStopTimeOf decodes the NYCT extension of a stop time update, reporting
+// false when it is absent or malformed
+func nyctStopTimeOf(update proto.Message) (nyctStopTime, bool) {
+	var ext nyctStopTime
+	ok := decodeNyctExtension(update, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ == protowire.BytesType && (num == nyctScheduledTrackField || num == nyctActualTrackField) {
+			v, n := protowire.ConsumeBytes(b)
+			if num == nyctScheduledTrackField {
+				ext.scheduledTrack = string(v)
+			} else {
+				ext.actualTrack = string(v)
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if !ok {
+		return nyctStopTime{}, false
+	}
+	return ext, true
+}
+
+// decodeNyctExtension finds the NYCT extension among msg's unknown fields and
+// hands each of its fields to field, which returns how many bytes it consumed
+// (negative on error)
+func decodeNyctExtension(msg proto.Message, field func(protowire.Number, protowire.Type, []byte) int) bool {
+	b := msg.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+		if num != nyctExtensionField || typ != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return false
+			}
+			b = b[n:]
+			continue
+		}
+
+		ext, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return false
+		}
+		for len(ext) > 0 {
+			num, typ, n := protowire.ConsumeTag(ext)
+			if n < 0 {
+				return false
+			}
+			ext = ext[n:]
+			if n = field(num, typ, ext); n < 0 {
+				return false
+			}
+			ext = ext[n:]
+		}
+		return true
+	}
+	return false
+}
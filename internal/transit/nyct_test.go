@@ -0,0 +1,98 @@
+package transit
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// nyctExtension encodes fields as a NYCT extension (field 1001) the way the
+// MTA's feeds carry it
+func nyctExtension(fields func(b []byte) []byte) []byte {
+	ext := fields(nil)
+	b := protowire.AppendTag(nil, nyctExtensionField, protowire.BytesType)
+	return protowire.AppendBytes(b, ext)
+}
+
+func TestParseArrivalsNYCTExtension(t *testing.T) {
+	now := time.Now()
+	feed := buildFeed(map[string][]testStop{
+		"A": {{"A27N", now.Add(3 * time.Minute)}, {"A28N", now.Add(5 * time.Minute)}},
+		"C": {{"A27S", now.Add(4 * time.Minute)}},
+	})
+
+	for _, entity := range feed.Entity {
+		update := entity.TripUpdate
+		if update.GetTrip().GetRouteId() != "A" {
+			continue
+		}
+		// Southbound per the extension, despite the N platforms: the
+		// extension wins over the stop ID suffix
+		update.Trip.ProtoReflect().SetUnknown(nyctExtension(func(b []byte) []byte {
+			b = protowire.AppendTag(b, nyctTrainIDField, protowire.BytesType)
+			b = protowire.AppendString(b, "1A 0712+ 207/FAR")
+			b = protowire.AppendTag(b, 2, protowire.VarintType) // is_assigned
+			b = protowire.AppendVarint(b, 1)
+			b = protowire.AppendTag(b, nyctDirectionField, protowire.VarintType)
+			return protowire.AppendVarint(b, 3)
+		}))
+		update.StopTimeUpdate[0].ProtoReflect().SetUnknown(nyctExtension(func(b []byte) []byte {
+			b = protowire.AppendTag(b, nyctScheduledTrackField, protowire.BytesType)
+			b = protowire.AppendString(b, "A1")
+			b = protowire.AppendTag(b, nyctActualTrackField, protowire.BytesType)
+			return protowire.AppendString(b, "A3")
+		}))
+	}
+
+	// Round-trip through the wire so the extension arrives as it would upstream
+	body, err := proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	feed.Reset()
+	if err := proto.Unmarshal(body, feed); err != nil {
+		t.Fatalf("unmarshal feed: %v", err)
+	}
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	byStop := make(map[string]Arrival)
+	for _, a := range svc.parseArrivals(feed, "") {
+		byStop[a.Route+" "+a.StopID] = a
+	}
+
+	a27 := byStop["A A27N"]
+	if a27.TrainID != "1A 0712+ 207/FAR" || a27.Direction != "southbound" {
+		t.Errorf("A at A27N = (%q, %q), want the extension's train ID, southbound", a27.TrainID, a27.Direction)
+	}
+	if a27.ScheduledTrack != "A1" || a27.ActualTrack != "A3" {
+		t.Errorf("A at A27N tracks = (%q, %q), want (A1, A3)", a27.ScheduledTrack, a27.ActualTrack)
+	}
+	if a28 := byStop["A A28N"]; a28.TrainID == "" || a28.ScheduledTrack != "" || a28.ActualTrack != "" {
+		t.Errorf("A at A28N = %+v, want the trip's train ID and no tracks", a28)
+	}
+
+	// No extension: the stop ID suffix decides
+	if c := byStop["C A27S"]; c.Direction != "southbound" || c.TrainID != "" || c.ScheduledTrack != "" {
+		t.Errorf("C at A27S = %+v, want southbound from the suffix and no NYCT fields", c)
+	}
+}
+
+func TestNYCTExtensionMalformed(t *testing.T) {
+	feed := buildFeed(map[string][]testStop{"A": {{"A27N", time.Now().Add(time.Minute)}}})
+	trip := feed.Entity[0].TripUpdate.Trip
+
+	// Claims more bytes than there are
+	b := protowire.AppendTag(nil, nyctExtensionField, protowire.BytesType)
+	b = protowire.AppendVarint(b, 40)
+	trip.ProtoReflect().SetUnknown(append(b, "short"...))
+	if ext, ok := nyctTripOf(trip); ok || ext != (nyctTrip{}) {
+		t.Errorf("nyctTripOf(truncated) = (%+v, %v), want zero and false", ext, ok)
+	}
+
+	trip.ProtoReflect().SetUnknown(nil)
+	if _, ok := nyctTripOf(trip); ok {
+		t.Error("nyctTripOf reported an extension that isn't there")
+	}
+}
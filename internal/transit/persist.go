@@ -0,0 +1,39 @@
+package transit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// LoadFeedCache warms the feed cache from a file written by SaveFeedCache,
+// skipping feeds that have already expired. A missing file is not an error.
+func (s *SubwayService) LoadFeedCache(path string) (int, error) {
+	return s.feedCache.LoadFile(path)
+}
+
+// SaveFeedCache writes the cached raw feeds and their expiry times to path
+func (s *SubwayService) SaveFeedCache(path string) error {
+	return s.feedCache.SaveFile(path)
+}
+
+// PersistFeedCache saves the feed cache to path every interval until ctx is
+// done, then saves once more. Failures are logged and retried next tick.
+func (s *SubwayService) PersistFeedCache(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.SaveFeedCache(path); err != nil {
+				slog.Warn("saving feed cache", "path", path, "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.SaveFeedCache(path); err != nil {
+				slog.Warn("saving feed cache", "path", path, "error", err)
+			}
+		}
+	}
+}
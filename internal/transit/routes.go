@@ -0,0 +1,83 @@
+package transit
+
+import "strings"
+
+// Route describes a subway line for display
+type Route struct {
+	ID        string `json:"id"`
+	Color     string `json:"color"`      // official MTA bullet color, "#RRGGBB"
+	TextColor string `json:"text_color"` // legible text color on the bullet
+	Feed      string `json:"feed"`       // GTFS-RT feed group, as used by /transit/subway/feed
+}
+
+// routeOrder lists subway routes in the MTA's usual display order. Aliases in
+// routeToFeed (e.g. SIR) are left out.
+var routeOrder = []string{
+	"1", "2", "3", "4", "5", "6", "7",
+	"A", "C", "E", "B", "D", "F", "M",
+	"G", "J", "Z", "L",
+	"N", "Q", "R", "W",
+	"SI",
+}
+
+// Bullet colors from the MTA's subway GTFS routes.txt; each trunk line shares one
+const (
+	colorBroadway7Av = "#EE352E"
+	colorLexington   = "#00933C"
+	colorFlushing    = "#B933AD"
+	colorEighthAv    = "#0039A6"
+	colorSixthAv     = "#FF6319"
+	colorCrosstown   = "#6CBE45"
+	colorNassau      = "#996633"
+	colorCanarsie    = "#A7A9AC"
+	colorBroadway    = "#FCCC0A"
+	colorShuttle     = "#808183"
+
+	textLight = "#FFFFFF"
+	textDark  = "#000000"
+)
+
+type routeColor struct {
+	color, text string
+}
+
+// routeColors maps GTFS route IDs, including shuttles, to their bullet colors
+var routeColors = map[string]routeColor{
+	"1": {colorBroadway7Av, textLight}, "2": {colorBroadway7Av, textLight}, "3": {colorBroadway7Av, textLight},
+	"4": {colorLexington, textLight}, "5": {colorLexington, textLight}, "6": {colorLexington, textLight},
+	"7": {colorFlushing, textLight},
+	"A": {colorEighthAv, textLight}, "C": {colorEighthAv, textLight}, "E": {colorEighthAv, textLight},
+	"B": {colorSixthAv, textLight}, "D": {colorSixthAv, textLight}, "F": {colorSixthAv, textLight}, "M": {colorSixthAv, textLight},
+	"G": {colorCrosstown, textLight},
+	"J": {colorNassau, textLight}, "Z": {colorNassau, textLight},
+	"L": {colorCanarsie, textLight},
+	"N": {colorBroadway, textDark}, "Q": {colorBroadway, textDark}, "R": {colorBroadway, textDark}, "W": {colorBroadway, textDark},
+	"GS": {colorShuttle, textLight}, "FS": {colorShuttle, textLight}, "H": {colorShuttle, textLight},
+	"SI": {colorEighthAv, textLight},
+}
+
+// colorsFor returns the bullet and text colors for a route ID, treating
+// express variants like 6X as their base route. Unknown routes get "".
+func colorsFor(routeID string) (color, text string) {
+	id := strings.ToUpper(routeID)
+	c, ok := routeColors[id]
+	if !ok && len(id) > 1 {
+		c = routeColors[strings.TrimSuffix(id, "X")]
+	}
+	return c.color, c.text
+}
+
+// Routes returns every subway route with its color and feed group
+func Routes() []Route {
+	routes := make([]Route, 0, len(routeOrder))
+	for _, id := range routeOrder {
+		color, text := colorsFor(id)
+		routes = append(routes, Route{
+			ID:        id,
+			Color:     color,
+			TextColor: text,
+			Feed:      routeToFeed[id],
+		})
+	}
+	return routes
+}
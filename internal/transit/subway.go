@@ -1,11 +1,18 @@
 package transit
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"math"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
@@ -15,14 +22,14 @@ import (
 
 // MTA GTFS-RT feed URLs by line group
 var feedURLs = map[string]string{
-	"ace":    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
-	"bdfm":   "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-bdfm",
-	"g":      "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-g",
-	"jz":     "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-jz",
-	"nqrw":   "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-nqrw",
-	"l":      "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-l",
+	"ace":     "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
+	"bdfm":    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-bdfm",
+	"g":       "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-g",
+	"jz":      "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-jz",
+	"nqrw":    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-nqrw",
+	"l":       "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-l",
 	"1234567": "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs",
-	"si":     "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-si",
+	"si":      "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-si",
 }
 
 // routeToFeed maps route letters to their feed
@@ -35,50 +42,237 @@ var routeToFeed = map[string]string{
 	"L": "l",
 	"1": "1234567", "2": "1234567", "3": "1234567", "4": "1234567",
 	"5": "1234567", "6": "1234567", "7": "1234567",
-	"SI": "si",
+	"SI": "si", "SIR": "si",
+}
+
+// OverrideRouteFeeds merges route-to-feed assignments over the built-in ones,
+// for when the MTA moves a route to another feed. Routes are case-insensitive
+// and may be new; every feed must be one of the known feed names, or nothing
+// is applied. Call it once at startup, before any service is in use.
+func OverrideRouteFeeds(overrides map[string]string) error {
+	normalized := make(map[string]string, len(overrides))
+	for route, feed := range overrides {
+		route = strings.ToUpper(strings.TrimSpace(route))
+		feed = strings.ToLower(strings.TrimSpace(feed))
+		if route == "" {
+			return errors.New("route feed override with an empty route")
+		}
+		if _, ok := feedURLs[feed]; !ok {
+			return fmt.Errorf("route %s: %w: %q", route, ErrUnknownFeed, feed)
+		}
+		normalized[route] = feed
+	}
+	maps.Copy(routeToFeed, normalized)
+	return nil
 }
 
 // Arrival represents an upcoming train arrival
 type Arrival struct {
-	Route       string    `json:"route"`
-	StopID      string    `json:"stop_id"`
-	Direction   string    `json:"direction"`
-	ArrivalTime time.Time `json:"arrival_time"`
-	MinutesAway int       `json:"minutes_away"`
-	Destination string    `json:"destination,omitempty"`
+	Route         string    `json:"route"`
+	StopID        string    `json:"stop_id"`
+	Direction     string    `json:"direction"`
+	ArrivalTime   time.Time `json:"arrival_time"`  // RFC3339 in America/New_York
+	ArrivalLocal  string    `json:"arrival_local"` // NYC wall-clock HH:MM
+	MinutesAway   int       `json:"minutes_away"`
+	Status        string    `json:"status"`
+	TimeSource    string    `json:"time_source,omitempty"`    // "arrival" or "departure": which stop time ArrivalTime is
+	Destination   string    `json:"destination,omitempty"`    // terminus; the API resolves it to a name
+	DestinationID string    `json:"destination_id,omitempty"` // terminus GTFS stop ID, never resolved
+
+	// The GTFS-RT trip descriptor, so a client can follow one train across
+	// polls. StartDate is YYYYMMDD and StartTime HH:MM:SS, as the feed has them.
+	TripID    string `json:"trip_id,omitempty"`
+	StartDate string `json:"start_date,omitempty"`
+	StartTime string `json:"start_time,omitempty"`
+
+	// From the NYCT feed extension, when present: the MTA's train ID and the
+	// track the train is scheduled for and, once known, actually using
+	TrainID        string `json:"train_id,omitempty"`
+	ScheduledTrack string `json:"scheduled_track,omitempty"`
+	ActualTrack    string `json:"actual_track,omitempty"`
+
+	// Route bullet colors as "#RRGGBB"; empty for unknown routes
+	RouteColor     string `json:"route_color,omitempty"`
+	RouteTextColor string `json:"route_text_color,omitempty"`
+}
+
+// Arrival statuses, derived from the countdown
+const (
+	StatusDue         = "due"         // under 30 seconds out
+	StatusApproaching = "approaching" // about a minute out
+	StatusTimed       = "timed"       // a normal countdown
+)
+
+// countdown returns whole minutes until arrival, rounded to the nearest
+// minute, and the matching status
+func countdown(arrTime, now time.Time) (int, string) {
+	minutes := int(math.Round(arrTime.Sub(now).Minutes()))
+	switch {
+	case minutes <= 0:
+		return 0, StatusDue
+	case minutes == 1:
+		return minutes, StatusApproaching
+	default:
+		return minutes, StatusTimed
+	}
 }
 
+const (
+	DefaultArrivalsPerDirection = 5
+	MaxArrivalsPerDirection     = 20
+)
+
+// ArrivalOptions controls how station arrivals are filtered and trimmed
+type ArrivalOptions struct {
+	// PerDirection caps arrivals returned per direction. Zero or negative
+	// uses DefaultArrivalsPerDirection; values above the max are clamped.
+	PerDirection int
+
+	// MinMinutes drops arrivals sooner than this many minutes, before the
+	// per-direction cap is applied. Zero keeps everything.
+	MinMinutes int
+
+	// TimeSource picks which stop time each arrival shows (TimeSourceArrival
+	// and so on). Empty or unknown uses the service's default.
+	TimeSource string
+
+	// MergedStations maps a requested station to nearby stations folded into
+	// it (see location.StopService.SetClusterRadius). GetArrivalsForStations
+	// counts their trains as the requested station's.
+	MergedStations map[string][]string
+}
+
+// Time sources: which of a stop's GTFS-RT arrival and departure times an
+// Arrival shows. Each falls back to the other time when its own is missing.
+const (
+	TimeSourceArrival   = "arrival"   // the arrival time; the default
+	TimeSourceDeparture = "departure" // the departure time
+	TimeSourceAuto      = "auto"      // departure at a trip's first stop, where it's the only meaningful time, else arrival
+)
+
+// ValidTimeSource reports whether source is one of the time sources
+func ValidTimeSource(source string) bool {
+	switch source {
+	case TimeSourceArrival, TimeSourceDeparture, TimeSourceAuto:
+		return true
+	}
+	return false
+}
+
+func (o ArrivalOptions) perDirection() int {
+	switch {
+	case o.PerDirection <= 0:
+		return DefaultArrivalsPerDirection
+	case o.PerDirection > MaxArrivalsPerDirection:
+		return MaxArrivalsPerDirection
+	default:
+		return o.PerDirection
+	}
+}
+
+// truncate drops arrivals under MinMinutes and trims a sorted arrival list to
+// the per-direction limit
+func (o ArrivalOptions) truncate(arrivals []Arrival) []Arrival {
+	if o.MinMinutes > 0 {
+		arrivals = slices.DeleteFunc(arrivals, func(a Arrival) bool {
+			return a.MinutesAway < o.MinMinutes
+		})
+	}
+	if limit := o.perDirection(); len(arrivals) > limit {
+		return arrivals[:limit]
+	}
+	return arrivals
+}
+
+// ErrUnknownFeed is returned when a feed name isn't one of the known MTA feeds
+var ErrUnknownFeed = errors.New("unknown feed")
+
 // SubwayService fetches real-time subway arrivals
 type SubwayService struct {
+	fetchTracker
+	fetchLogger
+	circuitBreakers
+	serviceClock
 	client    *http.Client
-	timeout   time.Duration
 	feedCache *cache.Cache[[]byte]
+	feedURLs  map[string]string
+
+	// validators outlive feedCache entries so an expired feed can be
+	// revalidated with a conditional request instead of downloaded again
+	validatorsMu sync.Mutex
+	validators   map[string]feedValidator
+
+	// decodedFeeds saves re-parsing a cached feed for every station looked
+	// up in it; see decoded
+	decodedMu    sync.Mutex
+	decodedFeeds map[string]decodedFeed
+
+	timeSource string // default for ArrivalOptions.TimeSource
+
+	// complexPlatforms lists the platforms of a station's whole complex;
+	// see SetComplexPlatforms. Nil disables expansion.
+	complexPlatforms func(stationID string) []string
+}
+
+// decodedFeed is a feed body and the arrivals decoded from it
+type decodedFeed struct {
+	body     []byte
+	arrivals []decodedArrival
+}
+
+// decodedArrival is an Arrival as decoded from a feed, before a time source
+// is picked and the countdown worked out
+type decodedArrival struct {
+	Arrival
+	arrivalAt   int64 // Unix seconds; zero when the feed leaves it out
+	departureAt int64
+	origin      bool // the trip's first stop
+}
+
+// stopTime returns the time source picks for this stop and which time it is
+func (d decodedArrival) stopTime(source string) (int64, string) {
+	preferDeparture := source == TimeSourceDeparture || (source == TimeSourceAuto && d.origin)
+	switch {
+	case preferDeparture && d.departureAt != 0, d.arrivalAt == 0:
+		return d.departureAt, TimeSourceDeparture
+	default:
+		return d.arrivalAt, TimeSourceArrival
+	}
+}
+
+// feedValidator is what a refetch needs to ask the upstream whether a feed
+// has changed: the ETag and Last-Modified it was served with, and its bytes
+type feedValidator struct {
+	etag         string
+	lastModified string
+	body         []byte
 }
 
 // NewSubwayService creates a new subway service
-func NewSubwayService(timeout time.Duration, cacheTTL time.Duration) *SubwayService {
+func NewSubwayService(client *http.Client, cacheTTL time.Duration) *SubwayService {
 	return &SubwayService{
-		client: &http.Client{
-			Timeout: timeout,
-		},
-		timeout:   timeout,
+		client:    client,
 		feedCache: cache.New[[]byte](cacheTTL),
+		feedURLs:  maps.Clone(feedURLs),
 	}
 }
 
 // GetArrivals fetches arrivals for a specific stop
-func (s *SubwayService) GetArrivals(stopID string, routes []string) ([]Arrival, error) {
+func (s *SubwayService) GetArrivals(ctx context.Context, stopID string, routes []string) ([]Arrival, error) {
 	// Determine which feeds to fetch based on routes
 	feeds := s.getFeedsForRoutes(routes)
-	
+
 	var allArrivals []Arrival
 	for _, feedName := range feeds {
-		arrivals, err := s.fetchFeed(feedName, stopID)
+		arrivals, err := s.fetchFeed(ctx, feedName, stopID, "")
 		if err != nil {
 			continue // Skip failed feeds, try others
 		}
 		allArrivals = append(allArrivals, arrivals...)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// Sort by arrival time
 	sort.Slice(allArrivals, func(i, j int) bool {
@@ -89,7 +283,7 @@ func (s *SubwayService) GetArrivals(stopID string, routes []string) ([]Arrival,
 }
 
 // GetArrivalsForStation fetches arrivals for a station (both directions)
-func (s *SubwayService) GetArrivalsForStation(baseStopID string) (map[string][]Arrival, error) {
+func (s *SubwayService) GetArrivalsForStation(ctx context.Context, baseStopID string, opts ArrivalOptions) (map[string][]Arrival, error) {
 	// MTA stop IDs: base = parent, N = northbound, S = southbound
 	northID := baseStopID + "N"
 	southID := baseStopID + "S"
@@ -97,9 +291,13 @@ func (s *SubwayService) GetArrivalsForStation(baseStopID string) (map[string][]A
 	// Fetch all feeds for comprehensive coverage
 	var northArrivals, southArrivals []Arrival
 
-	for feedName := range feedURLs {
-		arrivals, err := s.fetchFeed(feedName, "")
+	for feedName := range s.feedURLs {
+		arrivals, err := s.fetchFeed(ctx, feedName, "", opts.TimeSource)
 		if err != nil {
+			// Skip failed feeds, but stop early if the caller gave up
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			continue
 		}
 
@@ -116,57 +314,263 @@ func (s *SubwayService) GetArrivalsForStation(baseStopID string) (map[string][]A
 	sortArrivals(southArrivals)
 
 	return map[string][]Arrival{
-		"northbound": northArrivals,
-		"southbound": southArrivals,
+		"northbound": opts.truncate(northArrivals),
+		"southbound": opts.truncate(southArrivals),
 	}, nil
 }
 
-func (s *SubwayService) fetchFeed(feedName, filterStopID string) ([]Arrival, error) {
-	feedURL, ok := feedURLs[feedName]
-	if !ok {
-		return nil, fmt.Errorf("unknown feed: %s", feedName)
+// FailedFeeds returns the feeds that couldn't be fetched or parsed so far in
+// the request ctx belongs to. Station lookups skip those feeds, so a non-empty
+// result means their arrivals are missing. It needs a feed memo (see
+// WithFeedMemo); without one it always returns nil.
+func (s *SubwayService) FailedFeeds(ctx context.Context) []string {
+	return memoFailures(ctx)
+}
+
+// SetComplexPlatforms makes GetArrivalsForStations expand a station to every
+// platform in its station complex, using lookup to list them
+// ((*location.StopService).ComplexPlatformIDs fits). Lines in a complex
+// often have separate parent stations, so a request for 14 St-Union Sq's 635
+// then also gets the L at L03N and L03S. Nil turns it off.
+func (s *SubwayService) SetComplexPlatforms(lookup func(stationID string) []string) {
+	s.complexPlatforms = lookup
+}
+
+// platformBases returns the base IDs whose N and S platforms serve stopID:
+// stopID itself, plus the bases of its complex's direction platforms when
+// complex platforms are set
+func (s *SubwayService) platformBases(stopID string) []string {
+	bases := []string{stopID}
+	if s.complexPlatforms == nil {
+		return bases
 	}
+	for _, child := range s.complexPlatforms(stopID) {
+		base, ok := strings.CutSuffix(child, "N")
+		if !ok {
+			base, ok = strings.CutSuffix(child, "S")
+		}
+		if ok && base != "" && !slices.Contains(bases, base) {
+			bases = append(bases, base)
+		}
+	}
+	return bases
+}
 
-	body, err := s.fetchFeedBytes(feedName, feedURL)
+// SetTimeSource sets the time source used when ArrivalOptions doesn't name
+// one. Unknown sources keep TimeSourceArrival.
+func (s *SubwayService) SetTimeSource(source string) {
+	if !ValidTimeSource(source) {
+		source = TimeSourceArrival
+	}
+	s.timeSource = source
+}
+
+// fetchFeed returns a feed's upcoming arrivals, optionally only at stops
+// whose IDs start with filterStopID, timed by source. Decoding goes through
+// the request's feed memo, if the context carries one (see WithFeedMemo).
+func (s *SubwayService) fetchFeed(ctx context.Context, feedName, filterStopID, source string) ([]Arrival, error) {
+	decoded, err := memoized(ctx, feedName, func() ([]decodedArrival, error) {
+		return s.parseFeed(ctx, feedName)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return s.upcoming(decoded, filterStopID, source), nil
+}
 
+func (s *SubwayService) parseFeed(ctx context.Context, feedName string) ([]decodedArrival, error) {
+	body, err := s.GetFeedBytes(ctx, feedName)
+	if err != nil {
+		return nil, err
+	}
+
+	if decoded, ok := s.decoded(feedName, body); ok {
+		return decoded, nil
+	}
+
+	start := time.Now()
 	feed := &gtfs.FeedMessage{}
 	if err := proto.Unmarshal(body, feed); err != nil {
-		return nil, fmt.Errorf("parsing protobuf: %w", err)
+		err = fmt.Errorf("parsing protobuf: %w", err)
+		s.logFetch(ctx, "subway feed parse", start, err, slog.String("feed", feedName), slog.Int("bytes", len(body)))
+		return nil, err
+	}
+
+	decoded := decodeArrivals(feed)
+	s.setDecoded(feedName, body, decoded)
+	s.logFetch(ctx, "subway feed parse", start, nil,
+		slog.String("feed", feedName),
+		slog.Int("entities", len(feed.GetEntity())),
+		slog.Int("arrivals", len(decoded)),
+	)
+	return decoded, nil
+}
+
+// decoded returns a feed's decoded arrivals if they were decoded from body.
+// Entries are tied to the exact bytes, not a copy of them, so they last as
+// long as the feed cache keeps serving that body (a 304 revalidation keeps
+// it) and a fresh download is always decoded again.
+func (s *SubwayService) decoded(feedName string, body []byte) ([]decodedArrival, bool) {
+	s.decodedMu.Lock()
+	defer s.decodedMu.Unlock()
+	entry, ok := s.decodedFeeds[feedName]
+	if !ok || len(body) == 0 || len(entry.body) != len(body) || &entry.body[0] != &body[0] {
+		return nil, false
+	}
+	return entry.arrivals, true
+}
+
+func (s *SubwayService) setDecoded(feedName string, body []byte, arrivals []decodedArrival) {
+	s.decodedMu.Lock()
+	defer s.decodedMu.Unlock()
+	if s.decodedFeeds == nil {
+		s.decodedFeeds = make(map[string]decodedFeed)
 	}
+	s.decodedFeeds[feedName] = decodedFeed{body: body, arrivals: arrivals}
+}
+
+// FlushCache drops every cached feed, returning how many there were. Their
+// validators and decoded arrivals go too, so the next fetch of each feed
+// downloads and parses it in full.
+func (s *SubwayService) FlushCache() int {
+	n := s.feedCache.Size()
+	s.feedCache.Clear()
+	s.validatorsMu.Lock()
+	s.validators = nil
+	s.validatorsMu.Unlock()
+	s.decodedMu.Lock()
+	s.decodedFeeds = nil
+	s.decodedMu.Unlock()
+	return n
+}
 
-	return s.parseArrivals(feed, filterStopID), nil
+// UpstreamURLs returns every subway feed URL, for reachability checks
+func (s *SubwayService) UpstreamURLs() []string {
+	return slices.Sorted(maps.Values(s.feedURLs))
 }
 
-func (s *SubwayService) fetchFeedBytes(feedName, feedURL string) ([]byte, error) {
+// GetFeedBytes returns the raw GTFS-RT protobuf for a named feed, served from
+// the cache when fresh
+func (s *SubwayService) GetFeedBytes(ctx context.Context, feedName string) ([]byte, error) {
+	feedURL, ok := s.feedURLs[feedName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFeed, feedName)
+	}
+	return s.fetchFeedBytes(ctx, feedName, feedURL)
+}
+
+// RefreshFeed fetches a feed whether or not its cached copy is fresh, then
+// decodes it, so the next lookups neither download nor parse it. An unchanged
+// feed costs only a conditional request.
+func (s *SubwayService) RefreshFeed(ctx context.Context, feedName string) error {
+	feedURL, ok := s.feedURLs[feedName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFeed, feedName)
+	}
+	if _, err := s.downloadFeed(ctx, feedName, feedURL); err != nil {
+		return err
+	}
+	_, err := s.parseFeed(ctx, feedName)
+	return err
+}
+
+func (s *SubwayService) fetchFeedBytes(ctx context.Context, feedName, feedURL string) ([]byte, error) {
 	if cached, ok := s.feedCache.Get(feedName); ok {
 		return cached, nil
 	}
+	return s.downloadFeed(ctx, feedName, feedURL)
+}
 
-	resp, err := s.client.Get(feedURL)
-	if err != nil {
-		return nil, fmt.Errorf("fetching feed: %w", err)
+// downloadFeed fetches a feed from upstream, revalidating the last copy when
+// there is one, and caches the result
+func (s *SubwayService) downloadFeed(ctx context.Context, feedName, feedURL string) (body []byte, err error) {
+	if err := s.allow(feedName); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
-	}
+	start := time.Now()
+	status := 0
+	defer func() {
+		s.record(ctx, feedName, err)
+		s.logFetch(ctx, "subway feed fetch", start, err,
+			slog.String("feed", feedName), slog.Int("status", status), slog.Int("bytes", len(body)))
+	}()
 
-	body, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("reading response: %w", err)
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	prev, revalidating := s.validator(feedName)
+	if revalidating {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching feed: %w", err)
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	if resp.StatusCode == http.StatusNotModified && revalidating {
+		// Unchanged upstream: the bytes we have are current again
+		body = prev.body
+	} else {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+		}
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+		s.setValidator(feedName, resp.Header, body)
 	}
 
+	s.markSuccess()
 	s.feedCache.Set(feedName, body)
 	return body, nil
 }
 
+// validator returns the conditional-request state saved for a feed, if any
+func (s *SubwayService) validator(feedName string) (feedValidator, bool) {
+	s.validatorsMu.Lock()
+	defer s.validatorsMu.Unlock()
+	v, ok := s.validators[feedName]
+	return v, ok
+}
+
+// setValidator remembers the ETag and Last-Modified a feed was served with.
+// Upstreams that send neither just get full fetches every time.
+func (s *SubwayService) setValidator(feedName string, header http.Header, body []byte) {
+	etag, lastModified := header.Get("ETag"), header.Get("Last-Modified")
+
+	s.validatorsMu.Lock()
+	defer s.validatorsMu.Unlock()
+	if etag == "" && lastModified == "" {
+		delete(s.validators, feedName)
+		return
+	}
+	if s.validators == nil {
+		s.validators = make(map[string]feedValidator)
+	}
+	s.validators[feedName] = feedValidator{etag: etag, lastModified: lastModified, body: body}
+}
+
+// parseArrivals returns the feed's upcoming arrivals, optionally only those
+// at stops whose IDs start with filterStopID
 func (s *SubwayService) parseArrivals(feed *gtfs.FeedMessage, filterStopID string) []Arrival {
-	var arrivals []Arrival
-	now := time.Now()
+	return s.upcoming(decodeArrivals(feed), filterStopID, "")
+}
+
+// decodeArrivals flattens a feed into one entry per timed stop, past ones
+// included. Times and countdowns are left for upcoming to fill in, so the
+// result stays valid for as long as the feed does.
+func decodeArrivals(feed *gtfs.FeedMessage) []decodedArrival {
+	var arrivals []decodedArrival
 
 	for _, entity := range feed.GetEntity() {
 		tripUpdate := entity.GetTripUpdate()
@@ -174,62 +578,108 @@ func (s *SubwayService) parseArrivals(feed *gtfs.FeedMessage, filterStopID strin
 			continue
 		}
 
-		routeID := tripUpdate.GetTrip().GetRouteId()
+		trip := tripUpdate.GetTrip()
+		routeID := trip.GetRouteId()
+		var nyct nyctTrip
+		if trip != nil {
+			nyct, _ = nyctTripOf(trip)
+		}
 		stopTimeUpdates := tripUpdate.GetStopTimeUpdate()
 
 		// The last StopTimeUpdate is the trip's terminus
 		terminusID := ""
 		if n := len(stopTimeUpdates); n > 0 {
 			lastID := stopTimeUpdates[n-1].GetStopId()
-			terminusID = strings.TrimRight(lastID, "NS")
+			terminusID = parentStopID(lastID)
 		}
 
-		for _, stopTimeUpdate := range stopTimeUpdates {
+		for i, stopTimeUpdate := range stopTimeUpdates {
 			stopID := stopTimeUpdate.GetStopId()
 
-			if filterStopID != "" && !strings.HasPrefix(stopID, filterStopID) {
-				continue
-			}
-
-			arrivalTime := stopTimeUpdate.GetArrival().GetTime()
-			if arrivalTime == 0 {
-				arrivalTime = stopTimeUpdate.GetDeparture().GetTime()
-			}
-			if arrivalTime == 0 {
+			arrivalAt := stopTimeUpdate.GetArrival().GetTime()
+			departureAt := stopTimeUpdate.GetDeparture().GetTime()
+			if arrivalAt == 0 && departureAt == 0 {
 				continue
 			}
 
-			arrTime := time.Unix(arrivalTime, 0)
-			if arrTime.Before(now) {
-				continue
+			// The NYCT extension says which way the train runs; without it,
+			// go by the platform's N/S suffix
+			direction := nyct.direction
+			if direction == "" {
+				direction = "unknown"
+				if strings.HasSuffix(stopID, "N") {
+					direction = "northbound"
+				} else if strings.HasSuffix(stopID, "S") {
+					direction = "southbound"
+				}
 			}
+			tracks, _ := nyctStopTimeOf(stopTimeUpdate)
+
+			color, textColor := colorsFor(routeID)
+			arrivals = append(arrivals, decodedArrival{Arrival: Arrival{
+				Route:          routeID,
+				StopID:         stopID,
+				Direction:      direction,
+				Destination:    terminusID,
+				DestinationID:  terminusID,
+				TripID:         trip.GetTripId(),
+				StartDate:      trip.GetStartDate(),
+				StartTime:      trip.GetStartTime(),
+				TrainID:        nyct.trainID,
+				ScheduledTrack: tracks.scheduledTrack,
+				ActualTrack:    tracks.actualTrack,
+				RouteColor:     color,
+				RouteTextColor: textColor,
+			}, arrivalAt: arrivalAt, departureAt: departureAt, origin: i == 0})
+		}
+	}
 
-			direction := "unknown"
-			if strings.HasSuffix(stopID, "N") {
-				direction = "northbound"
-			} else if strings.HasSuffix(stopID, "S") {
-				direction = "southbound"
-			}
+	return arrivals
+}
 
-			arrivals = append(arrivals, Arrival{
-				Route:       routeID,
-				StopID:      stopID,
-				Direction:   direction,
-				ArrivalTime: arrTime,
-				MinutesAway: int(arrTime.Sub(now).Minutes()),
-				Destination: terminusID,
-			})
+// upcoming copies out the decoded arrivals that haven't happened yet, timed
+// by source (the service default if empty), with MinutesAway and Status
+// worked out as of now
+func (s *SubwayService) upcoming(decoded []decodedArrival, filterStopID, source string) []Arrival {
+	if !ValidTimeSource(source) {
+		source = s.timeSource
+	}
+	var arrivals []Arrival
+	now := s.now()
+	for _, d := range decoded {
+		if filterStopID != "" && !strings.HasPrefix(d.StopID, filterStopID) {
+			continue
+		}
+		at, used := d.stopTime(source)
+		stopTime := time.Unix(at, 0)
+		if stopTime.Before(now) {
+			continue
 		}
+		arr := d.Arrival
+		arr.ArrivalTime = inNYC(stopTime)
+		arr.ArrivalLocal = formatLocal(stopTime)
+		arr.TimeSource = used
+		arr.MinutesAway, arr.Status = countdown(stopTime, now)
+		arrivals = append(arrivals, arr)
 	}
-
 	return arrivals
 }
 
+// parentStopID strips a single trailing direction suffix from a platform ID.
+// Staten Island Railway stops are themselves prefixed with "S" (S31N is the
+// northbound platform at St George), so only the last character is considered.
+func parentStopID(stopID string) string {
+	if len(stopID) > 1 && (strings.HasSuffix(stopID, "N") || strings.HasSuffix(stopID, "S")) {
+		return stopID[:len(stopID)-1]
+	}
+	return stopID
+}
+
 func (s *SubwayService) getFeedsForRoutes(routes []string) []string {
 	if len(routes) == 0 {
 		// Return all feeds
-		feeds := make([]string, 0, len(feedURLs))
-		for name := range feedURLs {
+		feeds := make([]string, 0, len(s.feedURLs))
+		for name := range s.feedURLs {
 			feeds = append(feeds, name)
 		}
 		return feeds
@@ -252,10 +702,13 @@ func sortArrivals(arrivals []Arrival) {
 	})
 }
 
-const (
-	defaultSubwayRadius = 800 // meters (~0.5 mile)
-	maxSubwayStops      = 5
-)
+// MaxSubwayStops is the default cap on how many stations a nearby search or a
+// stops= query looks up; SUBWAY_MAX_STATIONS can change it
+const MaxSubwayStops = 5
+
+// MaxBulkStations caps how many stations GetArrivalsForStations looks up, as
+// used by the bulk POST endpoint
+const MaxBulkStations = 25
 
 // SubwayStop represents a subway station with optional distance info
 type SubwayStop struct {
@@ -265,6 +718,7 @@ type SubwayStop struct {
 	Lng            float64 `json:"lng"`
 	DistanceMeters float64 `json:"distance_meters,omitempty"`
 	DistanceMiles  float64 `json:"distance_miles,omitempty"`
+	Direction      string  `json:"direction,omitempty"`
 }
 
 // StationArrivals contains arrivals for a single station
@@ -275,34 +729,52 @@ type StationArrivals struct {
 	Lng            float64   `json:"stop_lon,omitempty"`
 	DistanceMeters float64   `json:"distance_meters,omitempty"`
 	DistanceMiles  float64   `json:"distance_miles,omitempty"`
+	Direction      string    `json:"direction,omitempty"`
+	WalkMinutes    int       `json:"walk_minutes,omitempty"` // set by ?catchable=true
 	Northbound     []Arrival `json:"northbound"`
 	Southbound     []Arrival `json:"southbound"`
 }
 
 // GetArrivalsForStations fetches arrivals for multiple stations
-func (s *SubwayService) GetArrivalsForStations(stopIDs []string) ([]StationArrivals, error) {
+func (s *SubwayService) GetArrivalsForStations(ctx context.Context, stopIDs []string, opts ArrivalOptions) ([]StationArrivals, error) {
 	if len(stopIDs) == 0 {
 		return nil, nil
 	}
 
 	// Limit number of stations to query
-	if len(stopIDs) > maxSubwayStops {
-		stopIDs = stopIDs[:maxSubwayStops]
+	if len(stopIDs) > MaxBulkStations {
+		stopIDs = stopIDs[:MaxBulkStations]
 	}
 
-	// Create a set of stop IDs we care about (both N and S directions)
+	// Create a set of stop IDs we care about (both N and S directions of
+	// every platform under each station)
+	stationBases := make([][]string, len(stopIDs))
 	stopSet := make(map[string]bool)
-	for _, id := range stopIDs {
-		stopSet[id+"N"] = true
-		stopSet[id+"S"] = true
+	for i, id := range stopIDs {
+		stationBases[i] = s.platformBases(id)
+		for _, merged := range opts.MergedStations[id] {
+			for _, base := range s.platformBases(merged) {
+				if !slices.Contains(stationBases[i], base) {
+					stationBases[i] = append(stationBases[i], base)
+				}
+			}
+		}
+		for _, base := range stationBases[i] {
+			stopSet[base+"N"] = true
+			stopSet[base+"S"] = true
+		}
 	}
 
 	// Fetch all feeds to get comprehensive coverage
 	allArrivals := make(map[string][]Arrival) // stopID -> arrivals
 
-	for feedName := range feedURLs {
-		arrivals, err := s.fetchFeed(feedName, "")
+	for feedName := range s.feedURLs {
+		arrivals, err := s.fetchFeed(ctx, feedName, "", opts.TimeSource)
 		if err != nil {
+			// Skip failed feeds, but stop early if the caller gave up
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			continue
 		}
 
@@ -315,30 +787,110 @@ func (s *SubwayService) GetArrivalsForStations(stopIDs []string) ([]StationArriv
 
 	// Organize arrivals by station
 	var results []StationArrivals
-	for _, stopID := range stopIDs {
-		northID := stopID + "N"
-		southID := stopID + "S"
-
-		northArrivals := allArrivals[northID]
-		southArrivals := allArrivals[southID]
+	for i, stopID := range stopIDs {
+		var northArrivals, southArrivals []Arrival
+		for _, base := range stationBases[i] {
+			northArrivals = append(northArrivals, allArrivals[base+"N"]...)
+			southArrivals = append(southArrivals, allArrivals[base+"S"]...)
+		}
 
 		sortArrivals(northArrivals)
 		sortArrivals(southArrivals)
 
-		// Limit to 5 arrivals per direction
-		if len(northArrivals) > 5 {
-			northArrivals = northArrivals[:5]
-		}
-		if len(southArrivals) > 5 {
-			southArrivals = southArrivals[:5]
-		}
-
 		results = append(results, StationArrivals{
 			StopID:     stopID,
-			Northbound: northArrivals,
-			Southbound: southArrivals,
+			Northbound: opts.truncate(northArrivals),
+			Southbound: opts.truncate(southArrivals),
 		})
 	}
 
 	return results, nil
 }
+
+// Limits on how many stations GetArrivalsForRoute returns
+const (
+	DefaultRouteStops = 25
+	MaxRouteStops     = 100
+)
+
+// ErrUnknownRoute is returned when a route isn't one of the known subway lines
+var ErrUnknownRoute = errors.New("unknown route")
+
+// GetArrivalsForRoute returns upcoming arrivals for a single line across the
+// whole system, grouped by station. Only the route's own feed is fetched.
+// Stations are ordered by their soonest train and capped at stopLimit; opts
+// trims each station's arrivals per direction. Express variants count as the
+// base route, so "6" includes 6X trains.
+func (s *SubwayService) GetArrivalsForRoute(ctx context.Context, route string, stopLimit int, opts ArrivalOptions) ([]StationArrivals, error) {
+	route = normalizeRouteID(route, false)
+	if _, ok := routeToFeed[route]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRoute, route)
+	}
+	if stopLimit <= 0 || stopLimit > MaxRouteStops {
+		stopLimit = MaxRouteStops
+	}
+	base := normalizeRouteID(route, true)
+
+	byStation := make(map[string]*StationArrivals)
+	var order []string
+	for _, feedName := range s.getFeedsForRoutes([]string{route}) {
+		arrivals, err := s.fetchFeed(ctx, feedName, "", opts.TimeSource)
+		if err != nil {
+			return nil, err
+		}
+		for _, arr := range arrivals {
+			if normalizeRouteID(arr.Route, true) != base {
+				continue
+			}
+			stopID := parentStopID(arr.StopID)
+			station, ok := byStation[stopID]
+			if !ok {
+				station = &StationArrivals{StopID: stopID}
+				byStation[stopID] = station
+				order = append(order, stopID)
+			}
+			switch arr.Direction {
+			case "northbound":
+				station.Northbound = append(station.Northbound, arr)
+			case "southbound":
+				station.Southbound = append(station.Southbound, arr)
+			}
+		}
+	}
+
+	results := make([]StationArrivals, 0, len(order))
+	for _, stopID := range order {
+		station := byStation[stopID]
+		sortArrivals(station.Northbound)
+		sortArrivals(station.Southbound)
+		station.Northbound = opts.truncate(station.Northbound)
+		station.Southbound = opts.truncate(station.Southbound)
+		if len(station.Northbound) == 0 && len(station.Southbound) == 0 {
+			continue
+		}
+		results = append(results, *station)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return soonestArrival(results[i]).Before(soonestArrival(results[j]))
+	})
+	if len(results) > stopLimit {
+		results = results[:stopLimit]
+	}
+	return results, nil
+}
+
+// soonestArrival returns the earliest arrival time at a station in either
+// direction; both lists must already be sorted and at least one non-empty
+func soonestArrival(s StationArrivals) time.Time {
+	switch {
+	case len(s.Northbound) == 0:
+		return s.Southbound[0].ArrivalTime
+	case len(s.Southbound) == 0:
+		return s.Northbound[0].ArrivalTime
+	case s.Southbound[0].ArrivalTime.Before(s.Northbound[0].ArrivalTime):
+		return s.Southbound[0].ArrivalTime
+	default:
+		return s.Northbound[0].ArrivalTime
+	}
+}
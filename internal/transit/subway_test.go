@@ -0,0 +1,863 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
+	"github.com/randytsao24/emteeayy/internal/location"
+	"google.golang.org/protobuf/proto"
+)
+
+func arrivalsFor(n int) []Arrival {
+	arrivals := make([]Arrival, n)
+	for i := range arrivals {
+		arrivals[i] = Arrival{Route: "A", ArrivalTime: time.Now().Add(time.Duration(i) * time.Minute)}
+	}
+	return arrivals
+}
+
+func TestArrivalOptionsTruncate(t *testing.T) {
+	tests := []struct {
+		name         string
+		perDirection int
+		available    int
+		want         int
+	}{
+		{"default", 0, 30, DefaultArrivalsPerDirection},
+		{"negative uses default", -1, 30, DefaultArrivalsPerDirection},
+		{"explicit", 2, 30, 2},
+		{"clamped", 1000, 30, MaxArrivalsPerDirection},
+		{"fewer than limit", 10, 3, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ArrivalOptions{PerDirection: tc.perDirection}
+			if got := len(opts.truncate(arrivalsFor(tc.available))); got != tc.want {
+				t.Errorf("truncate returned %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestArrivalOptionsMinMinutes(t *testing.T) {
+	arrivals := make([]Arrival, 10)
+	for i := range arrivals {
+		arrivals[i] = Arrival{Route: "A", MinutesAway: i}
+	}
+
+	// Filtering happens before the cap, so the limit still fills up
+	got := ArrivalOptions{PerDirection: 3, MinMinutes: 4}.truncate(arrivals)
+	if len(got) != 3 {
+		t.Fatalf("got %d arrivals, want 3", len(got))
+	}
+	for i, arr := range got {
+		if want := 4 + i; arr.MinutesAway != want {
+			t.Errorf("arrival %d is %d minutes away, want %d", i, arr.MinutesAway, want)
+		}
+	}
+}
+
+// testStop is a single stop time update in a crafted GTFS-RT feed
+type testStop struct {
+	stopID  string
+	arrival time.Time
+}
+
+// buildFeed crafts a GTFS-RT feed with one trip per route, each visiting stops in order
+func buildFeed(trips map[string][]testStop) *gtfs.FeedMessage {
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+	}
+	for route, stops := range trips {
+		var updates []*gtfs.TripUpdate_StopTimeUpdate
+		for _, st := range stops {
+			updates = append(updates, &gtfs.TripUpdate_StopTimeUpdate{
+				StopId:  proto.String(st.stopID),
+				Arrival: &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(st.arrival.Unix())},
+			})
+		}
+		feed.Entity = append(feed.Entity, &gtfs.FeedEntity{
+			Id: proto.String("trip-" + route),
+			TripUpdate: &gtfs.TripUpdate{
+				Trip:           &gtfs.TripDescriptor{RouteId: proto.String(route)},
+				StopTimeUpdate: updates,
+			},
+		})
+	}
+	return feed
+}
+
+func TestCountdown(t *testing.T) {
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		minutes int
+		status  string
+	}{
+		{"exactly now", 0, 0, StatusDue},
+		{"29 seconds", 29 * time.Second, 0, StatusDue},
+		{"50 seconds", 50 * time.Second, 1, StatusApproaching},
+		{"89 seconds", 89 * time.Second, 1, StatusApproaching},
+		{"91 seconds", 91 * time.Second, 2, StatusTimed},
+		{"5 minutes", 5 * time.Minute, 5, StatusTimed},
+		{"4m40s rounds up", 4*time.Minute + 40*time.Second, 5, StatusTimed},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			minutes, status := countdown(now.Add(tc.offset), now)
+			if minutes != tc.minutes || status != tc.status {
+				t.Errorf("countdown(+%v) = (%d, %q), want (%d, %q)", tc.offset, minutes, status, tc.minutes, tc.status)
+			}
+		})
+	}
+}
+
+func TestParseArrivalsFiltersPastAndLabels(t *testing.T) {
+	now := time.Now()
+	feed := buildFeed(map[string][]testStop{
+		"A": {
+			{"A27N", now.Add(-2 * time.Minute)},
+			{"A28N", now.Add(50 * time.Second)},
+			{"A30N", now.Add(10 * time.Minute)},
+		},
+	})
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	arrivals := svc.parseArrivals(feed, "")
+
+	if len(arrivals) != 2 {
+		t.Fatalf("got %d arrivals, want 2 (past arrival filtered): %+v", len(arrivals), arrivals)
+	}
+	for _, a := range arrivals {
+		if a.StopID == "A27N" {
+			t.Error("past arrival should be filtered")
+		}
+		if a.MinutesAway < 0 {
+			t.Errorf("negative MinutesAway for %s", a.StopID)
+		}
+	}
+	if arrivals[0].Status != StatusApproaching || arrivals[0].MinutesAway != 1 {
+		t.Errorf("50s arrival = (%d, %q), want (1, approaching)", arrivals[0].MinutesAway, arrivals[0].Status)
+	}
+	if arrivals[1].Status != StatusTimed {
+		t.Errorf("10m arrival status = %q, want timed", arrivals[1].Status)
+	}
+}
+
+func TestParseArrivalsRouteColors(t *testing.T) {
+	soon := time.Now().Add(5 * time.Minute)
+	feed := buildFeed(map[string][]testStop{
+		"A":  {{"A27N", soon}},
+		"N":  {{"R16N", soon}},
+		"6X": {{"626N", soon}},
+		"GS": {{"901N", soon}},
+		"QQ": {{"Q01N", soon}},
+	})
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	byRoute := make(map[string]Arrival)
+	for _, a := range svc.parseArrivals(feed, "") {
+		byRoute[a.Route] = a
+	}
+
+	tests := []struct {
+		route, color, text string
+	}{
+		{"A", "#0039A6", "#FFFFFF"},
+		{"N", "#FCCC0A", "#000000"},
+		{"6X", "#00933C", "#FFFFFF"}, // express variant uses the base route
+		{"GS", "#808183", "#FFFFFF"},
+		{"QQ", "", ""}, // unknown route
+	}
+	for _, tc := range tests {
+		a, ok := byRoute[tc.route]
+		if !ok {
+			t.Errorf("no arrival for route %s", tc.route)
+			continue
+		}
+		if a.RouteColor != tc.color || a.RouteTextColor != tc.text {
+			t.Errorf("route %s colors = (%q, %q), want (%q, %q)", tc.route, a.RouteColor, a.RouteTextColor, tc.color, tc.text)
+		}
+	}
+}
+
+func TestGetFeedBytes(t *testing.T) {
+	body := emptyFeedBytes(t)
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL}
+
+	for i := 0; i < 3; i++ {
+		got, err := svc.GetFeedBytes(context.Background(), "ace")
+		if err != nil {
+			t.Fatalf("GetFeedBytes: %v", err)
+		}
+		if !bytes.Equal(got, body) {
+			t.Fatal("returned bytes differ from upstream")
+		}
+	}
+	if hits != 1 {
+		t.Errorf("upstream hit %d times, want 1 (cached)", hits)
+	}
+
+	if _, err := svc.GetFeedBytes(context.Background(), "nope"); !errors.Is(err, ErrUnknownFeed) {
+		t.Errorf("unknown feed error = %v, want ErrUnknownFeed", err)
+	}
+}
+
+func TestParentStopID(t *testing.T) {
+	tests := map[string]string{
+		"A15N": "A15",
+		"127S": "127",
+		"S31N": "S31",
+		"S09S": "S09",
+		"S31":  "S31",
+		"S":    "S",
+	}
+	for in, want := range tests {
+		if got := parentStopID(in); got != want {
+			t.Errorf("parentStopID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestStatenIslandRailwayArrivals(t *testing.T) {
+	now := time.Now()
+	north := buildFeed(map[string][]testStop{
+		"SI": {{"S19N", now.Add(3 * time.Minute)}, {"S31N", now.Add(25 * time.Minute)}},
+	})
+	south := buildFeed(map[string][]testStop{
+		"SI": {{"S19S", now.Add(6 * time.Minute)}, {"S09S", now.Add(20 * time.Minute)}},
+	})
+	south.Entity[0].Id = proto.String("trip-SI-south")
+	north.Entity = append(north.Entity, south.Entity...)
+
+	body, err := proto.Marshal(north)
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"si": srv.URL}
+
+	// Great Kills, mid-line on the SIR
+	arrivals, err := svc.GetArrivalsForStation(context.Background(), "S19", ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+
+	northbound, southbound := arrivals["northbound"], arrivals["southbound"]
+	if len(northbound) != 1 || len(southbound) != 1 {
+		t.Fatalf("got %d northbound, %d southbound arrivals, want 1 each", len(northbound), len(southbound))
+	}
+	if got := northbound[0]; got.Route != "SI" || got.Direction != "northbound" || got.Destination != "S31" || got.DestinationID != "S31" {
+		t.Errorf("northbound arrival = %+v, want SI toward S31", got)
+	}
+	if got := southbound[0]; got.Route != "SI" || got.Direction != "southbound" || got.Destination != "S09" || got.DestinationID != "S09" {
+		t.Errorf("southbound arrival = %+v, want SI toward S09", got)
+	}
+
+	if feeds := svc.getFeedsForRoutes([]string{"SI"}); len(feeds) != 1 || feeds[0] != "si" {
+		t.Errorf("getFeedsForRoutes(SI) = %v, want [si]", feeds)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	routes := Routes()
+
+	byID := make(map[string]Route, len(routes))
+	for _, r := range routes {
+		if r.Color == "" || r.Feed == "" {
+			t.Errorf("route %s missing color or feed: %+v", r.ID, r)
+		}
+		if _, ok := feedURLs[r.Feed]; !ok {
+			t.Errorf("route %s grouped under unknown feed %q", r.ID, r.Feed)
+		}
+		byID[r.ID] = r
+	}
+
+	if a := byID["A"]; a.Color != "#0039A6" || a.TextColor != "#FFFFFF" || a.Feed != "ace" {
+		t.Errorf("A = %+v, want blue #0039A6 with white text in ace", a)
+	}
+	if seven := byID["7"]; seven.Color != "#B933AD" || seven.Feed != "1234567" {
+		t.Errorf("7 = %+v, want purple #B933AD in 1234567", seven)
+	}
+	if _, ok := byID["SIR"]; ok {
+		t.Error("alias SIR should not be listed as a separate route")
+	}
+
+	// Every route the feed mapping knows about is listed, aliases aside
+	for id := range routeToFeed {
+		if _, ok := byID[id]; !ok && id != "SIR" {
+			t.Errorf("route %s is in routeToFeed but not in Routes()", id)
+		}
+	}
+}
+
+func TestFeedCachePersistence(t *testing.T) {
+	feedBytes := []byte("gtfs-rt bytes")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(feedBytes)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "feeds.gob.gz")
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL}
+	if _, err := svc.GetFeedBytes(context.Background(), "ace"); err != nil {
+		t.Fatalf("GetFeedBytes: %v", err)
+	}
+	if err := svc.SaveFeedCache(path); err != nil {
+		t.Fatalf("SaveFeedCache: %v", err)
+	}
+
+	// A fresh service whose upstream is gone serves the feed from disk
+	srv.Close()
+	restarted := NewSubwayService(testClient(), time.Minute)
+	restarted.feedURLs = map[string]string{"ace": srv.URL}
+	if n, err := restarted.LoadFeedCache(path); err != nil || n != 1 {
+		t.Fatalf("LoadFeedCache = (%d, %v), want (1, nil)", n, err)
+	}
+	got, err := restarted.GetFeedBytes(context.Background(), "ace")
+	if err != nil {
+		t.Fatalf("GetFeedBytes after restore: %v", err)
+	}
+	if !bytes.Equal(got, feedBytes) {
+		t.Errorf("restored feed = %q, want %q", got, feedBytes)
+	}
+}
+
+func TestGetArrivalsForRoute(t *testing.T) {
+	now := time.Now()
+	feed := buildFeed(map[string][]testStop{
+		"L": {{"L08N", now.Add(6 * time.Minute)}, {"L06N", now.Add(9 * time.Minute)}},
+		"G": {{"G29N", now.Add(time.Minute)}},
+	})
+	south := buildFeed(map[string][]testStop{
+		"L": {{"L06S", now.Add(2 * time.Minute)}, {"L08S", now.Add(4 * time.Minute)}},
+	})
+	feed.Entity = append(feed.Entity, south.Entity...)
+	body, err := proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+
+	var otherHits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/l" {
+			otherHits.Add(1)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"l": srv.URL + "/l", "g": srv.URL + "/g", "ace": srv.URL + "/ace"}
+
+	stations, err := svc.GetArrivalsForRoute(context.Background(), "l", 0, ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForRoute: %v", err)
+	}
+	if otherHits.Load() != 0 {
+		t.Errorf("fetched %d feeds besides the L's", otherHits.Load())
+	}
+
+	// L06 has the soonest train (southbound in 2 min), so it comes first
+	if len(stations) != 2 || stations[0].StopID != "L06" || stations[1].StopID != "L08" {
+		t.Fatalf("stations = %+v, want L06 then L08", stations)
+	}
+	for _, st := range stations {
+		if len(st.Northbound) != 1 || len(st.Southbound) != 1 {
+			t.Errorf("%s: got %d north / %d south, want 1 / 1", st.StopID, len(st.Northbound), len(st.Southbound))
+		}
+		for _, arr := range append(st.Northbound, st.Southbound...) {
+			if arr.Route != "L" {
+				t.Errorf("%s: unexpected %s arrival", st.StopID, arr.Route)
+			}
+		}
+	}
+
+	limited, err := svc.GetArrivalsForRoute(context.Background(), "L", 1, ArrivalOptions{})
+	if err != nil || len(limited) != 1 || limited[0].StopID != "L06" {
+		t.Errorf("stop limit 1 = %+v, %v; want just L06", limited, err)
+	}
+
+	if _, err := svc.GetArrivalsForRoute(context.Background(), "K", 0, ArrivalOptions{}); !errors.Is(err, ErrUnknownRoute) {
+		t.Errorf("unknown route err = %v, want ErrUnknownRoute", err)
+	}
+}
+
+func TestOverrideRouteFeeds(t *testing.T) {
+	saved := maps.Clone(routeToFeed)
+	t.Cleanup(func() { routeToFeed = saved })
+
+	if err := OverrideRouteFeeds(map[string]string{"w": "BDFM", "H": "ace"}); err != nil {
+		t.Fatalf("OverrideRouteFeeds: %v", err)
+	}
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	if feeds := svc.getFeedsForRoutes([]string{"W", "N"}); !slices.Equal(feeds, []string{"bdfm", "nqrw"}) {
+		t.Errorf("getFeedsForRoutes(W, N) = %v, want [bdfm nqrw]", feeds)
+	}
+	if feeds := svc.getFeedsForRoutes([]string{"h"}); !slices.Equal(feeds, []string{"ace"}) {
+		t.Errorf("getFeedsForRoutes(h) = %v, want [ace]", feeds)
+	}
+	for _, r := range Routes() {
+		if r.ID == "W" && r.Feed != "bdfm" {
+			t.Errorf("Routes() lists W in %q, want bdfm", r.Feed)
+		}
+	}
+
+	// An unknown feed rejects the whole set
+	err := OverrideRouteFeeds(map[string]string{"N": "bdfm", "Q": "nope"})
+	if !errors.Is(err, ErrUnknownFeed) {
+		t.Errorf("unknown feed error = %v, want ErrUnknownFeed", err)
+	}
+	if routeToFeed["N"] != "nqrw" {
+		t.Errorf("N moved to %q by a rejected override set", routeToFeed["N"])
+	}
+}
+
+func TestParseArrivalsTripDescriptor(t *testing.T) {
+	now := time.Now()
+	feed := buildFeed(map[string][]testStop{
+		"A": {{"A27N", now.Add(3 * time.Minute)}},
+		"C": {{"A27N", now.Add(5 * time.Minute)}},
+	})
+	for _, entity := range feed.Entity {
+		if entity.GetTripUpdate().GetTrip().GetRouteId() == "A" {
+			trip := entity.TripUpdate.Trip
+			trip.TripId = proto.String("043150_A..N55R")
+			trip.StartDate = proto.String("20260301")
+			trip.StartTime = proto.String("07:11:30")
+		}
+	}
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	arrivals := svc.parseArrivals(feed, "")
+	if len(arrivals) != 2 {
+		t.Fatalf("got %d arrivals, want 2", len(arrivals))
+	}
+	for _, a := range arrivals {
+		switch a.Route {
+		case "A":
+			if a.TripID != "043150_A..N55R" || a.StartDate != "20260301" || a.StartTime != "07:11:30" {
+				t.Errorf("A trip = (%q, %q, %q), want the feed's descriptor", a.TripID, a.StartDate, a.StartTime)
+			}
+		case "C":
+			if a.TripID != "" || a.StartDate != "" || a.StartTime != "" {
+				t.Errorf("C trip without a descriptor = (%q, %q, %q), want empty", a.TripID, a.StartDate, a.StartTime)
+			}
+		}
+	}
+}
+
+func TestArrivalTimeSource(t *testing.T) {
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *gtfs.TripUpdate_StopTimeEvent {
+		return &gtfs.TripUpdate_StopTimeEvent{Time: proto.Int64(now.Add(d).Unix())}
+	}
+	// A trip whose first stop only departs, a stop with both times, and a
+	// last stop that only arrives
+	feed := &gtfs.FeedMessage{
+		Header: &gtfs.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfs.FeedEntity{{
+			Id: proto.String("trip-A"),
+			TripUpdate: &gtfs.TripUpdate{
+				Trip: &gtfs.TripDescriptor{RouteId: proto.String("A")},
+				StopTimeUpdate: []*gtfs.TripUpdate_StopTimeUpdate{
+					{StopId: proto.String("A27N"), Departure: at(2 * time.Minute)},
+					{StopId: proto.String("A28N"), Arrival: at(5 * time.Minute), Departure: at(6 * time.Minute)},
+					{StopId: proto.String("A30N"), Arrival: at(9 * time.Minute)},
+				},
+			},
+		}},
+	}
+
+	type want struct {
+		minutes int
+		source  string
+	}
+	tests := []struct {
+		source string
+		want   map[string]want
+	}{
+		{TimeSourceArrival, map[string]want{
+			"A27N": {2, TimeSourceDeparture},
+			"A28N": {5, TimeSourceArrival},
+			"A30N": {9, TimeSourceArrival},
+		}},
+		{TimeSourceDeparture, map[string]want{
+			"A27N": {2, TimeSourceDeparture},
+			"A28N": {6, TimeSourceDeparture},
+			"A30N": {9, TimeSourceArrival},
+		}},
+		{TimeSourceAuto, map[string]want{
+			"A27N": {2, TimeSourceDeparture},
+			"A28N": {5, TimeSourceArrival},
+			"A30N": {9, TimeSourceArrival},
+		}},
+	}
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.SetClock(NewFakeClock(now))
+	for _, tc := range tests {
+		t.Run(tc.source, func(t *testing.T) {
+			arrivals := svc.upcoming(decodeArrivals(feed), "", tc.source)
+			if len(arrivals) != len(tc.want) {
+				t.Fatalf("got %d arrivals, want %d", len(arrivals), len(tc.want))
+			}
+			for _, a := range arrivals {
+				w := tc.want[a.StopID]
+				if a.MinutesAway != w.minutes || a.TimeSource != w.source {
+					t.Errorf("%s = (%d min, %q), want (%d min, %q)", a.StopID, a.MinutesAway, a.TimeSource, w.minutes, w.source)
+				}
+				if !a.ArrivalTime.Equal(now.Add(time.Duration(w.minutes) * time.Minute)) {
+					t.Errorf("%s time = %v, want %d minutes out", a.StopID, a.ArrivalTime, w.minutes)
+				}
+			}
+		})
+	}
+
+	// Auto prefers the departure at a first stop that has both
+	feed.Entity[0].TripUpdate.StopTimeUpdate[0].Arrival = at(time.Minute)
+	if got := svc.upcoming(decodeArrivals(feed), "A27N", TimeSourceAuto); len(got) != 1 || got[0].TimeSource != TimeSourceDeparture {
+		t.Errorf("auto at the origin = %+v, want its departure", got)
+	}
+
+	// An empty or unknown source falls back to the service default
+	svc.SetTimeSource(TimeSourceDeparture)
+	for _, source := range []string{"", "bogus"} {
+		if got := svc.upcoming(decodeArrivals(feed), "A28N", source); len(got) != 1 || got[0].TimeSource != TimeSourceDeparture {
+			t.Errorf("source %q = %+v, want the departure default", source, got)
+		}
+	}
+}
+
+func TestParseArrivalsUsesClock(t *testing.T) {
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	feed := buildFeed(map[string][]testStop{
+		"A": {
+			{"A27N", now.Add(-time.Second)},
+			{"A28N", now},
+			{"A30N", now.Add(91 * time.Second)},
+		},
+	})
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	clock := NewFakeClock(now)
+	svc.SetClock(clock)
+
+	arrivals := svc.parseArrivals(feed, "")
+	if len(arrivals) != 2 || arrivals[0].StopID != "A28N" || arrivals[1].StopID != "A30N" {
+		t.Fatalf("arrivals = %+v, want A28N and A30N (one second ago is past)", arrivals)
+	}
+	if arrivals[0].Status != StatusDue || arrivals[1].MinutesAway != 2 {
+		t.Errorf("got (%q, %d min), want (due, 2 min)", arrivals[0].Status, arrivals[1].MinutesAway)
+	}
+
+	clock.Advance(2 * time.Second)
+	arrivals = svc.parseArrivals(feed, "")
+	if len(arrivals) != 1 || arrivals[0].StopID != "A30N" || arrivals[0].Status != StatusApproaching {
+		t.Errorf("two seconds later = %+v, want only A30N, approaching", arrivals)
+	}
+}
+
+func TestSubwayFlushCache(t *testing.T) {
+	body := emptyFeedBytes(t)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL, "g": srv.URL}
+	for _, feed := range []string{"ace", "g"} {
+		if _, err := svc.GetFeedBytes(context.Background(), feed); err != nil {
+			t.Fatalf("GetFeedBytes(%s): %v", feed, err)
+		}
+	}
+
+	if n := svc.FlushCache(); n != 2 {
+		t.Errorf("FlushCache cleared %d feeds, want 2", n)
+	}
+	svc.GetFeedBytes(context.Background(), "ace")
+	if hits.Load() != 3 {
+		t.Errorf("upstream hit %d times, want 3 (refetch after flush)", hits.Load())
+	}
+}
+
+func TestFeedRevalidatedWithConditionalRequest(t *testing.T) {
+	body := emptyFeedBytes(t)
+	const etag = `"v1"`
+	var full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/etag":
+			if r.Header.Get("If-None-Match") == etag {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+		case "/modified":
+			if r.Header.Get("If-Modified-Since") != "" {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", "Thu, 15 Oct 2026 12:00:00 GMT")
+		default:
+			if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+				t.Error("conditional request sent to an upstream without validators")
+			}
+		}
+		full.Add(1)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{"ace": srv.URL + "/etag", "g": srv.URL + "/modified", "l": srv.URL + "/plain"}
+
+	for _, feed := range []string{"ace", "g", "l"} {
+		for i := 0; i < 2; i++ {
+			svc.feedCache.Delete(feed) // expired
+			got, err := svc.GetFeedBytes(context.Background(), feed)
+			if err != nil {
+				t.Fatalf("%s fetch %d: %v", feed, i+1, err)
+			}
+			if !bytes.Equal(got, body) {
+				t.Fatalf("%s fetch %d: bytes differ from upstream", feed, i+1)
+			}
+		}
+		if _, ok := svc.feedCache.Get(feed); !ok {
+			t.Errorf("%s not cached after revalidation", feed)
+		}
+	}
+
+	// ace and g download once then revalidate; l downloads every time
+	if full.Load() != 4 || notModified.Load() != 2 {
+		t.Errorf("full downloads = %d, 304s = %d; want 4 and 2", full.Load(), notModified.Load())
+	}
+
+	// A flush forgets validators, so the next fetch is a full download
+	svc.FlushCache()
+	svc.GetFeedBytes(context.Background(), "ace")
+	if full.Load() != 5 {
+		t.Errorf("full downloads after flush = %d, want 5", full.Load())
+	}
+}
+
+// countParses returns how many feed parses were logged
+func countParses(records []map[string]any) int {
+	n := 0
+	for _, rec := range records {
+		if rec["msg"] == "subway feed parse" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDecodedFeedReusedAcrossLookups(t *testing.T) {
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	body, err := proto.Marshal(buildFeed(map[string][]testStop{
+		"A": {{"A27N", now.Add(3 * time.Minute)}, {"A28N", now.Add(5 * time.Minute)}, {"A30N", now.Add(8 * time.Minute)}},
+	}))
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	logger, records := captureLogs(t)
+	clock := NewFakeClock(now)
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.SetLogger(logger)
+	svc.SetClock(clock)
+	svc.feedURLs = map[string]string{"ace": srv.URL}
+
+	// No feed memo: each lookup stands for a separate request
+	for _, stopID := range []string{"A27", "A28", "A30"} {
+		if _, err := svc.GetArrivalsForStation(context.Background(), stopID, ArrivalOptions{}); err != nil {
+			t.Fatalf("GetArrivalsForStation(%s): %v", stopID, err)
+		}
+	}
+	if _, err := svc.GetArrivals(context.Background(), "A28", nil); err != nil {
+		t.Fatalf("GetArrivals: %v", err)
+	}
+	if n := countParses(records()); n != 1 {
+		t.Errorf("feed parsed %d times for four lookups, want 1", n)
+	}
+
+	// Countdowns follow the clock, not the time of the parse
+	clock.Advance(4 * time.Minute)
+	station, err := svc.GetArrivalsForStation(context.Background(), "A28", ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStation: %v", err)
+	}
+	if got := station["northbound"]; len(got) != 1 || got[0].MinutesAway != 1 || got[0].Status != StatusApproaching {
+		t.Errorf("A28 four minutes later = %+v, want 1 min, approaching", got)
+	}
+	station, _ = svc.GetArrivalsForStation(context.Background(), "A27", ArrivalOptions{})
+	if got := station["northbound"]; len(got) != 0 {
+		t.Errorf("A27 after its train left = %+v, want none", got)
+	}
+
+	// A new download is parsed again
+	svc.feedCache.Clear()
+	svc.GetArrivalsForStation(context.Background(), "A27", ArrivalOptions{})
+	if n := countParses(records()); n != 2 {
+		t.Errorf("parses after refetch = %d, want 2", n)
+	}
+}
+
+func TestGetArrivalsForStationsComplexPlatforms(t *testing.T) {
+	// In the shipped stops.txt 14 St-Union Sq is two parent stations: 635
+	// (4/5/6, platforms 635N/635S) and L03 (L, platforms L03N/L03S). Only the
+	// complexes file ties them together. Only an L train is coming.
+	complexes := filepath.Join(t.TempDir(), "complexes.csv")
+	if err := os.WriteFile(complexes, []byte("Complex ID,GTFS Stop ID\n602,635\n602,L03\n"), 0o644); err != nil {
+		t.Fatalf("write complexes: %v", err)
+	}
+	stops := location.NewStopService()
+	stops.SetComplexesFile(complexes)
+	if _, err := stops.Load(filepath.Join("..", "..", "data", "stops.txt")); err != nil {
+		t.Fatalf("load stops: %v", err)
+	}
+	if got := stops.PlatformIDs("635"); slices.Contains(got, "L03N") {
+		t.Fatalf("PlatformIDs(635) = %v; the L platforms should belong to L03", got)
+	}
+
+	now := time.Now()
+	body, err := proto.Marshal(buildFeed(map[string][]testStop{
+		"L": {{"L03N", now.Add(3 * time.Minute)}},
+	}))
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	svc := NewSubwayService(testClient(), time.Hour)
+	svc.feedURLs = map[string]string{"l": "http://feed.invalid"}
+	svc.feedCache.Set("l", body)
+
+	ctx := context.Background()
+	stations, err := svc.GetArrivalsForStations(ctx, []string{"635"}, ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStations: %v", err)
+	}
+	if len(stations) != 1 || len(stations[0].Northbound)+len(stations[0].Southbound) != 0 {
+		t.Fatalf("without expansion = %+v, want 635 with no arrivals", stations)
+	}
+
+	svc.SetComplexPlatforms(stops.ComplexPlatformIDs)
+	stations, err = svc.GetArrivalsForStations(ctx, []string{"635", "L03"}, ArrivalOptions{})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStations: %v", err)
+	}
+	if len(stations) != 2 || stations[0].StopID != "635" {
+		t.Fatalf("stations = %+v, want 635 then L03, keyed as requested", stations)
+	}
+	for _, station := range stations {
+		if len(station.Northbound) != 1 || station.Northbound[0].Route != "L" || len(station.Southbound) != 0 {
+			t.Errorf("%s with complex platforms = %+v, want the one northbound L", station.StopID, station)
+		}
+	}
+
+	// A station outside any complex still only gets its own platforms
+	if got := svc.platformBases("127"); !slices.Equal(got, []string{"127"}) {
+		t.Errorf("platformBases(127) = %v, want [127]", got)
+	}
+}
+
+func TestGetArrivalsForStationsMergedStations(t *testing.T) {
+	now := time.Now()
+	body, err := proto.Marshal(buildFeed(map[string][]testStop{
+		"1": {{"127N", now.Add(2 * time.Minute)}},
+		"7": {{"725N", now.Add(4 * time.Minute)}},
+	}))
+	if err != nil {
+		t.Fatalf("marshal feed: %v", err)
+	}
+	svc := NewSubwayService(testClient(), time.Hour)
+	svc.feedURLs = map[string]string{"l": "http://feed.invalid"}
+	svc.feedCache.Set("l", body)
+
+	stations, err := svc.GetArrivalsForStations(context.Background(), []string{"127"}, ArrivalOptions{
+		MergedStations: map[string][]string{"127": {"725"}},
+	})
+	if err != nil {
+		t.Fatalf("GetArrivalsForStations: %v", err)
+	}
+	if len(stations) != 1 || stations[0].StopID != "127" {
+		t.Fatalf("stations = %+v, want just 127", stations)
+	}
+	var routes []string
+	for _, arr := range stations[0].Northbound {
+		routes = append(routes, arr.Route)
+	}
+	if !slices.Equal(routes, []string{"1", "7"}) {
+		t.Errorf("northbound routes = %v, want 127's 1 then merged 725's 7", routes)
+	}
+}
+
+func BenchmarkStationLookupCachedFeed(b *testing.B) {
+	now := time.Now()
+	stops := make([]testStop, 0, 400)
+	for i := 0; i < cap(stops); i++ {
+		stops = append(stops, testStop{fmt.Sprintf("A%02dN", i%60), now.Add(time.Duration(i) * time.Minute)})
+	}
+	trips := map[string][]testStop{}
+	for _, route := range []string{"A", "C", "E", "H"} {
+		trips[route] = stops
+	}
+	body, err := proto.Marshal(buildFeed(trips))
+	if err != nil {
+		b.Fatalf("marshal feed: %v", err)
+	}
+
+	svc := NewSubwayService(testClient(), time.Hour)
+	svc.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	svc.feedURLs = map[string]string{"ace": "http://feed.invalid"}
+	svc.feedCache.Set("ace", body)
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := svc.GetArrivalsForStations(ctx, []string{"A10", "A20", "A30"}, ArrivalOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
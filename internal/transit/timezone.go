@@ -0,0 +1,32 @@
+package transit
+
+import (
+	"time"
+	_ "time/tzdata" // embed zone data so minimal containers can resolve America/New_York
+)
+
+// nycLocation is the zone all transit times are reported in. It is loaded once
+// at startup so responses don't depend on the server's local zone (often UTC).
+var nycLocation = mustLoadLocation("America/New_York")
+
+// localTimeFormat is the wall-clock format for pre-formatted arrival times
+const localTimeFormat = "15:04"
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic("transit: loading time zone " + name + ": " + err.Error())
+	}
+	return loc
+}
+
+// inNYC converts t to New York time, carrying an explicit -04:00/-05:00 offset
+// when serialized as RFC3339
+func inNYC(t time.Time) time.Time {
+	return t.In(nycLocation)
+}
+
+// formatLocal renders t as NYC wall-clock HH:MM
+func formatLocal(t time.Time) string {
+	return t.In(nycLocation).Format(localTimeFormat)
+}
@@ -0,0 +1,54 @@
+package transit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatLocalUsesNYCWallClock(t *testing.T) {
+	tests := []struct {
+		name      string
+		unix      int64
+		wantLocal string
+		wantRFC   string
+	}{
+		// 2026-01-15 14:30 UTC is 09:30 EST
+		{"winter", 1768487400, "09:30", "2026-01-15T09:30:00-05:00"},
+		// 2026-07-04 00:15 UTC is 20:15 EDT the previous evening
+		{"summer across midnight", 1783124100, "20:15", "2026-07-03T20:15:00-04:00"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Start from a UTC time, as time.Unix yields on a server running in UTC
+			at := time.Unix(tc.unix, 0).UTC()
+			if got := formatLocal(at); got != tc.wantLocal {
+				t.Errorf("formatLocal = %s, want %s", got, tc.wantLocal)
+			}
+			if got := inNYC(at).Format(time.RFC3339); got != tc.wantRFC {
+				t.Errorf("inNYC = %s, want %s", got, tc.wantRFC)
+			}
+		})
+	}
+}
+
+func TestParseArrivalsReportsNYCTime(t *testing.T) {
+	at := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	feed := buildFeed(map[string][]testStop{"A": {{"A15N", at}}})
+
+	svc := NewSubwayService(testClient(), time.Minute)
+	arrivals := svc.parseArrivals(feed, "")
+	if len(arrivals) != 1 {
+		t.Fatalf("got %d arrivals, want 1", len(arrivals))
+	}
+
+	got := arrivals[0]
+	if got.ArrivalTime.Location() != nycLocation {
+		t.Errorf("ArrivalTime zone = %v, want America/New_York", got.ArrivalTime.Location())
+	}
+	if !got.ArrivalTime.Equal(at) {
+		t.Errorf("ArrivalTime = %v, want instant %v", got.ArrivalTime, at)
+	}
+	if want := at.In(nycLocation).Format("15:04"); got.ArrivalLocal != want {
+		t.Errorf("ArrivalLocal = %s, want %s", got.ArrivalLocal, want)
+	}
+}
@@ -0,0 +1,67 @@
+package transit
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultUserAgent identifies emteeayy to MTA's APIs when none is configured
+const DefaultUserAgent = "emteeayy/1.0.0 (+https://github.com/randytsao24/emteeayy)"
+
+// headerTransport adds a fixed set of headers to every outbound request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+// NewHeaderTransport wraps base so every request carries the given headers.
+// Headers already set on a request are left alone. A nil base uses
+// http.DefaultTransport.
+func NewHeaderTransport(base http.RoundTripper, headers http.Header) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &headerTransport{base: base, headers: headers.Clone()}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		if req.Header.Get(name) == "" {
+			req.Header[name] = values
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// DefaultMaxIdleConnsPerHost keeps enough warm connections to fan out across
+// every subway feed at once (they all live on the same MTA host)
+const DefaultMaxIdleConnsPerHost = 10
+
+// NewHTTPClient builds the client shared by all transit services. Its pooled
+// transport keeps connections to the MTA hosts alive between requests, and
+// every request carries the given User-Agent.
+func NewHTTPClient(timeout time.Duration, userAgent string, maxIdleConnsPerHost int) *http.Client {
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.IdleConnTimeout = 90 * time.Second
+	transport.TLSHandshakeTimeout = 5 * time.Second
+	transport.ResponseHeaderTimeout = timeout
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: NewHeaderTransport(transport, http.Header{
+			"User-Agent": {userAgent},
+		}),
+	}
+}
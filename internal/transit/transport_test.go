@@ -0,0 +1,155 @@
+package transit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testClient returns a client like the one main wires up, with a short timeout
+func testClient() *http.Client {
+	return NewHTTPClient(time.Second, "", 0)
+}
+
+// uaRecorder serves an empty GTFS-RT feed and records the User-Agent it saw
+func uaRecorder(t *testing.T, seen *string) *httptest.Server {
+	t.Helper()
+	body := emptyFeedBytes(t)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*seen = r.Header.Get("User-Agent")
+		w.Write(body)
+	}))
+}
+
+func TestServicesSendUserAgent(t *testing.T) {
+	t.Run("subway default", func(t *testing.T) {
+		var seen string
+		srv := uaRecorder(t, &seen)
+		defer srv.Close()
+
+		svc := NewSubwayService(testClient(), time.Minute)
+		svc.feedURLs = map[string]string{"ace": srv.URL}
+		if _, err := svc.GetFeedBytes(context.Background(), "ace"); err != nil {
+			t.Fatalf("GetFeedBytes: %v", err)
+		}
+		if seen != DefaultUserAgent {
+			t.Errorf("User-Agent = %q, want %q", seen, DefaultUserAgent)
+		}
+	})
+
+	t.Run("alerts configured", func(t *testing.T) {
+		var seen string
+		srv := uaRecorder(t, &seen)
+		defer srv.Close()
+
+		svc := NewAlertService(NewHTTPClient(time.Second, "tester/2.0", 0), time.Minute)
+		svc.feedURL = srv.URL
+		if _, err := svc.GetAlerts(context.Background(), nil, AlertOptions{}); err != nil {
+			t.Fatalf("GetAlerts: %v", err)
+		}
+		if seen != "tester/2.0" {
+			t.Errorf("User-Agent = %q, want tester/2.0", seen)
+		}
+	})
+
+	t.Run("bus configured", func(t *testing.T) {
+		var seen string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r.Header.Get("User-Agent")
+			w.Write([]byte(`{"Siri":{"ServiceDelivery":{"StopMonitoringDelivery":[]}}}`))
+		}))
+		defer srv.Close()
+
+		svc := NewBusService("key", NewHTTPClient(time.Second, "tester/2.0", 0), time.Minute, time.Minute)
+		svc.baseURL = srv.URL
+		if _, err := svc.GetArrivalsForStop(context.Background(), "MTA_1"); err != nil {
+			t.Fatalf("GetArrivalsForStop: %v", err)
+		}
+		if seen != "tester/2.0" {
+			t.Errorf("User-Agent = %q, want tester/2.0", seen)
+		}
+	})
+}
+
+func TestHeaderTransportKeepsExplicitHeaders(t *testing.T) {
+	var seen string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get("User-Agent")
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewHeaderTransport(nil, http.Header{"User-Agent": {"default/1"}})}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("User-Agent", "explicit/1")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	if seen != "explicit/1" {
+		t.Errorf("User-Agent = %q, want explicit/1", seen)
+	}
+}
+
+// countingTransport records how many requests passed through it
+type countingTransport struct {
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestServicesUseInjectedClient(t *testing.T) {
+	body := emptyFeedBytes(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	counter := &countingTransport{}
+	client := &http.Client{Timeout: time.Second, Transport: counter}
+
+	subway := NewSubwayService(client, time.Minute)
+	subway.feedURLs = map[string]string{"ace": srv.URL}
+	if _, err := subway.GetFeedBytes(context.Background(), "ace"); err != nil {
+		t.Fatalf("GetFeedBytes: %v", err)
+	}
+
+	alerts := NewAlertService(client, time.Minute)
+	alerts.feedURL = srv.URL
+	if _, err := alerts.GetAlerts(context.Background(), nil, AlertOptions{}); err != nil {
+		t.Fatalf("GetAlerts: %v", err)
+	}
+
+	if counter.calls != 2 {
+		t.Errorf("injected transport saw %d requests, want 2", counter.calls)
+	}
+}
+
+func TestNewHTTPClientPoolSettings(t *testing.T) {
+	client := NewHTTPClient(3*time.Second, "", 0)
+	if client.Timeout != 3*time.Second {
+		t.Errorf("Timeout = %v, want 3s", client.Timeout)
+	}
+
+	ht, ok := client.Transport.(*headerTransport)
+	if !ok {
+		t.Fatalf("Transport = %T, want *headerTransport", client.Transport)
+	}
+	base, ok := ht.base.(*http.Transport)
+	if !ok {
+		t.Fatalf("base transport = %T, want *http.Transport", ht.base)
+	}
+	if base.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Errorf("MaxIdleConnsPerHost = %d, want %d", base.MaxIdleConnsPerHost, DefaultMaxIdleConnsPerHost)
+	}
+	if base == http.DefaultTransport {
+		t.Error("shared client should not mutate http.DefaultTransport")
+	}
+}
@@ -0,0 +1,121 @@
+package transit
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultUpstreamCheckTimeout bounds each reachability check
+	DefaultUpstreamCheckTimeout = 3 * time.Second
+	// DefaultUpstreamCheckTTL is how long check results are reused, so a
+	// busy health endpoint doesn't turn into load on the MTA
+	DefaultUpstreamCheckTTL = 30 * time.Second
+)
+
+// UpstreamStatus is the result of checking one upstream host
+type UpstreamStatus struct {
+	Host      string  `json:"host"`
+	Reachable bool    `json:"reachable"`
+	Status    int     `json:"status,omitempty"` // HTTP status, when the host answered
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// UpstreamChecker reports whether the upstream hosts answer at all. It sends
+// one HEAD request per host, all at once, each bounded by the timeout, and
+// caches the results for a while. Any response below 500 counts as reachable:
+// the check is about the host being up, not about what a bare request to it
+// is allowed to see.
+type UpstreamChecker struct {
+	client  *http.Client
+	timeout time.Duration
+	ttl     time.Duration
+	hosts   []string // scheme://host, sorted
+
+	mu        sync.Mutex // held during a check, so concurrent callers share it
+	results   []UpstreamStatus
+	checkedAt time.Time
+}
+
+// NewUpstreamChecker checks the hosts of urls, each once however many of its
+// URLs are given. Non-positive timeout and ttl use the defaults.
+func NewUpstreamChecker(client *http.Client, timeout, ttl time.Duration, urls []string) *UpstreamChecker {
+	if timeout <= 0 {
+		timeout = DefaultUpstreamCheckTimeout
+	}
+	if ttl <= 0 {
+		ttl = DefaultUpstreamCheckTTL
+	}
+
+	var hosts []string
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		host := u.Scheme + "://" + u.Host
+		if !slices.Contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	slices.Sort(hosts)
+
+	return &UpstreamChecker{client: client, timeout: timeout, ttl: ttl, hosts: hosts}
+}
+
+// Check returns the status of every upstream host and when it was checked,
+// reusing the last results while they are fresh
+func (c *UpstreamChecker) Check(ctx context.Context) ([]UpstreamStatus, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.results != nil && time.Since(c.checkedAt) < c.ttl {
+		return c.results, c.checkedAt
+	}
+
+	// Results are shared, so a caller giving up mustn't cut the checks short
+	ctx = context.WithoutCancel(ctx)
+	results := make([]UpstreamStatus, len(c.hosts))
+	var wg sync.WaitGroup
+	for i, host := range c.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.checkHost(ctx, host)
+		}()
+	}
+	wg.Wait()
+
+	c.results, c.checkedAt = results, time.Now()
+	return c.results, c.checkedAt
+}
+
+func (c *UpstreamChecker) checkHost(ctx context.Context, host string) UpstreamStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	status := UpstreamStatus{Host: host}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, host+"/", nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	status.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	status.Status = resp.StatusCode
+	status.Reachable = resp.StatusCode < http.StatusInternalServerError
+	return status
+}
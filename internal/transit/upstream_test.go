@@ -0,0 +1,74 @@
+package transit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpstreamChecker(t *testing.T) {
+	var upHits atomic.Int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upHits.Add(1)
+		if r.Method != http.MethodHead {
+			t.Errorf("check used %s, want HEAD", r.Method)
+		}
+		w.WriteHeader(http.StatusForbidden) // answering at all counts as up
+	}))
+	defer up.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	const timeout = 100 * time.Millisecond
+	checker := NewUpstreamChecker(testClient(), timeout, time.Minute, []string{
+		up.URL + "/feed/a", up.URL + "/feed/b", // one host, checked once
+		failing.URL, slow.URL, down.URL,
+	})
+
+	start := time.Now()
+	results, checkedAt := checker.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 4*timeout {
+		t.Errorf("Check took %v; hosts should be checked concurrently within %v", elapsed, timeout)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4 (one per host): %+v", len(results), results)
+	}
+
+	byHost := make(map[string]UpstreamStatus)
+	for _, r := range results {
+		byHost[r.Host] = r
+	}
+	if got := byHost[up.URL]; !got.Reachable || got.Status != http.StatusForbidden || got.Error != "" {
+		t.Errorf("up host = %+v, want reachable with status 403", got)
+	}
+	if got := byHost[failing.URL]; got.Reachable || got.Status != http.StatusServiceUnavailable {
+		t.Errorf("failing host = %+v, want unreachable with status 503", got)
+	}
+	for name, host := range map[string]string{"slow": slow.URL, "down": down.URL} {
+		if got := byHost[host]; got.Reachable || got.Status != 0 || got.Error == "" {
+			t.Errorf("%s host = %+v, want unreachable with an error", name, got)
+		}
+	}
+
+	// Fresh results are reused without going upstream again
+	again, againAt := checker.Check(context.Background())
+	if upHits.Load() != 1 || !againAt.Equal(checkedAt) || len(again) != len(results) {
+		t.Errorf("second Check hit upstream (%d hits) or returned new results", upHits.Load())
+	}
+}
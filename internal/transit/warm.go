@@ -0,0 +1,126 @@
+package transit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// warmJitter is how far, as a fraction of the interval, each refresh may
+	// land either side of its schedule
+	warmJitter = 0.1
+	// warmTick is how often FeedWarmer.Run checks for due feeds
+	warmTick = time.Second
+)
+
+// FeedWarmer re-fetches the feeds behind a set of "warm" stations and routes
+// in the background, so requests for them are served from the cache instead
+// of waiting on the MTA. Each feed keeps its own schedule: the first refresh
+// is spread at random across one interval and later ones land within
+// warmJitter of it, so feeds don't all hit the upstream together.
+type FeedWarmer struct {
+	serviceClock
+	subway   *SubwayService
+	interval time.Duration
+	jitter   func(n int64) int64 // random in [0, n)
+
+	mu  sync.Mutex
+	due map[string]time.Time // feed -> next refresh; zero until scheduled
+}
+
+// NewFeedWarmer warms the feeds serving routes, plus every feed when any
+// station is given, since station lookups read them all. Interval should be
+// comfortably below the feed cache TTL; non-positive is an error, as is an
+// unknown route.
+func NewFeedWarmer(subway *SubwayService, interval time.Duration, stations, routes []string) (*FeedWarmer, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("warm refresh interval must be positive, got %v", interval)
+	}
+
+	due := make(map[string]time.Time)
+	if len(stations) > 0 {
+		for feed := range subway.feedURLs {
+			due[feed] = time.Time{}
+		}
+	}
+	for _, route := range routes {
+		feed, ok := routeToFeed[normalizeRouteID(route, false)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRoute, route)
+		}
+		due[feed] = time.Time{}
+	}
+
+	return &FeedWarmer{subway: subway, interval: interval, jitter: rand.Int64N, due: due}, nil
+}
+
+// Feeds returns the names of the warmed feeds, sorted
+func (w *FeedWarmer) Feeds() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	feeds := make([]string, 0, len(w.due))
+	for feed := range w.due {
+		feeds = append(feeds, feed)
+	}
+	slices.Sort(feeds)
+	return feeds
+}
+
+// Run refreshes feeds as they come due until ctx is done
+func (w *FeedWarmer) Run(ctx context.Context) {
+	ticker := time.NewTicker(warmTick)
+	defer ticker.Stop()
+
+	w.refreshDue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.refreshDue(ctx)
+		}
+	}
+}
+
+// refreshDue schedules any feed seen for the first time and refreshes those
+// whose time has come, returning the refreshed feeds in order. Failures are
+// logged and the feed tried again next interval; the cached copy, if any,
+// keeps serving until it expires.
+func (w *FeedWarmer) refreshDue(ctx context.Context) []string {
+	now := w.now()
+
+	w.mu.Lock()
+	var due []string
+	for feed, at := range w.due {
+		switch {
+		case at.IsZero():
+			w.due[feed] = now.Add(time.Duration(w.jitter(int64(w.interval))))
+		case !now.Before(at):
+			due = append(due, feed)
+			w.due[feed] = now.Add(w.nextInterval())
+		}
+	}
+	w.mu.Unlock()
+
+	slices.Sort(due)
+	for _, feed := range due {
+		if err := w.subway.RefreshFeed(ctx, feed); err != nil {
+			slog.Warn("warming subway feed", "feed", feed, "error", err)
+		}
+	}
+	return due
+}
+
+// nextInterval is the interval moved by up to warmJitter either way
+func (w *FeedWarmer) nextInterval() time.Duration {
+	spread := int64(float64(w.interval) * warmJitter)
+	if spread <= 0 {
+		return w.interval
+	}
+	return w.interval - time.Duration(spread) + time.Duration(w.jitter(2*spread+1))
+}
@@ -0,0 +1,138 @@
+package transit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewFeedWarmerFeeds(t *testing.T) {
+	svc := NewSubwayService(testClient(), time.Minute)
+
+	w, err := NewFeedWarmer(svc, time.Minute, nil, []string{"L", "a", "C"})
+	if err != nil {
+		t.Fatalf("NewFeedWarmer: %v", err)
+	}
+	if got := w.Feeds(); !slices.Equal(got, []string{"ace", "l"}) {
+		t.Errorf("route feeds = %v, want [ace l]", got)
+	}
+
+	// Station lookups read every feed, so any station warms them all
+	w, err = NewFeedWarmer(svc, time.Minute, []string{"127"}, nil)
+	if err != nil {
+		t.Fatalf("NewFeedWarmer: %v", err)
+	}
+	if got := w.Feeds(); len(got) != len(svc.feedURLs) {
+		t.Errorf("station feeds = %v, want all %d", got, len(svc.feedURLs))
+	}
+
+	if _, err := NewFeedWarmer(svc, time.Minute, nil, []string{"Q9"}); !errors.Is(err, ErrUnknownRoute) {
+		t.Errorf("unknown route error = %v, want ErrUnknownRoute", err)
+	}
+	if _, err := NewFeedWarmer(svc, 0, nil, []string{"L"}); err == nil {
+		t.Error("zero interval accepted")
+	}
+}
+
+func TestFeedWarmerRefreshesOnSchedule(t *testing.T) {
+	body := emptyFeedBytes(t)
+	var mu sync.Mutex
+	fetches := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches[r.URL.Path]++
+		mu.Unlock()
+		w.Write(body)
+	}))
+	defer srv.Close()
+	count := func(feed string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches["/"+feed]
+	}
+
+	// A long TTL shows refreshes don't wait for the cached copy to expire
+	svc := NewSubwayService(testClient(), time.Hour)
+	svc.feedURLs = map[string]string{"ace": srv.URL + "/ace", "l": srv.URL + "/l", "g": srv.URL + "/g"}
+
+	start := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	w, err := NewFeedWarmer(svc, time.Minute, nil, []string{"A", "L"})
+	if err != nil {
+		t.Fatalf("NewFeedWarmer: %v", err)
+	}
+	w.SetClock(clock)
+	// Both feeds start halfway into the interval, and every later refresh
+	// lands at the far edge of its jitter window
+	w.jitter = func(n int64) int64 {
+		if n == int64(time.Minute) {
+			return n / 2
+		}
+		return n - 1
+	}
+
+	ctx := context.Background()
+	if got := w.refreshDue(ctx); len(got) != 0 {
+		t.Errorf("first pass refreshed %v, want only scheduling", got)
+	}
+
+	steps := []struct {
+		at   time.Duration
+		want []string
+	}{
+		{29 * time.Second, nil},
+		{30 * time.Second, []string{"ace", "l"}},
+		{95 * time.Second, nil},
+		{96 * time.Second, []string{"ace", "l"}}, // the interval plus 10%
+	}
+	for _, step := range steps {
+		clock.Set(start.Add(step.at))
+		if got := w.refreshDue(ctx); !slices.Equal(got, step.want) {
+			t.Errorf("at +%v refreshed %v, want %v", step.at, got, step.want)
+		}
+	}
+
+	if count("ace") != 2 || count("l") != 2 || count("g") != 0 {
+		t.Errorf("fetches = %v, want ace and l twice, g never", fetches)
+	}
+	for _, feed := range []string{"ace", "l"} {
+		cached, ok := svc.feedCache.Get(feed)
+		if !ok {
+			t.Fatalf("%s not cached after warming", feed)
+		}
+		if _, ok := svc.decoded(feed, cached); !ok {
+			t.Errorf("%s not decoded after warming", feed)
+		}
+	}
+}
+
+func TestFeedWarmerJitterBounds(t *testing.T) {
+	svc := NewSubwayService(testClient(), time.Minute)
+	svc.feedURLs = map[string]string{}
+	for _, feed := range []string{"ace", "bdfm", "g", "jz", "nqrw", "l", "1234567", "si"} {
+		svc.feedURLs[feed] = "http://127.0.0.1:0/" + feed
+	}
+	w, err := NewFeedWarmer(svc, time.Minute, []string{"127"}, nil)
+	if err != nil {
+		t.Fatalf("NewFeedWarmer: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	w.SetClock(NewFakeClock(now))
+
+	w.refreshDue(context.Background())
+	for feed, at := range w.due {
+		if at.Before(now) || !at.Before(now.Add(time.Minute)) {
+			t.Errorf("%s first due at +%v, want within one interval", feed, at.Sub(now))
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if d := w.nextInterval(); d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("nextInterval = %v, want within 10%% of a minute", d)
+		}
+	}
+}
@@ -112,7 +112,7 @@ function transitApp() {
         const resp = await fetch(endpoint);
         const data = await resp.json();
         if (!resp.ok)
-          throw new Error(data.message || data.error || "Failed to fetch");
+          throw new Error(data.error?.message || "Failed to fetch");
         if (data.location) {
           const city = data.location.city || "";
           const borough = data.location.borough || "NYC";
@@ -143,7 +143,7 @@ function transitApp() {
         const resp = await fetch(endpoint);
         const data = await resp.json();
         if (!resp.ok)
-          throw new Error(data.message || data.error || "Failed to fetch");
+          throw new Error(data.error?.message || "Failed to fetch");
         this.locationText = `Near ${lat.toFixed(4)}, ${lng.toFixed(4)}`;
         this.applyData(data);
       } catch (err) {
@@ -237,7 +237,7 @@ function transitApp() {
         const resp = await fetch(`/transit/subway/arrivals?stops=${ids}`);
         const data = await resp.json();
         if (!resp.ok)
-          throw new Error(data.message || data.error || "Failed to fetch");
+          throw new Error(data.error?.message || "Failed to fetch");
         this.applyData(data);
       } catch (err) {
         this.error = err.message;